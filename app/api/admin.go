@@ -0,0 +1,97 @@
+package api
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/secretnamebasis/secret-site/app/controllers"
+	"github.com/secretnamebasis/secret-site/app/models"
+)
+
+// Trash lists the items and users in the trash
+func Trash(c *fiber.Ctx) error {
+	trash, err := controllers.AllTrash()
+	if err != nil {
+		return ErrorResponse(c, fiber.StatusInternalServerError, "Error retrieving trash")
+	}
+
+	return SuccessResponse(c, "trash retrieved", trash)
+}
+
+// RestoreItem takes an item back out of the trash
+func RestoreItem(c *fiber.Ctx) error {
+	item, err := controllers.RestoreItem(c.Params("id"), Viewer(c).Name)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			return ErrorResponse(c, fiber.StatusNotFound, err.Error())
+		}
+		return ErrorResponse(c, fiber.StatusInternalServerError, err.Error())
+	}
+
+	return SuccessResponse(c, "item restored", item)
+}
+
+// RestoreUser takes a user, and the items deleted with them, back out of the trash
+func RestoreUser(c *fiber.Ctx) error {
+	user, err := controllers.RestoreUser(c.Params("id"), Viewer(c).Name)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			return ErrorResponse(c, fiber.StatusNotFound, err.Error())
+		}
+		return ErrorResponse(c, fiber.StatusInternalServerError, err.Error())
+	}
+
+	return SuccessResponse(c, "user restored", user)
+}
+
+// AuditLog lists the audit entries, filtered by the actor, action and resource query params
+func AuditLog(c *fiber.Ctx) error {
+	entries, err := controllers.AuditLog(
+		c.Query("actor"),
+		c.Query("action"),
+		c.Query("resource"),
+	)
+	if err != nil {
+		return ErrorResponse(c, fiber.StatusInternalServerError, "Error retrieving audit log")
+	}
+
+	return SuccessResponse(c, "audit log retrieved", entries)
+}
+
+// FileChecks lists the last check of every NFA's file, filtered by the status query param
+func FileChecks(c *fiber.Ctx) error {
+	checks, err := controllers.FileChecks(c.Query("status"))
+	if err != nil {
+		return ErrorResponse(c, fiber.StatusInternalServerError, "Error retrieving file checks")
+	}
+
+	return SuccessResponse(c, "file checks retrieved", checks)
+}
+
+// VerifyAudit checks every link of the audit chain
+func VerifyAudit(c *fiber.Ctx) error {
+	entries, err := controllers.VerifyAudit()
+	if err != nil {
+		var chainErr *models.AuditChainError
+		if errors.As(err, &chainErr) {
+			return ErrorResponse(c, fiber.StatusConflict, err.Error())
+		}
+		return ErrorResponse(c, fiber.StatusInternalServerError, "Error verifying audit log")
+	}
+
+	return SuccessResponse(c, "audit chain intact", fiber.Map{"entries": entries})
+}
+
+// AnchorAudit writes the head of the audit chain on-chain
+func AnchorAudit(c *fiber.Ctx) error {
+	result, err := controllers.AnchorAudit()
+	if err != nil {
+		if errors.Is(err, controllers.ErrAuditAnchored) {
+			return ErrorResponse(c, fiber.StatusConflict, err.Error())
+		}
+		return serverErrorResponse(c, err)
+	}
+
+	return SuccessResponse(c, "audit chain anchored", result)
+}
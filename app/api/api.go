@@ -7,8 +7,13 @@ import (
 	"strings"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/secretnamebasis/secret-site/app/integrations/dero"
+	"github.com/secretnamebasis/secret-site/app/models"
 )
 
+// HeaderItemKey carries the client-supplied key of a private item
+const HeaderItemKey = "X-Item-Key"
+
 // ErrorResponse is a common function to generate error responses
 func ErrorResponse(c *fiber.Ctx, status int, message string) error {
 	return c.Status(status).JSON(
@@ -19,6 +24,15 @@ func ErrorResponse(c *fiber.Ctx, status int, message string) error {
 	)
 }
 
+// RetryAfter is how many seconds clients should wait while DERO can't be reached
+const RetryAfter = "30"
+
+// UnavailableResponse tells clients the DERO wallet or node can't be reached, and when to retry
+func UnavailableResponse(c *fiber.Ctx) error {
+	c.Set(fiber.HeaderRetryAfter, RetryAfter)
+	return ErrorResponse(c, fiber.StatusServiceUnavailable, dero.ErrUnavailable.Error())
+}
+
 // SuccessResponse is a common function to generate success responses
 func SuccessResponse(c *fiber.Ctx, message string, data interface{}) error {
 	return c.JSON(
@@ -29,6 +43,29 @@ func SuccessResponse(c *fiber.Ctx, message string, data interface{}) error {
 		},
 	)
 }
+
+// Viewer returns the user making the request from its Basic credentials,
+// or an empty user for anonymous requests
+func Viewer(c *fiber.Ctx) models.JSON_User_Order {
+	name, pass, err := getCredentials(c)
+	if err != nil {
+		return models.JSON_User_Order{}
+	}
+	return models.JSON_User_Order{
+		Name:     name,
+		Password: pass,
+	}
+}
+
+// serverErrorResponse answers with a 503 when the error comes from DERO
+// being unreachable, a 500 otherwise
+func serverErrorResponse(c *fiber.Ctx, err error) error {
+	if errors.Is(err, dero.ErrUnavailable) {
+		return UnavailableResponse(c)
+	}
+	return ErrorResponse(c, fiber.StatusInternalServerError, err.Error())
+}
+
 func getCredentials(c *fiber.Ctx) (username, password string, err error) {
 	// Get the Authorization header from the request
 	authHeader := c.Get("Authorization")
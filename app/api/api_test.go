@@ -146,17 +146,24 @@ configure() error {
 		Wallet: successUpdateAddress,
 	}
 
+	contract, err := dero.NFAContract(
+		dero.NFA{
+			Royalty:     1,
+			Name:        "simple",
+			Description: "smart-contract",
+			Type:        "image",
+			Collection:  "test",
+			Owner:       successCreateAddress,
+		},
+	)
+	if err != nil {
+		return err
+	}
+
 	scid,
 		err = dero.MintContract(
 		WalletEndpoint,
-		dero.NFAContract(
-			"1",
-			"simple",
-			"smart-contract",
-			"image",
-			"test",
-			successCreateAddress,
-		),
+		contract,
 		successCreateSecondAddress, // you can't send to self
 	)
 
@@ -0,0 +1,100 @@
+package api
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/secretnamebasis/secret-site/app/controllers"
+	"github.com/secretnamebasis/secret-site/app/models"
+)
+
+// CreateCheckout opens a checkout for an item; the body may give a
+// refund_address
+func CreateCheckout(c *fiber.Ctx) error {
+	var order models.JSON_Checkout_Order
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&order); err != nil {
+			return ErrorResponse(c, fiber.StatusBadRequest, "Invalid request body")
+		}
+	}
+	order.User = Viewer(c)
+
+	checkout, err := controllers.CreateCheckout(c.Params("id"), order)
+	if err != nil {
+		switch {
+		case errors.Is(err, controllers.ErrForbidden):
+			return ErrorResponse(c, fiber.StatusForbidden, err.Error())
+		case strings.Contains(err.Error(), "not found"):
+			return ErrorResponse(c, fiber.StatusNotFound, err.Error())
+		case strings.Contains(err.Error(), "not for sale"),
+			strings.Contains(err.Error(), "invalid refund address"):
+			return ErrorResponse(c, fiber.StatusBadRequest, err.Error())
+		default:
+			return serverErrorResponse(c, err)
+		}
+	}
+
+	return SuccessResponse(c, "checkout created", checkout)
+}
+
+// CheckoutByID retrieves a checkout
+func CheckoutByID(c *fiber.Ctx) error {
+	checkout, err := controllers.GetCheckout(c.Params("id"), Viewer(c))
+	if err != nil {
+		switch {
+		case errors.Is(err, controllers.ErrForbidden):
+			return ErrorResponse(c, fiber.StatusForbidden, err.Error())
+		case strings.Contains(err.Error(), "not found"):
+			return ErrorResponse(c, fiber.StatusNotFound, err.Error())
+		default:
+			return ErrorResponse(c, fiber.StatusInternalServerError, err.Error())
+		}
+	}
+
+	return SuccessResponse(c, "checkout retrieved", checkout)
+}
+
+// UpdateCheckout changes where the buyer's refunds go
+func UpdateCheckout(c *fiber.Ctx) error {
+	var order models.JSON_Checkout_Order
+	if err := c.BodyParser(&order); err != nil {
+		return ErrorResponse(c, fiber.StatusBadRequest, "Invalid request body")
+	}
+	order.User = Viewer(c)
+
+	checkout, err := controllers.UpdateCheckout(c.Params("id"), order)
+	if err != nil {
+		switch {
+		case errors.Is(err, controllers.ErrForbidden):
+			return ErrorResponse(c, fiber.StatusForbidden, err.Error())
+		case strings.Contains(err.Error(), "not found"):
+			return ErrorResponse(c, fiber.StatusNotFound, err.Error())
+		case strings.Contains(err.Error(), "invalid refund address"):
+			return ErrorResponse(c, fiber.StatusBadRequest, err.Error())
+		default:
+			return ErrorResponse(c, fiber.StatusInternalServerError, err.Error())
+		}
+	}
+
+	return SuccessResponse(c, "checkout updated", checkout)
+}
+
+// RefundCheckout sends back what a checkout is owed
+func RefundCheckout(c *fiber.Ctx) error {
+	checkout, err := controllers.RefundCheckout(c.Params("id"), Viewer(c))
+	if err != nil {
+		switch {
+		case errors.Is(err, controllers.ErrForbidden):
+			return ErrorResponse(c, fiber.StatusForbidden, err.Error())
+		case strings.Contains(err.Error(), "not found"):
+			return ErrorResponse(c, fiber.StatusNotFound, err.Error())
+		case strings.Contains(err.Error(), "no address to refund to"):
+			return ErrorResponse(c, fiber.StatusConflict, err.Error())
+		default:
+			return serverErrorResponse(c, err)
+		}
+	}
+
+	return SuccessResponse(c, "checkout refunded", checkout)
+}
@@ -0,0 +1,133 @@
+package api
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/secretnamebasis/secret-site/app/controllers"
+	"github.com/secretnamebasis/secret-site/app/integrations/dero"
+	"github.com/secretnamebasis/secret-site/app/models"
+)
+
+// CreateCollection creates a collection curated by the user
+func CreateCollection(c *fiber.Ctx) error {
+	var order models.JSON_Collection_Order
+	if err := c.BodyParser(&order); err != nil {
+		return ErrorResponse(c, fiber.StatusBadRequest, "Invalid request body")
+	}
+	order.User = Viewer(c)
+
+	collection, err := controllers.CreateCollection(order)
+	if err != nil {
+		return collectionErrorResponse(c, err)
+	}
+
+	return SuccessResponse(c, "collection created", collection)
+}
+
+// AllCollections lists the collections
+func AllCollections(c *fiber.Ctx) error {
+	collections, err := controllers.AllCollections()
+	if err != nil {
+		return ErrorResponse(c, fiber.StatusInternalServerError, "Error retrieving collections")
+	}
+
+	return SuccessResponse(c, "collections retrieved", collections)
+}
+
+// CollectionByID retrieves a collection by its ID or slug
+func CollectionByID(c *fiber.Ctx) error {
+	collection, err := controllers.GetCollection(c.Params("id"))
+	if err != nil {
+		return collectionErrorResponse(c, err)
+	}
+
+	return SuccessResponse(c, "collection retrieved", collection)
+}
+
+// UpdateCollection changes one of the user's collections
+func UpdateCollection(c *fiber.Ctx) error {
+	var order models.JSON_Collection_Order
+	if err := c.BodyParser(&order); err != nil {
+		return ErrorResponse(c, fiber.StatusBadRequest, "Invalid request body")
+	}
+	order.User = Viewer(c)
+
+	collection, err := controllers.UpdateCollection(c.Params("id"), order)
+	if err != nil {
+		return collectionErrorResponse(c, err)
+	}
+
+	return SuccessResponse(c, "collection updated", collection)
+}
+
+// DeleteCollection removes one of the user's collections
+func DeleteCollection(c *fiber.Ctx) error {
+	if err := controllers.DeleteCollection(c.Params("id"), Viewer(c)); err != nil {
+		return collectionErrorResponse(c, err)
+	}
+
+	return SuccessResponse(c, "collection deleted", nil)
+}
+
+// CollectionStats sums up how a collection's NFAs are doing on the market
+func CollectionStats(c *fiber.Ctx) error {
+	collection, err := controllers.GetCollection(c.Params("id"))
+	if err != nil {
+		return collectionErrorResponse(c, err)
+	}
+
+	stats, err := controllers.CollectionStats(collection)
+	if err != nil {
+		return serverErrorResponse(c, err)
+	}
+
+	return SuccessResponse(c, "collection stats retrieved", stats)
+}
+
+// MintCollection mints several NFAs into one of the user's collections
+func MintCollection(c *fiber.Ctx) error {
+	var order models.JSON_Collection_Mint_Order
+	if err := c.BodyParser(&order); err != nil {
+		return ErrorResponse(c, fiber.StatusBadRequest, "Invalid request body")
+	}
+	order.User = Viewer(c)
+
+	items, err := controllers.MintCollection(c.Params("id"), order)
+	if err != nil {
+		// what was minted before the failure is in the collection all the same
+		if len(items) > 0 {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"message": err.Error(),
+				"result":  items,
+				"status":  "error",
+			})
+		}
+		return collectionErrorResponse(c, err)
+	}
+
+	return SuccessResponse(c, "nfas minted", items)
+}
+
+// private functions
+
+// collectionErrorResponse maps collection errors onto response statuses
+func collectionErrorResponse(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, controllers.ErrForbidden):
+		return ErrorResponse(c, fiber.StatusForbidden, err.Error())
+	case strings.Contains(err.Error(), "not found"):
+		return ErrorResponse(c, fiber.StatusNotFound, err.Error())
+	case errors.Is(err, dero.ErrUnavailable):
+		return UnavailableResponse(c)
+	case errors.Is(err, dero.ErrInvalidContract),
+		strings.Contains(err.Error(), "already exists"),
+		strings.Contains(err.Error(), "cannot"),
+		strings.Contains(err.Error(), "invalid"),
+		strings.Contains(err.Error(), "needs"):
+		return ErrorResponse(c, fiber.StatusBadRequest, err.Error())
+	default:
+		return serverErrorResponse(c, err)
+	}
+}
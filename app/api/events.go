@@ -0,0 +1,123 @@
+package api
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/secretnamebasis/secret-site/app/controllers"
+	"github.com/secretnamebasis/secret-site/app/events"
+)
+
+// keepAlive is how often an idle stream gets a comment, so that proxies
+// don't close it
+const keepAlive = 15 * time.Second
+
+// Events streams the events the viewer may see as server-sent events,
+// optionally filtered by resource, record ID or SCID. Clients reconnecting
+// with a Last-Event-ID header get the events they missed first.
+func Events(c *fiber.Ctx) error {
+	filter := controllers.EventFilter{
+		Resource: c.Query("resource"),
+		SCID:     c.Query("scid"),
+	}
+	if id := c.Query("id"); id != "" {
+		n, err := strconv.Atoi(id)
+		if err != nil || n <= 0 {
+			return ErrorResponse(c, fiber.StatusBadRequest, "invalid id")
+		}
+		filter.ID = n
+	}
+
+	stream, err := controllers.OpenEventStream(Viewer(c), filter)
+	if err != nil {
+		if errors.Is(err, controllers.ErrForbidden) {
+			return ErrorResponse(c, fiber.StatusUnauthorized, "invalid credentials")
+		}
+		return ErrorResponse(c, fiber.StatusBadRequest, err.Error())
+	}
+
+	// fresh connections start from now; a reconnect whose ID is from
+	// before a restart, or too far back, is told it missed events and
+	// starts from now too
+	last := events.Last()
+	lastID, err := strconv.ParseUint(c.Get("Last-Event-ID"), 10, 64)
+	reset := err == nil && !events.Held(lastID)
+	if err != nil || reset {
+		lastID = last
+	}
+
+	c.Set(fiber.HeaderContentType, "text/event-stream")
+	c.Set(fiber.HeaderCacheControl, "no-cache")
+	c.Set(fiber.HeaderConnection, "keep-alive")
+	c.Set("X-Accel-Buffering", "no")
+
+	// subscribe before catching up, so nothing slips in between
+	sub := events.Subscribe()
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		defer sub.Close()
+
+		fmt.Fprintf(w, "retry: %d\n\n", 3*time.Second/time.Millisecond)
+		if reset {
+			fmt.Fprintf(w, "id: %d\nevent: %s\ndata: {\"last_id\":%d}\n\n", lastID, events.StreamReset, lastID)
+		}
+		for _, event := range events.Since(lastID) {
+			if err := sendEvent(w, stream, event, &lastID); err != nil {
+				return
+			}
+		}
+		if err := w.Flush(); err != nil {
+			return
+		}
+
+		ticker := time.NewTicker(keepAlive)
+		defer ticker.Stop()
+		for {
+			select {
+			case event, ok := <-sub.C:
+				if !ok {
+					return
+				}
+				if err := sendEvent(w, stream, event, &lastID); err != nil {
+					return
+				}
+			case <-ticker.C:
+				fmt.Fprint(w, ": ping\n\n")
+			}
+			// a failed flush means the client went away
+			if err := w.Flush(); err != nil {
+				return
+			}
+		}
+	})
+
+	return nil
+}
+
+// private functions
+
+// sendEvent writes an event the viewer may see and hasn't been sent yet
+func sendEvent(w *bufio.Writer, stream *controllers.EventStream, event events.Event, lastID *uint64) error {
+	// events already replayed come through the subscription too
+	if event.ID <= *lastID {
+		return nil
+	}
+	*lastID = event.ID
+
+	if !stream.Visible(event) {
+		return nil
+	}
+
+	data, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("Error encoding event %d: %v", event.ID, err)
+		return nil
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, data)
+	return err
+}
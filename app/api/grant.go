@@ -0,0 +1,63 @@
+package api
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/secretnamebasis/secret-site/app/controllers"
+	"github.com/secretnamebasis/secret-site/app/models"
+)
+
+// CreateGrant gives a user read access to an item
+func CreateGrant(c *fiber.Ctx) error {
+	var order models.JSON_Grant_Order
+	if err := c.BodyParser(&order); err != nil {
+		return ErrorResponse(c, fiber.StatusBadRequest, "Invalid request body")
+	}
+	order.User = Viewer(c)
+
+	grant, err := controllers.CreateGrant(c.Params("id"), order)
+	if err != nil {
+		return grantErrorResponse(c, err)
+	}
+
+	return SuccessResponse(c, "grant created", grant)
+}
+
+// ItemGrants lists the grants given on an item
+func ItemGrants(c *fiber.Ctx) error {
+	grants, err := controllers.ItemGrants(c.Params("id"), Viewer(c))
+	if err != nil {
+		return grantErrorResponse(c, err)
+	}
+
+	return SuccessResponse(c, "grants retrieved", grants)
+}
+
+// RevokeGrant removes a grant from an item
+func RevokeGrant(c *fiber.Ctx) error {
+	if err := controllers.RevokeGrant(
+		c.Params("id"),
+		c.Params("grant"),
+		Viewer(c),
+	); err != nil {
+		return grantErrorResponse(c, err)
+	}
+
+	return SuccessResponse(c, "grant revoked", nil)
+}
+
+// private functions
+
+// grantErrorResponse maps grant errors onto response statuses
+func grantErrorResponse(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, controllers.ErrForbidden):
+		return ErrorResponse(c, fiber.StatusForbidden, err.Error())
+	case strings.Contains(err.Error(), "not found"):
+		return ErrorResponse(c, fiber.StatusNotFound, err.Error())
+	default:
+		return ErrorResponse(c, fiber.StatusBadRequest, err.Error())
+	}
+}
@@ -0,0 +1,22 @@
+package api
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/secretnamebasis/secret-site/app/controllers"
+	"github.com/secretnamebasis/secret-site/app/models"
+)
+
+// Healthz tells the process is alive, it doesn't look any further
+func Healthz(c *fiber.Ctx) error {
+	return c.JSON(models.Health{Status: models.HealthUp})
+}
+
+// Readyz tells whether the database, node and wallet are all up;
+// anything down turns it into a 503 so load balancers back off
+func Readyz(c *fiber.Ctx) error {
+	health := controllers.Readiness()
+	if !health.Ready() {
+		return c.Status(fiber.StatusServiceUnavailable).JSON(health)
+	}
+	return c.JSON(health)
+}
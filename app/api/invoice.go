@@ -0,0 +1,62 @@
+package api
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/secretnamebasis/secret-site/app/controllers"
+	"github.com/secretnamebasis/secret-site/app/models"
+)
+
+// Invoices lists the viewer's invoices, or with ?user= an admin's pick
+func Invoices(c *fiber.Ctx) error {
+	invoices, err := controllers.Invoices(c.Query("user"), Viewer(c))
+	if err != nil {
+		switch {
+		case errors.Is(err, controllers.ErrForbidden):
+			return ErrorResponse(c, fiber.StatusForbidden, err.Error())
+		default:
+			return ErrorResponse(c, fiber.StatusInternalServerError, err.Error())
+		}
+	}
+
+	return SuccessResponse(c, "invoices retrieved", invoices)
+}
+
+// InvoiceByID retrieves a signed invoice
+func InvoiceByID(c *fiber.Ctx) error {
+	invoice, err := controllers.GetInvoice(c.Params("id"), Viewer(c))
+	if err != nil {
+		switch {
+		case errors.Is(err, controllers.ErrForbidden):
+			return ErrorResponse(c, fiber.StatusForbidden, err.Error())
+		case strings.Contains(err.Error(), "not found"):
+			return ErrorResponse(c, fiber.StatusNotFound, err.Error())
+		default:
+			return ErrorResponse(c, fiber.StatusInternalServerError, err.Error())
+		}
+	}
+
+	return SuccessResponse(c, "invoice retrieved", invoice)
+}
+
+// VerifyInvoice checks that an invoice, as posted, was signed by the server
+// wallet; anyone may ask
+func VerifyInvoice(c *fiber.Ctx) error {
+	var invoice models.Invoice
+	if err := c.BodyParser(&invoice); err != nil {
+		return ErrorResponse(c, fiber.StatusBadRequest, "Invalid request body")
+	}
+
+	if err := controllers.VerifyInvoice(invoice); err != nil {
+		switch {
+		case errors.Is(err, controllers.ErrInvalidInvoice):
+			return ErrorResponse(c, fiber.StatusUnprocessableEntity, err.Error())
+		default:
+			return serverErrorResponse(c, err)
+		}
+	}
+
+	return SuccessResponse(c, "invoice verified", invoice)
+}
@@ -6,10 +6,12 @@ import (
 	"io"
 	"mime/multipart"
 	"net/http"
+	"strconv"
 	"strings"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/secretnamebasis/secret-site/app/controllers"
+	"github.com/secretnamebasis/secret-site/app/integrations/dero"
 	"github.com/secretnamebasis/secret-site/app/models"
 )
 
@@ -40,7 +42,7 @@ func CreateItemOrder(c *fiber.Ctx) error {
 	// Create the item record
 	item, err := controllers.CreateItemRecord(&order)
 	if err != nil {
-		return ErrorResponse(c, fiber.StatusInternalServerError, err.Error())
+		return serverErrorResponse(c, err)
 	}
 
 	// Return success response
@@ -58,6 +60,24 @@ func ItemByID(c *fiber.Ctx) error {
 		return ErrorResponse(c, fiber.StatusInternalServerError, err.Error())
 	}
 
+	// restricted items are kept to their owner and grantees
+	viewer := Viewer(c)
+	if err := controllers.CanView(item, viewer); err != nil {
+		return ErrorResponse(c, fiber.StatusForbidden, err.Error())
+	}
+
+	// private items are only readable by their owner
+	if item.IsPrivate() {
+		item, err = controllers.UnlockItem(
+			item,
+			viewer,
+			c.Get(HeaderItemKey),
+		)
+		if err != nil {
+			return ErrorResponse(c, fiber.StatusForbidden, err.Error())
+		}
+	}
+
 	return SuccessResponse(c, "item retrieved", item)
 }
 
@@ -81,6 +101,9 @@ func UpdateItem(c *fiber.Ctx) error {
 		return ErrorResponse(c, fiber.StatusInternalServerError, err.Error())
 	}
 	if err := updatedItem.Validate(); err != nil {
+		if errors.Is(err, dero.ErrUnavailable) {
+			return UnavailableResponse(c)
+		}
 		return ErrorResponse(c, fiber.StatusBadRequest, "Invalid request body")
 	}
 	// Check if the item exists
@@ -93,7 +116,10 @@ func UpdateItem(c *fiber.Ctx) error {
 	}
 
 	if err := controllers.UpdateItem(id, updatedItem); err != nil {
-		return ErrorResponse(c, fiber.StatusInternalServerError, err.Error())
+		if errors.Is(err, controllers.ErrForbidden) {
+			return ErrorResponse(c, fiber.StatusForbidden, err.Error())
+		}
+		return serverErrorResponse(c, err)
 	}
 
 	return SuccessResponse(c, "item updated", &item)
@@ -106,7 +132,10 @@ func DeleteItem(c *fiber.Ctx) error {
 	if err != nil {
 		return ErrorResponse(c, fiber.StatusNotFound, "User not found")
 	}
-	err = controllers.DeleteItem(id)
+	err = controllers.DeleteItem(id, Viewer(c))
+	if errors.Is(err, controllers.ErrForbidden) {
+		return ErrorResponse(c, fiber.StatusForbidden, err.Error())
+	}
 	if err != nil {
 		return ErrorResponse(c, fiber.StatusInternalServerError, "Error deleting item")
 	}
@@ -115,54 +144,14 @@ func DeleteItem(c *fiber.Ctx) error {
 
 // private functions
 func processItemOrderForm(form *multipart.Form, order *models.JSON_Item_Order) error {
-	var imageBase64 string
-	imageBase64 = ""
-	if file, ok := form.File["item_data.image"]; ok && len(file) > 0 {
-		imageFile, err := file[0].Open()
-		if err != nil {
-			return err
-		}
-		defer imageFile.Close()
-
-		buffer := make([]byte, 512)
-		_, err = imageFile.Read(buffer)
-		if err != nil {
-			return err
-		}
-
-		_, err = imageFile.Seek(0, io.SeekStart)
-		if err != nil {
-			return err
-		}
-
-		mimeType := http.DetectContentType(buffer)
-		if !strings.HasPrefix(mimeType, "image/") {
-			return errors.New("invalid file format, please upload an image")
-		}
-
-		imageBytes, err := io.ReadAll(imageFile)
-		if err != nil {
-			return err
-		}
-
-		imageBase64 = base64.StdEncoding.EncodeToString(imageBytes)
+	imageBase64, err := encodeFormFile(form, "item_data.image", true)
+	if err != nil {
+		return err
 	}
 
-	var fileBase64 string
-	fileBase64 = ""
-	if file, ok := form.File["item_data.file"]; ok && len(file) > 0 {
-		fileFile, err := file[0].Open()
-		if err != nil {
-			return err
-		}
-		defer fileFile.Close()
-
-		fileBytes, err := io.ReadAll(fileFile)
-		if err != nil {
-			return err
-		}
-
-		fileBase64 = base64.StdEncoding.EncodeToString(fileBytes)
+	fileBase64, err := encodeFormFile(form, "item_data.file", false)
+	if err != nil {
+		return err
 	}
 
 	order.User.Name = form.Value["name"][0]
@@ -171,6 +160,26 @@ func processItemOrderForm(form *multipart.Form, order *models.JSON_Item_Order) e
 	order.Title = form.Value["title"][0]
 	order.Description = form.Value["description"][0]
 	order.SCID = form.Value["scid"][0]
+	if restricted, ok := form.Value["restricted"]; ok && len(restricted) > 0 {
+		r := restricted[0] != ""
+		order.Restricted = &r
+	}
+	if price, ok := form.Value["price"]; ok && len(price) > 0 && price[0] != "" {
+		p, err := strconv.ParseUint(price[0], 10, 64)
+		if err != nil {
+			return errors.New("invalid price")
+		}
+		order.Price = p
+	}
+	if asset, ok := form.Value["price_asset"]; ok && len(asset) > 0 {
+		order.PriceAsset = asset[0]
+	}
+	if private, ok := form.Value["private"]; ok && len(private) > 0 {
+		order.Private = private[0] != ""
+	}
+	if key, ok := form.Value["key"]; ok && len(key) > 0 {
+		order.Key = key[0]
+	}
 	order.Image = imageBase64
 	order.File = fileBase64 // Assuming order.File is a string field to store the base64 representation of the file
 	return nil
@@ -188,6 +197,9 @@ func processItemOrderCredentials(c *fiber.Ctx, order *models.JSON_Item_Order) er
 	if order.User.Password == "" {
 		order.User.Password = pass
 	}
+	if order.Key == "" {
+		order.Key = c.Get(HeaderItemKey)
+	}
 	if order.User.Wallet == "" {
 		user, err := controllers.GetUserByName(order.User.Name)
 		if err != nil {
@@ -197,3 +209,29 @@ func processItemOrderCredentials(c *fiber.Ctx, order *models.JSON_Item_Order) er
 	}
 	return nil
 }
+
+// encodeFormFile returns the base64 of the file uploaded under key, or
+// nothing if there is none; images only takes images
+func encodeFormFile(form *multipart.Form, key string, imagesOnly bool) (string, error) {
+	files, ok := form.File[key]
+	if !ok || len(files) == 0 {
+		return "", nil
+	}
+
+	file, err := files[0].Open()
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	content, err := io.ReadAll(file)
+	if err != nil {
+		return "", err
+	}
+
+	if imagesOnly && !strings.HasPrefix(http.DetectContentType(content), "image/") {
+		return "", errors.New("invalid file format, please upload an image")
+	}
+
+	return base64.StdEncoding.EncodeToString(content), nil
+}
@@ -0,0 +1,85 @@
+package api
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/secretnamebasis/secret-site/app/controllers"
+	"github.com/secretnamebasis/secret-site/app/integrations/dero"
+	"github.com/secretnamebasis/secret-site/app/models"
+)
+
+// ItemNFA shows the decoded state of the item's NFA and its listing
+func ItemNFA(c *fiber.Ctx) error {
+	listing, err := controllers.NFAListing(c.Params("id"), Viewer(c))
+	if err != nil {
+		switch {
+		case errors.Is(err, dero.ErrNotNFA),
+			strings.Contains(err.Error(), "not found"),
+			strings.Contains(err.Error(), "has no contract"):
+			return ErrorResponse(c, fiber.StatusNotFound, err.Error())
+		case errors.Is(err, controllers.ErrForbidden):
+			return ErrorResponse(c, fiber.StatusForbidden, err.Error())
+		default:
+			return serverErrorResponse(c, err)
+		}
+	}
+
+	return SuccessResponse(c, "nfa retrieved", listing)
+}
+
+// VerifyNFAFile checks the item's file against the checksums in its NFA
+func VerifyNFAFile(c *fiber.Ctx) error {
+	check, err := controllers.VerifyNFAFile(c.Params("id"), Viewer(c))
+	if err != nil {
+		switch {
+		case errors.Is(err, dero.ErrNotNFA),
+			strings.Contains(err.Error(), "not found"),
+			strings.Contains(err.Error(), "has no contract"):
+			return ErrorResponse(c, fiber.StatusNotFound, err.Error())
+		case errors.Is(err, controllers.ErrForbidden):
+			return ErrorResponse(c, fiber.StatusForbidden, err.Error())
+		default:
+			return serverErrorResponse(c, err)
+		}
+	}
+
+	return SuccessResponse(c, "file checked", check)
+}
+
+// MarketAction lists, bids on, buys, closes, cancels or claims the item's NFA.
+// With prepare set, the transfer comes back for the user's own wallet to send.
+func MarketAction(c *fiber.Ctx) error {
+	var order models.JSON_Market_Order
+	// a bare close, cancel or claim needs no body
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&order); err != nil {
+			return ErrorResponse(c, fiber.StatusBadRequest, "Invalid request body")
+		}
+	}
+	order.User = Viewer(c)
+
+	call, err := controllers.MarketAction(c.Params("id"), c.Params("action"), order)
+	if err != nil {
+		switch {
+		case errors.Is(err, dero.ErrUnknownAction),
+			strings.Contains(err.Error(), "not found"):
+			return ErrorResponse(c, fiber.StatusNotFound, err.Error())
+		case errors.Is(err, dero.ErrInvalidCall),
+			strings.Contains(err.Error(), "has no contract"):
+			return ErrorResponse(c, fiber.StatusBadRequest, err.Error())
+		case errors.Is(err, controllers.ErrForbidden),
+			strings.Contains(err.Error(), "invalid password"),
+			strings.Contains(err.Error(), "does not exist"):
+			return ErrorResponse(c, fiber.StatusForbidden, err.Error())
+		default:
+			return serverErrorResponse(c, err)
+		}
+	}
+
+	if call.TXID == "" {
+		return SuccessResponse(c, "market call prepared", call)
+	}
+	return SuccessResponse(c, "market call sent", call)
+}
@@ -0,0 +1,57 @@
+package api
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/secretnamebasis/secret-site/app/controllers"
+	"github.com/secretnamebasis/secret-site/app/models"
+)
+
+// SendMessage sends an item's owner a message on-chain
+func SendMessage(c *fiber.Ctx) error {
+	var order models.JSON_Message_Order
+	if err := c.BodyParser(&order); err != nil {
+		return ErrorResponse(c, fiber.StatusBadRequest, "Invalid request body")
+	}
+	order.User = Viewer(c)
+
+	message, err := controllers.SendMessage(c.Params("id"), order)
+	if err != nil {
+		switch {
+		case errors.Is(err, controllers.ErrForbidden),
+			errors.Is(err, controllers.ErrMessagingDisabled):
+			return ErrorResponse(c, fiber.StatusForbidden, err.Error())
+		case errors.Is(err, controllers.ErrMessageRate),
+			errors.Is(err, controllers.ErrMessageFee):
+			return ErrorResponse(c, fiber.StatusTooManyRequests, err.Error())
+		case strings.Contains(err.Error(), "not found"):
+			return ErrorResponse(c, fiber.StatusNotFound, err.Error())
+		case strings.Contains(err.Error(), "message is"),
+			strings.Contains(err.Error(), "comment is too long"):
+			return ErrorResponse(c, fiber.StatusBadRequest, err.Error())
+		default:
+			return serverErrorResponse(c, err)
+		}
+	}
+
+	return SuccessResponse(c, "message sent", message)
+}
+
+// Inbox retrieves the viewer's inbox, or with ?user= an admin's pick
+func Inbox(c *fiber.Ctx) error {
+	inbox, err := controllers.GetInbox(c.Query("user"), Viewer(c))
+	if err != nil {
+		switch {
+		case errors.Is(err, controllers.ErrForbidden):
+			return ErrorResponse(c, fiber.StatusForbidden, err.Error())
+		case strings.Contains(err.Error(), "not found"):
+			return ErrorResponse(c, fiber.StatusNotFound, err.Error())
+		default:
+			return ErrorResponse(c, fiber.StatusInternalServerError, err.Error())
+		}
+	}
+
+	return SuccessResponse(c, "inbox retrieved", inbox)
+}
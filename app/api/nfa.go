@@ -0,0 +1,122 @@
+package api
+
+import (
+	"errors"
+	"mime/multipart"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/secretnamebasis/secret-site/app/controllers"
+	"github.com/secretnamebasis/secret-site/app/integrations/dero"
+	"github.com/secretnamebasis/secret-site/app/models"
+)
+
+// MintNFA mints an NFA for an uploaded item and lists the item under its SCID
+func MintNFA(c *fiber.Ctx) error {
+	var order models.JSON_NFA_Order
+	if form, _ := c.MultipartForm(); form != nil {
+		if err := processNFAOrderForm(form, &order); err != nil {
+			return ErrorResponse(c, fiber.StatusBadRequest, err.Error())
+		}
+	} else if err := c.BodyParser(&order); err != nil {
+		return ErrorResponse(c, fiber.StatusBadRequest, "Invalid request body")
+	}
+
+	// the form carries its own credentials, the API uses Basic auth
+	if order.User.Name == "" {
+		order.User = Viewer(c)
+	}
+
+	item, err := controllers.MintNFA(order)
+	if err != nil {
+		switch {
+		case errors.Is(err, dero.ErrInvalidContract),
+			strings.Contains(err.Error(), "already exists"),
+			strings.Contains(err.Error(), "cannot"):
+			return ErrorResponse(c, fiber.StatusBadRequest, err.Error())
+		case strings.Contains(err.Error(), "invalid password"),
+			strings.Contains(err.Error(), "does not exist"):
+			return ErrorResponse(c, fiber.StatusForbidden, err.Error())
+		default:
+			return serverErrorResponse(c, err)
+		}
+	}
+
+	return SuccessResponse(c, "nfa minted", item)
+}
+
+// NFAs lists the indexed ART-NFA-MS1 tokens, optionally filtered by the
+// collection, owner and active query params
+func NFAs(c *fiber.Ctx) error {
+	filter := controllers.NFAFilter{
+		Collection: c.Query("collection"),
+		Owner:      c.Query("owner"),
+	}
+	if active := c.Query("active"); active != "" {
+		b, err := strconv.ParseBool(active)
+		if err != nil {
+			return ErrorResponse(c, fiber.StatusBadRequest, "invalid active")
+		}
+		filter.Active = &b
+	}
+
+	nfas, err := controllers.IndexedNFAs(filter)
+	if err != nil {
+		return ErrorResponse(c, fiber.StatusInternalServerError, "Error retrieving NFAs")
+	}
+
+	return SuccessResponse(c, "nfas retrieved", nfas)
+}
+
+// private functions
+
+// processNFAOrderForm fills the order from the /nfas/new form
+func processNFAOrderForm(form *multipart.Form, order *models.JSON_NFA_Order) error {
+	image, err := encodeFormFile(form, "image", true)
+	if err != nil {
+		return err
+	}
+	if image == "" {
+		return errors.New("image cannot be empty")
+	}
+
+	file, err := encodeFormFile(form, "file", false)
+	if err != nil {
+		return err
+	}
+
+	value := func(key string) string {
+		if values := form.Value[key]; len(values) > 0 {
+			return values[0]
+		}
+		return ""
+	}
+
+	order.User.Name = value("name")
+	order.User.Password = value("password")
+	order.Title = value("title")
+	order.Description = value("description")
+	order.Type = value("type")
+	order.Collection = value("collection")
+	order.Tags = value("tags")
+	order.Image = image
+	order.File = file
+
+	if royalty := value("royalty"); royalty != "" {
+		r, err := strconv.ParseUint(royalty, 10, 64)
+		if err != nil {
+			return errors.New("invalid royalty")
+		}
+		order.Royalty = r
+	}
+	if price := value("price"); price != "" {
+		p, err := strconv.ParseUint(price, 10, 64)
+		if err != nil {
+			return errors.New("invalid price")
+		}
+		order.Price = p
+	}
+	order.PriceAsset = value("price_asset")
+	return nil
+}
@@ -13,15 +13,16 @@ func Ping(c *fiber.Ctx) error {
 
 	a, e := dero.GetWalletAddress(config.WalletEndpoint)
 
+	// a is nil when the wallet doesn't answer
+	if e != nil {
+		return ErrorResponse(c, fiber.StatusServiceUnavailable, e.Error())
+	}
+
 	m := "app: " + config.Domain +
 		" :: owner: " + a.String()
 
 	s := "success"
 
-	if e != nil {
-		return c.JSON(e)
-	}
-
 	r := fiber.Map{
 		"message": m,
 		"data":    d,
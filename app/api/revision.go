@@ -0,0 +1,62 @@
+package api
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/secretnamebasis/secret-site/app/controllers"
+)
+
+// ItemRevisions lists the revisions of an item
+func ItemRevisions(c *fiber.Ctx) error {
+	revisions, err := controllers.ItemRevisions(c.Params("id"), Viewer(c))
+	if err != nil {
+		return revisionErrorResponse(c, err)
+	}
+
+	return SuccessResponse(c, "revisions retrieved", revisions)
+}
+
+// ItemRevision retrieves a single revision of an item
+func ItemRevision(c *fiber.Ctx) error {
+	revision, err := controllers.GetItemRevision(
+		c.Params("id"),
+		c.Params("revision"),
+		Viewer(c),
+		c.Get(HeaderItemKey),
+	)
+	if err != nil {
+		return revisionErrorResponse(c, err)
+	}
+
+	return SuccessResponse(c, "revision retrieved", revision)
+}
+
+// RestoreItemRevision puts an earlier revision of an item back in place
+func RestoreItemRevision(c *fiber.Ctx) error {
+	item, err := controllers.RestoreItemRevision(
+		c.Params("id"),
+		c.Params("revision"),
+		Viewer(c),
+	)
+	if err != nil {
+		return revisionErrorResponse(c, err)
+	}
+
+	return SuccessResponse(c, "revision restored", item)
+}
+
+// private functions
+
+// revisionErrorResponse maps revision errors onto response statuses
+func revisionErrorResponse(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, controllers.ErrForbidden):
+		return ErrorResponse(c, fiber.StatusForbidden, err.Error())
+	case strings.Contains(err.Error(), "not found"):
+		return ErrorResponse(c, fiber.StatusNotFound, err.Error())
+	default:
+		return ErrorResponse(c, fiber.StatusInternalServerError, err.Error())
+	}
+}
@@ -1,6 +1,8 @@
 package api
 
 import (
+	"errors"
+
 	"github.com/gofiber/fiber/v2"
 	"github.com/secretnamebasis/secret-site/app/controllers"
 	"github.com/secretnamebasis/secret-site/app/models"
@@ -10,10 +12,10 @@ import (
 func CreateUserOrder(c *fiber.Ctx) error {
 	order := parseUserData(c)
 	if err := controllers.ValidateWalletAddress(order.Wallet); err != nil {
-		return ErrorResponse(c, fiber.StatusInternalServerError, err.Error())
+		return serverErrorResponse(c, err)
 	}
 	if err := controllers.CreateUserRecord(&order); err != nil {
-		return ErrorResponse(c, fiber.StatusInternalServerError, err.Error())
+		return serverErrorResponse(c, err)
 	}
 	return SuccessResponse(c, "user created", &order)
 }
@@ -41,7 +43,10 @@ func UserByID(c *fiber.Ctx) error {
 func UpdateUser(c *fiber.Ctx) error {
 	updatedUser := parseUpdatedUserData(c)
 	if err := controllers.UpdateUser(updatedUser); err != nil {
-		return ErrorResponse(c, fiber.StatusInternalServerError, err.Error())
+		if errors.Is(err, controllers.ErrForbidden) {
+			return ErrorResponse(c, fiber.StatusForbidden, err.Error())
+		}
+		return serverErrorResponse(c, err)
 	}
 	return SuccessResponse(c, "user updated", nil)
 }
@@ -52,7 +57,10 @@ func DeleteUser(c *fiber.Ctx) error {
 	if _, err := controllers.GetUserByID(id); err != nil {
 		return ErrorResponse(c, fiber.StatusNotFound, "User not found")
 	}
-	if err := controllers.DeleteUser(id); err != nil {
+	if err := controllers.DeleteUser(id, Viewer(c)); err != nil {
+		if errors.Is(err, controllers.ErrForbidden) {
+			return ErrorResponse(c, fiber.StatusForbidden, err.Error())
+		}
 		return ErrorResponse(c, fiber.StatusInternalServerError, "Error deleting user")
 	}
 	return SuccessResponse(c, "user deleted", nil)
@@ -100,9 +108,8 @@ func parseUpdatedUserData(c *fiber.Ctx) models.JSON_User_Order {
 	if err := c.BodyParser(&updatedUser); err != nil {
 		return updatedUser
 	}
-	if password != "" {
-		updatedUser.Password = password
-	}
+	// the credentials carry the current password, the body a new one
+	updatedUser.OldPassword = password
 	if name != "" {
 		updatedUser.Name = name
 	}
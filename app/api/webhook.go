@@ -0,0 +1,84 @@
+package api
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/secretnamebasis/secret-site/app/controllers"
+	"github.com/secretnamebasis/secret-site/app/models"
+)
+
+// CreateWebhook registers an endpoint for events; the secret deliveries
+// are signed with is only shown here
+func CreateWebhook(c *fiber.Ctx) error {
+	var order models.JSON_Webhook_Order
+	if err := c.BodyParser(&order); err != nil {
+		return ErrorResponse(c, fiber.StatusBadRequest, "Invalid request body")
+	}
+	order.User = Viewer(c)
+
+	webhook, err := controllers.CreateWebhook(order)
+	if err != nil {
+		return webhookErrorResponse(c, err)
+	}
+
+	return SuccessResponse(c, "webhook created", webhook)
+}
+
+// Webhooks lists the user's webhooks
+func Webhooks(c *fiber.Ctx) error {
+	webhooks, err := controllers.Webhooks(Viewer(c))
+	if err != nil {
+		return webhookErrorResponse(c, err)
+	}
+
+	return SuccessResponse(c, "webhooks retrieved", webhooks)
+}
+
+// DeleteWebhook removes one of the user's webhooks
+func DeleteWebhook(c *fiber.Ctx) error {
+	if err := controllers.DeleteWebhook(c.Params("id"), Viewer(c)); err != nil {
+		return webhookErrorResponse(c, err)
+	}
+
+	return SuccessResponse(c, "webhook deleted", nil)
+}
+
+// WebhookDeliveries lists the deliveries made to a webhook
+func WebhookDeliveries(c *fiber.Ctx) error {
+	deliveries, err := controllers.WebhookDeliveries(c.Params("id"), Viewer(c))
+	if err != nil {
+		return webhookErrorResponse(c, err)
+	}
+
+	return SuccessResponse(c, "deliveries retrieved", deliveries)
+}
+
+// RedeliverWebhook queues a delivery to a webhook again
+func RedeliverWebhook(c *fiber.Ctx) error {
+	delivery, err := controllers.RedeliverWebhook(
+		c.Params("id"),
+		c.Params("delivery"),
+		Viewer(c),
+	)
+	if err != nil {
+		return webhookErrorResponse(c, err)
+	}
+
+	return SuccessResponse(c, "delivery queued", delivery)
+}
+
+// private functions
+
+// webhookErrorResponse maps webhook errors onto response statuses
+func webhookErrorResponse(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, controllers.ErrForbidden):
+		return ErrorResponse(c, fiber.StatusForbidden, err.Error())
+	case strings.Contains(err.Error(), "not found"):
+		return ErrorResponse(c, fiber.StatusNotFound, err.Error())
+	default:
+		return ErrorResponse(c, fiber.StatusBadRequest, err.Error())
+	}
+}
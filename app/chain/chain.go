@@ -0,0 +1,248 @@
+package chain
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/deroproject/derohe/rpc"
+	"github.com/secretnamebasis/secret-site/app/database"
+	"github.com/secretnamebasis/secret-site/app/events"
+	"github.com/secretnamebasis/secret-site/app/integrations/dero"
+)
+
+// checkpoint keys in the meta bucket
+const (
+	checkpointTopoHeight = "chain.topoheight" // last block published
+	checkpointTransfers  = "chain.transfers"  // last block height transfers were published for, by asset after a dot
+)
+
+// maxCatchUp is how many blocks one poll publishes, so a long outage
+// doesn't hold everything else up
+const maxCatchUp = 100
+
+// Follower follows the chain and publishes what happens on it as events
+type Follower struct {
+	NodeEndpoint   string
+	WalletEndpoint string
+	// Tracked returns the SCIDs whose variables are watched for changes
+	Tracked func() ([]string, error)
+	// Assets returns the SCIDs of the tokens, besides DERO, whose incoming
+	// transfers are published
+	Assets func() ([]string, error)
+	// Receive handles each incoming transfer before it's published, with the
+	// asset's SCID, empty for DERO; transfers are checkpointed only once
+	// it returns without an error, so they're handed over again until then
+	Receive func(entry rpc.Entry, scid string) error
+
+	// the hash of each tracked contract's variables, as last seen
+	variables map[string]string
+}
+
+// Run polls the chain at every interval; run it in a goroutine of its own
+func (f *Follower) Run(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		// nothing to follow while the node is down, it's being probed
+		if !dero.NodeOnline() {
+			continue
+		}
+		if err := f.Poll(); err != nil {
+			log.Printf("Error following chain: %v", err)
+		}
+	}
+}
+
+// Poll publishes the blocks, contract changes and incoming transfers
+// since the last poll, checkpointing as it goes
+func (f *Follower) Poll() error {
+	info, err := dero.GetInfo(f.NodeEndpoint)
+	if err != nil {
+		return err
+	}
+
+	published, err := f.publishBlocks(info.TopoHeight)
+	if err != nil {
+		return err
+	}
+
+	// contracts only change with new blocks
+	if published > 0 && f.Tracked != nil {
+		if err := f.publishSCChanges(); err != nil {
+			return err
+		}
+	}
+
+	// tokens seen for the first time start where DERO stood before this
+	// poll, which is before whatever made them worth watching
+	start, ok, err := checkpoint(checkpointTransfers)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		start = info.Height
+	}
+
+	if err := f.publishTransfers("", info.Height); err != nil {
+		return err
+	}
+	if f.Assets == nil {
+		return nil
+	}
+	assets, err := f.Assets()
+	if err != nil {
+		return err
+	}
+	for _, scid := range assets {
+		if err := f.publishTransfers(scid, start); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// private functions
+
+// publishBlocks publishes each block after the checkpoint, up to topoHeight
+func (f *Follower) publishBlocks(topoHeight int64) (int, error) {
+	last, ok, err := checkpoint(checkpointTopoHeight)
+	if err != nil {
+		return 0, err
+	}
+	// on the first run we start from here, not from genesis
+	if !ok {
+		last = topoHeight - 1
+	}
+
+	published := 0
+	for height := last + 1; height <= topoHeight && published < maxCatchUp; height++ {
+		header, err := dero.GetBlockHeaderByTopoHeight(f.NodeEndpoint, height)
+		if err != nil {
+			return published, err
+		}
+		events.Publish(events.Event{Type: events.BlockNew, Data: header})
+
+		if err := setCheckpoint(checkpointTopoHeight, height); err != nil {
+			return published, err
+		}
+		published++
+	}
+	return published, nil
+}
+
+// publishSCChanges publishes the tracked contracts whose variables changed
+func (f *Follower) publishSCChanges() error {
+	scids, err := f.Tracked()
+	if err != nil {
+		return err
+	}
+
+	if f.variables == nil {
+		f.variables = make(map[string]string)
+	}
+
+	for _, scid := range scids {
+		result, err := dero.RefreshSC(f.NodeEndpoint, scid)
+		if err != nil {
+			log.Printf("Error reading SC %s: %v", scid, err)
+			continue
+		}
+
+		variables, err := json.Marshal([]interface{}{
+			result.VariableStringKeys,
+			result.VariableUint64Keys,
+			result.Balances,
+		})
+		if err != nil {
+			return err
+		}
+		sum := sha256.Sum256(variables)
+		hash := hex.EncodeToString(sum[:])
+
+		// the first look is only a baseline
+		previous, seen := f.variables[scid]
+		f.variables[scid] = hash
+		if seen && previous != hash {
+			events.Publish(events.Event{Type: events.SCChanged, SCID: scid, Data: result})
+		}
+	}
+	return nil
+}
+
+// publishTransfers publishes the transfers of an asset, DERO when empty,
+// received in blocks after its checkpoint. Without one, DERO starts at the
+// current height and tokens after start.
+func (f *Follower) publishTransfers(scid string, start int64) error {
+	key := checkpointTransfers
+	if scid != "" {
+		key += "." + scid
+	}
+	last, ok, err := checkpoint(key)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		if scid == "" {
+			return setCheckpoint(key, start)
+		}
+		last = start
+	}
+
+	entries, err := dero.GetIncomingTransfers(f.WalletEndpoint, scid, uint64(last)+1)
+	if err != nil {
+		return err
+	}
+
+	// by height, so the checkpoint never passes a transfer not yet received
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].Height < entries[j].Height })
+
+	latest := last
+	for _, entry := range entries {
+		// mined rewards aren't payments
+		if entry.Coinbase {
+			continue
+		}
+		if f.Receive != nil {
+			if err := f.Receive(entry, scid); err != nil {
+				// keep what came in at lower heights, and try this one again
+				if below := int64(entry.Height) - 1; below > last {
+					if err := setCheckpoint(key, below); err != nil {
+						return err
+					}
+				}
+				return fmt.Errorf("receiving transfer %s: %w", entry.TXID, err)
+			}
+		}
+		events.Publish(events.Event{Type: events.TransferIncoming, SCID: scid, Data: entry})
+		if int64(entry.Height) > latest {
+			latest = int64(entry.Height)
+		}
+	}
+
+	if latest == last && ok {
+		return nil
+	}
+	return setCheckpoint(key, latest)
+}
+
+// checkpoint reads a height from the meta bucket, ok is false when there is none
+func checkpoint(key string) (height int64, ok bool, err error) {
+	value, err := database.GetMeta(key)
+	if err != nil || value == nil {
+		return 0, false, err
+	}
+	height, err = strconv.ParseInt(string(value), 10, 64)
+	return height, err == nil, err
+}
+
+// setCheckpoint stores a height in the meta bucket
+func setCheckpoint(key string, height int64) error {
+	return database.PutMeta(key, []byte(strconv.FormatInt(height, 10)))
+}
@@ -0,0 +1,233 @@
+package chain_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/deroproject/derohe/rpc"
+	"github.com/secretnamebasis/secret-site/app/chain"
+	"github.com/secretnamebasis/secret-site/app/config"
+	"github.com/secretnamebasis/secret-site/app/database"
+	"github.com/secretnamebasis/secret-site/app/events"
+)
+
+// token is an asset the wallet receives besides DERO
+const token = "0000000000000000000000000000000000000000000000000000000000000001"
+
+// fakeDERO answers as both node and wallet, at the given topoheight, with a
+// DERO and a token transfer in at 12
+func fakeDERO(t *testing.T, topoHeight *atomic.Int64) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			ID     int             `json:"id"`
+			Method string          `json:"method"`
+			Params json.RawMessage `json:"params"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			t.Errorf("Failed to decode request: %v", err)
+		}
+
+		var result interface{}
+		switch request.Method {
+		case "DERO.GetInfo":
+			result = rpc.GetInfo_Result{Height: topoHeight.Load(), TopoHeight: topoHeight.Load()}
+		case "DERO.GetBlockHeaderByTopoHeight":
+			var params rpc.GetBlockHeaderByTopoHeight_Params
+			json.Unmarshal(request.Params, &params)
+			result = rpc.GetBlockHeaderByHeight_Result{
+				Block_Header: rpc.BlockHeader_Print{TopoHeight: int64(params.TopoHeight)},
+			}
+		case "GetTransfers":
+			var params rpc.Get_Transfers_Params
+			json.Unmarshal(request.Params, &params)
+			var entries []rpc.Entry
+			if params.Min_Height <= 12 && topoHeight.Load() >= 12 {
+				txid := "paid"
+				if params.SCID.String() == token {
+					txid = "paid in token"
+				}
+				entries = append(entries, rpc.Entry{Height: 12, TXID: txid, Amount: 100, DestinationPort: 7})
+			}
+			result = rpc.Get_Transfers_Result{Entries: entries}
+		}
+
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"jsonrpc": "2.0",
+			"id":      request.ID,
+			"result":  result,
+		})
+	}))
+}
+
+func TestFollowerPoll(t *testing.T) {
+	config.EnvPath = "../../.env.test"
+	if err := database.Initialize(config.Server{DatabasePath: t.TempDir(), Environment: "test"}); err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+
+	var topoHeight atomic.Int64
+	topoHeight.Store(10)
+	node := fakeDERO(t, &topoHeight)
+	defer node.Close()
+
+	sub := events.Subscribe(events.BlockNew, events.TransferIncoming)
+	defer sub.Close()
+
+	follower := &chain.Follower{NodeEndpoint: node.URL, WalletEndpoint: node.URL}
+
+	// the first poll starts from the current block
+	if err := follower.Poll(); err != nil {
+		t.Fatalf("Failed to poll: %v", err)
+	}
+	expectBlocks(t, sub, 10)
+
+	// later polls catch up from the checkpoint, transfers included
+	topoHeight.Store(13)
+	if err := follower.Poll(); err != nil {
+		t.Fatalf("Failed to poll: %v", err)
+	}
+	expectBlocks(t, sub, 11, 12, 13)
+
+	transfer := next(t, sub)
+	if entry, ok := transfer.Data.(rpc.Entry); !ok || entry.TXID != "paid" {
+		t.Errorf("Expected the incoming transfer, but got: %+v", transfer)
+	}
+
+	// a new follower, like after a restart, resumes from the checkpoint
+	follower = &chain.Follower{NodeEndpoint: node.URL, WalletEndpoint: node.URL}
+	topoHeight.Store(14)
+	if err := follower.Poll(); err != nil {
+		t.Fatalf("Failed to poll: %v", err)
+	}
+	expectBlocks(t, sub, 14)
+	if len(sub.C) != 0 {
+		t.Errorf("Expected no transfer to be published twice, but got: %+v", <-sub.C)
+	}
+}
+
+func TestFollowerPollAssets(t *testing.T) {
+	config.EnvPath = "../../.env.test"
+	if err := database.Initialize(config.Server{DatabasePath: t.TempDir(), Environment: "test"}); err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+
+	var topoHeight atomic.Int64
+	topoHeight.Store(10)
+	node := fakeDERO(t, &topoHeight)
+	defer node.Close()
+
+	sub := events.Subscribe(events.TransferIncoming)
+	defer sub.Close()
+
+	// the token only becomes worth watching after the first poll
+	var assets []string
+	follower := &chain.Follower{
+		NodeEndpoint:   node.URL,
+		WalletEndpoint: node.URL,
+		Assets:         func() ([]string, error) { return assets, nil },
+	}
+	if err := follower.Poll(); err != nil {
+		t.Fatalf("Failed to poll: %v", err)
+	}
+
+	assets = []string{token}
+	topoHeight.Store(13)
+	if err := follower.Poll(); err != nil {
+		t.Fatalf("Failed to poll: %v", err)
+	}
+
+	published := map[string]string{}
+	for i := 0; i < 2; i++ {
+		event := next(t, sub)
+		entry, _ := event.Data.(rpc.Entry)
+		published[entry.TXID] = event.SCID
+	}
+	if scid, ok := published["paid"]; !ok || scid != "" {
+		t.Errorf("Expected the DERO transfer without an SCID, but got: %+v", published)
+	}
+	if scid, ok := published["paid in token"]; !ok || scid != token {
+		t.Errorf("Expected the token transfer under %s, but got: %+v", token, published)
+	}
+
+	topoHeight.Store(14)
+	if err := follower.Poll(); err != nil {
+		t.Fatalf("Failed to poll: %v", err)
+	}
+	if len(sub.C) != 0 {
+		t.Errorf("Expected no transfer to be published twice, but got: %+v", <-sub.C)
+	}
+}
+
+func expectBlocks(t *testing.T, sub *events.Subscription, topoHeights ...int64) {
+	t.Helper()
+	for _, topoHeight := range topoHeights {
+		event := next(t, sub)
+		header, ok := event.Data.(*rpc.BlockHeader_Print)
+		if event.Type != events.BlockNew || !ok || header.TopoHeight != topoHeight {
+			t.Fatalf("Expected block %d, but got: %+v", topoHeight, event)
+		}
+	}
+}
+
+func next(t *testing.T, sub *events.Subscription) events.Event {
+	t.Helper()
+	select {
+	case event := <-sub.C:
+		return event
+	case <-time.After(time.Second):
+		t.Fatal("Expected an event, but got none")
+		return events.Event{}
+	}
+}
+
+func TestFollowerRetriesUnreceivedTransfers(t *testing.T) {
+	config.EnvPath = "../../.env.test"
+	if err := database.Initialize(config.Server{DatabasePath: t.TempDir(), Environment: "test"}); err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+
+	var topoHeight atomic.Int64
+	topoHeight.Store(10)
+	node := fakeDERO(t, &topoHeight)
+	defer node.Close()
+
+	var received []string
+	fail := true
+	follower := &chain.Follower{
+		NodeEndpoint:   node.URL,
+		WalletEndpoint: node.URL,
+		Receive: func(entry rpc.Entry, scid string) error {
+			if fail {
+				return errors.New("database is busy")
+			}
+			received = append(received, entry.TXID)
+			return nil
+		},
+	}
+	if err := follower.Poll(); err != nil {
+		t.Fatalf("Failed to poll: %v", err)
+	}
+
+	// the transfer at 12 isn't checkpointed until it's received
+	topoHeight.Store(13)
+	if err := follower.Poll(); err == nil {
+		t.Fatal("Expected the poll to fail with the transfer")
+	}
+	fail = false
+	if err := follower.Poll(); err != nil {
+		t.Fatalf("Failed to poll: %v", err)
+	}
+	topoHeight.Store(14)
+	if err := follower.Poll(); err != nil {
+		t.Fatalf("Failed to poll: %v", err)
+	}
+
+	if len(received) != 1 || received[0] != "paid" {
+		t.Errorf("Expected the transfer received once, after the failure, but got: %v", received)
+	}
+}
@@ -0,0 +1,130 @@
+package chain
+
+import (
+	"log"
+	"time"
+
+	"github.com/secretnamebasis/secret-site/app/database"
+	"github.com/secretnamebasis/secret-site/app/integrations/dero"
+	"github.com/secretnamebasis/secret-site/app/models"
+)
+
+// checkpointIndex is the last block the NFA index has scanned
+const checkpointIndex = "index.topoheight"
+
+// Indexer scans blocks for ART-NFA-MS1 tokens being installed and called, and
+// keeps the NFA index in the database up to date with them
+type Indexer struct {
+	NodeEndpoint string
+	// From is the topoheight to start at when there is no checkpoint;
+	// below zero starts at the current block
+	From int64
+	// Transactions lists the contract transactions of a block, by default
+	// dero.GetSCTransactions
+	Transactions func(endpoint string, topoHeight int64) ([]dero.SCTransaction, error)
+}
+
+// Run polls the chain at every interval; run it in a goroutine of its own
+func (i *Indexer) Run(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if !dero.NodeOnline() {
+			continue
+		}
+		if err := i.Poll(); err != nil {
+			log.Printf("Error indexing NFAs: %v", err)
+		}
+	}
+}
+
+// Poll scans the blocks since the last poll, checkpointing after each one
+func (i *Indexer) Poll() error {
+	info, err := dero.GetInfo(i.NodeEndpoint)
+	if err != nil {
+		return err
+	}
+
+	last, ok, err := checkpoint(checkpointIndex)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		last = i.From - 1
+		if i.From < 0 {
+			last = info.TopoHeight - 1
+		}
+	}
+
+	transactions := i.Transactions
+	if transactions == nil {
+		transactions = dero.GetSCTransactions
+	}
+
+	for height := last + 1; height <= info.TopoHeight && height <= last+maxCatchUp; height++ {
+		txs, err := transactions(i.NodeEndpoint, height)
+		if err != nil {
+			return err
+		}
+		for _, tx := range txs {
+			if err := i.index(tx, height); err != nil {
+				return err
+			}
+		}
+		if err := setCheckpoint(checkpointIndex, height); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// private functions
+
+// index records a token being installed, or re-reads one being called
+func (i *Indexer) index(tx dero.SCTransaction, height int64) error {
+	if tx.Install {
+		if !dero.IsNFAContract(tx.Code) {
+			return nil
+		}
+	}
+
+	// only calls to tokens already indexed matter
+	indexed, err := database.GetNFA(tx.SCID)
+	if err != nil || (indexed == nil && !tx.Install) {
+		return err
+	}
+
+	// the token as this block left it, which the tip has moved on from
+	// when catching up
+	sc, err := dero.GetSCAt(i.NodeEndpoint, tx.SCID, height)
+	if err != nil {
+		return err
+	}
+	state, err := dero.ParseNFAState(tx.SCID, sc)
+	if err != nil {
+		// the code matched, but the variables didn't come out of it
+		log.Printf("Error reading NFA %s: %v", tx.SCID, err)
+		return nil
+	}
+
+	// a call that hands a listed token to someone else is a sale
+	if indexed != nil {
+		if sale, ok := indexed.SaleTo(state); ok {
+			if err := database.PutSale(&models.Sale{
+				NFASale: sale,
+				TXID:    tx.TXID,
+				Height:  height,
+				Time:    tx.Time,
+			}); err != nil {
+				return err
+			}
+		}
+	}
+
+	return database.PutNFA(&models.IndexedNFA{
+		NFAState:      state,
+		DeployHeight:  height, // kept from the install on later calls
+		UpdatedHeight: height,
+	})
+}
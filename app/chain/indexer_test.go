@@ -0,0 +1,320 @@
+package chain_test
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/deroproject/derohe/rpc"
+	"github.com/secretnamebasis/secret-site/app/chain"
+	"github.com/secretnamebasis/secret-site/app/config"
+	"github.com/secretnamebasis/secret-site/app/database"
+	"github.com/secretnamebasis/secret-site/app/integrations/dero"
+)
+
+const (
+	minter = "dero1qy0khp9s9yw2h0eu20xmy9lth3zp5cacmx3rwt6k45l568d2mmcf6qgcsevzx"
+	buyer  = "dero1qyvqpdftj8r6005xs20rnflakmwa5pdxg9vcjzdcuywq2t8skqhvwqglt6x0g"
+)
+
+// fakeNode answers GetInfo at the given topoheight, and GetSC with the
+// variables of a token held by the owner, along with any extra ones, as
+// they were at the topoheight asked for
+type fakeNode struct {
+	mu         sync.Mutex
+	topoHeight int64
+	history    map[int64]tokenState
+}
+
+// tokenState is what the token holds from a topoheight on
+type tokenState struct {
+	owner string
+	extra map[string]interface{}
+}
+
+// set moves the node to the topoheight, with the token held by owner from there on
+func (n *fakeNode) set(topoHeight int64, owner string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.history == nil {
+		n.history = map[int64]tokenState{}
+	}
+	n.topoHeight = topoHeight
+	n.history[topoHeight] = tokenState{owner: owner, extra: n.at(topoHeight - 1).extra}
+}
+
+// setExtra changes the token's extra variables from the current topoheight on
+func (n *fakeNode) setExtra(extra map[string]interface{}) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	state := n.history[n.topoHeight]
+	state.extra = extra
+	n.history[n.topoHeight] = state
+}
+
+// at is the token as it was at the topoheight
+func (n *fakeNode) at(topoHeight int64) tokenState {
+	var state tokenState
+	for height := int64(0); height <= topoHeight; height++ {
+		if s, ok := n.history[height]; ok {
+			state = s
+		}
+	}
+	return state
+}
+
+func (n *fakeNode) serve(t *testing.T) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			ID     int              `json:"id"`
+			Method string           `json:"method"`
+			Params rpc.GetSC_Params `json:"params"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			t.Errorf("Failed to decode request: %v", err)
+		}
+
+		n.mu.Lock()
+		defer n.mu.Unlock()
+		var result interface{}
+		switch request.Method {
+		case "DERO.GetInfo":
+			result = rpc.GetInfo_Result{Height: n.topoHeight, TopoHeight: n.topoHeight}
+		case "DERO.GetSC":
+			topoHeight := request.Params.TopoHeight
+			if topoHeight == 0 {
+				topoHeight = n.topoHeight
+			}
+			state := n.at(topoHeight)
+			address, err := rpc.NewAddress(state.owner)
+			if err != nil {
+				t.Errorf("Failed to parse address: %v", err)
+			}
+			raw := hex.EncodeToString(address.Compressed())
+			text := func(s string) string { return hex.EncodeToString([]byte(s)) }
+			variables := map[string]interface{}{
+				"nameHdr":      text("sunset"),
+				"collection":   text("seascapes"),
+				"owner":        raw,
+				"creatorAddr":  raw,
+				"artificerFee": float64(1),
+				"royalty":      float64(5),
+			}
+			for key, value := range state.extra {
+				variables[key] = value
+			}
+			result = rpc.GetSC_Result{VariableStringKeys: variables}
+		default:
+			t.Errorf("Unexpected call to %s", request.Method)
+		}
+
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"jsonrpc": "2.0",
+			"id":      request.ID,
+			"result":  result,
+		})
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestIndexerPoll(t *testing.T) {
+	config.EnvPath = "../../.env.test"
+	if err := database.Initialize(config.Server{DatabasePath: t.TempDir(), Environment: "test"}); err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+
+	contract, err := dero.NFAContract(dero.NFA{Name: "sunset", Collection: "seascapes", Owner: minter, Creator: minter})
+	if err != nil {
+		t.Fatalf("Failed to render contract: %v", err)
+	}
+	nfa, other, stranger := strings.Repeat("a", 64), strings.Repeat("b", 64), strings.Repeat("c", 64)
+
+	// the chain as the indexer sees it, one block at a time
+	var scanned []int64
+	blocks := map[int64][]dero.SCTransaction{
+		9: {
+			{TXID: nfa, SCID: nfa, Install: true, Code: contract},
+			{TXID: other, SCID: other, Install: true, Code: "Function Initialize() Uint64\n10 RETURN 0\nEnd Function\n"},
+		},
+		11: {
+			{TXID: "bought", SCID: nfa},
+			{TXID: "called", SCID: stranger},
+		},
+	}
+	transactions := func(endpoint string, topoHeight int64) ([]dero.SCTransaction, error) {
+		scanned = append(scanned, topoHeight)
+		return blocks[topoHeight], nil
+	}
+
+	node := &fakeNode{}
+	node.set(9, minter)
+	node.set(10, minter)
+	url := node.serve(t).URL
+
+	indexer := &chain.Indexer{NodeEndpoint: url, From: 9, Transactions: transactions}
+	if err := indexer.Poll(); err != nil {
+		t.Fatalf("Failed to poll: %v", err)
+	}
+
+	nfas, err := database.GetNFAs("seascapes", "")
+	if err != nil {
+		t.Fatalf("Failed to list NFAs: %v", err)
+	}
+	if len(nfas) != 1 || nfas[0].SCID != nfa || nfas[0].Owner != minter || nfas[0].DeployHeight != 9 {
+		t.Fatalf("Expected only the token indexed at 9, but got: %+v", nfas)
+	}
+
+	// a new indexer, like after a restart, resumes from the checkpoint
+	// and follows the token to its new owner
+	node.set(11, buyer)
+	indexer = &chain.Indexer{NodeEndpoint: url, From: 0, Transactions: transactions}
+	if err := indexer.Poll(); err != nil {
+		t.Fatalf("Failed to poll: %v", err)
+	}
+	if len(scanned) != 3 || scanned[2] != 11 {
+		t.Errorf("Expected blocks 9 to 11 scanned once each, but got %v", scanned)
+	}
+
+	if stale, _ := database.GetNFAs("", minter); len(stale) != 0 {
+		t.Errorf("Expected nothing left under the minter, but got: %+v", stale)
+	}
+	nfas, err = database.GetNFAs("", buyer)
+	if err != nil {
+		t.Fatalf("Failed to list NFAs: %v", err)
+	}
+	if len(nfas) != 1 || nfas[0].DeployHeight != 9 || nfas[0].UpdatedHeight != 11 {
+		t.Errorf("Expected the token deployed at 9 and updated at 11, but got: %+v", nfas)
+	}
+	if unknown, _ := database.GetNFA(stranger); unknown != nil {
+		t.Errorf("Expected calls to other contracts ignored, but got: %+v", unknown)
+	}
+}
+
+func TestIndexerRecordsSales(t *testing.T) {
+	config.EnvPath = "../../.env.test"
+	if err := database.Initialize(config.Server{DatabasePath: t.TempDir(), Environment: "test"}); err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+
+	contract, err := dero.NFAContract(dero.NFA{Name: "sunset", Collection: "seascapes", Owner: minter, Creator: minter})
+	if err != nil {
+		t.Fatalf("Failed to render contract: %v", err)
+	}
+	nfa := strings.Repeat("a", 64)
+	sold := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	blocks := map[int64][]dero.SCTransaction{
+		1: {{TXID: nfa, SCID: nfa, Install: true, Code: contract}},
+		2: {{TXID: "listed", SCID: nfa}},
+		3: {{TXID: "bought", SCID: nfa, Time: sold}},
+	}
+	transactions := func(endpoint string, topoHeight int64) ([]dero.SCTransaction, error) {
+		return blocks[topoHeight], nil
+	}
+
+	node := &fakeNode{}
+	url := node.serve(t).URL
+	indexer := &chain.Indexer{NodeEndpoint: url, From: 1, Transactions: transactions}
+
+	// minted, then put up for sale
+	node.set(1, minter)
+	if err := indexer.Poll(); err != nil {
+		t.Fatalf("Failed to poll: %v", err)
+	}
+	node.set(2, minter)
+	node.setExtra(map[string]interface{}{"scBalance": float64(1), "listType": hex.EncodeToString([]byte(dero.ListSale))})
+	if err := indexer.Poll(); err != nil {
+		t.Fatalf("Failed to poll: %v", err)
+	}
+	if sales, _ := database.GetSales(); len(sales) != 0 {
+		t.Fatalf("Expected no sale from listing, but got: %+v", sales)
+	}
+
+	// bought
+	node.set(3, buyer)
+	node.setExtra(map[string]interface{}{"previousSalePrice": float64(1000)})
+	if err := indexer.Poll(); err != nil {
+		t.Fatalf("Failed to poll: %v", err)
+	}
+	sales, err := database.GetSales()
+	if err != nil {
+		t.Fatalf("Failed to list sales: %v", err)
+	}
+	if len(sales) != 1 {
+		t.Fatalf("Expected one sale, but got: %+v", sales)
+	}
+	sale := sales[0]
+	if sale.TXID != "bought" || sale.Height != 3 || !sale.Time.Equal(sold) {
+		t.Errorf("Expected the sale in bought at 3, but got: %+v", sale)
+	}
+	if sale.Seller != minter || sale.Buyer != buyer || sale.Price != 1000 || sale.Royalty != 50 || sale.ArtificerFee != 10 {
+		t.Errorf("Expected the minter to sell to the buyer for 1000, but got: %+v", sale)
+	}
+}
+
+func TestIndexerCatchesUpOnPastSales(t *testing.T) {
+	config.EnvPath = "../../.env.test"
+	if err := database.Initialize(config.Server{DatabasePath: t.TempDir(), Environment: "test"}); err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+
+	contract, err := dero.NFAContract(dero.NFA{Name: "sunset", Collection: "seascapes", Owner: minter, Creator: minter})
+	if err != nil {
+		t.Fatalf("Failed to render contract: %v", err)
+	}
+	nfa := strings.Repeat("a", 64)
+	blocks := map[int64][]dero.SCTransaction{
+		1: {{TXID: nfa, SCID: nfa, Install: true, Code: contract}},
+		2: {{TXID: "listed", SCID: nfa}},
+		3: {{TXID: "bought", SCID: nfa}},
+		4: {{TXID: "relisted", SCID: nfa}},
+		5: {{TXID: "bought back", SCID: nfa}},
+	}
+	transactions := func(endpoint string, topoHeight int64) ([]dero.SCTransaction, error) {
+		return blocks[topoHeight], nil
+	}
+	listed := hex.EncodeToString([]byte(dero.ListSale))
+
+	// the whole story happens before the indexer gets to look
+	node := &fakeNode{}
+	node.set(1, minter)
+	node.set(2, minter)
+	node.setExtra(map[string]interface{}{"scBalance": float64(1), "listType": listed})
+	node.set(3, buyer)
+	node.setExtra(map[string]interface{}{"previousSalePrice": float64(1000)})
+	node.set(4, buyer)
+	node.setExtra(map[string]interface{}{"scBalance": float64(1), "listType": listed, "previousSalePrice": float64(1000)})
+	node.set(5, minter)
+	node.setExtra(map[string]interface{}{"previousSalePrice": float64(3000)})
+
+	indexer := &chain.Indexer{NodeEndpoint: node.serve(t).URL, From: 1, Transactions: transactions}
+	if err := indexer.Poll(); err != nil {
+		t.Fatalf("Failed to poll: %v", err)
+	}
+
+	sales, err := database.GetSales()
+	if err != nil {
+		t.Fatalf("Failed to list sales: %v", err)
+	}
+	sort.Slice(sales, func(i, j int) bool { return sales[i].Height < sales[j].Height })
+	if len(sales) != 2 {
+		t.Fatalf("Expected both sales, but got: %+v", sales)
+	}
+	if sale := sales[0]; sale.TXID != "bought" || sale.Seller != minter || sale.Buyer != buyer || sale.Price != 1000 {
+		t.Errorf("Expected the minter to sell to the buyer for 1000 at 3, but got: %+v", sale)
+	}
+	if sale := sales[1]; sale.TXID != "bought back" || sale.Seller != buyer || sale.Buyer != minter || sale.Price != 3000 {
+		t.Errorf("Expected the buyer to sell back for 3000 at 5, but got: %+v", sale)
+	}
+
+	indexed, err := database.GetNFA(nfa)
+	if err != nil || indexed == nil || indexed.Owner != minter || indexed.UpdatedHeight != 5 {
+		t.Errorf("Expected the token back with the minter at 5, but got: %+v (%v)", indexed, err)
+	}
+}
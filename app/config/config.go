@@ -4,6 +4,7 @@ import (
 	"flag"
 	"fmt"
 	"log"
+	"log/slog"
 	"os"
 	"os/exec"
 	"strconv"
@@ -17,33 +18,62 @@ import (
 
 // Config struct to hold configuration parameters
 type Server struct {
-	Port           int
-	Environment    string
-	DatabasePath   string
-	EnvPath        string
-	NodeEndpoint   string
-	WalletEndpoint string
-	AppName        string
-	DevAddress     string
-	Domain         string
+	Port              int
+	Environment       string
+	DatabasePath      string
+	EnvPath           string
+	NodeEndpoint      string
+	WalletEndpoint    string
+	AppName           string
+	DevAddress        string
+	Domain            string
+	RevisionRetention int
+	TrashRetention    time.Duration
+	AuditAnchor       time.Duration
+	LogLevel          string
+	LogFormat         string
+	LogBodyLimit      int
+	MetricsAddr       string
+	SCCacheTTL        time.Duration
+	WebhookAttempts   int
+	IndexFrom         int64
+	FileCheckInterval time.Duration
+	MessageRate       int
+	MessageFeeCap     uint64
+	AllowPrivateHosts bool
 }
 
 const ()
 
 var (
-	Domain         string
-	NodeEndpoint   string
-	WalletEndpoint string
-	Environment    string
-	Port           int
-	ProjectDir     = "./"
-	EnvPath        string
-	DatabaseDir    string
-	DeroAddress    *rpc.Address
-	ServerWallet   rpc.GetAddress_Result
-	DevAddress     string
-	AppName        string
-	SimulatorDir   string
+	Domain            string
+	NodeEndpoint      string
+	WalletEndpoint    string
+	Environment       string
+	Port              int
+	ProjectDir        = "./"
+	EnvPath           string
+	DatabaseDir       string
+	DeroAddress       *rpc.Address
+	ServerWallet      rpc.GetAddress_Result
+	DevAddress        string
+	AppName           string
+	SimulatorDir      string
+	RevisionRetention int           // revisions kept per item, 0 keeps all
+	TrashRetention    time.Duration // how long deleted records stay in the trash
+	AuditAnchor       time.Duration // how often the audit chain head goes on-chain, 0 never
+	VerifyAudit       bool          // verify the audit chain and exit
+	LogLevel          string        // debug, info, warn or error
+	LogFormat         string        // text or json
+	LogBodyLimit      int           // bytes of a request or response body logged, 0 logs none
+	MetricsAddr       string        // where /metrics listens, empty turns it off
+	SCCacheTTL        time.Duration // how long smart-contract state is cached, 0 turns it off
+	WebhookAttempts   int           // how many times a webhook delivery is tried before it fails
+	IndexFrom         int64         // topoheight a fresh NFA index scans from, below zero the current block
+	FileCheckInterval time.Duration // how often NFA files are checked against their tokens, 0 turns it off
+	MessageRate       int           // messages a sender may leave per hour, 0 turns messaging off
+	MessageFeeCap     uint64        // most the server wallet pays in fees to send a message, in atomic units
+	AllowPrivateHosts bool          // let webhooks and NFA files live on loopback, private or link-local addresses
 )
 
 // Config func to get env value from key
@@ -87,6 +117,81 @@ var (
 		false, //default
 		"run in simulator",
 	)
+	revisionsFlag = flag.Int(
+		"revisions",
+		10, //default
+		"revisions kept per item, 0 keeps all",
+	)
+	trashFlag = flag.Duration(
+		"trash-retention",
+		30*24*time.Hour, //default
+		"how long deleted items and users stay in the trash",
+	)
+	anchorFlag = flag.Duration(
+		"audit-anchor",
+		0, //default
+		"how often the audit chain head is anchored on-chain, 0 never",
+	)
+	verifyAuditFlag = flag.Bool(
+		"verify-audit",
+		false, //default
+		"verify the audit chain and exit",
+	)
+	logLevelFlag = flag.String(
+		"log-level",
+		"info", //default
+		"log level: debug, info, warn or error",
+	)
+	logFormatFlag = flag.String(
+		"log-format",
+		"text", //default
+		"log format: text or json",
+	)
+	logBodyFlag = flag.Int(
+		"log-body-limit",
+		1024, //default
+		"bytes of request and response bodies logged at debug level, 0 logs none",
+	)
+	metricsFlag = flag.String(
+		"metrics-addr",
+		"127.0.0.1:2112", //default
+		"address /metrics listens on, empty turns it off",
+	)
+	scCacheFlag = flag.Duration(
+		"sc-cache-ttl",
+		30*time.Second, //default
+		"how long smart-contract state is cached, 0 turns it off",
+	)
+	webhookFlag = flag.Int(
+		"webhook-attempts",
+		8, //default
+		"how many times a webhook delivery is tried before it is marked failed",
+	)
+	indexFromFlag = flag.Int64(
+		"index-from",
+		-1, //default
+		"topoheight a fresh NFA index starts scanning from, -1 for the current block",
+	)
+	fileCheckFlag = flag.Duration(
+		"file-check-interval",
+		6*time.Hour, //default
+		"how often NFA files are checked against their tokens, 0 turns it off",
+	)
+	messageRateFlag = flag.Int(
+		"message-rate",
+		5, //default
+		"messages a sender may leave in an inbox per hour, 0 turns messaging off",
+	)
+	messageFeeFlag = flag.Uint64(
+		"message-fee-cap",
+		1000, //default
+		"most the server wallet pays in fees to send a message, in atomic units",
+	)
+	privateHostsFlag = flag.Bool(
+		"allow-private-hosts",
+		false, //default
+		"let webhooks and NFA files live on loopback, private or link-local addresses",
+	)
 )
 
 var delay = 2 * time.Second // Delay for simulator startup
@@ -99,6 +204,22 @@ func Initialize() Server {
 	Environment = *envFlag
 	Port = *portFlag
 	DatabaseDir = *dbFlag
+	RevisionRetention = *revisionsFlag
+	TrashRetention = *trashFlag
+	AuditAnchor = *anchorFlag
+	VerifyAudit = *verifyAuditFlag
+	LogLevel = *logLevelFlag
+	LogFormat = *logFormatFlag
+	LogBodyLimit = *logBodyFlag
+	MetricsAddr = *metricsFlag
+	SCCacheTTL = *scCacheFlag
+	WebhookAttempts = *webhookFlag
+	IndexFrom = *indexFromFlag
+	FileCheckInterval = *fileCheckFlag
+	MessageRate = *messageRateFlag
+	MessageFeeCap = *messageFeeFlag
+	AllowPrivateHosts = *privateHostsFlag
+	configureLogger()
 	SimulatorDir = "./vendors/derohe/cmd/simulator"
 
 	// Common initialization steps
@@ -126,17 +247,61 @@ func Initialize() Server {
 
 	// Create and return the server configuration
 	return Server{
-		Port:         Port,
-		Environment:  Environment,
-		DatabasePath: DatabaseDir,
-		EnvPath:      EnvPath,
-		NodeEndpoint: NodeEndpoint,
-		DevAddress:   DevAddress,
-		AppName:      AppName,
-		Domain:       Domain,
+		Port:              Port,
+		Environment:       Environment,
+		DatabasePath:      DatabaseDir,
+		EnvPath:           EnvPath,
+		NodeEndpoint:      NodeEndpoint,
+		DevAddress:        DevAddress,
+		AppName:           AppName,
+		Domain:            Domain,
+		RevisionRetention: RevisionRetention,
+		TrashRetention:    TrashRetention,
+		AuditAnchor:       AuditAnchor,
+		LogLevel:          LogLevel,
+		LogFormat:         LogFormat,
+		LogBodyLimit:      LogBodyLimit,
+		MetricsAddr:       MetricsAddr,
+		SCCacheTTL:        SCCacheTTL,
+		WebhookAttempts:   WebhookAttempts,
+		IndexFrom:         IndexFrom,
+		FileCheckInterval: FileCheckInterval,
+		MessageRate:       MessageRate,
+		MessageFeeCap:     MessageFeeCap,
+		AllowPrivateHosts: AllowPrivateHosts,
 	}
 }
 
+// SiteURL is the address the site is reached at, for links that leave it
+func SiteURL() string {
+	if Environment == "prod" {
+		return "https://" + Domain
+	}
+	return fmt.Sprintf("http://%s:%d", Domain, Port)
+}
+
+// configureLogger sets the default slog logger from the log flags;
+// the standard log package writes through it too
+func configureLogger() {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(LogLevel)); err != nil {
+		log.Printf("Unknown log level %q, using info", LogLevel)
+		level = slog.LevelInfo
+	}
+
+	options := &slog.HandlerOptions{Level: level}
+
+	var handler slog.Handler
+	switch LogFormat {
+	case "json":
+		handler = slog.NewJSONHandler(os.Stderr, options)
+	default:
+		handler = slog.NewTextHandler(os.Stderr, options)
+	}
+
+	slog.SetDefault(slog.New(handler))
+}
+
 func initializeForTest() {
 	Port = 3000
 	Environment = "test"
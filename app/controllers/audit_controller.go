@@ -0,0 +1,137 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/deroproject/derohe/rpc"
+	"github.com/secretnamebasis/secret-site/app/config"
+	"github.com/secretnamebasis/secret-site/app/database"
+	"github.com/secretnamebasis/secret-site/app/integrations/dero"
+	"github.com/secretnamebasis/secret-site/app/models"
+)
+
+// actorSystem is the actor for changes nobody asked for, like the trash purge
+const actorSystem = "system"
+
+// ErrAuditAnchored is returned when nothing was logged since the last anchor
+var ErrAuditAnchored = errors.New("audit chain is already anchored")
+
+// AuditLog retrieves the audit entries, oldest first, keeping only
+// those that match the non-empty filters.
+func AuditLog(actor, action, resource string) ([]models.AuditEntry, error) {
+	entries, err := database.GetAuditEntries()
+	if err != nil {
+		return nil, err
+	}
+
+	var matches []models.AuditEntry
+	for _, entry := range entries {
+		if actor != "" && entry.Actor != actor {
+			continue
+		}
+		if action != "" && entry.Action != action {
+			continue
+		}
+		if resource != "" && entry.Resource != resource {
+			continue
+		}
+		matches = append(matches, entry)
+	}
+	return matches, nil
+}
+
+// VerifyAudit walks the whole audit chain and returns an
+// *models.AuditChainError for the first broken link.
+func VerifyAudit() (int, error) {
+	entries, err := database.GetAuditEntries()
+	if err != nil {
+		return 0, err
+	}
+	return len(entries), models.VerifyAuditChain(entries)
+}
+
+// AnchorAudit writes the head of the audit chain on-chain, as a comment sent
+// to the DEV_ADDRESS, so the chain can't be rewritten without it showing.
+func AnchorAudit() (rpc.Transfer_Result, error) {
+	entries, err := database.GetAuditEntries()
+	if err != nil {
+		return rpc.Transfer_Result{}, err
+	}
+	if len(entries) == 0 {
+		return rpc.Transfer_Result{}, errors.New("audit log is empty")
+	}
+
+	// there is no point anchoring a chain that is already broken
+	if err := models.VerifyAuditChain(entries); err != nil {
+		return rpc.Transfer_Result{}, err
+	}
+
+	// nothing new to anchor since the last time
+	head := entries[len(entries)-1]
+	if head.Action == "anchor" {
+		return rpc.Transfer_Result{}, ErrAuditAnchored
+	}
+
+	result, err := dero.Comment(
+		config.WalletEndpoint,
+		fmt.Sprintf("audit:%d:%s", head.ID, head.Hash),
+		config.Env(config.EnvPath, "DEV_ADDRESS"),
+		"", // in DERO
+		0,  // at whatever fee the wallet works out
+	)
+	if err != nil {
+		return rpc.Transfer_Result{}, err
+	}
+
+	// the anchor goes in the chain too, with its txid as the after hash
+	entry := models.AuditEntry{
+		Actor:      actorSystem,
+		Action:     "anchor",
+		Resource:   "audit",
+		ResourceID: head.ID,
+		BeforeHash: head.Hash,
+		AfterHash:  result.TXID,
+		Timestamp:  time.Now(),
+	}
+	if err := database.AppendAuditEntry(&entry); err != nil {
+		return result, err
+	}
+
+	return result, nil
+}
+
+// RunAuditAnchor anchors the audit chain at every interval; run it in a goroutine of its own.
+func RunAuditAnchor(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if _, err := AnchorAudit(); err != nil && !errors.Is(err, ErrAuditAnchored) {
+			log.Printf("Error anchoring audit log: %v", err)
+		}
+	}
+}
+
+// private functions
+
+// audit appends a mutation to the audit chain; a record that doesn't exist
+// on one side of the change, like before a create, is passed as nil
+func audit(actor, action, resource string, id int, before, after interface{}) {
+	entry := models.AuditEntry{
+		Actor:      actor,
+		Action:     action,
+		Resource:   resource,
+		ResourceID: id,
+		BeforeHash: models.HashRecord(before),
+		AfterHash:  models.HashRecord(after),
+		Timestamp:  time.Now(),
+	}
+
+	// the change is already made, so failing to log it shouldn't undo it
+	if err := database.AppendAuditEntry(&entry); err != nil {
+		log.Printf("Error appending audit entry: %v", err)
+	}
+}
@@ -0,0 +1,74 @@
+package controllers_test
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/deroproject/derohe/rpc"
+	"github.com/secretnamebasis/secret-site/app/config"
+	"github.com/secretnamebasis/secret-site/app/controllers"
+	"github.com/secretnamebasis/secret-site/app/models"
+)
+
+func TestAnchorAuditOnlyWhatIsNew(t *testing.T) {
+	var params rpc.Transfer_Params
+	config.WalletEndpoint = fakeWallet(t, strings.Repeat("ac", 32), &params).URL
+
+	item := storedItem(t, "Anchored", "On chain", alice.Name, false)
+	if err := controllers.DeleteItem(strconv.Itoa(item.ID), alice); err != nil {
+		t.Fatalf("Failed to delete the item: %v", err)
+	}
+	if _, err := controllers.AnchorAudit(); err != nil {
+		t.Fatalf("Failed to anchor the audit log: %v", err)
+	}
+
+	// nothing was logged since, so there is nothing to anchor
+	params = rpc.Transfer_Params{}
+	if _, err := controllers.AnchorAudit(); !errors.Is(err, controllers.ErrAuditAnchored) {
+		t.Errorf("Expected ErrAuditAnchored, but got %v", err)
+	}
+	if len(params.Transfers) != 0 {
+		t.Errorf("Expected nothing sent, but got: %+v", params)
+	}
+
+	if _, err := controllers.RestoreItem(strconv.Itoa(item.ID), carol.Name); err != nil {
+		t.Fatalf("Failed to restore the item: %v", err)
+	}
+	if _, err := controllers.AnchorAudit(); err != nil {
+		t.Errorf("Expected the new entry anchored, but got %v", err)
+	}
+}
+
+func TestAuditActorsAreAuthenticated(t *testing.T) {
+	item := storedItem(t, "Impersonated", "Mine", alice.Name, false)
+	id := strconv.Itoa(item.ID)
+
+	// a name alone doesn't make the actor
+	forged := models.JSON_User_Order{Name: alice.Name, Password: "guess"}
+	if err := controllers.DeleteItem(id, forged); !errors.Is(err, controllers.ErrForbidden) {
+		t.Errorf("Expected ErrForbidden deleting as a forged alice, but got %v", err)
+	}
+	if err := controllers.DeleteUser(strconv.Itoa(userID(t, bob.Name)), forged); !errors.Is(err, controllers.ErrForbidden) {
+		t.Errorf("Expected ErrForbidden deleting bob as a forged alice, but got %v", err)
+	}
+	if err := controllers.UpdateUser(models.JSON_User_Order{Name: alice.Name, Wallet: wallet, OldPassword: "guess"}); !errors.Is(err, controllers.ErrForbidden) {
+		t.Errorf("Expected ErrForbidden updating a forged alice, but got %v", err)
+	}
+	if _, err := controllers.GetItemByID(id); err != nil {
+		t.Errorf("Expected the item untouched, but got %v", err)
+	}
+
+	if err := controllers.DeleteItem(id, alice); err != nil {
+		t.Fatalf("Failed to delete the item: %v", err)
+	}
+	entries, err := controllers.AuditLog("", "delete", "items")
+	if err != nil {
+		t.Fatalf("Failed to read the audit log: %v", err)
+	}
+	last := entries[len(entries)-1]
+	if last.ResourceID != item.ID || last.Actor != alice.Name {
+		t.Errorf("Expected alice's deletion logged last, but got: %+v", last)
+	}
+}
@@ -0,0 +1,366 @@
+package controllers
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/secretnamebasis/secret-site/app/config"
+	"github.com/secretnamebasis/secret-site/app/database"
+	"github.com/secretnamebasis/secret-site/app/events"
+	"github.com/secretnamebasis/secret-site/app/integrations/dero"
+	"github.com/secretnamebasis/secret-site/app/metrics"
+	"github.com/secretnamebasis/secret-site/app/models"
+)
+
+// checkoutExpiry is how long a buyer has to pay
+const checkoutExpiry = 30 * time.Minute
+
+// refundResendAfter is how long a refund that may have gone out is looked
+// for in the wallet before it is sent again
+const refundResendAfter = time.Hour
+
+// refundMu keeps refunds from overlapping, wallet calls and all
+var refundMu sync.Mutex
+
+// checkoutMu keeps the payment watcher and the API from writing over each
+// other's changes to a checkout; whoever holds it reads the checkout again
+var checkoutMu sync.Mutex
+
+// CreateCheckout opens a checkout for an item, with an integrated address
+// to pay its price to.
+func CreateCheckout(itemID string, order models.JSON_Checkout_Order) (models.Checkout, error) {
+	if err := order.Validate(); err != nil {
+		return models.Checkout{}, err
+	}
+	buyer := order.User
+
+	item, err := getActiveItem(itemID)
+	if err != nil {
+		return models.Checkout{}, err
+	}
+
+	// buyers have to be able to see what they buy
+	if err := CanView(item, buyer); err != nil {
+		return models.Checkout{}, err
+	}
+	if item.Price == 0 {
+		return models.Checkout{}, errors.New("item is not for sale")
+	}
+
+	id, err := database.NextID(bucketCheckouts)
+	if err != nil {
+		return models.Checkout{}, err
+	}
+
+	paymentID, err := newPaymentID()
+	if err != nil {
+		return models.Checkout{}, err
+	}
+
+	decimals, err := dero.AssetDecimals(config.NodeEndpoint, item.PriceAsset)
+	if err != nil {
+		return models.Checkout{}, err
+	}
+
+	now := time.Now()
+	checkout := models.Checkout{
+		ID:         id,
+		ItemID:     item.ID,
+		Buyer:      buyer.Name,
+		PaymentID:  paymentID,
+		Amount:     item.Price,
+		Asset:      item.PriceAsset,
+		Decimals:   decimals,
+		Status:     models.CheckoutPending,
+		CreatedAt:  now,
+		Expiration: now.Add(checkoutExpiry),
+
+		RefundAddress: order.RefundAddress,
+	}
+
+	address, err := dero.MakeIntegratedAddress(
+		fmt.Sprintf("%s checkout %d: %s", config.Domain, checkout.ID, item.Title),
+		checkout.PaymentID,
+		checkout.Amount,
+		checkout.Asset,
+		checkout.Expiration,
+	)
+	if err != nil {
+		return models.Checkout{}, err
+	}
+	checkout.Address = address.Integrated_Address
+
+	if err := checkout.Validate(); err != nil {
+		return models.Checkout{}, err
+	}
+
+	if err := database.CreateRecord(bucketCheckouts, &checkout); err != nil {
+		return models.Checkout{}, err
+	}
+	audit(buyer.Name, "create", bucketCheckouts, checkout.ID, nil, checkout)
+	metrics.CheckoutsCreated.Inc()
+
+	return checkout, nil
+}
+
+// GetCheckout retrieves a checkout, for its buyer or the item's owner;
+// guest checkouts are open to whoever holds their ID.
+func GetCheckout(id string, viewer models.JSON_User_Order) (models.Checkout, error) {
+	var checkout models.Checkout
+	if err := database.GetRecordByID(bucketCheckouts, id, &checkout); err != nil {
+		return models.Checkout{}, err
+	}
+
+	if checkout.Buyer == "" {
+		return checkout, nil
+	}
+
+	if checkout.Buyer == viewer.Name && authenticateUser(viewer) == nil {
+		return checkout, nil
+	}
+
+	var item models.Item
+	if err := database.GetRecordByID(bucketItems, strconv.Itoa(checkout.ItemID), &item); err != nil {
+		return models.Checkout{}, err
+	}
+	if err := authorizeOwner(item, viewer); err != nil {
+		return models.Checkout{}, err
+	}
+	return checkout, nil
+}
+
+// UpdateCheckout changes where a checkout's refunds go; only its buyer may,
+// so guest checkouts keep the address they were opened with
+func UpdateCheckout(id string, order models.JSON_Checkout_Order) (models.Checkout, error) {
+	if err := order.Validate(); err != nil {
+		return models.Checkout{}, err
+	}
+
+	checkoutMu.Lock()
+	defer checkoutMu.Unlock()
+
+	var checkout models.Checkout
+	if err := database.GetRecordByID(bucketCheckouts, id, &checkout); err != nil {
+		return models.Checkout{}, err
+	}
+	if checkout.Buyer == "" || checkout.Buyer != order.User.Name || authenticateUser(order.User) != nil {
+		return models.Checkout{}, ErrForbidden
+	}
+
+	before := checkout
+	checkout.RefundAddress = order.RefundAddress
+	if err := database.CreateRecord(bucketCheckouts, &checkout); err != nil {
+		return models.Checkout{}, err
+	}
+	audit(order.User.Name, "update", bucketCheckouts, checkout.ID, before, checkout)
+	return checkout, nil
+}
+
+// RefundCheckout sends back what a checkout is owed: the excess when it
+// was overpaid, everything when it was paid short, too late or not at all
+// in time. The item's owner or an admin may; refunding again sends nothing
+// more. The refund is saved before it is sent, so one that may have gone
+// out is looked for in the wallet's transfers rather than sent twice.
+func RefundCheckout(id string, viewer models.JSON_User_Order) (models.Checkout, error) {
+	// one refund at a time, so two requests can't both send one
+	refundMu.Lock()
+	defer refundMu.Unlock()
+
+	var checkout models.Checkout
+	if err := database.GetRecordByID(bucketCheckouts, id, &checkout); err != nil {
+		return models.Checkout{}, err
+	}
+	if err := authorizeRefund(checkout, viewer); err != nil {
+		return models.Checkout{}, err
+	}
+
+	// a refund that was saved but not seen through is finished first
+	if i := checkout.SendingRefund(); i >= 0 {
+		return resumeRefund(checkout, i, viewer)
+	}
+
+	checkout, err := startRefund(checkout.ID, viewer)
+	if err != nil {
+		return models.Checkout{}, err
+	}
+	i := checkout.SendingRefund()
+	if i < 0 {
+		return checkout, nil
+	}
+	return sendRefund(checkout, i, viewer)
+}
+
+// private functions
+
+// resumeRefund finishes the refund at index i of a checkout, which was
+// saved before it was sent: found among the wallet's transfers, it went
+// out; not found after refundResendAfter, it never will and is sent again
+func resumeRefund(checkout models.Checkout, i int, viewer models.JSON_User_Order) (models.Checkout, error) {
+	refund := checkout.Refunds[i]
+	entries, err := dero.GetOutgoingTransfers(config.WalletEndpoint, checkout.Asset, 0)
+	if err != nil {
+		return models.Checkout{}, err
+	}
+	for _, entry := range entries {
+		if comment, ok := dero.CommentOf(entry); ok && strings.Contains(comment, refund.Nonce) {
+			return refundSent(checkout, i, entry.TXID, viewer)
+		}
+	}
+
+	if time.Since(refund.At) < refundResendAfter {
+		return models.Checkout{}, fmt.Errorf("refund %s of checkout %d may still be on its way, try again later", refund.Nonce, checkout.ID)
+	}
+	log.Printf("Refund %s of checkout %d never showed up in the wallet, sending it again", refund.Nonce, checkout.ID)
+	return sendRefund(checkout, i, viewer)
+}
+
+// startRefund saves the refund of what a checkout is owed, about to be
+// sent; nothing is saved when nothing is due
+func startRefund(id int, viewer models.JSON_User_Order) (models.Checkout, error) {
+	checkoutMu.Lock()
+	defer checkoutMu.Unlock()
+
+	var checkout models.Checkout
+	if err := database.GetRecordByID(bucketCheckouts, strconv.Itoa(id), &checkout); err != nil {
+		return models.Checkout{}, err
+	}
+	due := checkout.RefundDue()
+	if due == 0 {
+		return checkout, nil
+	}
+	to := checkout.RefundTo()
+	if to == "" {
+		return models.Checkout{}, errors.New("no address to refund to, the buyer has to give one")
+	}
+	nonce, err := newRefundNonce()
+	if err != nil {
+		return models.Checkout{}, err
+	}
+
+	before := checkout
+	checkout.Refunds = append(checkout.Refunds, models.CheckoutRefund{
+		Address: to,
+		Amount:  due,
+		By:      viewer.Name,
+		At:      time.Now(),
+		Nonce:   nonce,
+		State:   models.RefundSending,
+	})
+	if err := database.CreateRecord(bucketCheckouts, &checkout); err != nil {
+		return models.Checkout{}, err
+	}
+	audit(viewer.Name, "refunding", bucketCheckouts, checkout.ID, before, checkout)
+	return checkout, nil
+}
+
+// sendRefund sends the refund at index i of a checkout, under its nonce;
+// when the wallet fails, the refund stays saved as being sent
+func sendRefund(checkout models.Checkout, i int, viewer models.JSON_User_Order) (models.Checkout, error) {
+	refund := checkout.Refunds[i]
+	result, err := dero.Send(
+		config.WalletEndpoint,
+		refund.Address,
+		checkout.Asset,
+		refund.Amount,
+		fmt.Sprintf("%s refund %s for checkout %d", config.Domain, refund.Nonce, checkout.ID),
+	)
+	if err != nil {
+		return models.Checkout{}, err
+	}
+	return refundSent(checkout, i, result.TXID, viewer)
+}
+
+// refundSent records that the refund at index i of a checkout went out
+// in txid, and works out where that leaves the checkout
+func refundSent(sent models.Checkout, i int, txid string, viewer models.JSON_User_Order) (models.Checkout, error) {
+	checkoutMu.Lock()
+	defer checkoutMu.Unlock()
+
+	// payments may have come in while the refund went out
+	var checkout models.Checkout
+	if err := database.GetRecordByID(bucketCheckouts, strconv.Itoa(sent.ID), &checkout); err != nil {
+		return models.Checkout{}, err
+	}
+	nonce := sent.Refunds[i].Nonce
+	i = slices.IndexFunc(checkout.Refunds, func(refund models.CheckoutRefund) bool {
+		return refund.Nonce == nonce
+	})
+	if i < 0 {
+		return models.Checkout{}, fmt.Errorf("refund %s of checkout %d is gone", nonce, sent.ID)
+	}
+
+	before := checkout
+	checkout.Refunds = append([]models.CheckoutRefund{}, checkout.Refunds...)
+	checkout.Refunds[i].TXID = txid
+	checkout.Refunds[i].State = models.RefundSent
+	switch {
+	case checkout.RefundDue() > 0:
+		// what came in meanwhile is still due back
+	case checkout.IsSettled():
+		// a sale stands once its excess is back
+		checkout.Status = models.CheckoutPaid
+	default:
+		// anything else is undone
+		checkout.Status = models.CheckoutRefunded
+	}
+	if err := database.CreateRecord(bucketCheckouts, &checkout); err != nil {
+		return models.Checkout{}, err
+	}
+	audit(viewer.Name, "refund", bucketCheckouts, checkout.ID, before, checkout)
+	metrics.RefundsSent.Inc()
+	publishCheckout(events.CheckoutRefunded, checkout)
+
+	return checkout, nil
+}
+
+// authorizeRefund lets the owner of the checkout's item, or an admin, refund it
+func authorizeRefund(checkout models.Checkout, user models.JSON_User_Order) error {
+	if err := authenticateUser(user); err != nil {
+		return ErrForbidden
+	}
+
+	var item models.Item
+	if err := database.GetRecordByID(bucketItems, strconv.Itoa(checkout.ItemID), &item); err == nil && item.Owner == user.Name {
+		return nil
+	}
+
+	account, err := GetUserByName(user.Name)
+	if err != nil {
+		return err
+	}
+	if !account.IsAdmin() {
+		return ErrForbidden
+	}
+	return nil
+}
+
+// newRefundNonce makes the random tag a refund's comment carries
+func newRefundNonce() (string, error) {
+	var b [8]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b[:]), nil
+}
+
+// newPaymentID picks a random destination port, never 0
+func newPaymentID() (uint64, error) {
+	for {
+		var b [8]byte
+		if _, err := rand.Read(b[:]); err != nil {
+			return 0, err
+		}
+		if id := binary.BigEndian.Uint64(b[:]); id != 0 {
+			return id, nil
+		}
+	}
+}
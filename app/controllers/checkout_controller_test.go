@@ -0,0 +1,565 @@
+package controllers_test
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/deroproject/derohe/rpc"
+	"github.com/secretnamebasis/secret-site/app/chain"
+	"github.com/secretnamebasis/secret-site/app/config"
+	"github.com/secretnamebasis/secret-site/app/controllers"
+	"github.com/secretnamebasis/secret-site/app/database"
+	"github.com/secretnamebasis/secret-site/app/events"
+	"github.com/secretnamebasis/secret-site/app/models"
+)
+
+// watchPayments starts the payment watcher once for all tests
+var watchPayments sync.Once
+
+// fakeCheckoutWallet makes integrated addresses, signs as the issuer, and
+// records the transfers it is asked to send
+func fakeCheckoutWallet(t *testing.T, sent *[]rpc.Transfer) *httptest.Server {
+	var mu sync.Mutex
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			ID     int             `json:"id"`
+			Method string          `json:"method"`
+			Params json.RawMessage `json:"params"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			t.Errorf("Failed to decode request: %v", err)
+		}
+
+		var result interface{}
+		switch request.Method {
+		case "MakeIntegratedAddress":
+			result = rpc.Make_Integrated_Address_Result{Integrated_Address: "deroi1checkout"}
+		case "GetAddress":
+			result = rpc.GetAddress_Result{Address: issuer}
+		case "SignData":
+			var data []byte
+			json.Unmarshal(request.Params, &data)
+			result = signMessage(data)
+		case "transfer":
+			var params rpc.Transfer_Params
+			json.Unmarshal(request.Params, &params)
+			mu.Lock()
+			*sent = append(*sent, params.Transfers...)
+			result = rpc.Transfer_Result{TXID: "refund" + strconv.Itoa(len(*sent))}
+			mu.Unlock()
+		default:
+			t.Errorf("Unexpected call to %s", request.Method)
+		}
+
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"jsonrpc": "2.0",
+			"id":      request.ID,
+			"result":  result,
+		})
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// openCheckout lists an item of alice's at 1000 and opens a checkout for bob
+func openCheckout(t *testing.T, title string, sent *[]rpc.Transfer) models.Checkout {
+	t.Helper()
+	return openCheckoutIn(t, title, "", sent)
+}
+
+// openCheckoutIn is openCheckout with the price in the token asset, DERO
+// when empty
+func openCheckoutIn(t *testing.T, title, asset string, sent *[]rpc.Transfer) models.Checkout {
+	t.Helper()
+	var params rpc.Transfer_Params
+	config.WalletEndpoint = fakeWallet(t, fmt.Sprintf("%x", sha256.Sum256([]byte(title))), &params).URL
+	item, err := controllers.MintNFA(models.JSON_NFA_Order{
+		Title:       title,
+		Description: "For sale",
+		Image:       base64.StdEncoding.EncodeToString([]byte("image")),
+		Price:       1000,
+		PriceAsset:  asset,
+		User:        alice,
+	})
+	if err != nil {
+		t.Fatalf("Failed to mint: %v", err)
+	}
+
+	config.WalletEndpoint = fakeCheckoutWallet(t, sent).URL
+	checkout, err := controllers.CreateCheckout(strconv.Itoa(item.ID), models.JSON_Checkout_Order{User: bob})
+	if err != nil {
+		t.Fatalf("Failed to open a checkout: %v", err)
+	}
+	return checkout
+}
+
+// pay hands a transfer to the checkout over as the chain follower would,
+// and checks it was recorded
+func pay(t *testing.T, checkout models.Checkout, txid string, amount uint64, at time.Time) models.Checkout {
+	t.Helper()
+	entry := rpc.Entry{
+		TXID:            txid,
+		Amount:          amount,
+		DestinationPort: checkout.PaymentID,
+		Sender:          wallet,
+		Time:            at,
+	}
+	if err := controllers.ReceiveTransfer(entry, checkout.Asset); err != nil {
+		t.Fatalf("Failed to receive %s: %v", txid, err)
+	}
+
+	current, err := controllers.GetCheckout(strconv.Itoa(checkout.ID), bob)
+	if err != nil {
+		t.Fatalf("Failed to get checkout: %v", err)
+	}
+	for _, payment := range current.Payments {
+		if payment.TXID == txid {
+			return current
+		}
+	}
+	t.Fatalf("Expected %s recorded against checkout %d", txid, checkout.ID)
+	return models.Checkout{}
+}
+
+func TestCheckoutUnderpaidRefund(t *testing.T) {
+	var sent []rpc.Transfer
+	checkout := openCheckout(t, "Paid short", &sent)
+	id := strconv.Itoa(checkout.ID)
+
+	checkout = pay(t, checkout, "short", 400, time.Now())
+	if checkout.Status != models.CheckoutUnderpaid || checkout.RefundDue() != 400 {
+		t.Fatalf("Expected the checkout underpaid with 400 due, but got: %+v", checkout)
+	}
+
+	// only the item's owner or an admin may refund
+	if _, err := controllers.RefundCheckout(id, bob); !errors.Is(err, controllers.ErrForbidden) {
+		t.Errorf("Expected ErrForbidden for the buyer, but got %v", err)
+	}
+
+	refunded, err := controllers.RefundCheckout(id, alice)
+	if err != nil {
+		t.Fatalf("Failed to refund: %v", err)
+	}
+	if refunded.Status != models.CheckoutRefunded || len(refunded.Refunds) != 1 {
+		t.Errorf("Expected the checkout refunded, but got: %+v", refunded)
+	}
+	if len(sent) != 1 || sent[0].Destination != wallet || sent[0].Amount != 400 {
+		t.Fatalf("Expected 400 sent back to the sender, but got: %+v", sent)
+	}
+
+	// refunding again sends nothing
+	again, err := controllers.RefundCheckout(id, carol)
+	if err != nil || len(sent) != 1 || len(again.Refunds) != 1 {
+		t.Errorf("Expected a second refund to change nothing, but got: %+v, %d sent (%v)", again, len(sent), err)
+	}
+
+	entries, err := controllers.AuditLog("", "refund", "checkouts")
+	if err != nil {
+		t.Fatalf("Failed to read the audit log: %v", err)
+	}
+	found := false
+	for _, entry := range entries {
+		found = found || (entry.ResourceID == checkout.ID && entry.Actor == alice.Name)
+	}
+	if !found {
+		t.Errorf("Expected alice's refund in the audit log, but got: %+v", entries)
+	}
+
+	// paying after that is late, and all of it is due back
+	checkout = pay(t, checkout, "after", 1000, time.Now())
+	if checkout.Status != models.CheckoutLate || checkout.RefundDue() != 1000 {
+		t.Errorf("Expected the checkout late with 1000 due, but got: %+v", checkout)
+	}
+}
+
+func TestCheckoutOverpaidRefund(t *testing.T) {
+	var sent []rpc.Transfer
+	checkout := openCheckout(t, "Paid over", &sent)
+
+	// the buyer would rather have the change elsewhere
+	refundTo := "dero1qyvqpdftj8r6005xs20rnflakmwa5pdxg9vcjzdcuywq2t8skqhvwqglt6x0g"
+	if _, err := controllers.UpdateCheckout(strconv.Itoa(checkout.ID), models.JSON_Checkout_Order{RefundAddress: refundTo, User: alice}); !errors.Is(err, controllers.ErrForbidden) {
+		t.Errorf("Expected ErrForbidden for someone else, but got %v", err)
+	}
+	if _, err := controllers.UpdateCheckout(strconv.Itoa(checkout.ID), models.JSON_Checkout_Order{RefundAddress: refundTo, User: bob}); err != nil {
+		t.Fatalf("Failed to set the refund address: %v", err)
+	}
+
+	checkout = pay(t, checkout, "over", 1500, time.Now())
+	if checkout.Status != models.CheckoutOverpaid || checkout.TXID != "over" || checkout.RefundDue() != 500 {
+		t.Fatalf("Expected the checkout overpaid with 500 due, but got: %+v", checkout)
+	}
+
+	refunded, err := controllers.RefundCheckout(strconv.Itoa(checkout.ID), carol)
+	if err != nil {
+		t.Fatalf("Failed to refund: %v", err)
+	}
+	// the sale stands
+	if refunded.Status != models.CheckoutPaid || refunded.RefundDue() != 0 {
+		t.Errorf("Expected the checkout paid once the excess is back, but got: %+v", refunded)
+	}
+	if len(sent) != 1 || sent[0].Destination != refundTo || sent[0].Amount != 500 {
+		t.Errorf("Expected 500 sent to the buyer's address, but got: %+v", sent)
+	}
+}
+
+func TestCheckoutPaidLate(t *testing.T) {
+	var sent []rpc.Transfer
+	checkout := openCheckout(t, "Paid late", &sent)
+
+	checkout = pay(t, checkout, "late", 1000, checkout.Expiration.Add(time.Minute))
+	if checkout.Status != models.CheckoutLate || checkout.RefundDue() != 1000 {
+		t.Errorf("Expected the checkout late with 1000 due, but got: %+v", checkout)
+	}
+}
+
+func TestCheckoutPaidInTimeAfterExpiring(t *testing.T) {
+	var sent []rpc.Transfer
+	checkout := openCheckout(t, "Paid before the sweep", &sent)
+	mined := time.Now().Add(-2 * time.Minute)
+
+	// the block it was mined in got swept for expired checkouts first
+	checkout.Expiration = mined.Add(time.Minute)
+	checkout.CreatedAt = checkout.Expiration.Add(-time.Hour)
+	checkout.Status = models.CheckoutExpired
+	if err := database.CreateRecord("checkouts", &checkout); err != nil {
+		t.Fatalf("Failed to save: %v", err)
+	}
+
+	checkout = pay(t, checkout, "mined in time", 1000, mined)
+	if checkout.Status != models.CheckoutPaid || checkout.TXID != "mined in time" || checkout.RefundDue() != 0 {
+		t.Errorf("Expected the checkout paid with nothing due, but got: %+v", checkout)
+	}
+}
+
+func TestCheckoutPaidConcurrently(t *testing.T) {
+	var sent []rpc.Transfer
+	checkout := openCheckout(t, "Paid in halves", &sent)
+
+	var wg sync.WaitGroup
+	for _, txid := range []string{"first half", "second half"} {
+		wg.Add(1)
+		go func(txid string) {
+			defer wg.Done()
+			entry := rpc.Entry{
+				TXID:            txid,
+				Amount:          500,
+				DestinationPort: checkout.PaymentID,
+				Sender:          wallet,
+				Time:            time.Now(),
+			}
+			if err := controllers.ReceiveTransfer(entry, ""); err != nil {
+				t.Errorf("Failed to receive %s: %v", txid, err)
+			}
+		}(txid)
+	}
+	wg.Wait()
+
+	current, err := controllers.GetCheckout(strconv.Itoa(checkout.ID), bob)
+	if err != nil {
+		t.Fatalf("Failed to get checkout: %v", err)
+	}
+	if len(current.Payments) != 2 || current.Status != models.CheckoutPaid {
+		t.Errorf("Expected both halves recorded and the checkout paid, but got: %+v", current)
+	}
+}
+
+// fakeRefundWallet fails every transfer while failing is set, and lists
+// the outgoing transfers in listed
+func fakeRefundWallet(t *testing.T, failing *atomic.Bool, listed *[]rpc.Entry, sent *[]rpc.Transfer) *httptest.Server {
+	var mu sync.Mutex
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			ID     int             `json:"id"`
+			Method string          `json:"method"`
+			Params json.RawMessage `json:"params"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			t.Errorf("Failed to decode request: %v", err)
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		response := map[string]interface{}{"jsonrpc": "2.0", "id": request.ID}
+		switch request.Method {
+		case "transfer":
+			var params rpc.Transfer_Params
+			json.Unmarshal(request.Params, &params)
+			*sent = append(*sent, params.Transfers...)
+			if failing.Load() {
+				response["error"] = map[string]interface{}{"code": -32098, "message": "connection reset"}
+			} else {
+				response["result"] = rpc.Transfer_Result{TXID: "refund" + strconv.Itoa(len(*sent))}
+			}
+		case "GetTransfers":
+			var params rpc.Get_Transfers_Params
+			json.Unmarshal(request.Params, &params)
+			if !params.Out || params.In {
+				t.Errorf("Expected only outgoing transfers asked for, but got: %+v", params)
+			}
+			response["result"] = rpc.Get_Transfers_Result{Entries: *listed}
+		default:
+			t.Errorf("Unexpected call to %s", request.Method)
+		}
+		json.NewEncoder(w).Encode(response)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestCheckoutRefundIsNotSentTwice(t *testing.T) {
+	var sent []rpc.Transfer
+	checkout := openCheckout(t, "Refunded once", &sent)
+	id := strconv.Itoa(checkout.ID)
+	pay(t, checkout, "once", 300, time.Now())
+
+	// the wallet may have sent it, though it didn't say so
+	var failing atomic.Bool
+	failing.Store(true)
+	var listed []rpc.Entry
+	config.WalletEndpoint = fakeRefundWallet(t, &failing, &listed, &sent).URL
+	if _, err := controllers.RefundCheckout(id, alice); err == nil {
+		t.Fatal("Expected the wallet's error")
+	}
+	saved, err := controllers.GetCheckout(id, bob)
+	if err != nil {
+		t.Fatalf("Failed to get checkout: %v", err)
+	}
+	if len(saved.Refunds) != 1 || !saved.Refunds[0].IsSending() || saved.Refunds[0].Nonce == "" || saved.RefundDue() != 0 {
+		t.Fatalf("Expected the refund saved as being sent, but got: %+v", saved.Refunds)
+	}
+	comment, _ := sent[0].Payload_RPC.Value(rpc.RPC_COMMENT, rpc.DataString).(string)
+	if !strings.Contains(comment, saved.Refunds[0].Nonce) {
+		t.Errorf("Expected the comment to carry nonce %s, but got %q", saved.Refunds[0].Nonce, comment)
+	}
+
+	// until it shows up in the wallet, it isn't sent again
+	failing.Store(false)
+	if _, err := controllers.RefundCheckout(id, alice); err == nil || len(sent) != 1 {
+		t.Errorf("Expected the refund left alone while it may be on its way, but got %d sent (%v)", len(sent), err)
+	}
+
+	listed = append(listed, rpc.Entry{TXID: "went-out", Amount: 300, Payload_RPC: sent[0].Payload_RPC})
+	refunded, err := controllers.RefundCheckout(id, alice)
+	if err != nil {
+		t.Fatalf("Failed to refund: %v", err)
+	}
+	if len(sent) != 1 || refunded.Status != models.CheckoutRefunded ||
+		refunded.Refunds[0].TXID != "went-out" || refunded.Refunds[0].State != models.RefundSent {
+		t.Errorf("Expected the refund found in the wallet, but got %d sent and: %+v", len(sent), refunded)
+	}
+}
+
+// fakeTokenNode answers DERO.GetSC with a token of 5 decimals
+func fakeTokenNode(t *testing.T) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			ID int `json:"id"`
+		}
+		json.NewDecoder(r.Body).Decode(&request)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"jsonrpc": "2.0",
+			"id":      request.ID,
+			"result": rpc.GetSC_Result{
+				Code:               "Function Initialize() Uint64\n10 RETURN 0\nEnd Function\n",
+				VariableStringKeys: map[string]interface{}{"decimals": float64(5)},
+			},
+		})
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// paymentAssets tells whether the follower would look for transfers of asset
+func paymentAssets(t *testing.T, asset string) bool {
+	t.Helper()
+	assets, err := controllers.PaymentAssets()
+	if err != nil {
+		t.Fatalf("Failed to get payment assets: %v", err)
+	}
+	for _, a := range assets {
+		if a == asset {
+			return true
+		}
+	}
+	return false
+}
+
+func TestTokenCheckoutToppedUp(t *testing.T) {
+	asset := strings.Repeat("a1", 32)
+	config.NodeEndpoint = fakeTokenNode(t).URL
+	var sent []rpc.Transfer
+	checkout := openCheckoutIn(t, "Topped up in tokens", asset, &sent)
+
+	checkout = pay(t, checkout, "first half", 500, time.Now())
+	if checkout.Status != models.CheckoutUnderpaid {
+		t.Fatalf("Expected the checkout underpaid, but got: %+v", checkout)
+	}
+	// the rest may still come in, so the token is still watched for
+	if !paymentAssets(t, asset) {
+		t.Errorf("Expected %s among the payment assets while underpaid", asset)
+	}
+
+	checkout = pay(t, checkout, "second half", 500, time.Now())
+	if checkout.Status != models.CheckoutPaid || checkout.TXID != "second half" || checkout.RefundDue() != 0 {
+		t.Errorf("Expected the checkout paid by the top-up, but got: %+v", checkout)
+	}
+	if paymentAssets(t, asset) {
+		t.Errorf("Expected %s no longer watched for once paid", asset)
+	}
+}
+
+func TestTokenCheckoutUnderpaidExpires(t *testing.T) {
+	asset := strings.Repeat("b2", 32)
+	config.NodeEndpoint = fakeTokenNode(t).URL
+	var sent []rpc.Transfer
+	checkout := openCheckoutIn(t, "Paid short in tokens", asset, &sent)
+	checkout = pay(t, checkout, "short of tokens", 400, time.Now())
+
+	// let it run out
+	checkout.Expiration = time.Now().Add(-time.Minute)
+	checkout.CreatedAt = checkout.Expiration.Add(-time.Hour)
+	if err := database.CreateRecord("checkouts", &checkout); err != nil {
+		t.Fatalf("Failed to save: %v", err)
+	}
+	watchPayments.Do(func() { go controllers.WatchPayments() })
+
+	id := strconv.Itoa(checkout.ID)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		events.Publish(events.Event{Type: events.BlockNew, Data: &rpc.BlockHeader_Print{}})
+		current, err := controllers.GetCheckout(id, bob)
+		if err != nil {
+			t.Fatalf("Failed to get checkout: %v", err)
+		}
+		if current.Status == models.CheckoutExpired {
+			checkout = current
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the underpaid checkout to expire, but got: %+v", current)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if paymentAssets(t, asset) {
+		t.Errorf("Expected %s no longer watched for once expired", asset)
+	}
+	// what came in goes back
+	if checkout.RefundDue() != 400 {
+		t.Errorf("Expected the 400 received due back, but got %d", checkout.RefundDue())
+	}
+	config.WalletEndpoint = fakeCheckoutWallet(t, &sent).URL
+	refunded, err := controllers.RefundCheckout(id, alice)
+	if err != nil {
+		t.Fatalf("Failed to refund: %v", err)
+	}
+	if refunded.Status != models.CheckoutRefunded || len(sent) != 1 || sent[0].Amount != 400 {
+		t.Errorf("Expected the 400 refunded, but got %+v sent and: %+v", sent, refunded)
+	}
+}
+
+// fakeFollowed answers the chain follower as both node and wallet, at the
+// given height, with the payment in the block after start
+func fakeFollowed(t *testing.T, height *atomic.Int64, start int64, payment rpc.Entry) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			ID     int             `json:"id"`
+			Method string          `json:"method"`
+			Params json.RawMessage `json:"params"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			t.Errorf("Failed to decode request: %v", err)
+		}
+
+		var result interface{}
+		switch request.Method {
+		case "DERO.GetInfo":
+			result = rpc.GetInfo_Result{Height: height.Load(), TopoHeight: height.Load()}
+		case "DERO.GetBlockHeaderByTopoHeight":
+			var params rpc.GetBlockHeaderByTopoHeight_Params
+			json.Unmarshal(request.Params, &params)
+			result = rpc.GetBlockHeaderByHeight_Result{
+				Block_Header: rpc.BlockHeader_Print{TopoHeight: int64(params.TopoHeight)},
+			}
+		case "GetTransfers":
+			var params rpc.Get_Transfers_Params
+			json.Unmarshal(request.Params, &params)
+			entries := []rpc.Entry{}
+			if int64(params.Min_Height) <= start+1 && height.Load() > start {
+				entries = append(entries, payment)
+			}
+			result = rpc.Get_Transfers_Result{Entries: entries}
+		}
+
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"jsonrpc": "2.0",
+			"id":      request.ID,
+			"result":  result,
+		})
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestCheckoutSettlesDespiteBlockFlood(t *testing.T) {
+	var sent []rpc.Transfer
+	checkout := openCheckout(t, "Paid in a flood", &sent)
+	watchPayments.Do(func() { go controllers.WatchPayments() })
+
+	var height atomic.Int64
+	height.Store(500)
+	payment := rpc.Entry{
+		Height:          501,
+		TXID:            "flooded",
+		Amount:          1000,
+		DestinationPort: checkout.PaymentID,
+		Sender:          wallet,
+		Time:            time.Now(),
+	}
+	node := fakeFollowed(t, &height, 500, payment)
+	follower := &chain.Follower{
+		NodeEndpoint:   node.URL,
+		WalletEndpoint: node.URL,
+		Receive:        controllers.ReceiveTransfer,
+	}
+
+	// the first poll only marks where the follower starts
+	if err := follower.Poll(); err != nil {
+		t.Fatalf("Failed to poll: %v", err)
+	}
+
+	// far more blocks than the watcher's subscription holds, while it
+	// scans the checkouts for each
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 1000; i++ {
+			events.Publish(events.Event{Type: events.BlockNew, Data: &rpc.BlockHeader_Print{TopoHeight: int64(i)}})
+		}
+	}()
+	height.Store(600)
+	if err := follower.Poll(); err != nil {
+		t.Fatalf("Failed to poll: %v", err)
+	}
+	<-done
+
+	current, err := controllers.GetCheckout(strconv.Itoa(checkout.ID), bob)
+	if err != nil {
+		t.Fatalf("Failed to get checkout: %v", err)
+	}
+	if current.Status != models.CheckoutPaid || current.TXID != "flooded" {
+		t.Errorf("Expected the checkout paid by the flooded transfer, but got: %+v", current)
+	}
+}
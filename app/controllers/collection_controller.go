@@ -0,0 +1,321 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/secretnamebasis/secret-site/app/config"
+	"github.com/secretnamebasis/secret-site/app/database"
+	"github.com/secretnamebasis/secret-site/app/integrations/dero"
+	"github.com/secretnamebasis/secret-site/app/models"
+)
+
+// CreateCollection creates a collection curated by the user, under a slug
+// made from its name
+func CreateCollection(order models.JSON_Collection_Order) (models.Collection, error) {
+	if err := authenticateUser(order.User); err != nil {
+		return models.Collection{}, ErrForbidden
+	}
+
+	if err := order.Validate(); err != nil {
+		return models.Collection{}, err
+	}
+
+	slug := models.Slug(order.Name)
+	if _, err := GetCollection(slug); err == nil {
+		return models.Collection{}, fmt.Errorf("collection %q already exists", slug)
+	}
+
+	if err := checkMembers(order.Name, order.SCIDs, order.User); err != nil {
+		return models.Collection{}, err
+	}
+
+	id, err := database.NextID(bucketCollections)
+	if err != nil {
+		return models.Collection{}, err
+	}
+
+	now := time.Now()
+	collection := models.Collection{
+		ID:          id,
+		Slug:        slug,
+		Name:        order.Name,
+		Description: order.Description,
+		Cover:       order.Cover,
+		Owner:       order.User.Name,
+		SCIDs:       order.SCIDs,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	if collection.SCIDs == nil {
+		collection.SCIDs = []string{}
+	}
+
+	if err := collection.Validate(); err != nil {
+		return models.Collection{}, err
+	}
+
+	if err := database.CreateRecord(bucketCollections, &collection); err != nil {
+		return models.Collection{}, err
+	}
+	audit(order.User.Name, "create", bucketCollections, collection.ID, nil, collection)
+
+	return collection, nil
+}
+
+// AllCollections retrieves every collection, oldest first
+func AllCollections() ([]models.Collection, error) {
+	var collections []models.Collection
+	if err := database.GetAllRecords(bucketCollections, &collections); err != nil {
+		return nil, err
+	}
+	sort.Slice(collections, func(i, j int) bool {
+		return collections[i].ID < collections[j].ID
+	})
+	return collections, nil
+}
+
+// GetCollection retrieves a collection by its ID or its slug; slugs are
+// never all digits, so the two can't be mistaken for one another
+func GetCollection(ref string) (models.Collection, error) {
+	if _, err := strconv.Atoi(ref); err == nil {
+		var collection models.Collection
+		if err := database.GetRecordByID(bucketCollections, ref, &collection); err != nil {
+			return models.Collection{}, err
+		}
+		return collection, nil
+	}
+
+	collections, err := AllCollections()
+	if err != nil {
+		return models.Collection{}, err
+	}
+	for _, collection := range collections {
+		if collection.Slug == ref {
+			return collection, nil
+		}
+	}
+	return models.Collection{}, fmt.Errorf("collection %s not found", ref)
+}
+
+// UpdateCollection changes what the order fills in of a collection the user
+// owns; admins may update any. The slug stays put, so links don't break.
+func UpdateCollection(ref string, order models.JSON_Collection_Order) (models.Collection, error) {
+	collection, err := ownedCollection(ref, order.User)
+	if err != nil {
+		return models.Collection{}, err
+	}
+
+	if order.Name == "" {
+		order.Name = collection.Name
+	}
+	if err := order.Validate(); err != nil {
+		return models.Collection{}, err
+	}
+
+	before := collection
+	collection.Name = order.Name
+	if order.Description != "" {
+		collection.Description = order.Description
+	}
+	if order.Cover != "" {
+		collection.Cover = order.Cover
+	}
+	if order.SCIDs != nil {
+		// the members already in stay, even if the name changes under them
+		var added []string
+		for _, scid := range order.SCIDs {
+			if !before.Has(scid) {
+				added = append(added, scid)
+			}
+		}
+		if err := checkMembers(collection.Name, added, order.User); err != nil {
+			return models.Collection{}, err
+		}
+		collection.SCIDs = order.SCIDs
+	}
+	collection.UpdatedAt = time.Now()
+
+	if err := collection.Validate(); err != nil {
+		return models.Collection{}, err
+	}
+
+	if err := database.CreateRecord(bucketCollections, &collection); err != nil {
+		return models.Collection{}, err
+	}
+	audit(order.User.Name, "update", bucketCollections, collection.ID, before, collection)
+
+	return collection, nil
+}
+
+// DeleteCollection removes a collection the user owns; its NFAs stay as they are
+func DeleteCollection(ref string, user models.JSON_User_Order) error {
+	collection, err := ownedCollection(ref, user)
+	if err != nil {
+		return err
+	}
+
+	if err := database.DeleteRecord(bucketCollections, strconv.Itoa(collection.ID)); err != nil {
+		return err
+	}
+	audit(user.Name, "delete", bucketCollections, collection.ID, collection, nil)
+	return nil
+}
+
+// CollectionNFAs reads the state of the collection's NFAs from the NFA
+// index, asking the node for those it hasn't come across
+func CollectionNFAs(collection models.Collection) ([]models.IndexedNFA, error) {
+	members := []models.IndexedNFA{}
+	for _, scid := range collection.SCIDs {
+		member, err := collectionNFA(scid)
+		if errors.Is(err, dero.ErrNotNFA) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		members = append(members, member)
+	}
+	return members, nil
+}
+
+// CollectionStats sums up how the collection's NFAs are doing right now
+func CollectionStats(collection models.Collection) (models.CollectionStats, error) {
+	members, err := CollectionNFAs(collection)
+	if err != nil {
+		return models.CollectionStats{}, err
+	}
+	return collection.Stats(members, time.Now()), nil
+}
+
+// MintCollection mints each NFA of the order into a collection the user
+// owns, adding them to it. Every order is checked before the first is
+// minted; should minting fail partway, what was minted stays in.
+func MintCollection(ref string, order models.JSON_Collection_Mint_Order) ([]models.Item, error) {
+	collection, err := ownedCollection(ref, order.User)
+	if err != nil {
+		return nil, err
+	}
+	if len(order.NFAs) == 0 {
+		return nil, errors.New("nfas cannot be empty")
+	}
+
+	titles := make(map[string]bool, len(order.NFAs))
+	for i := range order.NFAs {
+		nfa := &order.NFAs[i]
+		nfa.Collection = collection.Name
+		nfa.User = order.User
+		if err := nfa.Validate(); err != nil {
+			return nil, fmt.Errorf("nfa %d: %w", i+1, err)
+		}
+		if titles[nfa.Title] {
+			return nil, fmt.Errorf("nfa %d: title %q cannot be used twice", i+1, nfa.Title)
+		}
+		titles[nfa.Title] = true
+		if err := checkItemExistence(nfa.Title); err != nil {
+			return nil, fmt.Errorf("nfa %d: %w", i+1, err)
+		}
+	}
+
+	before := collection
+	items := []models.Item{}
+	var mintErr error
+	for i, nfa := range order.NFAs {
+		item, err := MintNFA(nfa)
+		if err != nil {
+			mintErr = fmt.Errorf("nfa %d: %w", i+1, err)
+			break
+		}
+		items = append(items, item)
+		collection.SCIDs = append(collection.SCIDs, item.SCID)
+	}
+
+	if len(items) > 0 {
+		collection.UpdatedAt = time.Now()
+		if err := database.CreateRecord(bucketCollections, &collection); err != nil {
+			return items, err
+		}
+		audit(order.User.Name, "mint", bucketCollections, collection.ID, before, collection)
+	}
+	return items, mintErr
+}
+
+// private functions
+
+// collectionNFA reads an NFA's state from the NFA index, or from the node
+// when the index hasn't come across it
+func collectionNFA(scid string) (models.IndexedNFA, error) {
+	indexed, err := database.GetNFA(scid)
+	if err != nil {
+		return models.IndexedNFA{}, err
+	}
+	if indexed != nil {
+		return *indexed, nil
+	}
+
+	sc, err := dero.GetSCID(config.NodeEndpoint, scid)
+	if err != nil {
+		return models.IndexedNFA{}, err
+	}
+	state, err := dero.ParseNFAState(scid, sc)
+	if err != nil {
+		return models.IndexedNFA{}, err
+	}
+	return models.IndexedNFA{NFAState: state}, nil
+}
+
+// checkMembers makes sure the user may put each NFA in the collection named
+// name: it has to be minted into it, or be theirs, as its owner or creator
+func checkMembers(name string, scids []string, user models.JSON_User_Order) error {
+	if len(scids) == 0 {
+		return nil
+	}
+	account, err := GetUserByName(user.Name)
+	if err != nil {
+		return err
+	}
+
+	for _, scid := range scids {
+		member, err := collectionNFA(scid)
+		if errors.Is(err, dero.ErrNotNFA) {
+			return fmt.Errorf("scid %s is not an NFA", scid)
+		}
+		if err != nil {
+			return err
+		}
+		if member.Collection == name ||
+			(account.Wallet != "" && (member.Owner == account.Wallet || member.Creator == account.Wallet)) {
+			continue
+		}
+		return fmt.Errorf("nfa %s is neither minted into %q nor yours: %w", scid, name, ErrForbidden)
+	}
+	return nil
+}
+
+// ownedCollection retrieves a collection the user may change: their own,
+// or any for admins
+func ownedCollection(ref string, user models.JSON_User_Order) (models.Collection, error) {
+	if err := authenticateUser(user); err != nil {
+		return models.Collection{}, ErrForbidden
+	}
+
+	collection, err := GetCollection(ref)
+	if err != nil {
+		return models.Collection{}, err
+	}
+	if collection.Owner == user.Name {
+		return collection, nil
+	}
+
+	account, err := GetUserByName(user.Name)
+	if err != nil {
+		return models.Collection{}, err
+	}
+	if !account.IsAdmin() {
+		return models.Collection{}, ErrForbidden
+	}
+	return collection, nil
+}
@@ -0,0 +1,228 @@
+package controllers_test
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/deroproject/derohe/rpc"
+	"github.com/secretnamebasis/secret-site/app/config"
+	"github.com/secretnamebasis/secret-site/app/controllers"
+	"github.com/secretnamebasis/secret-site/app/database"
+	"github.com/secretnamebasis/secret-site/app/integrations/dero"
+	"github.com/secretnamebasis/secret-site/app/models"
+)
+
+// fakeMintingWallet answers each transfer with the hash of its contract,
+// keeping the contracts it was sent, and signs as the issuer
+func fakeMintingWallet(t *testing.T, contracts *[]string) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			ID     int             `json:"id"`
+			Method string          `json:"method"`
+			Params json.RawMessage `json:"params"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			t.Errorf("Failed to decode request: %v", err)
+		}
+
+		var result interface{}
+		switch request.Method {
+		case "SignData":
+			var data []byte
+			json.Unmarshal(request.Params, &data)
+			result = signMessage(data)
+		default:
+			var params rpc.Transfer_Params
+			json.Unmarshal(request.Params, &params)
+			*contracts = append(*contracts, params.SC_Code)
+			result = rpc.Transfer_Result{TXID: fmt.Sprintf("%x", sha256.Sum256([]byte(params.SC_Code)))}
+		}
+
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"jsonrpc": "2.0",
+			"id":      request.ID,
+			"result":  result,
+		})
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestCreateCollection(t *testing.T) {
+	collection, err := controllers.CreateCollection(models.JSON_Collection_Order{
+		Name:        "Tide Pools",
+		Description: "Life between the tides",
+		User:        alice,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create: %v", err)
+	}
+	if collection.Slug != "tide-pools" || collection.Owner != alice.Name {
+		t.Errorf("Expected alice's tide-pools, but got: %+v", collection)
+	}
+
+	found, err := controllers.GetCollection("tide-pools")
+	if err != nil || found.ID != collection.ID {
+		t.Errorf("Expected to find it by slug, but got: %+v (%v)", found, err)
+	}
+
+	// names that slug the same are taken
+	if _, err := controllers.CreateCollection(models.JSON_Collection_Order{Name: "tide pools!", User: bob}); err == nil {
+		t.Error("Expected a duplicate slug to be refused")
+	}
+
+	// only the owner, or an admin, may change it
+	update := models.JSON_Collection_Order{Description: "Rock pools", User: bob}
+	if _, err := controllers.UpdateCollection("tide-pools", update); !errors.Is(err, controllers.ErrForbidden) {
+		t.Errorf("Expected ErrForbidden for bob, but got %v", err)
+	}
+	update.User = carol
+	updated, err := controllers.UpdateCollection("tide-pools", update)
+	if err != nil {
+		t.Fatalf("Failed to update: %v", err)
+	}
+	if updated.Description != "Rock pools" || updated.Name != "Tide Pools" || updated.Slug != "tide-pools" {
+		t.Errorf("Expected only the description changed, but got: %+v", updated)
+	}
+
+	if err := controllers.DeleteCollection("tide-pools", alice); err != nil {
+		t.Fatalf("Failed to delete: %v", err)
+	}
+	if _, err := controllers.GetCollection("tide-pools"); err == nil {
+		t.Error("Expected the collection gone")
+	}
+}
+
+func TestMintCollection(t *testing.T) {
+	var contracts []string
+	config.WalletEndpoint = fakeMintingWallet(t, &contracts).URL
+
+	if _, err := controllers.CreateCollection(models.JSON_Collection_Order{Name: "Harbours", User: alice}); err != nil {
+		t.Fatalf("Failed to create: %v", err)
+	}
+
+	image := base64.StdEncoding.EncodeToString([]byte("image"))
+	order := models.JSON_Collection_Mint_Order{
+		NFAs: []models.JSON_NFA_Order{
+			{Title: "Harbour at dawn", Description: "Boats", Image: image},
+			{Title: "Harbour at dusk", Description: "Boats", Image: image, Royalty: 3},
+		},
+		User: alice,
+	}
+
+	// bob doesn't get to mint into alice's collection
+	bobs := order
+	bobs.User = bob
+	if _, err := controllers.MintCollection("harbours", bobs); !errors.Is(err, controllers.ErrForbidden) {
+		t.Errorf("Expected ErrForbidden for bob, but got %v", err)
+	}
+
+	// a bad order stops the lot before anything is minted
+	bad := order
+	bad.NFAs = append([]models.JSON_NFA_Order{}, order.NFAs...)
+	bad.NFAs[1].Royalty = dero.MaxRoyalty + 1
+	if _, err := controllers.MintCollection("harbours", bad); err == nil || len(contracts) != 0 {
+		t.Errorf("Expected nothing minted, but got %d contracts (%v)", len(contracts), err)
+	}
+
+	items, err := controllers.MintCollection("harbours", order)
+	if err != nil {
+		t.Fatalf("Failed to mint: %v", err)
+	}
+	if len(items) != 2 || len(contracts) != 2 {
+		t.Fatalf("Expected two NFAs minted, but got %d items and %d contracts", len(items), len(contracts))
+	}
+	for _, contract := range contracts {
+		if !strings.Contains(contract, `STORE("collection", "Harbours")`) {
+			t.Errorf("Expected the contract minted into Harbours, but got:\n%s", contract)
+		}
+	}
+
+	collection, err := controllers.GetCollection("harbours")
+	if err != nil {
+		t.Fatalf("Failed to get: %v", err)
+	}
+	if len(collection.SCIDs) != 2 || collection.SCIDs[0] != items[0].SCID || collection.SCIDs[1] != items[1].SCID {
+		t.Errorf("Expected the minted SCIDs in the collection, but got %v", collection.SCIDs)
+	}
+
+	// the index knows one of them sold, so the node isn't asked
+	for i, item := range items {
+		if err := database.PutNFA(&models.IndexedNFA{
+			NFAState:      dero.NFAState{SCID: item.SCID, Collection: "Harbours", PreviousSalePrice: uint64(i) * 50000},
+			UpdatedHeight: int64(i),
+		}); err != nil {
+			t.Fatalf("Failed to index: %v", err)
+		}
+	}
+	stats, err := controllers.CollectionStats(collection)
+	if err != nil {
+		t.Fatalf("Failed to get stats: %v", err)
+	}
+	if stats.Items != 2 || stats.Listed != 0 || stats.LastSale != 50000 {
+		t.Errorf("Expected 2 unlisted items last sold at 50000, but got: %+v", stats)
+	}
+}
+
+func TestCollectionMembers(t *testing.T) {
+	// one minted into Estuaries by someone else, one of alice's, and one
+	// that is neither
+	scids := []string{
+		strings.Repeat("e1", 32),
+		strings.Repeat("e2", 32),
+		strings.Repeat("e3", 32),
+	}
+	for _, nfa := range []dero.NFAState{
+		{SCID: scids[0], Collection: "Estuaries", Owner: issuer, Creator: issuer},
+		{SCID: scids[1], Collection: "Elsewhere", Owner: wallet, Creator: issuer},
+		{SCID: scids[2], Collection: "Elsewhere", Owner: issuer, Creator: issuer},
+	} {
+		if err := database.PutNFA(&models.IndexedNFA{NFAState: nfa}); err != nil {
+			t.Fatalf("Failed to index: %v", err)
+		}
+	}
+
+	order := models.JSON_Collection_Order{Name: "Estuaries", SCIDs: scids, User: alice}
+	if _, err := controllers.CreateCollection(order); !errors.Is(err, controllers.ErrForbidden) {
+		t.Errorf("Expected ErrForbidden for someone else's NFA, but got %v", err)
+	}
+
+	order.SCIDs = scids[:2]
+	collection, err := controllers.CreateCollection(order)
+	if err != nil {
+		t.Fatalf("Failed to create: %v", err)
+	}
+
+	update := models.JSON_Collection_Order{SCIDs: scids, User: alice}
+	if _, err := controllers.UpdateCollection(collection.Slug, update); !errors.Is(err, controllers.ErrForbidden) {
+		t.Errorf("Expected ErrForbidden adding someone else's NFA, but got %v", err)
+	}
+
+	// the members already in stay when the collection is renamed
+	update = models.JSON_Collection_Order{Name: "Salt Marshes", SCIDs: scids[:2], User: alice}
+	if _, err := controllers.UpdateCollection(collection.Slug, update); err != nil {
+		t.Errorf("Failed to rename: %v", err)
+	}
+}
+
+func TestNumericCollectionName(t *testing.T) {
+	collection, err := controllers.CreateCollection(models.JSON_Collection_Order{Name: "1984", User: alice})
+	if err != nil {
+		t.Fatalf("Failed to create: %v", err)
+	}
+	if collection.Slug != "collection-1984" {
+		t.Errorf("Expected slug collection-1984, but got %q", collection.Slug)
+	}
+
+	found, err := controllers.GetCollection(collection.Slug)
+	if err != nil || found.ID != collection.ID {
+		t.Errorf("Expected to find it by slug, but got: %+v (%v)", found, err)
+	}
+}
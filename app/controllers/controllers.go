@@ -9,11 +9,20 @@ import (
 
 // Define bucket names
 const (
-	bucketItems     = "items"
-	bucketUsers     = "users"
-	bucketCheckouts = "checkouts"
+	bucketItems       = "items"
+	bucketUsers       = "users"
+	bucketCheckouts   = "checkouts"
+	bucketGrants      = "grants"
+	bucketCollections = "collections"
+	bucketWebhooks    = "webhooks"
+	bucketDeliveries  = "deliveries"
+	bucketInvoices    = "invoices"
+	bucketMessages    = "messages"
 )
 
+// ErrForbidden is returned when a user may not access a resource
+var ErrForbidden = errors.New("access denied")
+
 // isValidWallet checks if the provided wallet address is valid
 func isValidWallet(wallet string) error {
 	// Attempt to fetch the balance of the wallet address
@@ -24,6 +33,10 @@ func isValidWallet(wallet string) error {
 // validateWalletAddress checks if the provided wallet address is valid
 func ValidateWalletAddress(wallet string) error {
 	if err := isValidWallet(wallet); err != nil {
+		// we can't tell whether it's valid while the node is down
+		if errors.Is(err, dero.ErrUnavailable) {
+			return err
+		}
 		return errors.New("invalid wallet address")
 	}
 	return nil
@@ -0,0 +1,62 @@
+package controllers_test
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/secretnamebasis/secret-site/app/config"
+	"github.com/secretnamebasis/secret-site/app/controllers"
+	"github.com/secretnamebasis/secret-site/app/cryptography"
+	"github.com/secretnamebasis/secret-site/app/database"
+	"github.com/secretnamebasis/secret-site/app/models"
+)
+
+var (
+	alice = models.JSON_User_Order{Name: "alice", Password: "alice-password"}
+	bob   = models.JSON_User_Order{Name: "bob", Password: "bob-password"}
+	carol = models.JSON_User_Order{Name: "carol", Password: "carol-password"} // an admin
+
+	wallet = "dero1qy0khp9s9yw2h0eu20xmy9lth3zp5cacmx3rwt6k45l568d2mmcf6qgcsevzx"
+)
+
+func TestMain(m *testing.M) {
+	config.EnvPath = "../../.env.test"
+	config.WebhookAttempts = 3
+	config.MessageRate = 5
+	config.MessageFeeCap = 1000
+	// test servers listen on loopback
+	config.AllowPrivateHosts = true
+
+	dir, err := os.MkdirTemp("", "webhooks")
+	if err != nil {
+		panic(err)
+	}
+	if err := database.Initialize(config.Server{DatabasePath: dir, Environment: "test"}); err != nil {
+		panic(err)
+	}
+	for i, user := range []models.JSON_User_Order{alice, bob, carol} {
+		record := models.User{
+			ID:        i + 1,
+			Name:      user.Name,
+			Wallet:    wallet,
+			Password:  cryptography.HashString(user.Password),
+			Role:      []string{"user"},
+			CreatedAt: time.Now(),
+		}
+		if user == carol {
+			record.Role = append(record.Role, "admin")
+		}
+		if err := database.CreateRecord("users", &record); err != nil {
+			panic(err)
+		}
+	}
+
+	// events published before it subscribes are not queued
+	go controllers.WatchWebhooks()
+	time.Sleep(100 * time.Millisecond)
+
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
@@ -0,0 +1,144 @@
+package controllers
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/secretnamebasis/secret-site/app/database"
+	"github.com/secretnamebasis/secret-site/app/events"
+	"github.com/secretnamebasis/secret-site/app/models"
+)
+
+// EventFilter narrows a stream of events down to a resource, a record of
+// it, or a contract; empty fields match everything
+type EventFilter struct {
+	Resource string
+	ID       int
+	SCID     string
+}
+
+// EventStream decides which events a viewer gets to follow
+type EventStream struct {
+	viewer string
+	filter EventFilter
+}
+
+// OpenEventStream checks the viewer's credentials, once for the lifetime of
+// the stream; anonymous viewers only follow what is public.
+func OpenEventStream(viewer models.JSON_User_Order, filter EventFilter) (*EventStream, error) {
+	switch filter.Resource {
+	case "", bucketItems, bucketCheckouts:
+	default:
+		return nil, fmt.Errorf("unknown resource %q", filter.Resource)
+	}
+
+	if viewer.Name != "" {
+		if err := authenticateUser(viewer); err != nil {
+			return nil, ErrForbidden
+		}
+	}
+
+	return &EventStream{viewer: viewer.Name, filter: filter}, nil
+}
+
+// Visible reports whether the event passes the stream's filter and the
+// viewer may see it.
+func (s *EventStream) Visible(event events.Event) bool {
+	if !s.matches(event) {
+		return false
+	}
+
+	switch event.Type {
+	case events.BlockNew:
+		return true
+	case events.SCChanged:
+		// contracts are public, but which item a restricted one backs is not
+		item, err := database.GetItemByField("scid", event.SCID)
+		if err != nil {
+			return false
+		}
+		return item.ID == 0 || (!item.IsDeleted() && s.canView(item))
+	case events.ItemCreated, events.ItemUpdated, events.ItemDeleted:
+		summary, ok := event.Data.(models.ItemSummary)
+		if !ok {
+			return false
+		}
+		return s.canView(models.Item{
+			ID:         summary.ID,
+			Owner:      summary.Owner,
+			Restricted: summary.Restricted,
+		})
+	case events.CheckoutPaid, events.CheckoutExpired, events.CheckoutUnderpaid,
+		events.CheckoutOverpaid, events.CheckoutLate, events.CheckoutRefunded:
+		checkout, ok := event.Data.(models.Checkout)
+		if !ok {
+			return false
+		}
+		return s.canFollowCheckout(checkout)
+	default:
+		// the server wallet's transfers are nobody else's business
+		return false
+	}
+}
+
+// private functions
+
+// matches tells whether the event passes the stream's filter
+func (s *EventStream) matches(event events.Event) bool {
+	if s.filter.Resource != "" && event.Resource != s.filter.Resource {
+		return false
+	}
+	if s.filter.ID != 0 && event.ResourceID != s.filter.ID {
+		return false
+	}
+	if s.filter.SCID != "" && event.SCID != s.filter.SCID {
+		return false
+	}
+	return true
+}
+
+// canView tells whether the stream's viewer may view the item
+func (s *EventStream) canView(item models.Item) bool {
+	return !item.Restricted || canViewAs(item, s.viewer) == nil
+}
+
+// canFollowCheckout mirrors GetCheckout: the buyer and the item's owner may
+// follow a checkout, and guest checkouts whoever asks for them by ID
+func (s *EventStream) canFollowCheckout(checkout models.Checkout) bool {
+	if checkout.Buyer == "" && s.filter.Resource == bucketCheckouts && s.filter.ID == checkout.ID {
+		return true
+	}
+	if s.viewer == "" {
+		return false
+	}
+	if checkout.Buyer != "" && checkout.Buyer == s.viewer {
+		return true
+	}
+
+	var item models.Item
+	if err := database.GetRecordByID(bucketItems, strconv.Itoa(checkout.ItemID), &item); err != nil {
+		return false
+	}
+	return item.Owner == s.viewer
+}
+
+// publishItem lets the event streams know an item changed
+func publishItem(eventType string, item models.Item) {
+	events.Publish(events.Event{
+		Type:       eventType,
+		Resource:   bucketItems,
+		ResourceID: item.ID,
+		SCID:       item.SCID,
+		Data:       item.Summary(),
+	})
+}
+
+// publishCheckout lets the event streams know a checkout changed status
+func publishCheckout(eventType string, checkout models.Checkout) {
+	events.Publish(events.Event{
+		Type:       eventType,
+		Resource:   bucketCheckouts,
+		ResourceID: checkout.ID,
+		Data:       checkout,
+	})
+}
@@ -0,0 +1,157 @@
+package controllers
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"github.com/secretnamebasis/secret-site/app/config"
+	"github.com/secretnamebasis/secret-site/app/database"
+	"github.com/secretnamebasis/secret-site/app/integrations/dero"
+	"github.com/secretnamebasis/secret-site/app/metrics"
+	"github.com/secretnamebasis/secret-site/app/models"
+)
+
+// VerifyNFAFile checks the file of the item with the given ID or SCID
+// against its token now, and keeps the result
+func VerifyNFAFile(ref string, viewer models.JSON_User_Order) (models.FileCheck, error) {
+	item, err := GetItemByRef(ref, viewer)
+	if err != nil {
+		return models.FileCheck{}, err
+	}
+	if item.SCID == "" {
+		return models.FileCheck{}, errors.New("item has no contract")
+	}
+	return checkNFAFile(item.SCID)
+}
+
+// FileCheck retrieves the last check of a token's file, nil when it hasn't
+// been checked yet
+func FileCheck(scid string) (*models.FileCheck, error) {
+	return database.GetFileCheck(scid)
+}
+
+// FileChecks retrieves the last check of every token's file, optionally
+// only those with the given status
+func FileChecks(status string) ([]models.FileCheck, error) {
+	checks, err := database.GetFileChecks()
+	if err != nil {
+		return nil, err
+	}
+	if status == "" {
+		return checks, nil
+	}
+
+	found := []models.FileCheck{}
+	for _, check := range checks {
+		if check.Status == status {
+			found = append(found, check)
+		}
+	}
+	return found, nil
+}
+
+// CheckFiles checks the files of every item's token, and reports those
+// that don't match. A token the node can't be asked about is kept as
+// unreachable, and the rest are still checked.
+func CheckFiles() ([]models.FileCheck, error) {
+	scids, err := ItemSCIDs()
+	if err != nil {
+		return nil, err
+	}
+
+	mismatches := []models.FileCheck{}
+	for _, scid := range scids {
+		check, err := checkNFAFile(scid)
+		if errors.Is(err, dero.ErrNotNFA) {
+			continue
+		}
+		if err != nil {
+			return mismatches, err
+		}
+		if check.Status == models.FileMismatch {
+			log.Printf("File of NFA %s does not match: %s", scid, check.Reason)
+			mismatches = append(mismatches, check)
+		}
+	}
+	return mismatches, nil
+}
+
+// RunFileChecks checks files at every interval; run it in a goroutine of its own.
+func RunFileChecks(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		// the tokens can't be read while the node is down
+		if !dero.NodeOnline() {
+			continue
+		}
+		if _, err := CheckFiles(); err != nil {
+			log.Printf("Error checking files: %v", err)
+		}
+	}
+}
+
+// private functions
+
+// checkNFAFile checks a token's file against what it holds, and keeps the result
+func checkNFAFile(scid string) (models.FileCheck, error) {
+	sc, err := dero.GetSCID(config.NodeEndpoint, scid)
+	if err != nil {
+		return keepFileCheck(unreachableToken(scid, err))
+	}
+	state, err := dero.ParseNFAState(scid, sc)
+	if err != nil {
+		return models.FileCheck{}, err
+	}
+
+	check := models.FileCheck{
+		SCID:      scid,
+		FileURL:   state.FileURL,
+		CheckedAt: time.Now(),
+	}
+	// tokens minted here are signed by the server wallet
+	var signers []string
+	if server, err := dero.WalletAddress(config.WalletEndpoint); err == nil {
+		signers = append(signers, server.String())
+	}
+	method, err := dero.CheckFile(state, signers...)
+	switch {
+	case err == nil:
+		check.Status = models.FileVerified
+		check.Method = method
+	case errors.Is(err, dero.ErrFileMismatch):
+		check.Status = models.FileMismatch
+		check.Reason = err.Error()
+	default:
+		check.Status = models.FileUnreachable
+		check.Reason = err.Error()
+	}
+	return keepFileCheck(check)
+}
+
+// unreachableToken is the check of a token the node couldn't be asked
+// about; the file URL of the last check is kept, as there's no newer one
+func unreachableToken(scid string, err error) models.FileCheck {
+	check := models.FileCheck{
+		SCID:      scid,
+		Status:    models.FileUnreachable,
+		Reason:    "reading token: " + err.Error(),
+		CheckedAt: time.Now(),
+	}
+	if last, err := database.GetFileCheck(scid); err == nil && last != nil {
+		check.FileURL = last.FileURL
+	}
+	return check
+}
+
+// keepFileCheck counts and stores a check
+func keepFileCheck(check models.FileCheck) (models.FileCheck, error) {
+	metrics.FileChecks.WithLabelValues(check.Status).Inc()
+
+	if err := database.PutFileCheck(&check); err != nil {
+		return models.FileCheck{}, err
+	}
+	return check, nil
+}
@@ -0,0 +1,169 @@
+package controllers_test
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/deroproject/derohe/rpc"
+	"github.com/secretnamebasis/secret-site/app/config"
+	"github.com/secretnamebasis/secret-site/app/controllers"
+	"github.com/secretnamebasis/secret-site/app/integrations/dero"
+	"github.com/secretnamebasis/secret-site/app/models"
+)
+
+// fakeNFANode answers DERO.GetSC for scid with a token whose file and icon
+// are served from files, and with a contract of some other kind for the rest
+func fakeNFANode(t *testing.T, scid, files string, file, icon []byte) *httptest.Server {
+	address, err := rpc.NewAddress(wallet)
+	if err != nil {
+		t.Fatalf("Failed to parse address: %v", err)
+	}
+	raw := hex.EncodeToString(address.Compressed())
+	text := func(s string) string { return hex.EncodeToString([]byte(s)) }
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			ID     int              `json:"id"`
+			Method string           `json:"method"`
+			Params rpc.GetSC_Params `json:"params"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			t.Errorf("Failed to decode request: %v", err)
+		}
+
+		var result interface{}
+		switch {
+		case request.Method == "DERO.GetSC" && request.Params.SCID == scid:
+			result = rpc.GetSC_Result{VariableStringKeys: map[string]interface{}{
+				"owner":        raw,
+				"creatorAddr":  raw,
+				"artificerFee": float64(1),
+				"fileURL":      text(files + "/file"),
+				"iconURLHdr":   text(files + "/icon"),
+				"fileCheckC":   text(dero.FileChecksum(file)),
+				"fileCheckS":   text(dero.FileChecksum(icon)),
+			}}
+		case request.Method == "DERO.GetSC":
+			result = rpc.GetSC_Result{Code: "Function Initialize() Uint64\n10 RETURN 0\nEnd Function\n"}
+		default:
+			result = rpc.GetInfo_Result{}
+		}
+
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"jsonrpc": "2.0",
+			"id":      request.ID,
+			"result":  result,
+		})
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestCheckFiles(t *testing.T) {
+	item := mintForMarket(t, "Checked")
+
+	// the file server can be made to serve something else
+	var mu sync.Mutex
+	served := map[string][]byte{"/file": []byte("the file"), "/icon": []byte("the icon")}
+	files := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		w.Write(served[r.URL.Path])
+	}))
+	defer files.Close()
+	config.NodeEndpoint = fakeNFANode(t, item.SCID, files.URL, served["/file"], served["/icon"]).URL
+
+	check, err := controllers.VerifyNFAFile(item.SCID, alice)
+	if err != nil {
+		t.Fatalf("Failed to verify: %v", err)
+	}
+	if check.Status != models.FileVerified || check.Method != dero.FileCheckChecksum {
+		t.Errorf("Expected the file verified by checksum, but got: %+v", check)
+	}
+
+	mismatches, err := controllers.CheckFiles()
+	if err != nil {
+		t.Fatalf("Failed to check files: %v", err)
+	}
+	if len(mismatches) != 0 {
+		t.Errorf("Expected no mismatches, but got: %+v", mismatches)
+	}
+
+	// swapping the file out is caught and kept
+	mu.Lock()
+	served["/file"] = []byte("a different file")
+	mu.Unlock()
+	mismatches, err = controllers.CheckFiles()
+	if err != nil {
+		t.Fatalf("Failed to check files: %v", err)
+	}
+	if len(mismatches) != 1 || mismatches[0].SCID != item.SCID {
+		t.Fatalf("Expected %s reported, but got: %+v", item.SCID, mismatches)
+	}
+
+	stored, err := controllers.FileCheck(item.SCID)
+	if err != nil || stored == nil || stored.Status != models.FileMismatch {
+		t.Errorf("Expected the mismatch kept, but got: %+v (%v)", stored, err)
+	}
+	listed, err := controllers.FileChecks(models.FileMismatch)
+	if err != nil || len(listed) != 1 || listed[0].SCID != item.SCID {
+		t.Errorf("Expected only %s listed as a mismatch, but got: %+v (%v)", item.SCID, listed, err)
+	}
+}
+
+func TestCheckFilesPastNodeErrors(t *testing.T) {
+	unreadable := mintForMarket(t, "Unreadable")
+	readable := mintForMarket(t, "Readable")
+
+	files := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.URL.Path))
+	}))
+	defer files.Close()
+	nfas := fakeNFANode(t, readable.SCID, files.URL, []byte("/file"), []byte("/icon"))
+
+	// the node fails on one token, and answers for the rest
+	node := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		var request struct {
+			ID     int              `json:"id"`
+			Params rpc.GetSC_Params `json:"params"`
+		}
+		json.Unmarshal(body, &request)
+		if request.Params.SCID == unreadable.SCID {
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"jsonrpc": "2.0",
+				"id":      request.ID,
+				"error":   map[string]interface{}{"code": -32098, "message": "node is syncing"},
+			})
+			return
+		}
+		response, err := http.Post(nfas.URL, "application/json", bytes.NewReader(body))
+		if err != nil {
+			t.Errorf("Failed to reach the node: %v", err)
+			return
+		}
+		defer response.Body.Close()
+		io.Copy(w, response.Body)
+	}))
+	defer node.Close()
+	config.NodeEndpoint = node.URL
+
+	if _, err := controllers.CheckFiles(); err != nil {
+		t.Fatalf("Expected the node error kept rather than returned, but got %v", err)
+	}
+
+	stored, err := controllers.FileCheck(unreadable.SCID)
+	if err != nil || stored == nil || stored.Status != models.FileUnreachable {
+		t.Errorf("Expected %s kept as unreachable, but got: %+v (%v)", unreadable.SCID, stored, err)
+	}
+	stored, err = controllers.FileCheck(readable.SCID)
+	if err != nil || stored == nil || stored.Status != models.FileVerified {
+		t.Errorf("Expected %s still checked, but got: %+v (%v)", readable.SCID, stored, err)
+	}
+}
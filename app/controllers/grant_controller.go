@@ -0,0 +1,208 @@
+package controllers
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/secretnamebasis/secret-site/app/database"
+	"github.com/secretnamebasis/secret-site/app/models"
+)
+
+// CreateGrant gives a user read access to a restricted item on behalf of its owner.
+func CreateGrant(itemID string, order models.JSON_Grant_Order) (models.Grant, error) {
+	item, err := getActiveItem(itemID)
+	if err != nil {
+		return models.Grant{}, err
+	}
+
+	// only the owner hands out access
+	if err := authorizeOwner(item, order.User); err != nil {
+		return models.Grant{}, err
+	}
+
+	if err := order.Validate(); err != nil {
+		return models.Grant{}, err
+	}
+
+	// grantees can be named by username or by wallet
+	grantee, err := findGrantee(order.Grantee)
+	if err != nil {
+		return models.Grant{}, err
+	}
+
+	id, err := database.NextID(bucketGrants)
+	if err != nil {
+		return models.Grant{}, err
+	}
+
+	grant := models.Grant{
+		ID:        id,
+		ItemID:    item.ID,
+		Grantee:   grantee.Name,
+		Wallet:    grantee.Wallet,
+		ExpiresAt: order.ExpiresAt,
+		CreatedAt: time.Now(),
+	}
+
+	if err := grant.Validate(); err != nil {
+		return models.Grant{}, err
+	}
+
+	if err := database.CreateRecord(bucketGrants, &grant); err != nil {
+		return models.Grant{}, err
+	}
+	audit(order.User.Name, "create", bucketGrants, grant.ID, nil, grant)
+
+	return grant, nil
+}
+
+// ItemGrants retrieves the grants given on an item, for its owner.
+func ItemGrants(itemID string, user models.JSON_User_Order) ([]models.Grant, error) {
+	item, err := getActiveItem(itemID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := authorizeOwner(item, user); err != nil {
+		return nil, err
+	}
+
+	return grantsForItem(item.ID)
+}
+
+// RevokeGrant removes a grant from an item, for its owner.
+func RevokeGrant(itemID, grantID string, user models.JSON_User_Order) error {
+	item, err := getActiveItem(itemID)
+	if err != nil {
+		return err
+	}
+
+	if err := authorizeOwner(item, user); err != nil {
+		return err
+	}
+
+	var grant models.Grant
+	if err := database.GetRecordByID(bucketGrants, grantID, &grant); err != nil {
+		return err
+	}
+
+	// the grant has to belong to this item
+	if grant.ItemID != item.ID {
+		return errors.New("record with ID " + grantID + " not found")
+	}
+
+	if err := database.DeleteRecord(bucketGrants, grantID); err != nil {
+		return err
+	}
+	audit(user.Name, "delete", bucketGrants, grant.ID, grant, nil)
+	return nil
+}
+
+// CanView checks whether the viewer may see the item: anyone may see an
+// unrestricted item, restricted ones only show to the owner and to users
+// holding an active grant.
+func CanView(item models.Item, viewer models.JSON_User_Order) error {
+	if !item.Restricted {
+		return nil
+	}
+
+	if viewer.Name == "" {
+		return ErrForbidden
+	}
+	if err := authenticateUser(viewer); err != nil {
+		return ErrForbidden
+	}
+
+	return canViewAs(item, viewer.Name)
+}
+
+// private functions
+
+// canViewAs tells whether an already authenticated user may view a restricted item
+func canViewAs(item models.Item, name string) error {
+	if name == "" {
+		return ErrForbidden
+	}
+	if name == item.Owner {
+		return nil
+	}
+
+	grants, err := grantsForItem(item.ID)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, grant := range grants {
+		if grant.Grantee == name && grant.IsActive(now) {
+			return nil
+		}
+	}
+
+	return ErrForbidden
+}
+
+// grantsForItem retrieves all the grants given on an item
+func grantsForItem(itemID int) ([]models.Grant, error) {
+	var grants []models.Grant
+	if err := database.GetAllRecords(bucketGrants, &grants); err != nil {
+		return nil, err
+	}
+
+	var result []models.Grant
+	for _, grant := range grants {
+		if grant.ItemID == itemID {
+			result = append(result, grant)
+		}
+	}
+	return result, nil
+}
+
+// deleteItemGrants removes every grant given on an item
+func deleteItemGrants(itemID int) error {
+	grants, err := grantsForItem(itemID)
+	if err != nil {
+		return err
+	}
+
+	for _, grant := range grants {
+		if err := database.DeleteRecord(bucketGrants, strconv.Itoa(grant.ID)); err != nil {
+			return err
+		}
+		audit(actorSystem, "purge", bucketGrants, grant.ID, grant, nil)
+	}
+	return nil
+}
+
+// findGrantee looks up a user by name, then by wallet
+func findGrantee(grantee string) (models.User, error) {
+	user, err := database.GetUserByUsername(grantee)
+	if err != nil {
+		return models.User{}, errors.New("error checking user existence")
+	}
+	if user.Name != "" && !user.IsDeleted() {
+		return user, nil
+	}
+
+	user, err = database.GetUserByWallet(grantee)
+	if err != nil {
+		return models.User{}, errors.New("error checking user existence")
+	}
+	if user.Name != "" && !user.IsDeleted() {
+		return user, nil
+	}
+
+	return models.User{}, errors.New("grantee does not exist")
+}
+
+// authorizeOwner checks that the user is authenticated and owns the item
+func authorizeOwner(item models.Item, user models.JSON_User_Order) error {
+	if err := authenticateUser(user); err != nil {
+		return err
+	}
+	if item.Owner == "" || user.Name != item.Owner {
+		return ErrForbidden
+	}
+	return nil
+}
@@ -0,0 +1,150 @@
+package controllers_test
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/deroproject/derohe/cryptography/bn256"
+	"github.com/deroproject/derohe/cryptography/crypto"
+	"github.com/deroproject/derohe/rpc"
+	"github.com/secretnamebasis/secret-site/app/config"
+	"github.com/secretnamebasis/secret-site/app/controllers"
+	"github.com/secretnamebasis/secret-site/app/cryptography"
+	"github.com/secretnamebasis/secret-site/app/database"
+	"github.com/secretnamebasis/secret-site/app/models"
+)
+
+// storedItem stores an item, its data encrypted with the site's secret
+func storedItem(t *testing.T, title, description, owner string, restricted bool) models.Item {
+	id, err := controllers.NextItemID()
+	if err != nil {
+		t.Fatalf("Failed to get the next item ID: %v", err)
+	}
+	data, err := json.Marshal(models.ItemData{Description: description})
+	if err != nil {
+		t.Fatalf("Failed to marshal the item's data: %v", err)
+	}
+	data, err = cryptography.EncryptData(data, config.Env(config.EnvPath, "SECRET"))
+	if err != nil {
+		t.Fatalf("Failed to encrypt the item's data: %v", err)
+	}
+	item := models.Item{ID: id, Title: title, Data: data, Owner: owner, Restricted: restricted, CreatedAt: time.Now()}
+	if err := database.CreateRecord("items", &item); err != nil {
+		t.Fatalf("Failed to create the item: %v", err)
+	}
+	return item
+}
+
+func TestCanView(t *testing.T) {
+	item := storedItem(t, "Behind the curtain", "Hidden", alice.Name, true)
+	open := models.Item{ID: item.ID, Owner: alice.Name}
+	id := strconv.Itoa(item.ID)
+
+	// bob holds a grant, which carol's lapsed and erin's was taken back
+	if _, err := controllers.CreateGrant(id, models.JSON_Grant_Order{Grantee: bob.Name, User: alice}); err != nil {
+		t.Fatalf("Failed to grant bob: %v", err)
+	}
+	grantID, err := database.NextID("grants")
+	if err != nil {
+		t.Fatalf("Failed to get the next grant ID: %v", err)
+	}
+	lapsed := models.Grant{ID: grantID, ItemID: item.ID, Grantee: carol.Name, ExpiresAt: time.Now().Add(-time.Minute)}
+	if err := database.CreateRecord("grants", &lapsed); err != nil {
+		t.Fatalf("Failed to store carol's lapsed grant: %v", err)
+	}
+	erin := newUser(t, "erin", "erin-password", wallet)
+	revoked, err := controllers.CreateGrant(id, models.JSON_Grant_Order{Grantee: erin.Name, User: alice})
+	if err != nil {
+		t.Fatalf("Failed to grant erin: %v", err)
+	}
+	if err := controllers.RevokeGrant(id, strconv.Itoa(revoked.ID), alice); err != nil {
+		t.Fatalf("Failed to revoke erin's grant: %v", err)
+	}
+	stranger := models.JSON_User_Order{Name: "mallory", Password: "mallory-password"}
+
+	tests := []struct {
+		name   string
+		item   models.Item
+		viewer models.JSON_User_Order
+		want   error
+	}{
+		{"owner", item, alice, nil},
+		{"grantee", item, bob, nil},
+		{"grantee with a wrong password", item, models.JSON_User_Order{Name: bob.Name, Password: "guess"}, controllers.ErrForbidden},
+		{"expired grant", item, carol, controllers.ErrForbidden},
+		{"revoked grant", item, erin, controllers.ErrForbidden},
+		{"stranger", item, stranger, controllers.ErrForbidden},
+		{"anonymous", item, models.JSON_User_Order{}, controllers.ErrForbidden},
+		{"stranger on an unrestricted item", open, stranger, nil},
+		{"anonymous on an unrestricted item", open, models.JSON_User_Order{}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := controllers.CanView(tt.item, tt.viewer); !errors.Is(err, tt.want) {
+				t.Errorf("Expected %v, but got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestGrantees(t *testing.T) {
+	item := storedItem(t, "Passed around", "Hidden", alice.Name, true)
+	id := strconv.Itoa(item.ID)
+	frank := newUser(t, "frank", "frank-password",
+		rpc.NewAddressFromKeys((*crypto.Point)(new(bn256.G1).ScalarMult(crypto.G, crypto.RandomScalar()))).String())
+	gone := newUser(t, "gone", "gone-password", wallet)
+	if err := controllers.DeleteUser(strconv.Itoa(userID(t, gone.Name)), carol); err != nil {
+		t.Fatalf("Failed to delete %s: %v", gone.Name, err)
+	}
+
+	tests := []struct {
+		name    string
+		grantee string
+		want    string // empty when the grant is refused
+	}{
+		{"by name", frank.Name, frank.Name},
+		{"by wallet", userWallet(t, frank.Name), frank.Name},
+		{"unknown name", "nobody", ""},
+		{"unknown wallet", passerby, ""},
+		{"deleted user", gone.Name, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			grant, err := controllers.CreateGrant(id, models.JSON_Grant_Order{Grantee: tt.grantee, User: alice})
+			if tt.want == "" {
+				if err == nil {
+					t.Errorf("Expected no grant, but got: %+v", grant)
+				}
+				return
+			}
+			if err != nil || grant.Grantee != tt.want {
+				t.Errorf("Expected a grant to %s, but got: %+v (%v)", tt.want, grant, err)
+			}
+		})
+	}
+
+	// only the owner hands out grants
+	if _, err := controllers.CreateGrant(id, models.JSON_Grant_Order{Grantee: frank.Name, User: bob}); !errors.Is(err, controllers.ErrForbidden) {
+		t.Errorf("Expected ErrForbidden for bob, but got %v", err)
+	}
+}
+
+// userID and userWallet look a stored user up
+func userID(t *testing.T, name string) int {
+	user, err := database.GetUserByUsername(name)
+	if err != nil || user.Name == "" {
+		t.Fatalf("Failed to get %s: %v", name, err)
+	}
+	return user.ID
+}
+
+func userWallet(t *testing.T, name string) string {
+	user, err := database.GetUserByUsername(name)
+	if err != nil || user.Name == "" {
+		t.Fatalf("Failed to get %s: %v", name, err)
+	}
+	return user.Wallet
+}
@@ -0,0 +1,117 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/secretnamebasis/secret-site/app/config"
+	"github.com/secretnamebasis/secret-site/app/database"
+	"github.com/secretnamebasis/secret-site/app/integrations/dero"
+	"github.com/secretnamebasis/secret-site/app/models"
+)
+
+// healthTimeout is how long a dependency gets to answer before it counts as down
+const healthTimeout = 3 * time.Second
+
+// Readiness checks the database, the node and the wallet, side by side.
+func Readiness() models.Health {
+	checks := map[string]func() (map[string]interface{}, error){
+		"database": checkDatabase,
+		"node":     checkNode,
+		"wallet":   checkWallet,
+	}
+
+	var (
+		mu sync.Mutex
+		wg sync.WaitGroup
+	)
+	health := models.Health{Checks: make(map[string]models.HealthCheck)}
+	for name, check := range checks {
+		wg.Add(1)
+		go func(name string, check func() (map[string]interface{}, error)) {
+			defer wg.Done()
+			result := runHealthCheck(check)
+
+			mu.Lock()
+			defer mu.Unlock()
+			health.Checks[name] = result
+		}(name, check)
+	}
+	wg.Wait()
+
+	health.Status = models.HealthUp
+	if !health.Ready() {
+		health.Status = models.HealthDown
+	}
+	return health
+}
+
+// private functions
+
+// runHealthCheck times a check, giving up on it after the healthTimeout
+func runHealthCheck(check func() (map[string]interface{}, error)) models.HealthCheck {
+	type outcome struct {
+		details map[string]interface{}
+		err     error
+	}
+
+	start := time.Now()
+	done := make(chan outcome, 1)
+	go func() {
+		details, err := check()
+		done <- outcome{details, err}
+	}()
+
+	var result outcome
+	select {
+	case result = <-done:
+	case <-time.After(healthTimeout):
+		result.err = fmt.Errorf("no answer after %s", healthTimeout)
+	}
+
+	health := models.HealthCheck{
+		Status:  models.HealthUp,
+		Latency: time.Since(start).String(),
+		Details: result.details,
+	}
+	if result.err != nil {
+		health.Status = models.HealthDown
+		health.Error = result.err.Error()
+	}
+	return health
+}
+
+// checkDatabase makes sure bbolt is open and takes writes
+func checkDatabase() (map[string]interface{}, error) {
+	return nil, database.Ping()
+}
+
+// checkNode makes sure the node answers, and reports how far it has synced
+func checkNode() (map[string]interface{}, error) {
+	info, err := dero.GetInfo(config.NodeEndpoint)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		"height":       info.Height,
+		"topoheight":   info.TopoHeight,
+		"stableheight": info.StableHeight,
+		"network":      info.Network,
+	}, nil
+}
+
+// checkWallet makes sure the wallet answers, with the address we started with
+func checkWallet() (map[string]interface{}, error) {
+	addr, err := dero.GetWalletAddress(config.WalletEndpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	details := map[string]interface{}{"address": addr.String()}
+	if config.DeroAddress != nil && addr.String() != config.DeroAddress.String() {
+		return details, errors.New("wallet answers with an unexpected address")
+	}
+	return details, nil
+}
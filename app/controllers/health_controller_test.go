@@ -0,0 +1,91 @@
+package controllers_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/deroproject/derohe/rpc"
+	"github.com/secretnamebasis/secret-site/app/config"
+	"github.com/secretnamebasis/secret-site/app/controllers"
+	"github.com/secretnamebasis/secret-site/app/models"
+)
+
+// hangingServer answers nothing until the test is over
+func hangingServer(t *testing.T) *httptest.Server {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	t.Cleanup(server.Close)
+	t.Cleanup(func() { close(release) }) // runs first
+	return server
+}
+
+// closedServer is somewhere nothing answers anymore
+func closedServer() string {
+	server := httptest.NewServer(http.NotFoundHandler())
+	server.Close()
+	return server.URL
+}
+
+func TestReadiness(t *testing.T) {
+	var sent []rpc.Transfer
+	up := struct{ node, wallet string }{
+		fakeNFANode(t, "", "", nil, nil).URL,
+		fakeCheckoutWallet(t, &sent).URL,
+	}
+	// any address the wallet gives will do
+	address := config.DeroAddress
+	config.DeroAddress = nil
+	t.Cleanup(func() { config.DeroAddress = address })
+
+	tests := []struct {
+		name         string
+		node, wallet string
+		down         string // the check expected down, if any
+		reason       string // what its error says
+	}{
+		{"everything up", up.node, up.wallet, "", ""},
+		{"node failing", closedServer(), up.wallet, "node", "unavailable"},
+		{"wallet timing out", up.node, hangingServer(t).URL, "wallet", "no answer"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config.NodeEndpoint, config.WalletEndpoint = tt.node, tt.wallet
+
+			start := time.Now()
+			health := controllers.Readiness()
+			if elapsed := time.Since(start); elapsed > 5*time.Second {
+				t.Errorf("Expected an answer within the check timeout, but it took %s", elapsed)
+			}
+
+			for _, name := range []string{"database", "node", "wallet"} {
+				check, ok := health.Checks[name]
+				if !ok {
+					t.Fatalf("Expected a %s check, but got: %+v", name, health.Checks)
+				}
+				expected := models.HealthUp
+				if name == tt.down {
+					expected = models.HealthDown
+				}
+				if check.Status != expected {
+					t.Errorf("Expected %s %s, but got: %+v", name, expected, check)
+				}
+				if name == tt.down && !strings.Contains(check.Error, tt.reason) {
+					t.Errorf("Expected %s's error to say %q, but got %q", name, tt.reason, check.Error)
+				}
+			}
+
+			expected := models.HealthUp
+			if tt.down != "" {
+				expected = models.HealthDown
+			}
+			if health.Status != expected || health.Ready() != (tt.down == "") {
+				t.Errorf("Expected the status %s, but got: %+v", expected, health)
+			}
+		})
+	}
+}
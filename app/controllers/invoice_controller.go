@@ -0,0 +1,215 @@
+package controllers
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/secretnamebasis/secret-site/app/config"
+	"github.com/secretnamebasis/secret-site/app/database"
+	"github.com/secretnamebasis/secret-site/app/integrations/dero"
+	"github.com/secretnamebasis/secret-site/app/models"
+)
+
+// ErrInvalidInvoice is returned for invoices the server wallet didn't sign
+// as they stand
+var ErrInvalidInvoice = errors.New("invoice does not verify")
+
+// GetInvoice retrieves an invoice for its buyer, its seller or an admin;
+// invoices of guest checkouts are open to whoever holds their ID, like the
+// checkouts. Invoices the wallet couldn't sign yet get another try.
+func GetInvoice(id string, viewer models.JSON_User_Order) (models.Invoice, error) {
+	var invoice models.Invoice
+	if err := database.GetRecordByID(bucketInvoices, id, &invoice); err != nil {
+		return models.Invoice{}, err
+	}
+	if err := authorizeInvoice(invoice, viewer); err != nil {
+		return models.Invoice{}, err
+	}
+
+	if !invoice.IsSigned() {
+		if err := signInvoice(&invoice); err != nil {
+			log.Printf("Error signing invoice %d: %v", invoice.ID, err)
+		}
+	}
+	return invoice, nil
+}
+
+// Invoices lists the invoices of what a user bought or sold, newest first.
+// Users list their own; admins may list anyone's.
+func Invoices(user string, viewer models.JSON_User_Order) ([]models.Invoice, error) {
+	if err := authenticateUser(viewer); err != nil {
+		return nil, ErrForbidden
+	}
+	if user == "" {
+		user = viewer.Name
+	}
+	if user != viewer.Name {
+		account, err := GetUserByName(viewer.Name)
+		if err != nil {
+			return nil, err
+		}
+		if !account.IsAdmin() {
+			return nil, ErrForbidden
+		}
+	}
+
+	var invoices []models.Invoice
+	if err := database.GetAllRecords(bucketInvoices, &invoices); err != nil {
+		return nil, err
+	}
+	found := []models.Invoice{}
+	for _, invoice := range invoices {
+		if invoice.Buyer == user || invoice.Seller == user {
+			found = append(found, invoice)
+		}
+	}
+	sort.Slice(found, func(i, j int) bool { return found[i].ID > found[j].ID })
+	return found, nil
+}
+
+// VerifyInvoice checks an invoice carries the server wallet's signature of
+// it as it stands, so anyone holding one can prove the purchase
+func VerifyInvoice(invoice models.Invoice) error {
+	if !invoice.IsSigned() {
+		return fmt.Errorf("%w: it is not signed", ErrInvalidInvoice)
+	}
+	server, err := dero.WalletAddress(config.WalletEndpoint)
+	if err != nil {
+		return err
+	}
+
+	signer, message, err := dero.CheckSignedMessage([]byte(invoice.Signature))
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidInvoice, err)
+	}
+	if signer != server.String() || invoice.Issuer != signer {
+		return fmt.Errorf("%w: it is signed by %s", ErrInvalidInvoice, signer)
+	}
+
+	payload, err := invoice.Payload()
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(payload, message) {
+		return fmt.Errorf("%w: it was changed after it was signed", ErrInvalidInvoice)
+	}
+	return nil
+}
+
+// private functions
+
+// issueInvoice makes out the invoice of a paid checkout, once
+func issueInvoice(checkout models.Checkout) (models.Invoice, error) {
+	var invoices []models.Invoice
+	if err := database.GetAllRecords(bucketInvoices, &invoices); err != nil {
+		return models.Invoice{}, err
+	}
+	for _, invoice := range invoices {
+		if invoice.CheckoutID == checkout.ID {
+			return invoice, nil
+		}
+	}
+
+	var item models.Item
+	if err := database.GetRecordByID(bucketItems, strconv.Itoa(checkout.ItemID), &item); err != nil {
+		return models.Invoice{}, err
+	}
+	seller, err := GetUserByName(item.Owner)
+	if err != nil {
+		return models.Invoice{}, err
+	}
+	server, err := dero.WalletAddress(config.WalletEndpoint)
+	if err != nil {
+		return models.Invoice{}, err
+	}
+
+	// registered buyers are known by their wallet, guests by what they paid from
+	buyerWallet := checkout.Sender
+	if checkout.Buyer != "" {
+		if buyer, err := GetUserByName(checkout.Buyer); err == nil {
+			buyerWallet = buyer.Wallet
+		}
+	}
+
+	id, err := database.NextID(bucketInvoices)
+	if err != nil {
+		return models.Invoice{}, err
+	}
+	invoice := models.Invoice{
+		ID:         id,
+		CheckoutID: checkout.ID,
+		Lines: []models.InvoiceLine{
+			{
+				Description: item.Title,
+				ItemID:      item.ID,
+				SCID:        item.SCID,
+				Quantity:    1,
+				Amount:      checkout.Amount,
+			},
+		},
+		Amount:       checkout.Amount,
+		Asset:        checkout.Asset,
+		Decimals:     checkout.Decimals,
+		TXID:         checkout.TXID,
+		Height:       checkout.Height,
+		Buyer:        checkout.Buyer,
+		BuyerWallet:  buyerWallet,
+		Seller:       seller.Name,
+		SellerWallet: seller.Wallet,
+		Issuer:       server.String(),
+		// whole seconds, so the signed payload survives a round trip as is
+		IssuedAt: time.Now().UTC().Truncate(time.Second),
+	}
+
+	// an invoice the wallet can't sign now is still issued, and signed later
+	if err := signInvoice(&invoice); err != nil {
+		log.Printf("Error signing invoice %d: %v", invoice.ID, err)
+		if err := database.CreateRecord(bucketInvoices, &invoice); err != nil {
+			return models.Invoice{}, err
+		}
+	}
+	audit(actorSystem, "issue", bucketInvoices, invoice.ID, nil, invoice)
+	return invoice, nil
+}
+
+// signInvoice has the server wallet sign the invoice, and keeps it
+func signInvoice(invoice *models.Invoice) error {
+	payload, err := invoice.Payload()
+	if err != nil {
+		return err
+	}
+	signed, err := dero.SignData(config.WalletEndpoint, payload)
+	if err != nil {
+		return err
+	}
+	invoice.Signature = string(signed)
+	return database.CreateRecord(bucketInvoices, invoice)
+}
+
+// authorizeInvoice mirrors GetCheckout: the buyer, the seller and admins
+// may see an invoice, and anyone may see a guest's
+func authorizeInvoice(invoice models.Invoice, viewer models.JSON_User_Order) error {
+	if invoice.Buyer == "" {
+		return nil
+	}
+	if err := authenticateUser(viewer); err != nil {
+		return ErrForbidden
+	}
+	if viewer.Name == invoice.Buyer || viewer.Name == invoice.Seller {
+		return nil
+	}
+
+	account, err := GetUserByName(viewer.Name)
+	if err != nil {
+		return err
+	}
+	if !account.IsAdmin() {
+		return ErrForbidden
+	}
+	return nil
+}
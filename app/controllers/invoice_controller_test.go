@@ -0,0 +1,168 @@
+package controllers_test
+
+import (
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/deroproject/derohe/cryptography/bn256"
+	"github.com/deroproject/derohe/cryptography/crypto"
+	"github.com/deroproject/derohe/rpc"
+	"github.com/secretnamebasis/secret-site/app/controllers"
+	"github.com/secretnamebasis/secret-site/app/models"
+)
+
+// the key the fake server wallet signs with, and its address
+var (
+	issuerKey = crypto.RandomScalar()
+	issuer    = rpc.NewAddressFromKeys((*crypto.Point)(new(bn256.G1).ScalarMult(crypto.G, issuerKey))).String()
+)
+
+// signMessage makes the DERO signed message of data the wallet would,
+// as the issuer
+func signMessage(data []byte) []byte {
+	public := new(bn256.G1).ScalarMult(crypto.G, issuerKey)
+	nonce := crypto.RandomScalar()
+	point := new(bn256.G1).ScalarMult(crypto.G, nonce)
+	c := crypto.ReducedHash([]byte(fmt.Sprintf("%s%s%x", public.String(), point.String(), data)))
+	s := new(big.Int).Mul(c, issuerKey)
+	s.Add(s, nonce)
+	s.Mod(s, bn256.Order)
+
+	return pem.EncodeToMemory(&pem.Block{
+		Type: "DERO SIGNED MESSAGE",
+		Headers: map[string]string{
+			"Address": issuer,
+			"C":       fmt.Sprintf("%x", c),
+			"S":       fmt.Sprintf("%x", s),
+		},
+		Bytes: data,
+	})
+}
+
+func TestInvoiceIssuedOnPayment(t *testing.T) {
+	var sent []rpc.Transfer
+	checkout := openCheckout(t, "Invoiced", &sent)
+
+	checkout = pay(t, checkout, "invoiced", 1000, time.Now())
+	if checkout.Status != models.CheckoutPaid || checkout.InvoiceID == 0 {
+		t.Fatalf("Expected the paid checkout invoiced, but got: %+v", checkout)
+	}
+	id := strconv.Itoa(checkout.InvoiceID)
+
+	invoice, err := controllers.GetInvoice(id, bob)
+	if err != nil {
+		t.Fatalf("Failed to get the invoice: %v", err)
+	}
+	if invoice.CheckoutID != checkout.ID || invoice.Amount != 1000 || invoice.TXID != "invoiced" ||
+		invoice.Buyer != bob.Name || invoice.BuyerWallet != wallet || invoice.Seller != alice.Name ||
+		invoice.Issuer != issuer || !invoice.IsSigned() {
+		t.Errorf("Unexpected invoice: %+v", invoice)
+	}
+	if len(invoice.Lines) != 1 || invoice.Lines[0].Description != "Invoiced" || invoice.Lines[0].Amount != 1000 {
+		t.Errorf("Expected one line for the item, but got: %+v", invoice.Lines)
+	}
+
+	// the seller and admins may see it too, nobody else
+	for _, viewer := range []models.JSON_User_Order{alice, carol} {
+		if _, err := controllers.GetInvoice(id, viewer); err != nil {
+			t.Errorf("Expected %s to see the invoice, but got %v", viewer.Name, err)
+		}
+	}
+	if _, err := controllers.GetInvoice(id, models.JSON_User_Order{}); !errors.Is(err, controllers.ErrForbidden) {
+		t.Errorf("Expected ErrForbidden without credentials, but got %v", err)
+	}
+
+	// paying more afterwards makes no second invoice
+	checkout = pay(t, checkout, "invoiced again", 200, time.Now())
+	if checkout.Status != models.CheckoutOverpaid || checkout.InvoiceID != invoice.ID {
+		t.Errorf("Expected the same invoice on an overpaid checkout, but got: %+v", checkout)
+	}
+	invoices, err := controllers.Invoices("", bob)
+	if err != nil {
+		t.Fatalf("Failed to list invoices: %v", err)
+	}
+	count := 0
+	for _, listed := range invoices {
+		if listed.CheckoutID == checkout.ID {
+			count++
+		}
+	}
+	if count != 1 {
+		t.Errorf("Expected one invoice for the checkout, but got %d", count)
+	}
+}
+
+func TestInvoicesListing(t *testing.T) {
+	var sent []rpc.Transfer
+	checkout := openCheckout(t, "On the list", &sent)
+	checkout = pay(t, checkout, "on the list", 1000, time.Now())
+
+	// buyers and sellers both find it among their own
+	for _, viewer := range []models.JSON_User_Order{bob, alice} {
+		invoices, err := controllers.Invoices("", viewer)
+		if err != nil {
+			t.Fatalf("Failed to list %s's invoices: %v", viewer.Name, err)
+		}
+		if len(invoices) == 0 || invoices[0].ID != checkout.InvoiceID {
+			t.Errorf("Expected %s's newest invoice to be %d, but got: %+v", viewer.Name, checkout.InvoiceID, invoices)
+		}
+	}
+
+	// only admins list someone else's
+	if _, err := controllers.Invoices(bob.Name, alice); !errors.Is(err, controllers.ErrForbidden) {
+		t.Errorf("Expected ErrForbidden for another user's invoices, but got %v", err)
+	}
+	invoices, err := controllers.Invoices(bob.Name, carol)
+	if err != nil || len(invoices) == 0 {
+		t.Errorf("Expected an admin to list bob's invoices, but got: %+v (%v)", invoices, err)
+	}
+	if _, err := controllers.Invoices("", models.JSON_User_Order{}); !errors.Is(err, controllers.ErrForbidden) {
+		t.Errorf("Expected ErrForbidden without credentials, but got %v", err)
+	}
+}
+
+func TestVerifyInvoice(t *testing.T) {
+	var sent []rpc.Transfer
+	checkout := openCheckout(t, "Proven", &sent)
+	checkout = pay(t, checkout, "proven", 1000, time.Now())
+
+	invoice, err := controllers.GetInvoice(strconv.Itoa(checkout.InvoiceID), bob)
+	if err != nil {
+		t.Fatalf("Failed to get the invoice: %v", err)
+	}
+
+	// the buyer keeps the JSON, and brings it back later
+	kept, err := json.Marshal(invoice)
+	if err != nil {
+		t.Fatalf("Failed to marshal the invoice: %v", err)
+	}
+	var brought models.Invoice
+	if err := json.Unmarshal(kept, &brought); err != nil {
+		t.Fatalf("Failed to unmarshal the invoice: %v", err)
+	}
+	if err := controllers.VerifyInvoice(brought); err != nil {
+		t.Fatalf("Expected the invoice to verify, but got %v", err)
+	}
+
+	tampered := brought
+	tampered.Amount = 1
+	if err := controllers.VerifyInvoice(tampered); !errors.Is(err, controllers.ErrInvalidInvoice) {
+		t.Errorf("Expected ErrInvalidInvoice for a changed amount, but got %v", err)
+	}
+	tampered = brought
+	tampered.BuyerWallet = "someone else"
+	if err := controllers.VerifyInvoice(tampered); !errors.Is(err, controllers.ErrInvalidInvoice) {
+		t.Errorf("Expected ErrInvalidInvoice for a changed buyer, but got %v", err)
+	}
+	unsigned := brought
+	unsigned.Signature = ""
+	if err := controllers.VerifyInvoice(unsigned); !errors.Is(err, controllers.ErrInvalidInvoice) {
+		t.Errorf("Expected ErrInvalidInvoice without a signature, but got %v", err)
+	}
+}
@@ -2,14 +2,18 @@ package controllers
 
 import (
 	"bytes"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"log"
+	"strconv"
 	"time"
 
 	"github.com/secretnamebasis/secret-site/app/config"
 	"github.com/secretnamebasis/secret-site/app/cryptography"
 	"github.com/secretnamebasis/secret-site/app/database"
+	"github.com/secretnamebasis/secret-site/app/events"
 	"github.com/secretnamebasis/secret-site/app/integrations/dero"
 	"github.com/secretnamebasis/secret-site/app/models"
 )
@@ -48,96 +52,41 @@ func CreateItemRecord(order *models.JSON_Item_Order) (models.Item, error) {
 	}
 	item.SCID = order.SCID
 
-	// Marshal the JSON_Item_Order into bytes
-	// this is a really important concept:
-	// we are going to be doing and seeing this kind
-	// of operation a lot, we are going to be
-	// marshalling data into bytes into some kind
-	// of model so we are taking an order and we
-	// are effectively building the ItemData that
-	// will be stored as bytes.
-
-	// and our validation already checks to see if
-	// these fields are empty
-	bytes, err := json.Marshal(
-		models.ItemData{
-			Description: order.Description,
-			Image:       order.Image,
-			File:        order.File,
-		},
-	)
-	// this should not be a problem...
-	// but if it is...
-	if err != nil {
-		return models.Item{}, err
-	}
-
-	// Ensure that the marshaled bytes are not nil
-	if bytes == nil {
-		return models.Item{}, errors.New("marshaled bytes are nil")
-	}
-
-	// strap those bytes to our item
-	item.Data = bytes
-	// Encrypt bytes before storing in the database
-	encryptedBytes,
-		err := cryptography.EncryptData(
-		item.Data, // we want to lock these bitches down!
-		config.Env(
-			config.EnvPath, // and to do it we are going into our env
-			"SECRET",       // and we are going to refer to our secret
-		), // shouldn't ever change unless we are changing our encryption scheme
-	)
-	// and it better work.
-	if err != nil {
-		return models.Item{}, err
-	}
-	item.Data = encryptedBytes
-
-	item.Initialize()
-
-	// Validate the item
-	if err := item.Validate(); err != nil {
-		return models.Item{}, err
-	}
-
-	// Create the item record in the database
-	err = database.CreateRecord(bucketItems, &item)
-	if err != nil {
-		return models.Item{}, err
-	}
-
-	return item, nil
+	return storeItem(item, order)
 }
 
-// AllItems retrieves all items from the database.
+// AllItems retrieves all items, except those in the trash, from the database.
 func AllItems() ([]models.Item, error) {
 	var items []models.Item
 	err := database.GetAllRecords(bucketItems, &items)
 	if err != nil {
 		return nil, err // Return nil slice and error
 	}
-	return items, nil // Return retrieved items and nil error
+	return activeItems(items), nil // Return retrieved items and nil error
 }
 
-// AllItems retrieves all items from the database.
+// AllItems retrieves all items, except those in the trash, from the database.
 func AllItemTitles() ([]models.Item, error) {
 	var items []models.Item
 	err := database.GetAllItemTitles(bucketItems, &items)
 	if err != nil {
 		return nil, err // Return nil slice and error
 	}
-	return items, nil // Return retrieved items and nil error
+	return activeItems(items), nil // Return retrieved items and nil error
 }
 
 // GetItemByID retrieves an item from the database by ID.
 func GetItemByID(id string) (models.Item, error) {
-	var existingItem models.Item
-
-	if err := database.GetRecordByID(bucketItems, id, &existingItem); err != nil {
+	existingItem, err := getActiveItem(id)
+	if err != nil {
 		return models.Item{}, err
 	}
 
+	// private items stay sealed until the owner unlocks them
+	if existingItem.IsPrivate() {
+		return existingItem, nil
+	}
+
 	decryptedData, // seeing as this is a big garbaldy goop...
 		err := cryptography.DecryptData(
 		existingItem.Data,
@@ -150,14 +99,30 @@ func GetItemByID(id string) (models.Item, error) {
 	return existingItem, err
 }
 
-// GetItemByID retrieves an item from the database by ID.
-func GetItemBySCID(scid string) (models.Item, error) {
+// GetItemBySCID retrieves an item from the database by SCID, for a viewer
+// who may see it.
+func GetItemBySCID(scid string, viewer models.JSON_User_Order) (models.Item, error) {
 
 	item, err := database.GetItemByField("scid", scid)
 	if err != nil {
 		return models.Item{}, err
 	}
 
+	// items in the trash are not to be seen
+	if item.IsDeleted() {
+		return models.Item{}, fmt.Errorf("record with SCID %s not found", scid)
+	}
+
+	// restricted items are kept to their owner and grantees
+	if err := CanView(item, viewer); err != nil {
+		return models.Item{}, err
+	}
+
+	// private items stay sealed until the owner unlocks them
+	if item.IsPrivate() {
+		return item, nil
+	}
+
 	decryptedData, // seeing as this is a big garbaldy goop...
 		err := cryptography.DecryptData(
 		item.Data,
@@ -170,21 +135,49 @@ func GetItemBySCID(scid string) (models.Item, error) {
 	return item, err
 }
 
-// UpdateItem updates an item in the database with the provided ID and updated data.
+// GetItemByRef retrieves an item by SCID or, for items minted here whose
+// links were made before the SCID was known, by ID.
+func GetItemByRef(ref string, viewer models.JSON_User_Order) (models.Item, error) {
+	if len(ref) == 64 {
+		return GetItemBySCID(ref, viewer)
+	}
+
+	item, err := GetItemByID(ref)
+	if err != nil {
+		return models.Item{}, err
+	}
+	if err := CanView(item, viewer); err != nil {
+		return models.Item{}, err
+	}
+	return item, nil
+}
+
+// UpdateItem updates an item in the database with the provided ID and
+// updated data; only its owner or an admin may.
 func UpdateItem(id string, order models.JSON_Item_Order) error {
 	if err := authenticateUser(order.User); err != nil {
 		return err
 	}
-	var existingItem models.Item
+	existingItem, err := getActiveItem(id)
+	if err != nil {
+		return err
+	}
+	if err := authorizeOwnerOrAdmin(existingItem, order.User); err != nil {
+		return err
+	}
+	// the item as stored now becomes a revision
+	previousItem := existingItem
 
-	if err := database.GetRecordByID(bucketItems, id, &existingItem); err != nil {
+	// private items can only be opened with the owner's credentials
+	secret, err := itemSecret(existingItem, order.User, order.Key)
+	if err != nil {
 		return err
 	}
 
 	decryptedData, // seeing as this is a big garbaldy goop...
 		err := cryptography.DecryptData(
 		existingItem.Data,
-		config.Env(config.EnvPath, "SECRET"),
+		secret,
 	)
 	if err != nil {
 		return err
@@ -204,6 +197,23 @@ func UpdateItem(id string, order models.JSON_Item_Order) error {
 	if order.Description != "" {
 		existingItemData.Description = order.Description
 	}
+	if order.Price != 0 {
+		existingItem.Price = order.Price
+	}
+	// the zero hash switches the price back to DERO
+	if order.PriceAsset != "" {
+		if err := models.HasValidAsset(order.PriceAsset); err != nil {
+			return err
+		}
+		existingItem.PriceAsset = priceAsset(order.PriceAsset)
+	}
+	// only the owner decides who may view the item
+	if order.Restricted != nil {
+		if err := authorizeOwner(existingItem, order.User); err != nil {
+			return err
+		}
+		existingItem.Restricted = *order.Restricted
+	}
 
 	// Marshal the updated data and encrypt it
 	updatedBytes, err := json.Marshal(existingItemData)
@@ -217,10 +227,7 @@ func UpdateItem(id string, order models.JSON_Item_Order) error {
 	encryptedBytes,
 		err := cryptography.EncryptData(
 		updatedBytes,
-		config.Env(
-			config.EnvPath,
-			"SECRET",
-		),
+		secret,
 	)
 	if err != nil {
 		return err
@@ -230,12 +237,73 @@ func UpdateItem(id string, order models.JSON_Item_Order) error {
 	existingItem.Data = encryptedBytes
 	existingItem.UpdatedAt = time.Now()
 
-	return database.CreateRecord(bucketItems, &existingItem)
+	if err := saveRevision(previousItem); err != nil {
+		return err
+	}
+
+	if err := database.CreateRecord(bucketItems, &existingItem); err != nil {
+		return err
+	}
+	audit(order.User.Name, "update", bucketItems, existingItem.ID, previousItem, existingItem)
+	publishItem(events.ItemUpdated, existingItem)
+	return nil
+}
+
+// UnlockItem decrypts a private item's data with the owner's credentials,
+// using the client-supplied key instead of the password when one is given.
+func UnlockItem(item models.Item, user models.JSON_User_Order, key string) (models.Item, error) {
+	if !item.IsPrivate() {
+		return item, nil
+	}
+
+	secret, err := itemSecret(item, user, key)
+	if err != nil {
+		return models.Item{}, err
+	}
+
+	decryptedData, err := cryptography.DecryptData(item.Data, secret)
+	if err != nil {
+		return models.Item{}, err
+	}
+	item.Data = decryptedData
+	return item, nil
 }
 
-// DeleteItem deletes an item from the database by ID.
-func DeleteItem(id string) error {
-	return database.DeleteRecord(bucketItems, id)
+// DeleteItem moves an item to the trash by ID, on behalf of the actor,
+// who has to be its owner or an admin.
+func DeleteItem(id string, actor models.JSON_User_Order) error {
+	if err := authenticateUser(actor); err != nil {
+		return ErrForbidden
+	}
+	item, err := getActiveItem(id)
+	if err != nil {
+		return err
+	}
+	if err := authorizeOwnerOrAdmin(item, actor); err != nil {
+		return err
+	}
+	before := item
+
+	item.DeletedAt = time.Now()
+	if err := database.CreateRecord(bucketItems, &item); err != nil {
+		return err
+	}
+	audit(actor.Name, "delete", bucketItems, item.ID, before, item)
+	publishItem(events.ItemDeleted, item)
+	return nil
+}
+
+// ItemSCIDs returns the SCIDs of the items on the site, for the chain follower to track.
+func ItemSCIDs() ([]string, error) {
+	items, err := AllItemTitles()
+	if err != nil {
+		return nil, err
+	}
+	scids := make([]string, 0, len(items))
+	for _, item := range items {
+		scids = append(scids, item.SCID)
+	}
+	return scids, nil
 }
 
 // NextItemID returns the next available item ID.
@@ -244,6 +312,137 @@ func NextItemID() (int, error) {
 }
 
 // private functions
+
+// storeItem fills in a new item from its order, seals its data and saves it
+func storeItem(item models.Item, order *models.JSON_Item_Order) (models.Item, error) {
+	// Marshal the JSON_Item_Order into bytes
+	// this is a really important concept:
+	// we are going to be doing and seeing this kind
+	// of operation a lot, we are going to be
+	// marshalling data into bytes into some kind
+	// of model so we are taking an order and we
+	// are effectively building the ItemData that
+	// will be stored as bytes.
+
+	// and our validation already checks to see if
+	// these fields are empty
+	bytes, err := json.Marshal(
+		models.ItemData{
+			Description: order.Description,
+			Image:       order.Image,
+			File:        order.File,
+		},
+	)
+	// this should not be a problem...
+	// but if it is...
+	if err != nil {
+		return models.Item{}, err
+	}
+
+	// Ensure that the marshaled bytes are not nil
+	if bytes == nil {
+		return models.Item{}, errors.New("marshaled bytes are nil")
+	}
+
+	// strap those bytes to our item
+	item.Data = bytes
+	item.Owner = order.User.Name
+	item.Price = order.Price
+	item.PriceAsset = priceAsset(order.PriceAsset)
+	if order.Restricted != nil {
+		item.Restricted = *order.Restricted
+	}
+
+	// private items get a key of their own,
+	// which only the owner can unwrap
+	secret := config.Env(
+		config.EnvPath, // and to do it we are going into our env
+		"SECRET",       // and we are going to refer to our secret
+	) // shouldn't ever change unless we are changing our encryption scheme
+	if order.Private {
+		secret, err = sealItemKey(&item, order)
+		if err != nil {
+			return models.Item{}, err
+		}
+	}
+
+	// Encrypt bytes before storing in the database
+	encryptedBytes,
+		err := cryptography.EncryptData(
+		item.Data, // we want to lock these bitches down!
+		secret,
+	)
+	// and it better work.
+	if err != nil {
+		return models.Item{}, err
+	}
+	item.Data = encryptedBytes
+
+	item.Initialize()
+
+	// Validate the item
+	if err := item.Validate(); err != nil {
+		return models.Item{}, err
+	}
+
+	// Create the item record in the database
+	err = database.CreateRecord(bucketItems, &item)
+	if err != nil {
+		return models.Item{}, err
+	}
+	if item.IsPrivate() {
+		if err := database.PutItemKey(item.ID, item.WrappedKey); err != nil {
+			return models.Item{}, err
+		}
+	}
+	audit(order.User.Name, "create", bucketItems, item.ID, nil, item)
+	publishItem(events.ItemCreated, item)
+
+	return item, nil
+}
+
+// getActiveItem retrieves an item record by ID, treating items in the trash as missing
+func getActiveItem(id string) (models.Item, error) {
+	var item models.Item
+	if err := database.GetRecordByID(bucketItems, id, &item); err != nil {
+		return models.Item{}, err
+	}
+	if item.IsDeleted() {
+		return models.Item{}, fmt.Errorf("record with ID %s not found", id)
+	}
+	return item, nil
+}
+
+// activeItems leaves out the items in the trash
+func activeItems(items []models.Item) []models.Item {
+	var active []models.Item
+	for _, item := range items {
+		if !item.IsDeleted() {
+			active = append(active, item)
+		}
+	}
+	return active
+}
+
+// purgeItem deletes an item, with its grants and revisions, from the database for good
+func purgeItem(item models.Item) error {
+	if err := deleteItemGrants(item.ID); err != nil {
+		return err
+	}
+	id := strconv.Itoa(item.ID)
+	if err := database.DeleteRevisions(id); err != nil {
+		return err
+	}
+	if err := database.DeleteItemKey(item.ID); err != nil {
+		return err
+	}
+	if err := database.DeleteRecord(bucketItems, id); err != nil {
+		return err
+	}
+	audit(actorSystem, "purge", bucketItems, item.ID, item, nil)
+	return nil
+}
+
 // checkItemExistence checks if a user with the same title or data already exists
 func checkItemExistence(title string) error {
 
@@ -264,6 +463,80 @@ func checkItemExistence(title string) error {
 	return nil
 }
 
+// sealItemKey gives the item a fresh data key, wraps it with the order's key
+// (or the owner's password) and returns the secret to encrypt the data with.
+func sealItemKey(item *models.Item, order *models.JSON_Item_Order) (string, error) {
+	key, err := cryptography.GenerateKey()
+	if err != nil {
+		return "", err
+	}
+
+	wrapWith := order.User.Password
+	if order.Key != "" {
+		wrapWith = order.Key
+	}
+
+	wrapped, err := cryptography.WrapKey(key, wrapWith)
+	if err != nil {
+		return "", err
+	}
+	item.Private = true
+	item.WrappedKey = wrapped
+
+	return hex.EncodeToString(key), nil
+}
+
+// itemSecret returns the secret an item's data is encrypted with: the server
+// SECRET for ordinary items, the owner's unwrapped data key for private ones.
+func itemSecret(item models.Item, user models.JSON_User_Order, key string) (string, error) {
+	if !item.IsPrivate() {
+		return config.Env(config.EnvPath, "SECRET"), nil
+	}
+
+	if user.Name != item.Owner {
+		return "", ErrForbidden
+	}
+	if err := authenticateUser(user); err != nil {
+		return "", err
+	}
+
+	unwrapWith := user.Password
+	if key != "" {
+		unwrapWith = key
+	}
+
+	wrapped := item.WrappedKey
+	if len(wrapped) == 0 {
+		var err error
+		if wrapped, err = database.GetItemKey(item.ID); err != nil {
+			return "", err
+		}
+	}
+
+	dataKey, err := cryptography.UnwrapKey(wrapped, unwrapWith)
+	if err != nil {
+		return "", ErrForbidden
+	}
+
+	return hex.EncodeToString(dataKey), nil
+}
+
+// authorizeOwnerOrAdmin lets the item's owner, or an admin, change it;
+// the user has to be authenticated already
+func authorizeOwnerOrAdmin(item models.Item, user models.JSON_User_Order) error {
+	if item.Owner != "" && item.Owner == user.Name {
+		return nil
+	}
+	account, err := GetUserByName(user.Name)
+	if err != nil {
+		return err
+	}
+	if !account.IsAdmin() {
+		return ErrForbidden
+	}
+	return nil
+}
+
 // authenticateUser checks if a user with the same username or wallet already exists
 func authenticateUser(order models.JSON_User_Order) error {
 
@@ -273,7 +546,7 @@ func authenticateUser(order models.JSON_User_Order) error {
 		log.Printf("Error checking user existence: %v", err)
 		return errors.New("error checking user existence")
 	}
-	if existingUser.Name == "" {
+	if existingUser.Name == "" || existingUser.IsDeleted() {
 		log.Printf("user does not exist: %v", err)
 		return errors.New("user does not exist")
 	}
@@ -291,3 +564,11 @@ func authenticateUser(order models.JSON_User_Order) error {
 
 	return nil
 }
+
+// priceAsset keeps DERO prices without an asset
+func priceAsset(scid string) string {
+	if dero.IsDERO(scid) {
+		return ""
+	}
+	return scid
+}
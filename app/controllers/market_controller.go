@@ -0,0 +1,105 @@
+package controllers
+
+import (
+	"errors"
+	"time"
+
+	"github.com/secretnamebasis/secret-site/app/config"
+	"github.com/secretnamebasis/secret-site/app/integrations/dero"
+	"github.com/secretnamebasis/secret-site/app/models"
+)
+
+// NFAListing decodes the contract of the item with the given ID or SCID, as
+// it stands now
+func NFAListing(ref string, viewer models.JSON_User_Order) (dero.NFAListing, error) {
+	item, err := GetItemByRef(ref, viewer)
+	if err != nil {
+		return dero.NFAListing{}, err
+	}
+	if item.SCID == "" {
+		return dero.NFAListing{}, errors.New("item has no contract")
+	}
+
+	sc, err := dero.GetSCID(config.NodeEndpoint, item.SCID)
+	if err != nil {
+		return dero.NFAListing{}, err
+	}
+	state, err := dero.ParseNFAState(item.SCID, sc)
+	if err != nil {
+		return dero.NFAListing{}, err
+	}
+	return state.At(time.Now()), nil
+}
+
+// MarketAction makes a marketplace call on the contract of the item with the
+// given ID or SCID. A prepared call only builds the transfer, for the user to
+// send from their own wallet. Otherwise the server wallet sends it, spending
+// the server's DERO as the server's address, so only admins may ask for that.
+func MarketAction(ref, action string, order models.JSON_Market_Order) (models.MarketCall, error) {
+	if err := authenticateUser(order.User); err != nil {
+		return models.MarketCall{}, err
+	}
+
+	item, err := GetItemByRef(ref, order.User)
+	if err != nil {
+		return models.MarketCall{}, err
+	}
+	if item.SCID == "" {
+		return models.MarketCall{}, errors.New("item has no contract")
+	}
+
+	call := dero.MarketCall{
+		Action:      action,
+		SCID:        item.SCID,
+		ListType:    order.ListType,
+		Duration:    order.Duration,
+		StartPrice:  order.StartPrice,
+		CharityAddr: order.CharityAddress,
+		CharityPerc: order.CharityPercent,
+		Amount:      order.Amount,
+	}
+	// no sense asking the node for anything the contract would refuse
+	if err := call.Validate(); err != nil {
+		return models.MarketCall{}, err
+	}
+
+	user, err := GetUserByName(order.User.Name)
+	if err != nil {
+		return models.MarketCall{}, err
+	}
+	signer := user.Wallet
+	if !order.Prepare {
+		if !user.IsAdmin() {
+			return models.MarketCall{}, ErrForbidden
+		}
+		signer = config.ServerWallet.Address
+	}
+
+	destination, err := dero.GetRandomAddress(config.NodeEndpoint, signer)
+	if err != nil {
+		return models.MarketCall{}, err
+	}
+	params, err := dero.MarketParams(call, destination)
+	if err != nil {
+		return models.MarketCall{}, err
+	}
+
+	result := models.MarketCall{
+		Action: action,
+		ItemID: item.ID,
+		SCID:   item.SCID,
+		Params: params,
+	}
+	if order.Prepare {
+		return result, nil
+	}
+
+	transfer, err := dero.CallContract(config.WalletEndpoint, params)
+	if err != nil {
+		return models.MarketCall{}, err
+	}
+	result.TXID = transfer.TXID
+
+	audit(user.Name, action, bucketItems, item.ID, nil, result)
+	return result, nil
+}
@@ -0,0 +1,165 @@
+package controllers_test
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/deroproject/derohe/cryptography/crypto"
+	"github.com/deroproject/derohe/rpc"
+	"github.com/secretnamebasis/secret-site/app/config"
+	"github.com/secretnamebasis/secret-site/app/controllers"
+	"github.com/secretnamebasis/secret-site/app/integrations/dero"
+	"github.com/secretnamebasis/secret-site/app/models"
+)
+
+// passerby is the address the node offers besides the users' own
+const passerby = "dero1qyvqpdftj8r6005xs20rnflakmwa5pdxg9vcjzdcuywq2t8skqhvwqglt6x0g"
+
+// fakeRandomAddresses answers DERO.GetRandomAddress with the users' wallet and passerby
+func fakeRandomAddresses(t *testing.T) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			ID     int    `json:"id"`
+			Method string `json:"method"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.Method != "DERO.GetRandomAddress" {
+			t.Errorf("Expected DERO.GetRandomAddress, but got: %+v (%v)", request, err)
+		}
+
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"jsonrpc": "2.0",
+			"id":      request.ID,
+			"result":  rpc.GetRandomAddress_Result{Address: []string{wallet, passerby}},
+		})
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// mintForMarket mints an item of alice's to call the marketplace on
+func mintForMarket(t *testing.T, title string) models.Item {
+	txid := fmt.Sprintf("%x", sha256.Sum256([]byte(title)))
+	var params rpc.Transfer_Params
+	config.WalletEndpoint = fakeWallet(t, txid, &params).URL
+
+	item, err := controllers.MintNFA(models.JSON_NFA_Order{
+		Title:       title,
+		Description: "For sale",
+		Image:       base64.StdEncoding.EncodeToString([]byte("image")),
+		User:        alice,
+	})
+	if err != nil {
+		t.Fatalf("Failed to mint: %v", err)
+	}
+	return item
+}
+
+func TestMarketActionPrepares(t *testing.T) {
+	item := mintForMarket(t, "Listed")
+	config.NodeEndpoint = fakeRandomAddresses(t).URL
+
+	call, err := controllers.MarketAction(strconv.Itoa(item.ID), "start", models.JSON_Market_Order{
+		ListType:   dero.ListAuction,
+		Duration:   48,
+		StartPrice: 50000,
+		Prepare:    true,
+		User:       alice,
+	})
+	if err != nil {
+		t.Fatalf("Failed to prepare: %v", err)
+	}
+	if call.TXID != "" || call.SCID != item.SCID {
+		t.Errorf("Expected an unsent call on %s, but got: %+v", item.SCID, call)
+	}
+
+	params := call.Params
+	if params.SC_ID != item.SCID || params.Ringsize != 2 {
+		t.Errorf("Expected a ring of 2 calling %s, but got: %+v", item.SCID, params)
+	}
+	if entrypoint := params.SC_RPC.Value("entrypoint", rpc.DataString); entrypoint != "Start" {
+		t.Errorf("Expected the Start entrypoint, but got %v", entrypoint)
+	}
+	if listType := params.SC_RPC.Value("listType", rpc.DataString); listType != dero.ListAuction {
+		t.Errorf("Expected an auction, but got %v", listType)
+	}
+	if price := params.SC_RPC.Value("startPrice", rpc.DataUint64); price != uint64(50000) {
+		t.Errorf("Expected a start price of 50000, but got %v", price)
+	}
+
+	// the token goes in as a burn, alongside a transfer to anyone but alice
+	if len(params.Transfers) != 1 {
+		t.Fatalf("Expected one transfer, but got: %+v", params.Transfers)
+	}
+	transfer := params.Transfers[0]
+	if transfer.SCID != crypto.HashHexToHash(item.SCID) || transfer.Burn != 1 || transfer.Destination != passerby {
+		t.Errorf("Expected the token burnt alongside a transfer to %s, but got: %+v", passerby, transfer)
+	}
+}
+
+func TestMarketActionBidBurnsDERO(t *testing.T) {
+	item := mintForMarket(t, "Auctioned")
+	config.NodeEndpoint = fakeRandomAddresses(t).URL
+
+	call, err := controllers.MarketAction(item.SCID, "bid", models.JSON_Market_Order{
+		Amount:  75000,
+		Prepare: true,
+		User:    bob,
+	})
+	if err != nil {
+		t.Fatalf("Failed to prepare: %v", err)
+	}
+	transfers := call.Params.Transfers
+	if len(transfers) != 1 || !transfers[0].SCID.IsZero() || transfers[0].Burn != 75000 {
+		t.Errorf("Expected 75000 DERO burnt, but got: %+v", transfers)
+	}
+
+	// a bid of nothing is refused before it costs a fee
+	if _, err := controllers.MarketAction(item.SCID, "bid", models.JSON_Market_Order{Prepare: true, User: bob}); !errors.Is(err, dero.ErrInvalidCall) {
+		t.Errorf("Expected ErrInvalidCall, but got %v", err)
+	}
+}
+
+func TestMarketActionSendsForAdminsOnly(t *testing.T) {
+	item := mintForMarket(t, "Closed")
+	config.NodeEndpoint = fakeRandomAddresses(t).URL
+
+	if _, err := controllers.MarketAction(item.SCID, "close", models.JSON_Market_Order{User: alice}); !errors.Is(err, controllers.ErrForbidden) {
+		t.Errorf("Expected ErrForbidden for a user, but got %v", err)
+	}
+
+	txid := strings.Repeat("ef", 32)
+	var params rpc.Transfer_Params
+	config.WalletEndpoint = fakeWallet(t, txid, &params).URL
+
+	call, err := controllers.MarketAction(item.SCID, "close", models.JSON_Market_Order{User: carol})
+	if err != nil {
+		t.Fatalf("Failed to send: %v", err)
+	}
+	if call.TXID != txid {
+		t.Errorf("Expected txid %s, but got %s", txid, call.TXID)
+	}
+	// nothing to burn, so the wallet picks its own ring
+	if params.SC_ID != item.SCID || len(params.Transfers) != 0 {
+		t.Errorf("Expected a bare call to %s, but got: %+v", item.SCID, params)
+	}
+	if entrypoint := params.SC_RPC.Value("entrypoint", rpc.DataString); entrypoint != "CloseListing" {
+		t.Errorf("Expected the CloseListing entrypoint, but got %v", entrypoint)
+	}
+}
+
+func TestMarketActionRejectsUnknownActions(t *testing.T) {
+	item := mintForMarket(t, "Unknown")
+
+	_, err := controllers.MarketAction(item.SCID, "steal", models.JSON_Market_Order{Prepare: true, User: alice})
+	if !errors.Is(err, dero.ErrUnknownAction) {
+		t.Errorf("Expected ErrUnknownAction, but got %v", err)
+	}
+}
@@ -0,0 +1,371 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/deroproject/derohe/rpc"
+	"github.com/secretnamebasis/secret-site/app/config"
+	"github.com/secretnamebasis/secret-site/app/database"
+	"github.com/secretnamebasis/secret-site/app/integrations/dero"
+	"github.com/secretnamebasis/secret-site/app/models"
+)
+
+var (
+	// ErrMessageRate is returned when a sender has used up their messages for now
+	ErrMessageRate = errors.New("too many messages, try again later")
+	// ErrMessageFee is returned when sending a message costs more than the fee cap
+	ErrMessageFee = errors.New("sending a message costs more than the fee cap")
+	// ErrMessagingDisabled is returned when the message rate is 0
+	ErrMessagingDisabled = errors.New("messaging is disabled")
+)
+
+// messageWindow is what message rates are counted over
+const messageWindow = time.Hour
+
+// feeLookups is how many of the latest messages are asked about their fee
+const feeLookups = 3
+
+// messageMu keeps messages from slipping past the limits together
+var messageMu sync.Mutex
+
+// messagesSending counts, by sender, the messages on their way out that
+// aren't saved yet, so they count towards the rate; guarded by messageMu
+var messagesSending = map[string]int{}
+
+// SendMessage has the server wallet send an item's owner a message from a
+// user, as a comment transfer to the owner's wallet, and leaves it in their
+// inbox. The transfer pays its fee as the wallet would work it out, or what
+// the last message cost if that was more, and never more than the fee cap.
+func SendMessage(itemID string, order models.JSON_Message_Order) (models.Message, error) {
+	if config.MessageRate == 0 {
+		return models.Message{}, ErrMessagingDisabled
+	}
+	if err := authenticateUser(order.User); err != nil {
+		return models.Message{}, ErrForbidden
+	}
+	if err := order.Validate(); err != nil {
+		return models.Message{}, err
+	}
+
+	item, err := getActiveItem(itemID)
+	if err != nil {
+		return models.Message{}, err
+	}
+	if err := CanView(item, order.User); err != nil {
+		return models.Message{}, err
+	}
+	owner, err := GetUserByName(item.Owner)
+	if err != nil {
+		return models.Message{}, err
+	}
+	if owner.Name == "" {
+		return models.Message{}, errors.New("owner not found")
+	}
+	if owner.Name == order.User.Name {
+		return models.Message{}, errors.New("message is to yourself")
+	}
+
+	// the owner's wallet shows who it is from, and where
+	comment := fmt.Sprintf("%s on %s: %s", order.User.Name, config.Domain, order.Message)
+	if err := dero.CheckComment(comment); err != nil {
+		return models.Message{}, err
+	}
+
+	now := time.Now()
+	if err := reserveMessage(order.User.Name, now); err != nil {
+		return models.Message{}, err
+	}
+	defer releaseMessage(order.User.Name)
+
+	// the wallet is asked about fees without holding up the rest
+	var messages []models.Message
+	if err := database.GetAllRecords(bucketMessages, &messages); err != nil {
+		return models.Message{}, err
+	}
+	last, err := messageFee(messages)
+	if err != nil {
+		return models.Message{}, err
+	}
+	if last > config.MessageFeeCap {
+		return models.Message{}, fmt.Errorf("%w: the last one cost %d", ErrMessageFee, last)
+	}
+	fee := max(dero.CommentFee(), last)
+	if fee > config.MessageFeeCap {
+		return models.Message{}, fmt.Errorf("%w: it costs %d", ErrMessageFee, fee)
+	}
+
+	result, err := dero.Comment(config.WalletEndpoint, comment, owner.Wallet, "", fee)
+	if err != nil {
+		return models.Message{}, err
+	}
+
+	id, err := database.NextID(bucketMessages)
+	if err != nil {
+		return models.Message{}, err
+	}
+	message := models.Message{
+		ID:        id,
+		To:        owner.Name,
+		From:      order.User.Name,
+		ItemID:    item.ID,
+		Body:      order.Message,
+		Via:       models.MessageViaSite,
+		TXID:      result.TXID,
+		Amount:    1,
+		CreatedAt: now,
+	}
+	if err := database.CreateRecord(bucketMessages, &message); err != nil {
+		return models.Message{}, err
+	}
+	audit(order.User.Name, "send", bucketMessages, message.ID, nil, message)
+	return message, nil
+}
+
+// GetInbox returns a user's messages, newest first, and the address to
+// message them at. Users read their own; admins may read anyone's.
+func GetInbox(user string, viewer models.JSON_User_Order) (models.Inbox, error) {
+	if err := authenticateUser(viewer); err != nil {
+		return models.Inbox{}, ErrForbidden
+	}
+	if user == "" {
+		user = viewer.Name
+	}
+	if user != viewer.Name {
+		account, err := GetUserByName(viewer.Name)
+		if err != nil {
+			return models.Inbox{}, err
+		}
+		if !account.IsAdmin() {
+			return models.Inbox{}, ErrForbidden
+		}
+	}
+	account, err := GetUserByName(user)
+	if err != nil {
+		return models.Inbox{}, err
+	}
+	if account.Name == "" {
+		return models.Inbox{}, fmt.Errorf("user %s not found", user)
+	}
+
+	var messages []models.Message
+	if err := database.GetAllRecords(bucketMessages, &messages); err != nil {
+		return models.Inbox{}, err
+	}
+	inbox := models.Inbox{User: account.Name, Messages: []models.Message{}}
+	for _, message := range messages {
+		if message.To == account.Name {
+			inbox.Messages = append(inbox.Messages, message)
+		}
+	}
+	sort.Slice(inbox.Messages, func(i, j int) bool {
+		return inbox.Messages[i].ID > inbox.Messages[j].ID
+	})
+
+	// the messages are there without the wallet, just not the address
+	address, err := inboxAddress(account)
+	if err != nil {
+		log.Printf("Error making the inbox address of %s: %v", account.Name, err)
+	}
+	inbox.Address = address
+	return inbox, nil
+}
+
+// WalletInbox is GetInbox for the user with the wallet; the viewer's own
+// inbox when the wallet is theirs
+func WalletInbox(wallet string, viewer models.JSON_User_Order) (models.Inbox, error) {
+	if account, err := GetUserByName(viewer.Name); err == nil && account.Wallet == wallet {
+		return GetInbox(account.Name, viewer)
+	}
+	user, err := database.GetUserByWallet(wallet)
+	if err != nil || user.Name == "" || user.IsDeleted() {
+		return models.Inbox{}, fmt.Errorf("user with wallet %s not found", wallet)
+	}
+	return GetInbox(user.Name, viewer)
+}
+
+// private functions
+
+// deliverMessage leaves the comment a transfer, of the asset with the given
+// SCID, carries to an inbox's port in that inbox
+func deliverMessage(entry rpc.Entry, scid string) error {
+	if entry.DestinationPort == 0 {
+		return nil
+	}
+	comment, ok := dero.CommentOf(entry)
+	if !ok || comment == "" {
+		return nil
+	}
+
+	var users []models.User
+	if err := database.GetAllRecords(bucketUsers, &users); err != nil {
+		return err
+	}
+	var recipient models.User
+	for _, user := range users {
+		if user.InboxPort == entry.DestinationPort && !user.IsDeleted() {
+			recipient = user
+			break
+		}
+	}
+	if recipient.Name == "" {
+		return nil
+	}
+	if config.MessageRate == 0 {
+		log.Printf("Dropping message %s to %s: %v", entry.TXID, recipient.Name, ErrMessagingDisabled)
+		return nil
+	}
+
+	messageMu.Lock()
+	defer messageMu.Unlock()
+
+	var messages []models.Message
+	if err := database.GetAllRecords(bucketMessages, &messages); err != nil {
+		return err
+	}
+	for _, message := range messages {
+		if message.TXID == entry.TXID && message.To == recipient.Name {
+			return nil
+		}
+	}
+	// counted by when they were mined, so catching up doesn't drop them;
+	// senders the wallet can't tell apart share their limit
+	received := countMessages(messages, entry.Time, func(message models.Message) bool {
+		return message.Via == models.MessageViaChain && message.To == recipient.Name && message.Sender == entry.Sender
+	})
+	if received >= config.MessageRate {
+		log.Printf("Dropping message %s to %s: %v", entry.TXID, recipient.Name, ErrMessageRate)
+		return nil
+	}
+
+	id, err := database.NextID(bucketMessages)
+	if err != nil {
+		return err
+	}
+	message := models.Message{
+		ID:        id,
+		To:        recipient.Name,
+		Sender:    entry.Sender,
+		Body:      comment,
+		Via:       models.MessageViaChain,
+		TXID:      entry.TXID,
+		Height:    entry.Height,
+		Amount:    entry.Amount,
+		Asset:     priceAsset(scid),
+		CreatedAt: entry.Time,
+	}
+	if err := database.CreateRecord(bucketMessages, &message); err != nil {
+		return err
+	}
+	audit(actorSystem, "receive", bucketMessages, message.ID, nil, message)
+	return nil
+}
+
+// reserveMessage counts a message from the user as on its way out, unless
+// they have used up their messages for now
+func reserveMessage(from string, now time.Time) error {
+	messageMu.Lock()
+	defer messageMu.Unlock()
+
+	var messages []models.Message
+	if err := database.GetAllRecords(bucketMessages, &messages); err != nil {
+		return err
+	}
+	sent := countMessages(messages, now, func(message models.Message) bool {
+		return message.Via == models.MessageViaSite && message.From == from
+	})
+	if sent+messagesSending[from] >= config.MessageRate {
+		return ErrMessageRate
+	}
+	messagesSending[from]++
+	return nil
+}
+
+// releaseMessage stops counting a message from the user as on its way
+// out, once it was saved or failed
+func releaseMessage(from string) {
+	messageMu.Lock()
+	defer messageMu.Unlock()
+
+	if messagesSending[from]--; messagesSending[from] <= 0 {
+		delete(messagesSending, from)
+	}
+}
+
+// countMessages counts the matching messages in the window up to now
+func countMessages(messages []models.Message, now time.Time, match func(models.Message) bool) int {
+	count := 0
+	for _, message := range messages {
+		if match(message) && message.CreatedAt.After(now.Add(-messageWindow)) && !message.CreatedAt.After(now) {
+			count++
+		}
+	}
+	return count
+}
+
+// messageFee returns what the latest message the server wallet sent cost in
+// fees, which the next one is expected to cost at least. The wallet knows
+// once the transfer is mined, so fees are looked up then, and kept.
+func messageFee(messages []models.Message) (uint64, error) {
+	sent := []models.Message{}
+	for _, message := range messages {
+		if message.Via == models.MessageViaSite {
+			sent = append(sent, message)
+		}
+	}
+	sort.Slice(sent, func(i, j int) bool { return sent[i].ID > sent[j].ID })
+
+	lookups := 0
+	for _, message := range sent {
+		if message.Fee > 0 {
+			return message.Fee, nil
+		}
+		if lookups == feeLookups {
+			break
+		}
+		lookups++
+
+		entry, err := dero.GetTransferByTXID(config.WalletEndpoint, message.TXID)
+		if err != nil || entry.Fees == 0 {
+			continue
+		}
+		message.Fee = entry.Fees
+		message.Height = entry.Height
+		if err := database.CreateRecord(bucketMessages, &message); err != nil {
+			return 0, err
+		}
+		return message.Fee, nil
+	}
+	return 0, nil
+}
+
+// inboxAddress returns the integrated address that leaves a message in the
+// user's inbox, picking the inbox's port the first time
+func inboxAddress(user models.User) (string, error) {
+	if user.InboxPort == 0 {
+		port, err := newPaymentID()
+		if err != nil {
+			return "", err
+		}
+		// whoever asks first picks it, everyone after gets theirs
+		if user.InboxPort, err = database.ClaimInboxPort(user.ID, port); err != nil {
+			return "", err
+		}
+	}
+
+	address, err := dero.MakeIntegratedAddress(
+		fmt.Sprintf("message for %s on %s", user.Name, config.Domain),
+		user.InboxPort,
+		0,
+		"",
+		time.Time{},
+	)
+	if err != nil {
+		return "", err
+	}
+	return address.Integrated_Address, nil
+}
@@ -0,0 +1,408 @@
+package controllers_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/deroproject/derohe/rpc"
+	"github.com/secretnamebasis/secret-site/app/config"
+	"github.com/secretnamebasis/secret-site/app/controllers"
+	"github.com/secretnamebasis/secret-site/app/integrations/dero"
+	"github.com/secretnamebasis/secret-site/app/models"
+)
+
+// fakeMessageWallet records the comments it is asked to send, and the fees
+// they pay in paid when it isn't nil, tells the fees of the ones in fees,
+// and makes inbox addresses
+func fakeMessageWallet(t *testing.T, sent *[]rpc.Transfer, paid *[]uint64, fees map[string]uint64) *httptest.Server {
+	var mu sync.Mutex
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			ID     int             `json:"id"`
+			Method string          `json:"method"`
+			Params json.RawMessage `json:"params"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			t.Errorf("Failed to decode request: %v", err)
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		var result interface{}
+		switch request.Method {
+		case "transfer":
+			var params rpc.Transfer_Params
+			json.Unmarshal(request.Params, &params)
+			*sent = append(*sent, params.Transfers...)
+			if paid != nil {
+				*paid = append(*paid, params.Fees)
+			}
+			result = rpc.Transfer_Result{TXID: "message" + strconv.Itoa(len(*sent))}
+		case "GetTransferbyTXID":
+			var params rpc.Get_Transfer_By_TXID_Params
+			json.Unmarshal(request.Params, &params)
+			result = rpc.Get_Transfer_By_TXID_Result{Entry: rpc.Entry{TXID: params.TXID, Fees: fees[params.TXID]}}
+		case "MakeIntegratedAddress":
+			result = rpc.Make_Integrated_Address_Result{Integrated_Address: "deroi1inbox"}
+		default:
+			t.Errorf("Unexpected call to %s", request.Method)
+		}
+
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"jsonrpc": "2.0",
+			"id":      request.ID,
+			"result":  result,
+		})
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// commentTransfer is a transfer of amount carrying a comment to port
+func commentTransfer(txid, sender, comment string, port, amount uint64) rpc.Entry {
+	return rpc.Entry{
+		TXID:            txid,
+		Incoming:        true,
+		Amount:          amount,
+		Sender:          sender,
+		DestinationPort: port,
+		Time:            time.Now(),
+		Payload_RPC: rpc.Arguments{
+			{Name: rpc.RPC_DESTINATION_PORT, DataType: rpc.DataUint64, Value: port},
+			{Name: rpc.RPC_COMMENT, DataType: rpc.DataString, Value: comment},
+		},
+	}
+}
+
+func TestSendMessage(t *testing.T) {
+	item := mintForMarket(t, "Messaged")
+	var sent []rpc.Transfer
+	config.WalletEndpoint = fakeMessageWallet(t, &sent, nil, nil).URL
+
+	message, err := controllers.SendMessage(strconv.Itoa(item.ID), models.JSON_Message_Order{Message: " Is it still for sale? ", User: bob})
+	if err != nil {
+		t.Fatalf("Failed to send the message: %v", err)
+	}
+	if message.To != alice.Name || message.From != bob.Name || message.Body != "Is it still for sale?" || message.Via != models.MessageViaSite || message.TXID != "message1" {
+		t.Errorf("Unexpected message: %+v", message)
+	}
+
+	// it went to the owner's wallet as a comment
+	if len(sent) != 1 || sent[0].Destination != wallet || sent[0].Amount != 1 {
+		t.Fatalf("Expected one atomic unit sent to the owner, but got: %+v", sent)
+	}
+	comment, _ := sent[0].Payload_RPC.Value(rpc.RPC_COMMENT, rpc.DataString).(string)
+	if !strings.HasPrefix(comment, "bob on ") || !strings.HasSuffix(comment, ": Is it still for sale?") {
+		t.Errorf("Unexpected comment: %q", comment)
+	}
+
+	inbox, err := controllers.GetInbox("", alice)
+	if err != nil {
+		t.Fatalf("Failed to get the inbox: %v", err)
+	}
+	if len(inbox.Messages) == 0 || inbox.Messages[0].ID != message.ID || inbox.Address != "deroi1inbox" {
+		t.Errorf("Expected the message in alice's inbox, but got: %+v", inbox)
+	}
+
+	// only she and admins read it
+	if _, err := controllers.GetInbox(alice.Name, bob); !errors.Is(err, controllers.ErrForbidden) {
+		t.Errorf("Expected ErrForbidden for someone else's inbox, but got %v", err)
+	}
+	if _, err := controllers.GetInbox(alice.Name, carol); err != nil {
+		t.Errorf("Expected an admin to read alice's inbox, but got %v", err)
+	}
+
+	// owners don't message themselves, and comments have to fit in a transfer
+	if _, err := controllers.SendMessage(strconv.Itoa(item.ID), models.JSON_Message_Order{Message: "Hello me", User: alice}); err == nil {
+		t.Errorf("Expected an error messaging yourself")
+	}
+	if _, err := controllers.SendMessage(strconv.Itoa(item.ID), models.JSON_Message_Order{Message: strings.Repeat("a", 200), User: bob}); err == nil {
+		t.Errorf("Expected an error for a message too long for a transfer")
+	}
+	if len(sent) != 1 {
+		t.Errorf("Expected nothing more sent, but got: %+v", sent)
+	}
+}
+
+func TestSendMessageFeeCap(t *testing.T) {
+	item := mintForMarket(t, "Capped")
+	id := strconv.Itoa(item.ID)
+	var sent []rpc.Transfer
+	var paid []uint64
+	config.WalletEndpoint = fakeMessageWallet(t, &sent, &paid, nil).URL
+
+	rate, feeCap := config.MessageRate, config.MessageFeeCap
+	defer func() { config.MessageRate, config.MessageFeeCap = rate, feeCap }()
+
+	// a cap below what a transfer costs refuses it, even with no fee known
+	config.MessageFeeCap = dero.CommentFee() - 1
+	if _, err := controllers.SendMessage(id, models.JSON_Message_Order{Message: "Too dear", User: bob}); !errors.Is(err, controllers.ErrMessageFee) {
+		t.Errorf("Expected ErrMessageFee under the cap, but got %v", err)
+	}
+	if len(sent) != 0 {
+		t.Errorf("Expected nothing sent, but got: %+v", sent)
+	}
+
+	config.MessageFeeCap = dero.CommentFee()
+	if _, err := controllers.SendMessage(id, models.JSON_Message_Order{Message: "Just right", User: bob}); err != nil {
+		t.Fatalf("Failed to send the message at the cap: %v", err)
+	}
+	if len(paid) != 1 || paid[0] != dero.CommentFee() {
+		t.Errorf("Expected %d paid, but got %v", dero.CommentFee(), paid)
+	}
+
+	config.MessageRate = 0
+	if _, err := controllers.SendMessage(id, models.JSON_Message_Order{Message: "Anyone there?", User: bob}); !errors.Is(err, controllers.ErrMessagingDisabled) {
+		t.Errorf("Expected ErrMessagingDisabled, but got %v", err)
+	}
+}
+
+func TestSendMessageLimits(t *testing.T) {
+	item := mintForMarket(t, "Limited")
+	id := strconv.Itoa(item.ID)
+	var sent []rpc.Transfer
+	var paid []uint64
+	fees := map[string]uint64{}
+	config.WalletEndpoint = fakeMessageWallet(t, &sent, &paid, fees).URL
+
+	rate, feeCap := config.MessageRate, config.MessageFeeCap
+	defer func() { config.MessageRate, config.MessageFeeCap = rate, feeCap }()
+	config.MessageRate = 2
+
+	// the fee of the last message, once mined, stands in for the next
+	first, err := controllers.SendMessage(id, models.JSON_Message_Order{Message: "First", User: carol})
+	if err != nil {
+		t.Fatalf("Failed to send the message: %v", err)
+	}
+	fees[first.TXID] = 5000
+	if _, err := controllers.SendMessage(id, models.JSON_Message_Order{Message: "Second", User: carol}); !errors.Is(err, controllers.ErrMessageFee) {
+		t.Errorf("Expected ErrMessageFee over the cap, but got %v", err)
+	}
+	config.MessageFeeCap = 5000
+	if _, err := controllers.SendMessage(id, models.JSON_Message_Order{Message: "Second", User: carol}); err != nil {
+		t.Fatalf("Failed to send the message within the cap: %v", err)
+	}
+
+	// two an hour
+	if _, err := controllers.SendMessage(id, models.JSON_Message_Order{Message: "Third", User: carol}); !errors.Is(err, controllers.ErrMessageRate) {
+		t.Errorf("Expected ErrMessageRate, but got %v", err)
+	}
+	if len(sent) != 2 {
+		t.Errorf("Expected two messages sent, but got: %+v", sent)
+	}
+
+	// each transfer pays its fee as worked out, or as the last one cost
+	if len(paid) != 2 || paid[0] != dero.CommentFee() || paid[1] != 5000 {
+		t.Errorf("Expected fees of %d and 5000 paid, but got %v", dero.CommentFee(), paid)
+	}
+}
+
+func TestInboxReceivesComments(t *testing.T) {
+	var sent []rpc.Transfer
+	config.WalletEndpoint = fakeMessageWallet(t, &sent, nil, nil).URL
+
+	rate := config.MessageRate
+	defer func() { config.MessageRate = rate }()
+	config.MessageRate = 1
+
+	// opening the inbox picks its port
+	if _, err := controllers.GetInbox("", bob); err != nil {
+		t.Fatalf("Failed to get the inbox: %v", err)
+	}
+	port, err := controllers.GetUserByName(bob.Name)
+	if err != nil || port.InboxPort == 0 {
+		t.Fatalf("Expected bob's inbox to have a port, but got: %+v (%v)", port, err)
+	}
+
+	// receive hands a transfer over as the chain follower would
+	receive := func(entry rpc.Entry) {
+		t.Helper()
+		if err := controllers.ReceiveTransfer(entry, ""); err != nil {
+			t.Fatalf("Failed to receive %s: %v", entry.TXID, err)
+		}
+	}
+	// received checks the transfer shows up in bob's inbox
+	received := func(entry rpc.Entry) models.Message {
+		t.Helper()
+		receive(entry)
+		inbox, err := controllers.GetInbox("", bob)
+		if err != nil {
+			t.Fatalf("Failed to get the inbox: %v", err)
+		}
+		for _, message := range inbox.Messages {
+			if message.TXID == entry.TXID {
+				return message
+			}
+		}
+		t.Fatalf("Expected %s in bob's inbox", entry.TXID)
+		return models.Message{}
+	}
+
+	message := received(commentTransfer("hello", wallet, "Hello bob", port.InboxPort, 10))
+	if message.Body != "Hello bob" || message.Sender != wallet || message.Amount != 10 || message.Via != models.MessageViaChain {
+		t.Errorf("Unexpected message: %+v", message)
+	}
+
+	// the same sender is over the rate, someone else isn't
+	receive(commentTransfer("again", wallet, "Hello again", port.InboxPort, 1))
+	received(commentTransfer("other", "", "Hi from nobody", port.InboxPort, 1))
+	// and transfers to other ports aren't messages for bob
+	receive(commentTransfer("elsewhere", wallet, "Not for bob", port.InboxPort+1, 1))
+	received(commentTransfer("last", "dero1someoneelse", "Last", port.InboxPort, 1))
+
+	inbox, err := controllers.GetInbox("", bob)
+	if err != nil {
+		t.Fatalf("Failed to get the inbox: %v", err)
+	}
+	for _, message := range inbox.Messages {
+		if message.TXID == "again" || message.TXID == "elsewhere" {
+			t.Errorf("Expected %s left out of the inbox, but got: %+v", message.TXID, message)
+		}
+	}
+}
+
+// fakeSlowWallet holds every transfer until release is closed, telling
+// sending when one comes in, and records the ports of inbox addresses
+func fakeSlowWallet(t *testing.T, sending chan<- struct{}, release <-chan struct{}, ports *[]uint64) *httptest.Server {
+	var mu sync.Mutex
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			ID     int             `json:"id"`
+			Method string          `json:"method"`
+			Params json.RawMessage `json:"params"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			t.Errorf("Failed to decode request: %v", err)
+		}
+
+		var result interface{}
+		switch request.Method {
+		case "transfer":
+			sending <- struct{}{}
+			<-release
+			result = rpc.Transfer_Result{TXID: "slow message"}
+		case "GetTransferbyTXID":
+			result = rpc.Get_Transfer_By_TXID_Result{}
+		case "MakeIntegratedAddress":
+			var params rpc.Make_Integrated_Address_Params
+			json.Unmarshal(request.Params, &params)
+			mu.Lock()
+			*ports = append(*ports, params.Payload_RPC.Value(rpc.RPC_DESTINATION_PORT, rpc.DataUint64).(uint64))
+			mu.Unlock()
+			result = rpc.Make_Integrated_Address_Result{Integrated_Address: "deroi1inbox"}
+		default:
+			t.Errorf("Unexpected call to %s", request.Method)
+		}
+
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"jsonrpc": "2.0",
+			"id":      request.ID,
+			"result":  result,
+		})
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestSendMessageDoesNotHoldUpInboxes(t *testing.T) {
+	item := storedItem(t, "Messaged slowly", "Bob's", bob.Name, false)
+	sending, release := make(chan struct{}), make(chan struct{})
+	var ports []uint64
+	config.WalletEndpoint = fakeSlowWallet(t, sending, release, &ports).URL
+
+	rate, feeCap := config.MessageRate, config.MessageFeeCap
+	defer func() { config.MessageRate, config.MessageFeeCap = rate, feeCap }()
+	// what the messages before cost doesn't matter here
+	config.MessageRate, config.MessageFeeCap = 1, 5000
+
+	if _, err := controllers.GetInbox("", bob); err != nil {
+		t.Fatalf("Failed to get the inbox: %v", err)
+	}
+	account, err := controllers.GetUserByName(bob.Name)
+	if err != nil || account.InboxPort == 0 {
+		t.Fatalf("Expected bob's inbox to have a port, but got: %+v (%v)", account, err)
+	}
+
+	sent := make(chan error, 1)
+	go func() {
+		_, err := controllers.SendMessage(strconv.Itoa(item.ID), models.JSON_Message_Order{Message: "Still there?", User: alice})
+		sent <- err
+	}()
+	select {
+	case <-sending:
+	case err := <-sent:
+		t.Fatalf("Expected the message held up in the wallet, but got %v", err)
+	}
+
+	defer close(release)
+
+	// while the wallet is at it, the message counts towards the rate
+	again := make(chan error, 1)
+	go func() {
+		_, err := controllers.SendMessage(strconv.Itoa(item.ID), models.JSON_Message_Order{Message: "Hello?", User: alice})
+		again <- err
+	}()
+	select {
+	case err := <-again:
+		if !errors.Is(err, controllers.ErrMessageRate) {
+			t.Errorf("Expected ErrMessageRate with a message on its way, but got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Expected another message turned away while one was being sent")
+	}
+	// and transfers still make it to inboxes
+	received := make(chan error, 1)
+	go func() {
+		received <- controllers.ReceiveTransfer(commentTransfer("meanwhile", "dero1meanwhile", "Meanwhile", account.InboxPort, 1), "")
+	}()
+	select {
+	case err := <-received:
+		if err != nil {
+			t.Errorf("Failed to receive the transfer: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Expected the transfer received while a message was being sent")
+	}
+
+	release <- struct{}{}
+	if err := <-sent; err != nil {
+		t.Errorf("Failed to send the message: %v", err)
+	}
+}
+
+func TestInboxPortPickedOnce(t *testing.T) {
+	sending, release := make(chan struct{}), make(chan struct{})
+	var ports []uint64
+	config.WalletEndpoint = fakeSlowWallet(t, sending, release, &ports).URL
+
+	// everyone opening the inbox first at once gets the same port
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := controllers.GetInbox("", carol); err != nil {
+				t.Errorf("Failed to get the inbox: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	account, err := controllers.GetUserByName(carol.Name)
+	if err != nil || account.InboxPort == 0 || !account.IsAdmin() {
+		t.Fatalf("Expected carol's inbox to have a port and carol to stay an admin, but got: %+v (%v)", account, err)
+	}
+	for _, port := range ports {
+		if port != account.InboxPort {
+			t.Errorf("Expected every address to carry port %d, but got %v", account.InboxPort, ports)
+			break
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package controllers
+
+import (
+	"encoding/base64"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/secretnamebasis/secret-site/app/config"
+	"github.com/secretnamebasis/secret-site/app/database"
+	"github.com/secretnamebasis/secret-site/app/integrations/dero"
+	"github.com/secretnamebasis/secret-site/app/models"
+)
+
+// defaultNFAType is the type header of tokens minted without one
+const defaultNFAType = "image"
+
+// NFAFilter narrows down the NFA index; empty fields don't filter
+type NFAFilter struct {
+	Collection string
+	Owner      string
+	Active     *bool // listed for sale or auction right now
+}
+
+// IndexedNFAs lists the tokens the indexer found on chain, newest first
+func IndexedNFAs(filter NFAFilter) ([]models.IndexedNFA, error) {
+	nfas, err := database.GetNFAs(filter.Collection, filter.Owner)
+	if err != nil {
+		return nil, err
+	}
+
+	found := []models.IndexedNFA{}
+	now := time.Now()
+	for _, nfa := range nfas {
+		if filter.Active != nil && nfa.Listed(now) != *filter.Active {
+			continue
+		}
+		found = append(found, nfa)
+	}
+	sort.Slice(found, func(i, j int) bool {
+		return found[i].DeployHeight > found[j].DeployHeight
+	})
+	return found, nil
+}
+
+// MintNFA mints an ART-NFA-MS1 token for an uploaded item from the server
+// wallet, sends it to the user's wallet and lists the item under the new SCID.
+// The user's wallet is the token's creator, so royalties go to them. The
+// token's links point at the item's own /images and /files; as the SCID
+// isn't known before minting, they go by item ID. The server wallet signs
+// the file, and the token holds the signature.
+func MintNFA(order models.JSON_NFA_Order) (models.Item, error) {
+	if err := authenticateUser(order.User); err != nil {
+		return models.Item{}, err
+	}
+
+	if err := order.Validate(); err != nil {
+		return models.Item{}, err
+	}
+
+	// no duplicate titles allowed
+	if err := checkItemExistence(order.Title); err != nil {
+		return models.Item{}, err
+	}
+
+	user, err := GetUserByName(order.User.Name)
+	if err != nil {
+		return models.Item{}, err
+	}
+
+	// tokens of a single file are the image itself
+	data := models.ItemData{
+		Description: order.Description,
+		Image:       order.Image,
+		File:        order.File,
+	}
+	if data.File == "" {
+		data.File = data.Image
+	}
+	file, err := base64.StdEncoding.DecodeString(data.File)
+	if err != nil {
+		return models.Item{}, err
+	}
+	signer, c, s, err := dero.SignFile(config.WalletEndpoint, file)
+	if err != nil {
+		return models.Item{}, err
+	}
+
+	id, err := NextItemID()
+	if err != nil {
+		return models.Item{}, err
+	}
+
+	nfaType := order.Type
+	if nfaType == "" {
+		nfaType = defaultNFAType
+	}
+
+	imageURL := config.SiteURL() + "/images/" + strconv.Itoa(id)
+	fileURL := config.SiteURL() + "/files/" + strconv.Itoa(id)
+	contract, err := dero.NFAContract(
+		dero.NFA{
+			Royalty:     order.Royalty,
+			Name:        order.Title,
+			Description: order.Description,
+			Type:        nfaType,
+			Collection:  order.Collection,
+			Tags:        order.Tags,
+			IconURL:     imageURL,
+			CoverURL:    imageURL,
+			FileURL:     fileURL,
+			FileSignURL: fileURL + "/signature",
+			FileCheckC:  c,
+			FileCheckS:  s,
+			Owner:       user.Wallet,
+			Creator:     user.Wallet,
+		},
+	)
+	if err != nil {
+		return models.Item{}, err
+	}
+
+	// the server wallet can't send to itself, so the token goes straight to the user
+	result, err := dero.MintContract(config.WalletEndpoint, contract, user.Wallet)
+	if err != nil {
+		return models.Item{}, err
+	}
+
+	return storeItem(
+		models.Item{
+			ID:       id,
+			Title:    order.Title,
+			SCID:     result.TXID,
+			FileSign: &models.FileSign{Signer: signer, C: c, S: s},
+		},
+		&models.JSON_Item_Order{
+			Title:       order.Title,
+			SCID:        result.TXID,
+			Description: data.Description,
+			Image:       data.Image,
+			File:        data.File,
+			Price:       order.Price,
+			PriceAsset:  order.PriceAsset,
+			User:        order.User,
+		},
+	)
+}
@@ -0,0 +1,140 @@
+package controllers_test
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/deroproject/derohe/rpc"
+	"github.com/secretnamebasis/secret-site/app/config"
+	"github.com/secretnamebasis/secret-site/app/controllers"
+	"github.com/secretnamebasis/secret-site/app/integrations/dero"
+	"github.com/secretnamebasis/secret-site/app/models"
+)
+
+// fakeWallet answers transfers with txid, keeping the last one's params,
+// and signs as the issuer
+func fakeWallet(t *testing.T, txid string, params *rpc.Transfer_Params) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			ID     int             `json:"id"`
+			Method string          `json:"method"`
+			Params json.RawMessage `json:"params"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			t.Errorf("Failed to decode request: %v", err)
+		}
+
+		var result interface{}
+		switch request.Method {
+		case "GetAddress":
+			result = rpc.GetAddress_Result{Address: issuer}
+		case "SignData":
+			var data []byte
+			json.Unmarshal(request.Params, &data)
+			result = signMessage(data)
+		case "transfer":
+			*params = rpc.Transfer_Params{}
+			json.Unmarshal(request.Params, params)
+			result = rpc.Transfer_Result{TXID: txid}
+		default:
+			t.Errorf("Expected a transfer, but got a call to %s", request.Method)
+		}
+
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"jsonrpc": "2.0",
+			"id":      request.ID,
+			"result":  result,
+		})
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestMintNFA(t *testing.T) {
+	txid := strings.Repeat("ab", 32)
+	var params rpc.Transfer_Params
+	config.WalletEndpoint = fakeWallet(t, txid, &params).URL
+
+	image := base64.StdEncoding.EncodeToString([]byte("\x89PNG\r\n\x1a\nnot much of an image"))
+	item, err := controllers.MintNFA(models.JSON_NFA_Order{
+		Title:       "Minted",
+		Description: "A token for an item",
+		Image:       image,
+		Collection:  "tests",
+		Royalty:     5,
+		User:        alice,
+	})
+	if err != nil {
+		t.Fatalf("Failed to mint: %v", err)
+	}
+
+	// the item is linked to the new contract
+	if item.SCID != txid || item.Owner != alice.Name {
+		t.Errorf("Expected an item of alice's under %s, but got: %+v", txid, item)
+	}
+
+	// the token goes to the user, and every header is filled in
+	if len(params.Transfers) != 1 || params.Transfers[0].Destination != wallet {
+		t.Errorf("Expected the token to go to %s, but got: %+v", wallet, params.Transfers)
+	}
+	if placeholder := regexp.MustCompile(`"<\w+>"`).FindString(params.SC_Code); placeholder != "" {
+		t.Errorf("Expected no placeholders left in the contract, but got %s", placeholder)
+	}
+
+	// the server wallet signs the file, and the token holds the signature
+	sign := item.FileSign
+	if sign == nil || sign.Signer != issuer {
+		t.Fatalf("Expected the file signed by the server wallet, but got: %+v", sign)
+	}
+	decoded, _ := base64.StdEncoding.DecodeString(image)
+	if err := dero.VerifyFileSignature(sign.Signer, sign.C, sign.S, decoded); err != nil {
+		t.Errorf("Expected the signature to verify against the file, but got %v", err)
+	}
+	files := config.SiteURL() + "/files/" + strconv.Itoa(item.ID)
+	for _, header := range []string{
+		`STORE("royalty", 5)`,
+		`STORE("nameHdr", "Minted")`,
+		`STORE("typeHdr", "image")`,
+		`STORE("collection", "tests")`,
+		`STORE("fileURL", "` + files + `")`,
+		`STORE("fileSignURL", "` + files + `/signature")`,
+		`STORE("iconURLHdr", "` + config.SiteURL() + `/images/` + strconv.Itoa(item.ID) + `")`,
+		`STORE("fileCheckC", "` + sign.C + `")`,
+		`STORE("fileCheckS", "` + sign.S + `")`,
+		// royalties go to the user, not to the server wallet minting it
+		`STORE("creatorAddr", ADDRESS_RAW("` + wallet + `"))`,
+	} {
+		if !strings.Contains(params.SC_Code, header) {
+			t.Errorf("Expected the contract to %s", header)
+		}
+	}
+
+	// the item's file defaults to its image
+	stored, err := controllers.GetItemByRef(strconv.Itoa(item.ID), alice)
+	if err != nil {
+		t.Fatalf("Failed to retrieve item: %v", err)
+	}
+	var data models.ItemData
+	if err := json.Unmarshal(stored.Data, &data); err != nil || data.File != image {
+		t.Errorf("Expected the image as the file, but got: %+v (%v)", data, err)
+	}
+}
+
+func TestMintNFARejectsRoyaltyOver99(t *testing.T) {
+	_, err := controllers.MintNFA(models.JSON_NFA_Order{
+		Title:       "Greedy",
+		Description: "All of it",
+		Image:       base64.StdEncoding.EncodeToString([]byte("image")),
+		Royalty:     100,
+		User:        alice,
+	})
+	if err == nil {
+		t.Error("Expected a royalty of 100 to be rejected")
+	}
+}
@@ -0,0 +1,182 @@
+package controllers
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"github.com/deroproject/derohe/rpc"
+	"github.com/secretnamebasis/secret-site/app/database"
+	"github.com/secretnamebasis/secret-site/app/events"
+	"github.com/secretnamebasis/secret-site/app/metrics"
+	"github.com/secretnamebasis/secret-site/app/models"
+)
+
+// ReceiveTransfer settles the checkout a transfer to the server wallet pays,
+// of the asset with the given SCID, and leaves its comment in the inbox it
+// was sent to. The chain follower hands every transfer over, until it's
+// received without an error; receiving one twice changes nothing.
+func ReceiveTransfer(entry rpc.Entry, scid string) error {
+	return errors.Join(
+		settleCheckout(entry, scid),
+		deliverMessage(entry, scid),
+	)
+}
+
+// WatchPayments expires the checkouts left unpaid as new blocks come in;
+// missing a block only puts it off to the next. Run it in a goroutine of its own.
+func WatchPayments() {
+	sub := events.Subscribe(events.BlockNew)
+	defer sub.Close()
+
+	for range sub.C {
+		if err := expireCheckouts(time.Now()); err != nil {
+			log.Printf("Error expiring checkouts: %v", err)
+		}
+	}
+}
+
+// PaymentAssets returns the tokens, other than DERO, open checkouts are
+// waiting to be paid in
+func PaymentAssets() ([]string, error) {
+	var checkouts []models.Checkout
+	if err := database.GetAllRecords(bucketCheckouts, &checkouts); err != nil {
+		return nil, err
+	}
+
+	seen := map[string]bool{}
+	assets := []string{}
+	for _, checkout := range checkouts {
+		if !checkout.IsOpen() || checkout.Asset == "" || seen[checkout.Asset] {
+			continue
+		}
+		seen[checkout.Asset] = true
+		assets = append(assets, checkout.Asset)
+	}
+	return assets, nil
+}
+
+// private functions
+
+// settleCheckout records the transfer, of the asset with the given SCID,
+// against the checkout it pays, and works out where that leaves it
+func settleCheckout(entry rpc.Entry, scid string) error {
+	// payments carry the checkout's port
+	if entry.DestinationPort == 0 {
+		return nil
+	}
+
+	checkoutMu.Lock()
+	defer checkoutMu.Unlock()
+
+	var checkouts []models.Checkout
+	if err := database.GetAllRecords(bucketCheckouts, &checkouts); err != nil {
+		return err
+	}
+
+	for _, checkout := range checkouts {
+		if checkout.PaymentID != entry.DestinationPort {
+			continue
+		}
+		// the port is right, but paying in some other token pays nothing
+		if checkout.Asset != priceAsset(scid) {
+			log.Printf("Checkout %d got a transfer of asset %q instead of %q, leaving it be", checkout.ID, scid, checkout.Asset)
+			return nil
+		}
+		for _, payment := range checkout.Payments {
+			if payment.TXID == entry.TXID {
+				return nil
+			}
+		}
+
+		before := checkout
+		checkout.Payments = append(checkout.Payments, models.CheckoutPayment{
+			TXID:   entry.TXID,
+			Height: entry.Height,
+			Sender: entry.Sender,
+			Amount: entry.Amount,
+			Time:   entry.Time,
+		})
+
+		var eventType string
+		received := checkout.Received()
+		switch {
+		case checkout.IsSettled():
+			// paying again after the sale only adds to what's due back
+			checkout.Status = models.CheckoutOverpaid
+			eventType = events.CheckoutOverpaid
+		case checkout.Status == models.CheckoutLate ||
+			checkout.Status == models.CheckoutRefunded ||
+			len(checkout.Refunds) > 0:
+			// once paid late or refunded, the checkout is over, so this goes back too
+			checkout.Status = models.CheckoutLate
+			eventType = events.CheckoutLate
+		case entry.Time.After(checkout.Expiration):
+			// only when it was mined decides lateness: blocks are swept for
+			// expired checkouts before their transfers come in, so one paid
+			// in time may already be marked expired
+			checkout.Status = models.CheckoutLate
+			eventType = events.CheckoutLate
+		case received < checkout.Amount:
+			checkout.Status = models.CheckoutUnderpaid
+			eventType = events.CheckoutUnderpaid
+		default:
+			checkout.Status = models.CheckoutPaid
+			if received > checkout.Amount {
+				checkout.Status = models.CheckoutOverpaid
+			}
+			checkout.TXID = entry.TXID
+			checkout.Height = entry.Height
+			checkout.Sender = entry.Sender
+			checkout.PaidAt = time.Now()
+			eventType = events.CheckoutPaid
+			metrics.PaymentsReceived.Inc()
+		}
+		if checkout.Status != models.CheckoutPaid {
+			log.Printf("Checkout %d got %d atomic units at %s, %d in all, and is now %s", checkout.ID, entry.Amount, entry.Time, received, checkout.Status)
+		}
+		// the sale is made, so the buyer gets a receipt
+		if checkout.IsSettled() && checkout.InvoiceID == 0 {
+			if invoice, err := issueInvoice(checkout); err != nil {
+				log.Printf("Error issuing the invoice of checkout %d: %v", checkout.ID, err)
+			} else {
+				checkout.InvoiceID = invoice.ID
+			}
+		}
+
+		if err := database.CreateRecord(bucketCheckouts, &checkout); err != nil {
+			return err
+		}
+		audit(actorSystem, checkout.Status, bucketCheckouts, checkout.ID, before, checkout)
+		publishCheckout(eventType, checkout)
+		return nil
+	}
+	return nil
+}
+
+// expireCheckouts marks the checkouts still open past their expiration as
+// expired; whatever some of them got is then due back
+func expireCheckouts(now time.Time) error {
+	checkoutMu.Lock()
+	defer checkoutMu.Unlock()
+
+	var checkouts []models.Checkout
+	if err := database.GetAllRecords(bucketCheckouts, &checkouts); err != nil {
+		return err
+	}
+
+	for _, checkout := range checkouts {
+		if !checkout.IsExpired(now) {
+			continue
+		}
+
+		before := checkout
+		checkout.Status = models.CheckoutExpired
+		if err := database.CreateRecord(bucketCheckouts, &checkout); err != nil {
+			return err
+		}
+		audit(actorSystem, "expire", bucketCheckouts, checkout.ID, before, checkout)
+		publishCheckout(events.CheckoutExpired, checkout)
+	}
+	return nil
+}
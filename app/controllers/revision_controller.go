@@ -0,0 +1,145 @@
+package controllers
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/secretnamebasis/secret-site/app/config"
+	"github.com/secretnamebasis/secret-site/app/cryptography"
+	"github.com/secretnamebasis/secret-site/app/database"
+	"github.com/secretnamebasis/secret-site/app/events"
+	"github.com/secretnamebasis/secret-site/app/models"
+)
+
+// ItemRevisions retrieves the revisions of an item, without their data.
+func ItemRevisions(itemID string, viewer models.JSON_User_Order) ([]models.Revision, error) {
+	item, err := getActiveItem(itemID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := CanView(item, viewer); err != nil {
+		return nil, err
+	}
+
+	revisions, err := database.GetRevisions(itemID)
+	if err != nil {
+		return nil, err
+	}
+
+	// the listing only tells what changed when
+	for i := range revisions {
+		revisions[i].Data = nil
+	}
+	return revisions, nil
+}
+
+// GetItemRevision retrieves a revision of an item with its data decrypted;
+// revisions of private items need the owner's credentials.
+func GetItemRevision(
+	itemID,
+	revisionID string,
+	viewer models.JSON_User_Order,
+	key string,
+) (models.Revision, error) {
+	item, err := getActiveItem(itemID)
+	if err != nil {
+		return models.Revision{}, err
+	}
+
+	if err := CanView(item, viewer); err != nil {
+		return models.Revision{}, err
+	}
+
+	var revision models.Revision
+	if err := database.GetRevision(itemID, revisionID, &revision); err != nil {
+		return models.Revision{}, err
+	}
+
+	// revisions are encrypted just like the item itself
+	secret, err := itemSecret(item, viewer, key)
+	if err != nil {
+		return models.Revision{}, err
+	}
+
+	decryptedData, err := cryptography.DecryptData(revision.Data, secret)
+	if err != nil {
+		return models.Revision{}, err
+	}
+	revision.Data = decryptedData
+
+	return revision, nil
+}
+
+// RestoreItemRevision puts an earlier revision back in place of the item,
+// keeping the item's current state as a revision of its own.
+func RestoreItemRevision(itemID, revisionID string, user models.JSON_User_Order) (models.Item, error) {
+	if err := authenticateUser(user); err != nil {
+		return models.Item{}, err
+	}
+
+	item, err := getActiveItem(itemID)
+	if err != nil {
+		return models.Item{}, err
+	}
+
+	// owned items are only restored by their owner, the others by admins
+	if item.Owner != "" {
+		if err := authorizeOwner(item, user); err != nil {
+			return models.Item{}, err
+		}
+	} else {
+		account, err := GetUserByName(user.Name)
+		if err != nil {
+			return models.Item{}, err
+		}
+		if !account.IsAdmin() {
+			return models.Item{}, ErrForbidden
+		}
+	}
+
+	var revision models.Revision
+	if err := database.GetRevision(itemID, revisionID, &revision); err != nil {
+		return models.Item{}, err
+	}
+
+	if err := saveRevision(item); err != nil {
+		return models.Item{}, err
+	}
+	before := item
+
+	// the revision's data is still encrypted with the item's secret,
+	// so it goes back as it is
+	item.Title = revision.Title
+	item.Data = revision.Data
+	item.UpdatedAt = time.Now()
+
+	if err := database.CreateRecord(bucketItems, &item); err != nil {
+		return models.Item{}, err
+	}
+	audit(user.Name, "restore", bucketItems, item.ID, before, item)
+	publishItem(events.ItemUpdated, item)
+
+	return item, nil
+}
+
+// private functions
+
+// saveRevision keeps the stored state of an item as a revision,
+// then drops the revisions past the configured retention
+func saveRevision(item models.Item) error {
+	revision := models.NewRevision(item)
+	if err := revision.Validate(); err != nil {
+		return err
+	}
+
+	id := strconv.Itoa(item.ID)
+	if err := database.CreateRevision(id, revision); err != nil {
+		return err
+	}
+
+	if config.RevisionRetention > 0 {
+		return database.PruneRevisions(id, config.RevisionRetention)
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+package controllers_test
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"testing"
+
+	"github.com/secretnamebasis/secret-site/app/config"
+	"github.com/secretnamebasis/secret-site/app/controllers"
+	"github.com/secretnamebasis/secret-site/app/models"
+)
+
+// describe updates an item's description on behalf of user
+func describe(t *testing.T, id string, user models.JSON_User_Order, description string) {
+	if err := controllers.UpdateItem(id, models.JSON_Item_Order{Description: description, User: user}); err != nil {
+		t.Fatalf("Failed to update item %s: %v", id, err)
+	}
+}
+
+// description decrypts what an item, or a revision, says about itself
+func description(t *testing.T, data []byte) string {
+	var itemData models.ItemData
+	if err := json.Unmarshal(data, &itemData); err != nil {
+		t.Fatalf("Failed to unmarshal the item's data: %v", err)
+	}
+	return itemData.Description
+}
+
+func TestRevisionRetention(t *testing.T) {
+	retention := config.RevisionRetention
+	config.RevisionRetention = 2
+	t.Cleanup(func() { config.RevisionRetention = retention })
+
+	item := storedItem(t, "Drafted", "First draft", alice.Name, false)
+	id := strconv.Itoa(item.ID)
+	for _, draft := range []string{"Second draft", "Third draft", "Final draft"} {
+		describe(t, id, alice, draft)
+	}
+
+	// only the last two states before the current one are kept
+	revisions, err := controllers.ItemRevisions(id, bob)
+	if err != nil {
+		t.Fatalf("Failed to list the revisions: %v", err)
+	}
+	if len(revisions) != 2 {
+		t.Fatalf("Expected 2 revisions, but got: %+v", revisions)
+	}
+	for _, revision := range revisions {
+		if revision.Data != nil {
+			t.Errorf("Expected the listing without data, but got: %+v", revision)
+		}
+	}
+	var drafts []string
+	for _, revision := range revisions {
+		kept, err := controllers.GetItemRevision(id, strconv.Itoa(revision.ID), bob, "")
+		if err != nil {
+			t.Fatalf("Failed to get revision %d: %v", revision.ID, err)
+		}
+		drafts = append(drafts, description(t, kept.Data))
+	}
+	if drafts[0] != "Second draft" || drafts[1] != "Third draft" {
+		t.Errorf("Expected the second and third drafts kept, but got: %v", drafts)
+	}
+}
+
+func TestRestoreItemRevision(t *testing.T) {
+	item := storedItem(t, "Reverted", "Original", alice.Name, false)
+	id := strconv.Itoa(item.ID)
+	describe(t, id, alice, "Vandalized")
+
+	revisions, err := controllers.ItemRevisions(id, alice)
+	if err != nil || len(revisions) != 1 {
+		t.Fatalf("Expected one revision, but got: %+v (%v)", revisions, err)
+	}
+	revisionID := strconv.Itoa(revisions[0].ID)
+
+	// only the owner, or an admin, changes it
+	if err := controllers.UpdateItem(id, models.JSON_Item_Order{Title: "Bob's now", Price: 1, User: bob}); !errors.Is(err, controllers.ErrForbidden) {
+		t.Errorf("Expected ErrForbidden updating alice's item as bob, but got %v", err)
+	}
+	if current, err := controllers.GetItemByID(id); err != nil || current.Title != "Reverted" || current.Price != 0 {
+		t.Errorf("Expected the item untouched, but got: %+v (%v)", current, err)
+	}
+
+	// only the owner restores an owned item
+	if _, err := controllers.RestoreItemRevision(id, revisionID, bob); !errors.Is(err, controllers.ErrForbidden) {
+		t.Errorf("Expected ErrForbidden for bob, but got %v", err)
+	}
+
+	if _, err := controllers.RestoreItemRevision(id, revisionID, alice); err != nil {
+		t.Fatalf("Failed to restore the revision: %v", err)
+	}
+	restored, err := controllers.GetItemByID(id)
+	if err != nil {
+		t.Fatalf("Failed to get the item: %v", err)
+	}
+	if got := description(t, restored.Data); got != "Original" {
+		t.Errorf("Expected the original description back, but got %q", got)
+	}
+
+	// what it replaced is kept as a revision in turn
+	revisions, err = controllers.ItemRevisions(id, alice)
+	if err != nil || len(revisions) != 2 {
+		t.Fatalf("Expected two revisions, but got: %+v (%v)", revisions, err)
+	}
+	replaced, err := controllers.GetItemRevision(id, strconv.Itoa(revisions[1].ID), alice, "")
+	if err != nil {
+		t.Fatalf("Failed to get the newest revision: %v", err)
+	}
+	if got := description(t, replaced.Data); got != "Vandalized" {
+		t.Errorf("Expected the vandalized description kept, but got %q", got)
+	}
+}
+
+func TestRestoreOwnerlessItemRevision(t *testing.T) {
+	item := storedItem(t, "Nobody's", "Original", "", false)
+	id := strconv.Itoa(item.ID)
+	describe(t, id, carol, "Changed")
+
+	revisions, err := controllers.ItemRevisions(id, bob)
+	if err != nil || len(revisions) != 1 {
+		t.Fatalf("Expected one revision, but got: %+v (%v)", revisions, err)
+	}
+	revisionID := strconv.Itoa(revisions[0].ID)
+
+	// items without an owner are only restored by admins
+	if _, err := controllers.RestoreItemRevision(id, revisionID, bob); !errors.Is(err, controllers.ErrForbidden) {
+		t.Errorf("Expected ErrForbidden for bob, but got %v", err)
+	}
+	if _, err := controllers.RestoreItemRevision(id, revisionID, carol); err != nil {
+		t.Errorf("Expected an admin to restore it, but got %v", err)
+	}
+}
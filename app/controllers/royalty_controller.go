@@ -0,0 +1,86 @@
+package controllers
+
+import (
+	"sort"
+	"time"
+
+	"github.com/secretnamebasis/secret-site/app/database"
+	"github.com/secretnamebasis/secret-site/app/models"
+)
+
+// RoyaltyReport reports the sales of the NFAs a wallet created, or that
+// belong to items of the user with that wallet, from from up to to. Zero
+// times leave the range open.
+func RoyaltyReport(wallet string, from, to time.Time) (models.RoyaltyReport, error) {
+	report := models.RoyaltyReport{
+		Wallet: wallet,
+		From:   from,
+		To:     to,
+		Sales:  []models.Sale{},
+		Items:  []models.RoyaltySummary{},
+	}
+
+	owned, err := walletSCIDs(wallet)
+	if err != nil {
+		return report, err
+	}
+	sales, err := database.GetSales()
+	if err != nil {
+		return report, err
+	}
+
+	for _, sale := range sales {
+		if sale.Creator != wallet && !owned[sale.SCID] {
+			continue
+		}
+		if (!from.IsZero() && sale.Time.Before(from)) || (!to.IsZero() && !sale.Time.Before(to)) {
+			continue
+		}
+		report.Sales = append(report.Sales, sale)
+	}
+	sort.Slice(report.Sales, func(i, j int) bool {
+		return report.Sales[i].Height < report.Sales[j].Height
+	})
+
+	items := map[string]*models.RoyaltySummary{}
+	for _, sale := range report.Sales {
+		item, ok := items[sale.SCID]
+		if !ok {
+			item = &models.RoyaltySummary{SCID: sale.SCID, Name: sale.Name}
+			items[sale.SCID] = item
+		}
+		item.Add(sale)
+		report.Totals.Add(sale)
+	}
+	for _, item := range items {
+		report.Items = append(report.Items, *item)
+	}
+	sort.Slice(report.Items, func(i, j int) bool {
+		return report.Items[i].Volume > report.Items[j].Volume
+	})
+
+	return report, nil
+}
+
+// private functions
+
+// walletSCIDs returns the tokens of the items, trashed ones included, of the
+// user with the given wallet; none when there is no such user
+func walletSCIDs(wallet string) (map[string]bool, error) {
+	scids := map[string]bool{}
+	user, err := database.GetUserByWallet(wallet)
+	if err != nil || user.Name == "" {
+		return scids, nil
+	}
+
+	var items []models.Item
+	if err := database.GetAllRecords(bucketItems, &items); err != nil {
+		return nil, err
+	}
+	for _, item := range items {
+		if item.Owner == user.Name && item.SCID != "" {
+			scids[item.SCID] = true
+		}
+	}
+	return scids, nil
+}
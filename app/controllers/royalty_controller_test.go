@@ -0,0 +1,95 @@
+package controllers_test
+
+import (
+	"bytes"
+	"encoding/csv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/secretnamebasis/secret-site/app/controllers"
+	"github.com/secretnamebasis/secret-site/app/database"
+	"github.com/secretnamebasis/secret-site/app/integrations/dero"
+	"github.com/secretnamebasis/secret-site/app/models"
+)
+
+func TestRoyaltyReport(t *testing.T) {
+	item := mintForMarket(t, "Royalties")
+
+	day := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	sale := func(txid, scid, creator string, at time.Time, price uint64) {
+		t.Helper()
+		if err := database.PutSale(&models.Sale{
+			NFASale: dero.NFASale{
+				SCID:     scid,
+				Creator:  creator,
+				ListType: dero.ListSale,
+				Price:    price,
+				Royalty:  price / 10,
+			},
+			TXID:   txid,
+			Height: at.Unix(),
+			Time:   at,
+		}); err != nil {
+			t.Fatalf("Failed to store sale: %v", err)
+		}
+	}
+	// alice created one token herself, and has an item minted by the server
+	sale("created", "created-scid", wallet, day, 1000)
+	sale("minted", item.SCID, "dero1server", day.Add(time.Hour), 3000)
+	sale("earlier", "created-scid", wallet, day.AddDate(0, 0, -10), 5000)
+	sale("others", "other-scid", "dero1someone", day, 7000)
+
+	report, err := controllers.RoyaltyReport(wallet, day.AddDate(0, 0, -1), day.AddDate(0, 0, 1))
+	if err != nil {
+		t.Fatalf("Failed to report: %v", err)
+	}
+	if len(report.Sales) != 2 || report.Sales[0].TXID != "created" || report.Sales[1].TXID != "minted" {
+		t.Fatalf("Expected the two sales in range, but got: %+v", report.Sales)
+	}
+	if report.Totals.Sales != 2 || report.Totals.Volume != 4000 || report.Totals.Royalties != 400 {
+		t.Errorf("Expected 2 sales for 4000 with 400 in royalties, but got: %+v", report.Totals)
+	}
+	if len(report.Items) != 2 || report.Items[0].SCID != item.SCID {
+		t.Errorf("Expected the items by volume, but got: %+v", report.Items)
+	}
+
+	var out bytes.Buffer
+	if err := report.WriteCSV(&out); err != nil {
+		t.Fatalf("Failed to write CSV: %v", err)
+	}
+	rows, err := csv.NewReader(&out).ReadAll()
+	if err != nil {
+		t.Fatalf("Failed to read CSV: %v", err)
+	}
+	if len(rows) != 3 || rows[1][1] != "created" || rows[1][7] != "1000" || len(rows[1]) != 12 {
+		t.Errorf("Expected a header and the two sales, but got: %v", rows)
+	}
+}
+
+func TestRoyaltyReportOfUnknownWallet(t *testing.T) {
+	// an item nobody owns, whose token sold
+	item := storedItem(t, "Unclaimed", "Ownerless", "", false)
+	scid := strings.Repeat("0f", 32)
+	item.SCID = scid
+	if err := database.CreateRecord("items", &item); err != nil {
+		t.Fatalf("Failed to update the item: %v", err)
+	}
+	if err := database.PutSale(&models.Sale{
+		NFASale: dero.NFASale{SCID: scid, Creator: "dero1someone", ListType: dero.ListSale, Price: 1000},
+		TXID:    "ownerless",
+		Time:    time.Now(),
+	}); err != nil {
+		t.Fatalf("Failed to store sale: %v", err)
+	}
+
+	// a wallet no user has isn't the owner of the items nobody owns
+	stranger := "dero1qyvqpdftj8r6005xs20rnflakmwa5pdxg9vcjzdcuywq2t8skqhvwqglt6x0g"
+	report, err := controllers.RoyaltyReport(stranger, time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatalf("Failed to report: %v", err)
+	}
+	if len(report.Sales) != 0 {
+		t.Errorf("Expected no sales for a wallet nobody has, but got: %+v", report.Sales)
+	}
+}
@@ -0,0 +1,165 @@
+package controllers
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/secretnamebasis/secret-site/app/config"
+	"github.com/secretnamebasis/secret-site/app/database"
+	"github.com/secretnamebasis/secret-site/app/events"
+	"github.com/secretnamebasis/secret-site/app/models"
+)
+
+// AllTrash retrieves the items and users in the trash.
+func AllTrash() (models.Trash, error) {
+	var trash models.Trash
+
+	var items []models.Item
+	if err := database.GetAllItemTitles(bucketItems, &items); err != nil {
+		return trash, err
+	}
+	for _, item := range items {
+		if item.IsDeleted() {
+			trash.Items = append(trash.Items, item)
+		}
+	}
+
+	var users []models.User
+	if err := database.GetAllRecords(bucketUsers, &users); err != nil {
+		return trash, err
+	}
+	for _, user := range users {
+		if user.IsDeleted() {
+			trash.Users = append(trash.Users, user)
+		}
+	}
+
+	return trash, nil
+}
+
+// RestoreItem takes an item back out of the trash by ID, on behalf of the actor.
+func RestoreItem(id, actor string) (models.Item, error) {
+	var item models.Item
+	if err := database.GetRecordByID(bucketItems, id, &item); err != nil {
+		return models.Item{}, err
+	}
+	if !item.IsDeleted() {
+		return models.Item{}, fmt.Errorf("record with ID %s not found in trash", id)
+	}
+	before := item
+
+	item.DeletedAt = time.Time{}
+	if err := database.CreateRecord(bucketItems, &item); err != nil {
+		return models.Item{}, err
+	}
+	audit(actor, "restore", bucketItems, item.ID, before, item)
+	publishItem(events.ItemUpdated, item)
+	return item, nil
+}
+
+// RestoreUser takes a user back out of the trash by ID, on behalf of the
+// actor, along with the items that were deleted with them.
+func RestoreUser(id, actor string) (models.User, error) {
+	var user models.User
+	if err := database.GetRecordByID(bucketUsers, id, &user); err != nil {
+		return models.User{}, err
+	}
+	if !user.IsDeleted() {
+		return models.User{}, fmt.Errorf("record with ID %s not found in trash", id)
+	}
+
+	var items []models.Item
+	if err := database.GetAllItemTitles(bucketItems, &items); err != nil {
+		return models.User{}, err
+	}
+	for _, item := range items {
+		// items deleted on their own stay in the trash
+		if item.Owner != user.Name || !item.DeletedAt.Equal(user.DeletedAt) {
+			continue
+		}
+		before := item
+		item.DeletedAt = time.Time{}
+		if err := database.CreateRecord(bucketItems, &item); err != nil {
+			return models.User{}, err
+		}
+		audit(actor, "restore", bucketItems, item.ID, before, item)
+		publishItem(events.ItemUpdated, item)
+	}
+
+	before := user
+	user.DeletedAt = time.Time{}
+	if err := database.CreateRecord(bucketUsers, &user); err != nil {
+		return models.User{}, err
+	}
+	audit(actor, "restore", bucketUsers, user.ID, before, user)
+	return user, nil
+}
+
+// PurgeTrash deletes, for good, the records that have been in the trash longer than the retention.
+func PurgeTrash(retention time.Duration) error {
+	cutoff := time.Now().Add(-retention)
+
+	trash, err := AllTrash()
+	if err != nil {
+		return err
+	}
+
+	for _, item := range trash.Items {
+		if item.DeletedAt.After(cutoff) {
+			continue
+		}
+		if err := purgeItem(item); err != nil {
+			return err
+		}
+	}
+
+	for _, user := range trash.Users {
+		if user.DeletedAt.After(cutoff) {
+			continue
+		}
+		if err := purgeUser(user); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// RunTrashPurge purges the trash at every interval; run it in a goroutine of its own.
+func RunTrashPurge(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if err := PurgeTrash(config.TrashRetention); err != nil {
+			log.Printf("Error purging trash: %v", err)
+		}
+	}
+}
+
+// private functions
+
+// purgeUser deletes a user, and the grants they hold, from the database for good
+func purgeUser(user models.User) error {
+	var grants []models.Grant
+	if err := database.GetAllRecords(bucketGrants, &grants); err != nil {
+		return err
+	}
+	for _, grant := range grants {
+		if grant.Grantee != user.Name {
+			continue
+		}
+		if err := database.DeleteRecord(bucketGrants, strconv.Itoa(grant.ID)); err != nil {
+			return err
+		}
+		audit(actorSystem, "purge", bucketGrants, grant.ID, grant, nil)
+	}
+
+	if err := database.DeleteRecord(bucketUsers, strconv.Itoa(user.ID)); err != nil {
+		return err
+	}
+	audit(actorSystem, "purge", bucketUsers, user.ID, user, nil)
+	return nil
+}
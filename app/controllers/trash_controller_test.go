@@ -0,0 +1,174 @@
+package controllers_test
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/secretnamebasis/secret-site/app/controllers"
+	"github.com/secretnamebasis/secret-site/app/database"
+	"github.com/secretnamebasis/secret-site/app/models"
+)
+
+// inTrash tells whether the trash holds the item
+func inTrash(t *testing.T, id int) bool {
+	trash, err := controllers.AllTrash()
+	if err != nil {
+		t.Fatalf("Failed to list the trash: %v", err)
+	}
+	for _, item := range trash.Items {
+		if item.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// listed tells whether the item is among the active ones
+func listed(t *testing.T, id int) bool {
+	items, err := controllers.AllItems()
+	if err != nil {
+		t.Fatalf("Failed to list the items: %v", err)
+	}
+	for _, item := range items {
+		if item.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// ageInTrash backdates when a record was deleted
+func ageInTrash(t *testing.T, bucket string, record interface{}, deletedAt time.Time) {
+	switch r := record.(type) {
+	case *models.Item:
+		r.DeletedAt = deletedAt
+	case *models.User:
+		r.DeletedAt = deletedAt
+	}
+	if err := database.CreateRecord(bucket, record); err != nil {
+		t.Fatalf("Failed to backdate the record: %v", err)
+	}
+}
+
+func TestDeletedItemsAreHidden(t *testing.T) {
+	item := storedItem(t, "Thrown away", "Trash", alice.Name, false)
+	id := strconv.Itoa(item.ID)
+
+	// only the owner, or an admin, throws it away
+	if err := controllers.DeleteItem(id, bob); !errors.Is(err, controllers.ErrForbidden) {
+		t.Errorf("Expected ErrForbidden deleting alice's item as bob, but got %v", err)
+	}
+	if !listed(t, item.ID) {
+		t.Fatalf("Expected the item still listed")
+	}
+
+	if err := controllers.DeleteItem(id, alice); err != nil {
+		t.Fatalf("Failed to delete the item: %v", err)
+	}
+	if _, err := controllers.GetItemByID(id); err == nil {
+		t.Errorf("Expected a deleted item not to be found")
+	}
+	if _, err := controllers.ItemRevisions(id, alice); err == nil {
+		t.Errorf("Expected no revisions of a deleted item")
+	}
+	if err := controllers.DeleteItem(id, alice); err == nil {
+		t.Errorf("Expected a deleted item not to be deleted again")
+	}
+	if listed(t, item.ID) || !inTrash(t, item.ID) {
+		t.Errorf("Expected the item in the trash and off the list")
+	}
+
+	if _, err := controllers.RestoreItem(id, carol.Name); err != nil {
+		t.Fatalf("Failed to restore the item: %v", err)
+	}
+	if _, err := controllers.GetItemByID(id); err != nil {
+		t.Errorf("Expected the restored item to be found, but got %v", err)
+	}
+	if !listed(t, item.ID) || inTrash(t, item.ID) {
+		t.Errorf("Expected the item back on the list and out of the trash")
+	}
+	if _, err := controllers.RestoreItem(id, carol.Name); err == nil {
+		t.Errorf("Expected an item out of the trash not to be restored again")
+	}
+}
+
+func TestDeletedUsersTakeTheirItems(t *testing.T) {
+	ivan := newUser(t, "ivan", "ivan-password", wallet)
+	item := storedItem(t, "Ivan's", "Belongings", ivan.Name, false)
+	id := strconv.Itoa(userID(t, ivan.Name))
+
+	if err := controllers.DeleteUser(id, carol); err != nil {
+		t.Fatalf("Failed to delete the user: %v", err)
+	}
+	if user, err := controllers.GetUserByName(ivan.Name); err != nil || user.Name != "" {
+		t.Errorf("Expected a deleted user not to be found, but got: %+v (%v)", user, err)
+	}
+	if listed(t, item.ID) {
+		t.Errorf("Expected the user's item to go with them")
+	}
+
+	if _, err := controllers.RestoreUser(id, carol.Name); err != nil {
+		t.Fatalf("Failed to restore the user: %v", err)
+	}
+	if !listed(t, item.ID) {
+		t.Errorf("Expected the user's item back with them")
+	}
+}
+
+func TestPurgeTrash(t *testing.T) {
+	old := storedItem(t, "Long gone", "Old trash", alice.Name, false)
+	recent := storedItem(t, "Just gone", "New trash", alice.Name, false)
+	describe(t, strconv.Itoa(old.ID), alice, "Revised trash")
+	if _, err := controllers.CreateGrant(strconv.Itoa(old.ID), models.JSON_Grant_Order{Grantee: bob.Name, User: alice}); err != nil {
+		t.Fatalf("Failed to grant bob: %v", err)
+	}
+	judy := newUser(t, "judy", "judy-password", wallet)
+	for _, id := range []int{old.ID, recent.ID} {
+		if err := controllers.DeleteItem(strconv.Itoa(id), alice); err != nil {
+			t.Fatalf("Failed to delete item %d: %v", id, err)
+		}
+	}
+	if err := controllers.DeleteUser(strconv.Itoa(userID(t, judy.Name)), carol); err != nil {
+		t.Fatalf("Failed to delete the user: %v", err)
+	}
+
+	// only what has been in the trash longer than the retention goes
+	var item models.Item
+	if err := database.GetRecordByID("items", strconv.Itoa(old.ID), &item); err != nil {
+		t.Fatalf("Failed to get the item: %v", err)
+	}
+	ageInTrash(t, "items", &item, time.Now().Add(-2*time.Hour))
+	user, err := database.GetUserByUsername(judy.Name)
+	if err != nil {
+		t.Fatalf("Failed to get the user: %v", err)
+	}
+	ageInTrash(t, "users", &user, time.Now().Add(-2*time.Hour))
+
+	if err := controllers.PurgeTrash(time.Hour); err != nil {
+		t.Fatalf("Failed to purge the trash: %v", err)
+	}
+
+	if err := database.GetRecordByID("items", strconv.Itoa(old.ID), &item); err == nil {
+		t.Errorf("Expected the old item purged")
+	}
+	if revisions, err := database.GetRevisions(strconv.Itoa(old.ID)); err != nil || len(revisions) != 0 {
+		t.Errorf("Expected the old item's revisions purged, but got: %+v (%v)", revisions, err)
+	}
+	var grants []models.Grant
+	if err := database.GetAllRecords("grants", &grants); err != nil {
+		t.Fatalf("Failed to get the grants: %v", err)
+	}
+	for _, grant := range grants {
+		if grant.ItemID == old.ID {
+			t.Errorf("Expected the old item's grants purged, but got: %+v", grant)
+		}
+	}
+	if user, err := database.GetUserByUsername(judy.Name); err != nil || user.Name != "" {
+		t.Errorf("Expected the old user purged, but got: %+v (%v)", user, err)
+	}
+	if !inTrash(t, recent.ID) {
+		t.Errorf("Expected the recent item still in the trash")
+	}
+}
@@ -2,6 +2,7 @@ package controllers
 
 import (
 	"errors"
+	"fmt"
 	"time"
 
 	"github.com/secretnamebasis/secret-site/app/cryptography"
@@ -48,21 +49,30 @@ func CreateUserRecord(order *models.JSON_User_Order) error {
 	user.Initialize()
 
 	// Store the user record in the database
-	return database.CreateRecord(bucketUsers, &user)
+	if err := database.CreateRecord(bucketUsers, &user); err != nil {
+		return err
+	}
+	audit(user.Name, "create", bucketUsers, user.ID, nil, user)
+	return nil
 }
 
-// AllUsers retrieves all users from the database.
+// AllUsers retrieves all users, except those in the trash, from the database.
 func AllUsers() ([]models.User, error) {
 	var users []models.User
 	err := database.GetAllRecords(bucketUsers, &users)
-	return users, err
+	return activeUsers(users), err
 }
 
 // GetUserByID retrieves a user from the database by ID.
 func GetUserByID(id string) (models.User, error) {
 	var user models.User
-	err := database.GetRecordByID(bucketUsers, id, &user)
-	return user, err
+	if err := database.GetRecordByID(bucketUsers, id, &user); err != nil {
+		return user, err
+	}
+	if user.IsDeleted() {
+		return models.User{}, fmt.Errorf("record with ID %s not found", id)
+	}
+	return user, nil
 }
 
 func GetUserByName(name string) (models.User, error) {
@@ -70,13 +80,15 @@ func GetUserByName(name string) (models.User, error) {
 	if err != nil {
 		return existingUser, errors.New("error checking user existence")
 	}
-	if existingUser.Name != "" {
+	if existingUser.Name != "" && !existingUser.IsDeleted() {
 		return existingUser, nil
 	}
 	return models.User{}, err
 }
 
 // UpdateUser updates a user in the database with the provided ID and updated data.
+// It takes the user's current password; a new one rewraps the keys of their
+// private items along with it.
 func UpdateUser(order models.JSON_User_Order) error {
 	// Check if user with the provided ID exists
 	existingUser, err := database.GetUserByUsername(order.Name)
@@ -84,9 +96,15 @@ func UpdateUser(order models.JSON_User_Order) error {
 	if err != nil {
 		return errors.New("error checking user existence")
 	}
-	if existingUser.Name == "" {
+	if existingUser.Name == "" || existingUser.IsDeleted() {
 		return errors.New("user not found")
 	}
+	previousUser := existingUser
+
+	// only the user may change themselves
+	if err := authenticateUser(models.JSON_User_Order{Name: order.Name, Password: order.OldPassword}); err != nil {
+		return ErrForbidden
+	}
 
 	// Validate wallet address
 	if err := ValidateWalletAddress(order.Wallet); err != nil {
@@ -99,23 +117,66 @@ func UpdateUser(order models.JSON_User_Order) error {
 		existingUser.Wallet = order.Wallet
 	}
 	// Always update the password if provided
-	if order.Password != "" {
+	keys := map[int][]byte{}
+	if order.Password != "" && order.Password != order.OldPassword {
 		existingUser.Password = []byte( // it will be "best" to store as byte
 			cryptography.HashString( // so let's hash the string up
 				order.Password, // because we don't want to record this anywhere
 			),
 		)
+		if keys, err = rewrapItemKeys(existingUser.Name, order.OldPassword, order.Password); err != nil {
+			return err
+		}
 	}
 
 	existingUser.UpdatedAt = time.Now()
 
-	// Update the user record in the database
-	return database.CreateRecord(bucketUsers, &existingUser)
+	// Update the user record, and the keys, in the database
+	if err := database.UpdateUserKeys(&existingUser, keys); err != nil {
+		return err
+	}
+	audit(order.Name, "update", bucketUsers, existingUser.ID, previousUser, existingUser)
+	return nil
 }
 
-// DeleteUser deletes a user from the database by ID.
-func DeleteUser(id string) error {
-	return database.DeleteRecord(bucketUsers, id)
+// DeleteUser moves a user, and the items they own, to the trash by ID,
+// on behalf of the actor.
+func DeleteUser(id string, actor models.JSON_User_Order) error {
+	if err := authenticateUser(actor); err != nil {
+		return ErrForbidden
+	}
+	user, err := GetUserByID(id)
+	if err != nil {
+		return err
+	}
+
+	// the user's items go along with them, at the same moment,
+	// so that restoring the user brings them back too
+	deletedAt := time.Now()
+
+	var items []models.Item
+	if err := database.GetAllItemTitles(bucketItems, &items); err != nil {
+		return err
+	}
+	for _, item := range activeItems(items) {
+		if item.Owner != user.Name {
+			continue
+		}
+		before := item
+		item.DeletedAt = deletedAt
+		if err := database.CreateRecord(bucketItems, &item); err != nil {
+			return err
+		}
+		audit(actor.Name, "delete", bucketItems, item.ID, before, item)
+	}
+
+	before := user
+	user.DeletedAt = deletedAt
+	if err := database.CreateRecord(bucketUsers, &user); err != nil {
+		return err
+	}
+	audit(actor.Name, "delete", bucketUsers, user.ID, before, user)
+	return nil
 }
 
 // NextUserID returns the next available user ID.
@@ -123,6 +184,17 @@ func NextUserID() (int, error) {
 	return database.NextID(bucketUsers)
 }
 
+// activeUsers leaves out the users in the trash
+func activeUsers(users []models.User) []models.User {
+	var active []models.User
+	for _, user := range users {
+		if !user.IsDeleted() {
+			active = append(active, user)
+		}
+	}
+	return active
+}
+
 // checkUserExistence checks if a user with the same username or wallet already exists
 func checkUserExistence(order models.JSON_User_Order) error {
 
@@ -147,3 +219,32 @@ func checkUserExistence(order models.JSON_User_Order) error {
 
 	return nil
 }
+
+// rewrapItemKeys wraps the keys of the owner's private items, trashed ones
+// too, with a new password. Keys the owner sealed with a key of their own
+// don't open with the password, and are left as they are.
+func rewrapItemKeys(owner, oldPassword, newPassword string) (map[int][]byte, error) {
+	var items []models.Item
+	if err := database.GetAllRecords(bucketItems, &items); err != nil {
+		return nil, err
+	}
+
+	keys := map[int][]byte{}
+	for _, item := range items {
+		if item.Owner != owner || !item.IsPrivate() {
+			continue
+		}
+		wrapped, err := database.GetItemKey(item.ID)
+		if err != nil {
+			return nil, err
+		}
+		dataKey, err := cryptography.UnwrapKey(wrapped, oldPassword)
+		if err != nil {
+			continue
+		}
+		if keys[item.ID], err = cryptography.WrapKey(dataKey, newPassword); err != nil {
+			return nil, fmt.Errorf("error rewrapping the key of item %d: %w", item.ID, err)
+		}
+	}
+	return keys, nil
+}
@@ -0,0 +1,107 @@
+package controllers_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/secretnamebasis/secret-site/app/config"
+	"github.com/secretnamebasis/secret-site/app/controllers"
+	"github.com/secretnamebasis/secret-site/app/cryptography"
+	"github.com/secretnamebasis/secret-site/app/database"
+	"github.com/secretnamebasis/secret-site/app/models"
+)
+
+// newUser makes a user of their own for tests that change one
+func newUser(t *testing.T, name, password, wallet string) models.JSON_User_Order {
+	// TestMain's users were stored without the bucket's sequence
+	var users []models.User
+	if err := database.GetAllRecords("users", &users); err != nil {
+		t.Fatalf("Failed to get the users: %v", err)
+	}
+	id := 0
+	for _, user := range users {
+		id = max(id, user.ID)
+	}
+	record := models.User{
+		ID:        id + 1,
+		Name:      name,
+		Wallet:    wallet,
+		Password:  cryptography.HashString(password),
+		Role:      []string{"user"},
+		CreatedAt: time.Now(),
+	}
+	if err := database.CreateRecord("users", &record); err != nil {
+		t.Fatalf("Failed to create %s: %v", name, err)
+	}
+	return models.JSON_User_Order{Name: name, Password: password}
+}
+
+func TestUpdatePasswordRewrapsItemKeys(t *testing.T) {
+	dave := newUser(t, "dave", "dave-password", wallet)
+	config.NodeEndpoint = fakeNFANode(t, "", "", nil, nil).URL
+
+	item, err := controllers.CreateItemRecord(&models.JSON_Item_Order{
+		Title:       "Dave's diary",
+		SCID:        fmt.Sprintf("%064x", 26),
+		Description: "Dear diary",
+		Private:     true,
+		User:        dave,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create the private item: %v", err)
+	}
+
+	// the wrapped key stays out of the item's JSON
+	itemJSON, err := json.Marshal(item)
+	if err != nil {
+		t.Fatalf("Failed to marshal the item: %v", err)
+	}
+	if bytes.Contains(itemJSON, []byte("wrapped_key")) {
+		t.Errorf("Expected no wrapped key in the item's JSON, but got: %s", itemJSON)
+	}
+
+	// the current password is needed to change it
+	err = controllers.UpdateUser(models.JSON_User_Order{
+		Name:        dave.Name,
+		Wallet:      wallet,
+		Password:    "new-password",
+		OldPassword: "wrong-password",
+	})
+	if !errors.Is(err, controllers.ErrForbidden) {
+		t.Fatalf("Expected ErrForbidden for a wrong password, but got %v", err)
+	}
+
+	err = controllers.UpdateUser(models.JSON_User_Order{
+		Name:        dave.Name,
+		Wallet:      wallet,
+		Password:    "new-password",
+		OldPassword: dave.Password,
+	})
+	if err != nil {
+		t.Fatalf("Failed to change the password: %v", err)
+	}
+
+	stored, err := controllers.GetItemByID(fmt.Sprint(item.ID))
+	if err != nil {
+		t.Fatalf("Failed to get the item: %v", err)
+	}
+	if !stored.IsPrivate() {
+		t.Fatalf("Expected the stored item to be private, but got: %+v", stored)
+	}
+	if _, err := controllers.UnlockItem(stored, dave, ""); err == nil {
+		t.Errorf("Expected the old password to unlock nothing")
+	}
+	dave.Password = "new-password"
+	unlocked, err := controllers.UnlockItem(stored, dave, "")
+	if err != nil {
+		t.Fatalf("Failed to unlock with the new password: %v", err)
+	}
+	var data models.ItemData
+	if err := json.Unmarshal(unlocked.Data, &data); err != nil || data.Description != "Dear diary" {
+		t.Errorf("Expected the diary, but got: %s (%v)", unlocked.Data, err)
+	}
+}
@@ -0,0 +1,487 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/secretnamebasis/secret-site/app/config"
+	"github.com/secretnamebasis/secret-site/app/cryptography"
+	"github.com/secretnamebasis/secret-site/app/database"
+	"github.com/secretnamebasis/secret-site/app/events"
+	"github.com/secretnamebasis/secret-site/app/metrics"
+	"github.com/secretnamebasis/secret-site/app/models"
+	"github.com/secretnamebasis/secret-site/app/safehttp"
+)
+
+// Headers that go along with every webhook delivery; the signature is the
+// HMAC-SHA256 of the timestamp, a dot and the body, under the webhook's secret
+const (
+	HeaderWebhookEvent     = "X-Webhook-Event"
+	HeaderWebhookDelivery  = "X-Webhook-Delivery"
+	HeaderWebhookTimestamp = "X-Webhook-Timestamp"
+	HeaderWebhookSignature = "X-Webhook-Signature"
+)
+
+// webhookEvents are the event types webhooks may be told about
+var webhookEvents = []string{
+	events.ItemCreated,
+	events.ItemUpdated,
+	events.ItemDeleted,
+	events.CheckoutPaid,
+	events.CheckoutExpired,
+	events.CheckoutUnderpaid,
+	events.CheckoutOverpaid,
+	events.CheckoutLate,
+	events.CheckoutRefunded,
+}
+
+// Retries back off from webhookBackoff, doubling up to webhookMaxBackoff
+const (
+	webhookBackoff    = 30 * time.Second
+	webhookMaxBackoff = time.Hour
+)
+
+// webhookWorkers is how many webhooks are posted to at once, so one that
+// hangs doesn't hold up the others
+const webhookWorkers = 8
+
+// Deliveries that are done are kept in the log for deliveryRetention, and
+// the log is pruned every deliveryPruneInterval
+const (
+	deliveryRetention     = 7 * 24 * time.Hour
+	deliveryPruneInterval = time.Hour
+)
+
+// webhookClient posts deliveries, only ever to public addresses; endpoints
+// that hang count as failed
+var webhookClient = safehttp.NewClient(10 * time.Second)
+
+// CreateWebhook registers an endpoint to be told about the events its owner may see.
+func CreateWebhook(order models.JSON_Webhook_Order) (models.Webhook, error) {
+	if err := authenticateUser(order.User); err != nil {
+		return models.Webhook{}, ErrForbidden
+	}
+
+	if err := order.Validate(); err != nil {
+		return models.Webhook{}, err
+	}
+	for _, eventType := range order.Events {
+		if !isWebhookEvent(eventType) {
+			return models.Webhook{}, fmt.Errorf("unknown event %q", eventType)
+		}
+	}
+
+	id, err := database.NextID(bucketWebhooks)
+	if err != nil {
+		return models.Webhook{}, err
+	}
+
+	secret, err := cryptography.GenerateKey()
+	if err != nil {
+		return models.Webhook{}, err
+	}
+
+	webhook := models.Webhook{
+		ID:        id,
+		Owner:     order.User.Name,
+		URL:       order.URL,
+		Events:    order.Events,
+		Secret:    hex.EncodeToString(secret),
+		CreatedAt: time.Now(),
+	}
+
+	if err := webhook.Validate(); err != nil {
+		return models.Webhook{}, err
+	}
+
+	if err := database.CreateRecord(bucketWebhooks, &webhook); err != nil {
+		return models.Webhook{}, err
+	}
+	audit(order.User.Name, "create", bucketWebhooks, webhook.ID, nil, webhook)
+
+	return webhook, nil
+}
+
+// Webhooks retrieves the user's webhooks, without their secrets.
+func Webhooks(user models.JSON_User_Order) ([]models.Webhook, error) {
+	if err := authenticateUser(user); err != nil {
+		return nil, ErrForbidden
+	}
+
+	var webhooks []models.Webhook
+	if err := database.GetAllRecords(bucketWebhooks, &webhooks); err != nil {
+		return nil, err
+	}
+
+	owned := []models.Webhook{}
+	for _, webhook := range webhooks {
+		if webhook.Owner == user.Name {
+			webhook.Secret = ""
+			owned = append(owned, webhook)
+		}
+	}
+	return owned, nil
+}
+
+// DeleteWebhook removes one of the user's webhooks; its pending deliveries fail.
+func DeleteWebhook(id string, user models.JSON_User_Order) error {
+	webhook, err := ownedWebhook(id, user)
+	if err != nil {
+		return err
+	}
+
+	if err := database.DeleteRecord(bucketWebhooks, id); err != nil {
+		return err
+	}
+	audit(user.Name, "delete", bucketWebhooks, webhook.ID, webhook, nil)
+	return nil
+}
+
+// WebhookDeliveries retrieves the delivery log of one of the user's webhooks, latest first.
+func WebhookDeliveries(id string, user models.JSON_User_Order) ([]models.Delivery, error) {
+	webhook, err := ownedWebhook(id, user)
+	if err != nil {
+		return nil, err
+	}
+
+	var deliveries []models.Delivery
+	if err := database.GetAllRecords(bucketDeliveries, &deliveries); err != nil {
+		return nil, err
+	}
+
+	logged := []models.Delivery{}
+	for _, delivery := range deliveries {
+		if delivery.WebhookID == webhook.ID {
+			logged = append(logged, delivery)
+		}
+	}
+	// keys sort as strings, so "10" comes before "9"
+	sort.Slice(logged, func(i, j int) bool {
+		return logged[i].ID > logged[j].ID
+	})
+	return logged, nil
+}
+
+// RedeliverWebhook queues an earlier delivery to one of the user's webhooks
+// again, as a new delivery.
+func RedeliverWebhook(id, deliveryID string, user models.JSON_User_Order) (models.Delivery, error) {
+	webhook, err := ownedWebhook(id, user)
+	if err != nil {
+		return models.Delivery{}, err
+	}
+
+	var original models.Delivery
+	if err := database.GetRecordByID(bucketDeliveries, deliveryID, &original); err != nil {
+		return models.Delivery{}, err
+	}
+	// the delivery has to belong to this webhook
+	if original.WebhookID != webhook.ID {
+		return models.Delivery{}, errors.New("record with ID " + deliveryID + " not found")
+	}
+
+	delivery, err := queueDelivery(webhook, original.EventID, original.EventType, original.Payload)
+	if err != nil {
+		return models.Delivery{}, err
+	}
+	delivery.RedeliveryOf = original.ID
+	if err := database.PutDelivery(&delivery); err != nil {
+		return models.Delivery{}, err
+	}
+	audit(user.Name, "redeliver", bucketDeliveries, delivery.ID, original, delivery)
+
+	return delivery, nil
+}
+
+// WatchWebhooks queues a delivery to every webhook that wants an event and
+// whose owner may see it; run it in a goroutine of its own.
+func WatchWebhooks() {
+	sub := events.Subscribe(webhookEvents...)
+	defer sub.Close()
+
+	for event := range sub.C {
+		if err := queueDeliveries(event); err != nil {
+			log.Printf("Error queueing webhook deliveries for event %d: %v", event.ID, err)
+		}
+	}
+}
+
+// DeliverWebhooks tries the pending deliveries that are due at the given
+// time; failed attempts are retried with exponential backoff until the
+// configured number of attempts is reached. Webhooks are posted to side by
+// side, each one's deliveries in the order they were queued; one that fails
+// isn't tried again before the next round.
+func DeliverWebhooks(now time.Time) error {
+	deliveries, err := database.GetPendingDeliveries()
+	if err != nil {
+		return err
+	}
+
+	due := map[int][]models.Delivery{}
+	for _, delivery := range deliveries {
+		if delivery.IsDue(now) {
+			due[delivery.WebhookID] = append(due[delivery.WebhookID], delivery)
+		}
+	}
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		errs    []error
+		workers = make(chan struct{}, webhookWorkers)
+	)
+	for webhookID, queue := range due {
+		wg.Add(1)
+		go func(webhookID int, queue []models.Delivery) {
+			defer wg.Done()
+			workers <- struct{}{}
+			defer func() { <-workers }()
+
+			if err := deliverQueue(webhookID, queue, now); err != nil {
+				mu.Lock()
+				errs = append(errs, fmt.Errorf("webhook %d: %w", webhookID, err))
+				mu.Unlock()
+			}
+		}(webhookID, queue)
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// PruneDeliveries drops the deliveries that were done before the retention
+// from the log; pending ones are kept however old they are.
+func PruneDeliveries(retention time.Duration) error {
+	pruned, err := database.PruneDeliveries(time.Now().Add(-retention))
+	if err != nil {
+		return err
+	}
+	if pruned > 0 {
+		log.Printf("Pruned %d webhook deliveries", pruned)
+	}
+	return nil
+}
+
+// RunWebhookDeliveries delivers what is due at every interval, and prunes
+// the log now and then; the queue lives in the database, so deliveries
+// pending at shutdown go out after a restart. Run it in a goroutine of its
+// own.
+func RunWebhookDeliveries(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var pruned time.Time
+	for range ticker.C {
+		if err := DeliverWebhooks(time.Now()); err != nil {
+			log.Printf("Error delivering webhooks: %v", err)
+		}
+		if time.Since(pruned) < deliveryPruneInterval {
+			continue
+		}
+		if err := PruneDeliveries(deliveryRetention); err != nil {
+			log.Printf("Error pruning webhook deliveries: %v", err)
+		}
+		pruned = time.Now()
+	}
+}
+
+// private functions
+
+// queueDeliveries queues the event for every webhook that is to be told about it
+func queueDeliveries(event events.Event) error {
+	var webhooks []models.Webhook
+	if err := database.GetAllRecords(bucketWebhooks, &webhooks); err != nil {
+		return err
+	}
+
+	var payload []byte
+	for _, webhook := range webhooks {
+		if !webhook.Wants(event.Type) {
+			continue
+		}
+
+		// users in the trash aren't told anything
+		owner, err := database.GetUserByUsername(webhook.Owner)
+		if err != nil {
+			return err
+		}
+		if owner.Name == "" || owner.IsDeleted() {
+			continue
+		}
+
+		// webhooks see what their owner would see on the event stream
+		stream := &EventStream{viewer: webhook.Owner}
+		if !stream.Visible(event) {
+			continue
+		}
+
+		if payload == nil {
+			var err error
+			if payload, err = json.Marshal(event); err != nil {
+				return err
+			}
+		}
+
+		delivery, err := queueDelivery(webhook, event.ID, event.Type, payload)
+		if err != nil {
+			return err
+		}
+		if err := database.PutDelivery(&delivery); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// queueDelivery prepares a pending delivery of the payload, due right away
+func queueDelivery(webhook models.Webhook, eventID uint64, eventType string, payload []byte) (models.Delivery, error) {
+	id, err := database.NextID(bucketDeliveries)
+	if err != nil {
+		return models.Delivery{}, err
+	}
+
+	now := time.Now()
+	delivery := models.Delivery{
+		ID:          id,
+		WebhookID:   webhook.ID,
+		EventID:     eventID,
+		EventType:   eventType,
+		Payload:     payload,
+		Status:      models.DeliveryPending,
+		NextAttempt: now,
+		CreatedAt:   now,
+	}
+	return delivery, delivery.Validate()
+}
+
+// deliverQueue tries a webhook's due deliveries in order, stopping at the
+// first one that doesn't go through
+func deliverQueue(webhookID int, queue []models.Delivery, now time.Time) error {
+	sort.Slice(queue, func(i, j int) bool {
+		return queue[i].ID < queue[j].ID
+	})
+
+	var webhook models.Webhook
+	err := database.GetRecordByID(bucketWebhooks, strconv.Itoa(webhookID), &webhook)
+	if err != nil && !strings.Contains(err.Error(), "not found") {
+		return err
+	}
+	deleted := err != nil
+
+	for _, delivery := range queue {
+		if deleted {
+			delivery.Status = models.DeliveryFailed
+			delivery.LastError = "webhook deleted"
+		} else {
+			attempt(webhook, &delivery, now)
+		}
+
+		if err := database.PutDelivery(&delivery); err != nil {
+			return err
+		}
+		if !deleted && delivery.Status != models.DeliveryDelivered {
+			return nil
+		}
+	}
+	return nil
+}
+
+// attempt posts the delivery once and records how it went
+func attempt(webhook models.Webhook, delivery *models.Delivery, now time.Time) {
+	delivery.Attempts++
+
+	status, err := post(webhook, *delivery, now)
+	delivery.ResponseStatus = status
+	if err == nil {
+		delivery.Status = models.DeliveryDelivered
+		delivery.LastError = ""
+		delivery.DeliveredAt = now
+		metrics.WebhookDeliveries.WithLabelValues("delivered").Inc()
+		return
+	}
+
+	delivery.LastError = err.Error()
+	if delivery.Attempts >= config.WebhookAttempts {
+		delivery.Status = models.DeliveryFailed
+		metrics.WebhookDeliveries.WithLabelValues("failed").Inc()
+		return
+	}
+	delivery.NextAttempt = now.Add(backoff(delivery.Attempts))
+	metrics.WebhookDeliveries.WithLabelValues("retry").Inc()
+}
+
+// post sends the signed payload to the webhook and returns the response status
+func post(webhook models.Webhook, delivery models.Delivery, now time.Time) (int, error) {
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	signed := append([]byte(timestamp+"."), delivery.Payload...)
+
+	request, err := http.NewRequest(http.MethodPost, webhook.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return 0, err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set(HeaderWebhookEvent, delivery.EventType)
+	request.Header.Set(HeaderWebhookDelivery, strconv.Itoa(delivery.ID))
+	request.Header.Set(HeaderWebhookTimestamp, timestamp)
+	request.Header.Set(HeaderWebhookSignature, "sha256="+cryptography.Sign(webhook.Secret, signed))
+
+	response, err := webhookClient.Do(request)
+	if err != nil {
+		return 0, err
+	}
+	defer response.Body.Close()
+	// drain a little, so the connection can be reused
+	_, _ = io.Copy(io.Discard, io.LimitReader(response.Body, 4096))
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return response.StatusCode, fmt.Errorf("endpoint answered %s", response.Status)
+	}
+	return response.StatusCode, nil
+}
+
+// backoff is how long to wait after the given number of failed attempts
+func backoff(attempts int) time.Duration {
+	wait := webhookBackoff
+	for i := 1; i < attempts && wait < webhookMaxBackoff; i++ {
+		wait *= 2
+	}
+	if wait > webhookMaxBackoff {
+		wait = webhookMaxBackoff
+	}
+	return wait
+}
+
+// ownedWebhook retrieves a webhook by ID, for its owner
+func ownedWebhook(id string, user models.JSON_User_Order) (models.Webhook, error) {
+	if err := authenticateUser(user); err != nil {
+		return models.Webhook{}, ErrForbidden
+	}
+
+	var webhook models.Webhook
+	if err := database.GetRecordByID(bucketWebhooks, id, &webhook); err != nil {
+		return models.Webhook{}, err
+	}
+	if webhook.Owner != user.Name {
+		return models.Webhook{}, ErrForbidden
+	}
+	return webhook, nil
+}
+
+// isWebhookEvent tells whether webhooks may be told about the event type
+func isWebhookEvent(eventType string) bool {
+	for _, e := range webhookEvents {
+		if e == eventType {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,326 @@
+package controllers_test
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/secretnamebasis/secret-site/app/config"
+	"github.com/secretnamebasis/secret-site/app/controllers"
+	"github.com/secretnamebasis/secret-site/app/events"
+	"github.com/secretnamebasis/secret-site/app/models"
+	"github.com/secretnamebasis/secret-site/app/safehttp"
+)
+
+// receiver is a webhook endpoint that checks signatures and answers with status
+type receiver struct {
+	*httptest.Server
+	t        *testing.T
+	secret   string
+	status   atomic.Int32
+	received atomic.Int32
+	// hold, when set, keeps every answer back until it is closed
+	hold chan struct{}
+}
+
+func newReceiver(t *testing.T) *receiver {
+	r := &receiver{t: t}
+	r.status.Store(http.StatusOK)
+	r.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+
+		mac := hmac.New(sha256.New, []byte(r.secret))
+		mac.Write([]byte(req.Header.Get(controllers.HeaderWebhookTimestamp) + "."))
+		mac.Write(body)
+		expected := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+		if !hmac.Equal([]byte(req.Header.Get(controllers.HeaderWebhookSignature)), []byte(expected)) {
+			r.t.Errorf("Expected a valid signature, but got: %s", req.Header.Get(controllers.HeaderWebhookSignature))
+		}
+
+		var event events.Event
+		if err := json.Unmarshal(body, &event); err != nil || event.Type != req.Header.Get(controllers.HeaderWebhookEvent) {
+			r.t.Errorf("Expected the event as the body, but got: %s", body)
+		}
+
+		r.received.Add(1)
+		if r.hold != nil {
+			<-r.hold
+		}
+		w.WriteHeader(int(r.status.Load()))
+	}))
+	t.Cleanup(r.Close)
+	return r
+}
+
+func createWebhook(t *testing.T, r *receiver, user models.JSON_User_Order, types ...string) models.Webhook {
+	t.Helper()
+	webhook, err := controllers.CreateWebhook(models.JSON_Webhook_Order{URL: r.URL, Events: types, User: user})
+	if err != nil {
+		t.Fatalf("Failed to create webhook: %v", err)
+	}
+	r.secret = webhook.Secret
+	return webhook
+}
+
+func publishItem(eventType string, item models.ItemSummary) {
+	events.Publish(events.Event{
+		Type:       eventType,
+		Resource:   "items",
+		ResourceID: item.ID,
+		SCID:       item.SCID,
+		Data:       item,
+	})
+}
+
+// waitForDeliveries waits until the webhook has n deliveries queued
+func waitForDeliveries(t *testing.T, webhook models.Webhook, user models.JSON_User_Order, n int) []models.Delivery {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		deliveries, err := controllers.WebhookDeliveries(strconv.Itoa(webhook.ID), user)
+		if err != nil {
+			t.Fatalf("Failed to retrieve deliveries: %v", err)
+		}
+		if len(deliveries) >= n || time.Now().After(deadline) {
+			if len(deliveries) != n {
+				t.Fatalf("Expected %d deliveries, but got %d", n, len(deliveries))
+			}
+			return deliveries
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestWebhookDeliversSignedEvents(t *testing.T) {
+	r := newReceiver(t)
+	webhook := createWebhook(t, r, alice, events.ItemCreated)
+
+	// only the event types asked for are delivered
+	publishItem(events.ItemUpdated, models.ItemSummary{ID: 1, Title: "skipped"})
+	publishItem(events.ItemCreated, models.ItemSummary{ID: 1, Title: "delivered"})
+	waitForDeliveries(t, webhook, alice, 1)
+
+	if err := controllers.DeliverWebhooks(time.Now()); err != nil {
+		t.Fatalf("Failed to deliver: %v", err)
+	}
+
+	deliveries := waitForDeliveries(t, webhook, alice, 1)
+	if r.received.Load() != 1 {
+		t.Errorf("Expected 1 delivery received, but got %d", r.received.Load())
+	}
+	if deliveries[0].Status != models.DeliveryDelivered || deliveries[0].Attempts != 1 || deliveries[0].EventType != events.ItemCreated {
+		t.Errorf("Expected a delivered item.created, but got: %+v", deliveries[0])
+	}
+}
+
+func TestWebhookRetriesThenFails(t *testing.T) {
+	r := newReceiver(t)
+	r.status.Store(http.StatusInternalServerError)
+	webhook := createWebhook(t, r, alice, events.ItemDeleted)
+
+	publishItem(events.ItemDeleted, models.ItemSummary{ID: 2})
+	waitForDeliveries(t, webhook, alice, 1)
+
+	now := time.Now()
+	if err := controllers.DeliverWebhooks(now); err != nil {
+		t.Fatalf("Failed to deliver: %v", err)
+	}
+	delivery := waitForDeliveries(t, webhook, alice, 1)[0]
+	if delivery.Status != models.DeliveryPending || delivery.Attempts != 1 || delivery.ResponseStatus != http.StatusInternalServerError {
+		t.Fatalf("Expected a pending delivery after one attempt, but got: %+v", delivery)
+	}
+
+	// nothing is tried again before the backoff
+	if err := controllers.DeliverWebhooks(now); err != nil {
+		t.Fatalf("Failed to deliver: %v", err)
+	}
+	if r.received.Load() != 1 {
+		t.Fatalf("Expected no retry before the backoff, but got %d attempts", r.received.Load())
+	}
+
+	// the backoff doubles, and the last attempt marks the delivery failed
+	for _, later := range []time.Duration{30 * time.Second, 90 * time.Second} {
+		if err := controllers.DeliverWebhooks(now.Add(later)); err != nil {
+			t.Fatalf("Failed to deliver: %v", err)
+		}
+	}
+	delivery = waitForDeliveries(t, webhook, alice, 1)[0]
+	if delivery.Status != models.DeliveryFailed || delivery.Attempts != config.WebhookAttempts {
+		t.Fatalf("Expected a failed delivery after %d attempts, but got: %+v", config.WebhookAttempts, delivery)
+	}
+
+	// redelivery queues the same event again
+	r.status.Store(http.StatusNoContent)
+	redelivery, err := controllers.RedeliverWebhook(strconv.Itoa(webhook.ID), strconv.Itoa(delivery.ID), alice)
+	if err != nil {
+		t.Fatalf("Failed to redeliver: %v", err)
+	}
+	if redelivery.RedeliveryOf != delivery.ID || redelivery.EventID != delivery.EventID {
+		t.Errorf("Expected a redelivery of %d, but got: %+v", delivery.ID, redelivery)
+	}
+	if err := controllers.DeliverWebhooks(time.Now()); err != nil {
+		t.Fatalf("Failed to deliver: %v", err)
+	}
+
+	deliveries := waitForDeliveries(t, webhook, alice, 2)
+	if deliveries[0].ID != redelivery.ID || deliveries[0].Status != models.DeliveryDelivered {
+		t.Errorf("Expected the redelivery first and delivered, but got: %+v", deliveries[0])
+	}
+}
+
+func TestWebhookOnlyDeliversWhatTheOwnerMaySee(t *testing.T) {
+	r := newReceiver(t)
+	webhook := createWebhook(t, r, bob, events.ItemUpdated)
+
+	// alice's restricted item stays hidden from bob
+	publishItem(events.ItemUpdated, models.ItemSummary{ID: 3, Owner: alice.Name, Restricted: true})
+	publishItem(events.ItemUpdated, models.ItemSummary{ID: 4, Owner: alice.Name})
+
+	deliveries := waitForDeliveries(t, webhook, bob, 1)
+	var event events.Event
+	if err := json.Unmarshal(deliveries[0].Payload, &event); err != nil || event.ResourceID != 4 {
+		t.Errorf("Expected only the public item, but got: %s", deliveries[0].Payload)
+	}
+}
+
+func TestWebhookBelongsToItsOwner(t *testing.T) {
+	r := newReceiver(t)
+	webhook := createWebhook(t, r, alice)
+	id := strconv.Itoa(webhook.ID)
+
+	if _, err := controllers.WebhookDeliveries(id, bob); !errors.Is(err, controllers.ErrForbidden) {
+		t.Errorf("Expected '%v' error, but got: %v", controllers.ErrForbidden, err)
+	}
+	if err := controllers.DeleteWebhook(id, bob); !errors.Is(err, controllers.ErrForbidden) {
+		t.Errorf("Expected '%v' error, but got: %v", controllers.ErrForbidden, err)
+	}
+
+	webhooks, err := controllers.Webhooks(alice)
+	if err != nil {
+		t.Fatalf("Failed to list webhooks: %v", err)
+	}
+	for _, w := range webhooks {
+		if w.Secret != "" {
+			t.Errorf("Expected secrets to stay hidden, but got: %+v", w)
+		}
+	}
+
+	wrong := models.JSON_User_Order{Name: alice.Name, Password: "wrong"}
+	if _, err := controllers.CreateWebhook(models.JSON_Webhook_Order{URL: r.URL, User: wrong}); !errors.Is(err, controllers.ErrForbidden) {
+		t.Errorf("Expected '%v' error, but got: %v", controllers.ErrForbidden, err)
+	}
+	if _, err := controllers.CreateWebhook(models.JSON_Webhook_Order{URL: "ftp://example.com", User: alice}); err == nil {
+		t.Error("Expected an invalid url to be rejected")
+	}
+	if _, err := controllers.CreateWebhook(models.JSON_Webhook_Order{URL: r.URL, Events: []string{"block.new"}, User: alice}); err == nil {
+		t.Error("Expected an unknown event to be rejected")
+	}
+
+	if err := controllers.DeleteWebhook(id, alice); err != nil {
+		t.Errorf("Failed to delete webhook: %v", err)
+	}
+}
+
+func TestWebhookRefusesPrivateAddresses(t *testing.T) {
+	r := newReceiver(t)
+	webhook := createWebhook(t, r, alice, events.ItemCreated)
+
+	config.AllowPrivateHosts = false
+	t.Cleanup(func() { config.AllowPrivateHosts = true })
+
+	for _, url := range []string{
+		"http://127.0.0.1:8080/hook",
+		"http://10.0.0.5/hook",
+		"http://169.254.169.254/latest/meta-data",
+	} {
+		_, err := controllers.CreateWebhook(models.JSON_Webhook_Order{URL: url, User: alice})
+		if !errors.Is(err, safehttp.ErrPrivateAddress) {
+			t.Errorf("Expected %s refused, but got %v", url, err)
+		}
+	}
+
+	// a webhook that got through is still refused when it's dialed
+	publishItem(events.ItemCreated, models.ItemSummary{ID: 5})
+	waitForDeliveries(t, webhook, alice, 1)
+	if err := controllers.DeliverWebhooks(time.Now()); err != nil {
+		t.Fatalf("Failed to deliver: %v", err)
+	}
+	delivery := waitForDeliveries(t, webhook, alice, 1)[0]
+	if r.received.Load() != 0 || !strings.Contains(delivery.LastError, safehttp.ErrPrivateAddress.Error()) {
+		t.Errorf("Expected the delivery refused at dial time, but got: %+v", delivery)
+	}
+}
+
+func TestSlowWebhookDoesNotHoldUpOthers(t *testing.T) {
+	slow := newReceiver(t)
+	slow.hold = make(chan struct{})
+	defer close(slow.hold)
+	fast := newReceiver(t)
+	slowWebhook := createWebhook(t, slow, alice, events.ItemCreated)
+	fastWebhook := createWebhook(t, fast, alice, events.ItemCreated)
+
+	publishItem(events.ItemCreated, models.ItemSummary{ID: 6})
+	waitForDeliveries(t, slowWebhook, alice, 1)
+	waitForDeliveries(t, fastWebhook, alice, 1)
+
+	done := make(chan error, 1)
+	go func() { done <- controllers.DeliverWebhooks(time.Now()) }()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for fast.received.Load() == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if fast.received.Load() != 1 || slow.received.Load() != 1 {
+		t.Fatalf("Expected both webhooks posted to while one hangs, but got %d fast and %d slow", fast.received.Load(), slow.received.Load())
+	}
+
+	slow.hold <- struct{}{}
+	if err := <-done; err != nil {
+		t.Fatalf("Failed to deliver: %v", err)
+	}
+	for _, webhook := range []models.Webhook{slowWebhook, fastWebhook} {
+		if delivery := waitForDeliveries(t, webhook, alice, 1)[0]; delivery.Status != models.DeliveryDelivered {
+			t.Errorf("Expected delivered, but got: %+v", delivery)
+		}
+	}
+}
+
+func TestPruneDeliveries(t *testing.T) {
+	ok := newReceiver(t)
+	failing := newReceiver(t)
+	failing.status.Store(http.StatusServiceUnavailable)
+	delivered := createWebhook(t, ok, alice, events.ItemCreated)
+	pending := createWebhook(t, failing, alice, events.ItemCreated)
+
+	publishItem(events.ItemCreated, models.ItemSummary{ID: 7})
+	waitForDeliveries(t, delivered, alice, 1)
+	waitForDeliveries(t, pending, alice, 1)
+	if err := controllers.DeliverWebhooks(time.Now()); err != nil {
+		t.Fatalf("Failed to deliver: %v", err)
+	}
+
+	// within the retention nothing goes
+	if err := controllers.PruneDeliveries(time.Hour); err != nil {
+		t.Fatalf("Failed to prune: %v", err)
+	}
+	waitForDeliveries(t, delivered, alice, 1)
+
+	// past it, what is done goes and what is still pending stays
+	if err := controllers.PruneDeliveries(0); err != nil {
+		t.Fatalf("Failed to prune: %v", err)
+	}
+	waitForDeliveries(t, delivered, alice, 0)
+	if delivery := waitForDeliveries(t, pending, alice, 1)[0]; delivery.Status != models.DeliveryPending {
+		t.Errorf("Expected the pending delivery kept, but got: %+v", delivery)
+	}
+}
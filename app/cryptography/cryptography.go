@@ -3,8 +3,11 @@ package cryptography
 import (
 	"crypto/aes"
 	"crypto/cipher"
+	"crypto/hmac"
 	"crypto/rand"
 	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 
@@ -17,6 +20,11 @@ type Hash [HashLength]byte
 
 var ZEROHASH Hash
 
+// ErrInvalidKey is returned when a wrapped key cannot be opened with the given secret.
+var ErrInvalidKey = errors.New("invalid key")
+
+const saltLength = 16
+
 // HashString calculates the SHA-256 hash of the input string and returns it as a hexadecimal string.
 func HashString(s string) []byte {
 
@@ -29,6 +37,13 @@ func HashString(s string) []byte {
 	return hash
 }
 
+// Sign returns the hex-encoded HMAC-SHA256 of the message under the secret.
+func Sign(secret string, message []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(message)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
 // EncryptData encrypts the input data using AES encryption with the provided password.
 // https://www.golinuxcloud.com/golang-encrypt-decrypt/
 func EncryptData(data []byte, password string) ([]byte, error) {
@@ -85,11 +100,82 @@ func DecryptData(ciphertext []byte, password string) ([]byte, error) {
 	return plaintext, nil
 }
 
+// GenerateKey returns a random key of length HashLength for encrypting a single item.
+func GenerateKey() ([]byte, error) {
+	key := make([]byte, HashLength)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return nil, fmt.Errorf("error generating key: %v", err)
+	}
+	return key, nil
+}
+
+// WrapKey seals the key with a key derived from the secret, so that only the
+// holder of the secret can recover it. Unlike EncryptData, the result is
+// authenticated: UnwrapKey can tell a wrong secret from a right one.
+func WrapKey(key []byte, secret string) ([]byte, error) {
+	// every wrapped key gets its own salt
+	salt := make([]byte, saltLength)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return nil, fmt.Errorf("error generating salt: %v", err)
+	}
+
+	gcm, err := newGCM(deriveKeyWithSalt(secret, salt))
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, fmt.Errorf("error generating nonce: %v", err)
+	}
+
+	// salt | nonce | sealed key
+	wrapped := append(salt, nonce...)
+	return gcm.Seal(wrapped, nonce, key, nil), nil
+}
+
+// UnwrapKey recovers a key sealed by WrapKey, returning ErrInvalidKey when the secret is wrong.
+func UnwrapKey(wrapped []byte, secret string) ([]byte, error) {
+	if len(wrapped) < saltLength {
+		return nil, ErrInvalidKey
+	}
+	salt := wrapped[:saltLength]
+
+	gcm, err := newGCM(deriveKeyWithSalt(secret, salt))
+	if err != nil {
+		return nil, err
+	}
+
+	rest := wrapped[saltLength:]
+	if len(rest) < gcm.NonceSize() {
+		return nil, ErrInvalidKey
+	}
+	nonce, sealed := rest[:gcm.NonceSize()], rest[gcm.NonceSize():]
+
+	key, err := gcm.Open(nil, nonce, sealed, nil)
+	if err != nil {
+		return nil, ErrInvalidKey
+	}
+	return key, nil
+}
+
+// newGCM creates an AES-GCM cipher for the given key.
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("error creating cipher block: %v", err)
+	}
+	return cipher.NewGCM(block)
+}
+
 // deriveKey derives a key of length HashLength from the password using PBKDF2.
 // this seemed like the way to do it
 func deriveKey(password string) []byte {
+	return deriveKeyWithSalt(password, make([]byte, saltLength)) // take a pinch of salt...
+}
 
-	salt := make([]byte, 16) // take a pinch of salt...
+// deriveKeyWithSalt derives a key of length HashLength from the password and salt using PBKDF2.
+func deriveKeyWithSalt(password string, salt []byte) []byte {
 
 	iterations := 4096 // set a "timer"
 
@@ -89,3 +89,61 @@ func TestEncryptDecryptEmptyData(t *testing.T) {
 		t.Errorf("Decrypted empty data does not match original data. Expected: %v, Got: %v", emptyData, decryptedData)
 	}
 }
+
+func TestWrapUnwrapKey(t *testing.T) {
+	// Test data
+	password := "secretPassword"
+
+	// Generate a key to wrap
+	key, err := cryptography.GenerateKey()
+	if err != nil {
+		t.Fatalf("Error generating key: %v", err)
+	}
+
+	// Wrap the key with the password
+	wrapped, err := cryptography.WrapKey(key, password)
+	if err != nil {
+		t.Fatalf("Error wrapping key: %v", err)
+	}
+
+	// Unwrap the key with the same password
+	unwrapped, err := cryptography.UnwrapKey(wrapped, password)
+	if err != nil {
+		t.Errorf("Error unwrapping key: %v", err)
+	}
+
+	// Verify that the unwrapped key matches the original key
+	if !bytes.Equal(unwrapped, key) {
+		t.Errorf("Unwrapped key does not match original key. Expected: %x, Got: %x", key, unwrapped)
+	}
+}
+
+func TestUnwrapKeyWithIncorrectPassword(t *testing.T) {
+	// Test data
+	password := "secretPassword"
+	incorrectPassword := "incorrectPassword"
+
+	// Wrap a key with the correct password
+	key, _ := cryptography.GenerateKey()
+	wrapped, _ := cryptography.WrapKey(key, password)
+
+	// Attempt to unwrap with an incorrect password
+	_, err := cryptography.UnwrapKey(wrapped, incorrectPassword)
+
+	// Unlike DecryptData, a wrong password must be detected
+	if err != cryptography.ErrInvalidKey {
+		t.Errorf("Expected '%v' error, but got: %v", cryptography.ErrInvalidKey, err)
+	}
+}
+
+func TestSign(t *testing.T) {
+	// RFC 4231, test case 2
+	expected := "5bdcc146bf60754e6a042426089575c75a003f089d2739839dec58b964ec3843"
+
+	signature := cryptography.Sign("Jefe", []byte("what do ya want for nothing?"))
+
+	// Verify that the signature matches the known HMAC-SHA256
+	if signature != expected {
+		t.Errorf("Signature does not match. Expected: %s, Got: %s", expected, signature)
+	}
+}
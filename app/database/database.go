@@ -1,15 +1,18 @@
 package database
 
 import (
+	"encoding/binary"
 	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
 	"reflect"
 	"strconv"
+	"time"
 
 	"github.com/secretnamebasis/secret-site/app/config"
 	"github.com/secretnamebasis/secret-site/app/cryptography"
+	"github.com/secretnamebasis/secret-site/app/metrics"
 	"github.com/secretnamebasis/secret-site/app/models"
 
 	"go.etcd.io/bbolt"
@@ -20,12 +23,67 @@ var (
 	itemsBucket    = []byte("items")
 	usersBucket    = []byte("users")
 	checkoutBucket = []byte("checkouts")
+	grantsBucket   = []byte("grants")
+
+	// collections group NFAs, by SCID
+	collectionsBucket = []byte("collections")
+
+	// webhooks and the queue and log of their deliveries
+	webhooksBucket   = []byte("webhooks")
+	deliveriesBucket = []byte("deliveries")
+	// pendingDeliveriesBucket indexes the deliveries still to go out
+	pendingDeliveriesBucket = []byte("deliveries.pending")
+
+	// revisions holds a bucket of revisions per item
+	revisionsBucket = []byte("revisions")
+
+	// audit is append-only, there is no way to delete from it
+	auditBucket = []byte("audit")
+
+	// meta holds the app's own bookkeeping, like checkpoints
+	metaBucket = []byte("meta")
+
+	// the NFA index: tokens by SCID, and a bucket of SCIDs per collection and per owner
+	nfasBucket           = []byte("nfas")
+	nfaCollectionsBucket = []byte("nfas.collections")
+	nfaOwnersBucket      = []byte("nfas.owners")
+
+	// the last check of each NFA's file, by SCID
+	fileChecksBucket = []byte("filechecks")
+
+	// NFA sales, by TXID
+	salesBucket = []byte("sales")
+
+	// receipts of paid checkouts
+	invoicesBucket = []byte("invoices")
+
+	// users' inboxes
+	messagesBucket = []byte("messages")
+
+	// private items' data keys, wrapped by their owners, by item ID
+	itemKeysBucket = []byte("item_keys")
 
 	// this was my first byte array.
 	buckets = [][]byte{
 		itemsBucket,
 		checkoutBucket,
 		usersBucket,
+		grantsBucket,
+		collectionsBucket,
+		webhooksBucket,
+		deliveriesBucket,
+		pendingDeliveriesBucket,
+		revisionsBucket,
+		auditBucket,
+		metaBucket,
+		nfasBucket,
+		nfaCollectionsBucket,
+		nfaOwnersBucket,
+		fileChecksBucket,
+		salesBucket,
+		invoicesBucket,
+		messagesBucket,
+		itemKeysBucket,
 	}
 )
 
@@ -43,22 +101,42 @@ func Initialize(c config.Server) error {
 	if err != nil {
 		return err
 	}
+	metrics.WatchBolt(db)
 
 	// Ensure buckets exist
 	err = db.Update(
 		func(tx *bbolt.Tx) error {
+			indexed := tx.Bucket(pendingDeliveriesBucket) != nil
 			for _, bucket := range buckets {
 				_, err := tx.CreateBucketIfNotExists(bucket)
 				if err != nil {
 					return err
 				}
 			}
-			return nil
+			if !indexed {
+				if err := indexPendingDeliveries(tx); err != nil {
+					return err
+				}
+			}
+			return migrateItemKeys(tx)
 		})
 
 	return err
 }
 
+// Ping checks the database is open and takes writes.
+func Ping() error {
+	if db == nil {
+		return fmt.Errorf("database is not open")
+	}
+	// an empty read-write transaction still commits to disk
+	return db.Update(
+		func(tx *bbolt.Tx) error {
+			return nil
+		},
+	)
+}
+
 // CreateRecord creates a record in the database for the given item/user after encrypting the content.
 func CreateRecord(bucketName string, record interface{}) error {
 	return db.Update(
@@ -170,6 +248,20 @@ func GetAllRecords(bucketName string, records interface{}) error {
 				return unmarshalRecord(&models.Item{})
 			case *[]models.User:
 				return unmarshalRecord(&models.User{})
+			case *[]models.Grant:
+				return unmarshalRecord(&models.Grant{})
+			case *[]models.Checkout:
+				return unmarshalRecord(&models.Checkout{})
+			case *[]models.Collection:
+				return unmarshalRecord(&models.Collection{})
+			case *[]models.Webhook:
+				return unmarshalRecord(&models.Webhook{})
+			case *[]models.Delivery:
+				return unmarshalRecord(&models.Delivery{})
+			case *[]models.Invoice:
+				return unmarshalRecord(&models.Invoice{})
+			case *[]models.Message:
+				return unmarshalRecord(&models.Message{})
 			default:
 				return fmt.Errorf("unsupported record type")
 			}
@@ -373,3 +465,741 @@ func NextID(bucketName string) (int, error) {
 
 	return id, nil
 }
+
+// CreateRevision stores a revision in the item's own bucket within the revisions bucket.
+func CreateRevision(itemID string, revision *models.Revision) error {
+	return db.Update(
+		func(tx *bbolt.Tx) error {
+			b := tx.Bucket(revisionsBucket)
+			if b == nil {
+				return fmt.Errorf("bucket %q not found ", revisionsBucket)
+			}
+
+			// every item keeps its revisions in a bucket of its own
+			ib, err := b.CreateBucketIfNotExists([]byte(itemID))
+			if err != nil {
+				return err
+			}
+
+			seq, err := ib.NextSequence()
+			if err != nil {
+				return err
+			}
+			revision.ID = int(seq)
+
+			revisionJSON, err := json.Marshal(revision)
+			if err != nil {
+				return err
+			}
+
+			return ib.Put(itob(seq), revisionJSON)
+		},
+	)
+}
+
+// GetRevisions retrieves the revisions of an item, oldest first.
+func GetRevisions(itemID string) ([]models.Revision, error) {
+	var revisions []models.Revision
+	err := db.View(
+		func(tx *bbolt.Tx) error {
+			b := tx.Bucket(revisionsBucket)
+			if b == nil {
+				return fmt.Errorf("bucket %q not found", revisionsBucket)
+			}
+
+			ib := b.Bucket([]byte(itemID))
+			if ib == nil {
+				return nil // no revisions yet
+			}
+
+			return ib.ForEach(
+				func(k, v []byte) error {
+					var revision models.Revision
+					if err := json.Unmarshal(v, &revision); err != nil {
+						return err
+					}
+					revisions = append(revisions, revision)
+					return nil
+				},
+			)
+		},
+	)
+	return revisions, err
+}
+
+// GetRevision retrieves a single revision of an item.
+func GetRevision(itemID, revisionID string, revision *models.Revision) error {
+	seq, err := strconv.ParseUint(revisionID, 10, 64)
+	if err != nil {
+		return fmt.Errorf("record with ID %s not found", revisionID)
+	}
+
+	return db.View(
+		func(tx *bbolt.Tx) error {
+			b := tx.Bucket(revisionsBucket)
+			if b == nil {
+				return fmt.Errorf("bucket %q not found", revisionsBucket)
+			}
+
+			ib := b.Bucket([]byte(itemID))
+			if ib == nil {
+				return fmt.Errorf("record with ID %s not found", revisionID)
+			}
+
+			revisionJSON := ib.Get(itob(seq))
+			if revisionJSON == nil {
+				return fmt.Errorf("record with ID %s not found", revisionID)
+			}
+
+			return json.Unmarshal(revisionJSON, revision)
+		},
+	)
+}
+
+// PruneRevisions deletes the oldest revisions of an item so that at most keep remain.
+func PruneRevisions(itemID string, keep int) error {
+	return db.Update(
+		func(tx *bbolt.Tx) error {
+			b := tx.Bucket(revisionsBucket)
+			if b == nil {
+				return fmt.Errorf("bucket %q not found ", revisionsBucket)
+			}
+
+			ib := b.Bucket([]byte(itemID))
+			if ib == nil {
+				return nil
+			}
+
+			excess := ib.Stats().KeyN - keep
+
+			// keys are big-endian sequences, so the cursor starts at the oldest
+			c := ib.Cursor()
+			for k, _ := c.First(); k != nil && excess > 0; k, _ = c.First() {
+				if err := ib.Delete(k); err != nil {
+					return err
+				}
+				excess--
+			}
+			return nil
+		},
+	)
+}
+
+// DeleteRevisions deletes every revision of an item.
+func DeleteRevisions(itemID string) error {
+	return db.Update(
+		func(tx *bbolt.Tx) error {
+			b := tx.Bucket(revisionsBucket)
+			if b == nil {
+				return fmt.Errorf("bucket %q not found ", revisionsBucket)
+			}
+
+			if b.Bucket([]byte(itemID)) == nil {
+				return nil
+			}
+			return b.DeleteBucket([]byte(itemID))
+		},
+	)
+}
+
+// AppendAuditEntry links the entry to the head of the audit chain and stores it;
+// reading the head and writing the entry share a transaction so the chain can't fork.
+func AppendAuditEntry(entry *models.AuditEntry) error {
+	return db.Update(
+		func(tx *bbolt.Tx) error {
+			b := tx.Bucket(auditBucket)
+			if b == nil {
+				return fmt.Errorf("bucket %q not found ", auditBucket)
+			}
+
+			// the last key is the head of the chain
+			entry.PrevHash = ""
+			if _, headJSON := b.Cursor().Last(); headJSON != nil {
+				var head models.AuditEntry
+				if err := json.Unmarshal(headJSON, &head); err != nil {
+					return err
+				}
+				entry.PrevHash = head.Hash
+			}
+
+			seq, err := b.NextSequence()
+			if err != nil {
+				return err
+			}
+			entry.ID = int(seq)
+			entry.Hash = entry.ComputeHash()
+
+			entryJSON, err := json.Marshal(entry)
+			if err != nil {
+				return err
+			}
+
+			return b.Put(itob(seq), entryJSON)
+		},
+	)
+}
+
+// GetAuditEntries retrieves the whole audit chain, oldest entry first.
+func GetAuditEntries() ([]models.AuditEntry, error) {
+	var entries []models.AuditEntry
+	err := db.View(
+		func(tx *bbolt.Tx) error {
+			b := tx.Bucket(auditBucket)
+			if b == nil {
+				return fmt.Errorf("bucket %q not found", auditBucket)
+			}
+
+			return b.ForEach(
+				func(k, v []byte) error {
+					var entry models.AuditEntry
+					if err := json.Unmarshal(v, &entry); err != nil {
+						return err
+					}
+					entries = append(entries, entry)
+					return nil
+				},
+			)
+		},
+	)
+	return entries, err
+}
+
+// GetMeta retrieves a value from the meta bucket, nil when it isn't set.
+func GetMeta(key string) ([]byte, error) {
+	var value []byte
+	err := db.View(
+		func(tx *bbolt.Tx) error {
+			b := tx.Bucket(metaBucket)
+			if b == nil {
+				return fmt.Errorf("bucket %q not found", metaBucket)
+			}
+			// bbolt's bytes only live as long as the transaction
+			if v := b.Get([]byte(key)); v != nil {
+				value = append([]byte(nil), v...)
+			}
+			return nil
+		},
+	)
+	return value, err
+}
+
+// PutMeta stores a value in the meta bucket.
+func PutMeta(key string, value []byte) error {
+	return db.Update(
+		func(tx *bbolt.Tx) error {
+			b := tx.Bucket(metaBucket)
+			if b == nil {
+				return fmt.Errorf("bucket %q not found ", metaBucket)
+			}
+			return b.Put([]byte(key), value)
+		},
+	)
+}
+
+// PutNFA stores the token in the NFA index and files it under its collection
+// and owner, keeping the height it was first indexed at.
+func PutNFA(nfa *models.IndexedNFA) error {
+	return db.Update(
+		func(tx *bbolt.Tx) error {
+			b := tx.Bucket(nfasBucket)
+			if b == nil {
+				return fmt.Errorf("bucket %q not found ", nfasBucket)
+			}
+			collections := tx.Bucket(nfaCollectionsBucket)
+			owners := tx.Bucket(nfaOwnersBucket)
+			if collections == nil || owners == nil {
+				return fmt.Errorf("bucket %q not found ", nfaOwnersBucket)
+			}
+			key := []byte(nfa.SCID)
+
+			// what it was filed under before has to go
+			if previousJSON := b.Get(key); previousJSON != nil {
+				var previous models.IndexedNFA
+				if err := json.Unmarshal(previousJSON, &previous); err != nil {
+					return err
+				}
+				if previous.DeployHeight != 0 {
+					nfa.DeployHeight = previous.DeployHeight
+				}
+				if err := unfile(collections, previous.Collection, key); err != nil {
+					return err
+				}
+				if err := unfile(owners, previous.Owner, key); err != nil {
+					return err
+				}
+			}
+
+			nfaJSON, err := json.Marshal(nfa)
+			if err != nil {
+				return err
+			}
+			if err := b.Put(key, nfaJSON); err != nil {
+				return err
+			}
+			if err := file(collections, nfa.Collection, key); err != nil {
+				return err
+			}
+			return file(owners, nfa.Owner, key)
+		},
+	)
+}
+
+// GetNFA retrieves a token from the NFA index, nil when it isn't indexed.
+func GetNFA(scid string) (*models.IndexedNFA, error) {
+	var nfa *models.IndexedNFA
+	err := db.View(
+		func(tx *bbolt.Tx) error {
+			b := tx.Bucket(nfasBucket)
+			if b == nil {
+				return fmt.Errorf("bucket %q not found", nfasBucket)
+			}
+			v := b.Get([]byte(scid))
+			if v == nil {
+				return nil
+			}
+			nfa = &models.IndexedNFA{}
+			return json.Unmarshal(v, nfa)
+		},
+	)
+	return nfa, err
+}
+
+// GetNFAs retrieves the indexed tokens in the collection and held by the
+// owner; leaving either empty doesn't filter on it.
+func GetNFAs(collection, owner string) ([]models.IndexedNFA, error) {
+	var nfas []models.IndexedNFA
+	err := db.View(
+		func(tx *bbolt.Tx) error {
+			b := tx.Bucket(nfasBucket)
+			if b == nil {
+				return fmt.Errorf("bucket %q not found", nfasBucket)
+			}
+
+			// narrow down by the index buckets, then check the record itself
+			var scids [][]byte
+			switch {
+			case collection != "":
+				scids = filed(tx.Bucket(nfaCollectionsBucket), collection)
+			case owner != "":
+				scids = filed(tx.Bucket(nfaOwnersBucket), owner)
+			default:
+				b.ForEach(func(k, _ []byte) error {
+					scids = append(scids, k)
+					return nil
+				})
+			}
+
+			for _, scid := range scids {
+				v := b.Get(scid)
+				if v == nil {
+					continue
+				}
+				var nfa models.IndexedNFA
+				if err := json.Unmarshal(v, &nfa); err != nil {
+					return err
+				}
+				if owner != "" && nfa.Owner != owner {
+					continue
+				}
+				nfas = append(nfas, nfa)
+			}
+			return nil
+		},
+	)
+	return nfas, err
+}
+
+// PutFileCheck stores the check of a token's file, over the one before
+func PutFileCheck(check *models.FileCheck) error {
+	return db.Update(
+		func(tx *bbolt.Tx) error {
+			b := tx.Bucket(fileChecksBucket)
+			if b == nil {
+				return fmt.Errorf("bucket %q not found", fileChecksBucket)
+			}
+			checkJSON, err := json.Marshal(check)
+			if err != nil {
+				return err
+			}
+			return b.Put([]byte(check.SCID), checkJSON)
+		},
+	)
+}
+
+// GetFileCheck retrieves the last check of a token's file, nil when there is none
+func GetFileCheck(scid string) (*models.FileCheck, error) {
+	var check *models.FileCheck
+	err := db.View(
+		func(tx *bbolt.Tx) error {
+			b := tx.Bucket(fileChecksBucket)
+			if b == nil {
+				return fmt.Errorf("bucket %q not found", fileChecksBucket)
+			}
+			v := b.Get([]byte(scid))
+			if v == nil {
+				return nil
+			}
+			check = &models.FileCheck{}
+			return json.Unmarshal(v, check)
+		},
+	)
+	return check, err
+}
+
+// GetFileChecks retrieves the last check of every token's file
+func GetFileChecks() ([]models.FileCheck, error) {
+	checks := []models.FileCheck{}
+	err := db.View(
+		func(tx *bbolt.Tx) error {
+			b := tx.Bucket(fileChecksBucket)
+			if b == nil {
+				return fmt.Errorf("bucket %q not found", fileChecksBucket)
+			}
+			return b.ForEach(func(_, v []byte) error {
+				var check models.FileCheck
+				if err := json.Unmarshal(v, &check); err != nil {
+					return err
+				}
+				checks = append(checks, check)
+				return nil
+			})
+		},
+	)
+	return checks, err
+}
+
+// PutSale stores an NFA sale; seeing the same transaction again changes nothing
+func PutSale(sale *models.Sale) error {
+	return db.Update(
+		func(tx *bbolt.Tx) error {
+			b := tx.Bucket(salesBucket)
+			if b == nil {
+				return fmt.Errorf("bucket %q not found", salesBucket)
+			}
+			saleJSON, err := json.Marshal(sale)
+			if err != nil {
+				return err
+			}
+			return b.Put([]byte(sale.TXID), saleJSON)
+		},
+	)
+}
+
+// GetSales retrieves every NFA sale, in no particular order
+func GetSales() ([]models.Sale, error) {
+	sales := []models.Sale{}
+	err := db.View(
+		func(tx *bbolt.Tx) error {
+			b := tx.Bucket(salesBucket)
+			if b == nil {
+				return fmt.Errorf("bucket %q not found", salesBucket)
+			}
+			return b.ForEach(func(_, v []byte) error {
+				var sale models.Sale
+				if err := json.Unmarshal(v, &sale); err != nil {
+					return err
+				}
+				sales = append(sales, sale)
+				return nil
+			})
+		},
+	)
+	return sales, err
+}
+
+// PutDelivery stores a webhook delivery, and keeps it in the pending
+// index for as long as it is still to go out
+func PutDelivery(delivery *models.Delivery) error {
+	return db.Update(
+		func(tx *bbolt.Tx) error {
+			b, pending := tx.Bucket(deliveriesBucket), tx.Bucket(pendingDeliveriesBucket)
+			if b == nil || pending == nil {
+				return fmt.Errorf("buckets %q and %q not found", deliveriesBucket, pendingDeliveriesBucket)
+			}
+			key := []byte(strconv.Itoa(delivery.ID))
+
+			deliveryJSON, err := json.Marshal(delivery)
+			if err != nil {
+				return err
+			}
+			if err := b.Put(key, deliveryJSON); err != nil {
+				return err
+			}
+			if delivery.Status == models.DeliveryPending {
+				return pending.Put(key, nil)
+			}
+			return pending.Delete(key)
+		},
+	)
+}
+
+// GetPendingDeliveries retrieves the webhook deliveries still to go out,
+// without going through the ones that are done
+func GetPendingDeliveries() ([]models.Delivery, error) {
+	deliveries := []models.Delivery{}
+	err := db.View(
+		func(tx *bbolt.Tx) error {
+			b, pending := tx.Bucket(deliveriesBucket), tx.Bucket(pendingDeliveriesBucket)
+			if b == nil || pending == nil {
+				return fmt.Errorf("buckets %q and %q not found", deliveriesBucket, pendingDeliveriesBucket)
+			}
+			return pending.ForEach(func(k, _ []byte) error {
+				v := b.Get(k)
+				if v == nil {
+					return nil
+				}
+				var delivery models.Delivery
+				if err := json.Unmarshal(v, &delivery); err != nil {
+					return err
+				}
+				deliveries = append(deliveries, delivery)
+				return nil
+			})
+		},
+	)
+	return deliveries, err
+}
+
+// PruneDeliveries deletes the webhook deliveries that are done and were
+// queued before the given time, and returns how many went
+func PruneDeliveries(before time.Time) (int, error) {
+	pruned := 0
+	err := db.Update(
+		func(tx *bbolt.Tx) error {
+			b, pending := tx.Bucket(deliveriesBucket), tx.Bucket(pendingDeliveriesBucket)
+			if b == nil || pending == nil {
+				return fmt.Errorf("buckets %q and %q not found", deliveriesBucket, pendingDeliveriesBucket)
+			}
+
+			// deleting while iterating skips keys, so collect them first
+			var done [][]byte
+			err := b.ForEach(func(k, v []byte) error {
+				if pending.Get(k) != nil {
+					return nil
+				}
+				var delivery models.Delivery
+				if err := json.Unmarshal(v, &delivery); err != nil {
+					return err
+				}
+				if delivery.Status != models.DeliveryPending && delivery.CreatedAt.Before(before) {
+					done = append(done, append([]byte(nil), k...))
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			for _, k := range done {
+				if err := b.Delete(k); err != nil {
+					return err
+				}
+			}
+			pruned = len(done)
+			return nil
+		},
+	)
+	return pruned, err
+}
+
+// indexPendingDeliveries fills the pending index from the deliveries
+// queued before there was one
+func indexPendingDeliveries(tx *bbolt.Tx) error {
+	b, pending := tx.Bucket(deliveriesBucket), tx.Bucket(pendingDeliveriesBucket)
+	return b.ForEach(func(k, v []byte) error {
+		var delivery models.Delivery
+		if err := json.Unmarshal(v, &delivery); err != nil {
+			return err
+		}
+		if delivery.Status != models.DeliveryPending {
+			return nil
+		}
+		return pending.Put(k, nil)
+	})
+}
+
+// migrateItemKeys moves the wrapped keys items used to carry in their
+// records into the item keys bucket
+func migrateItemKeys(tx *bbolt.Tx) error {
+	items, keys := tx.Bucket(itemsBucket), tx.Bucket(itemKeysBucket)
+	migrated := map[string][]byte{}
+	err := items.ForEach(func(k, v []byte) error {
+		var legacy struct {
+			WrappedKey []byte `json:"wrapped_key"`
+		}
+		if err := json.Unmarshal(v, &legacy); err != nil || len(legacy.WrappedKey) == 0 {
+			return nil
+		}
+		var item models.Item
+		if err := json.Unmarshal(v, &item); err != nil {
+			return err
+		}
+		item.Private = true
+		itemJSON, err := json.Marshal(item)
+		if err != nil {
+			return err
+		}
+		migrated[string(k)] = itemJSON
+		return keys.Put(k, legacy.WrappedKey)
+	})
+	if err != nil {
+		return err
+	}
+	for k, v := range migrated {
+		if err := items.Put([]byte(k), v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetItemKey returns a private item's wrapped data key, nil for other items
+func GetItemKey(itemID int) ([]byte, error) {
+	var wrapped []byte
+	err := db.View(
+		func(tx *bbolt.Tx) error {
+			b := tx.Bucket(itemKeysBucket)
+			if b == nil {
+				return fmt.Errorf("bucket %q not found", itemKeysBucket)
+			}
+			if v := b.Get([]byte(strconv.Itoa(itemID))); v != nil {
+				wrapped = append([]byte{}, v...)
+			}
+			return nil
+		},
+	)
+	return wrapped, err
+}
+
+// PutItemKey keeps a private item's wrapped data key, out of the item
+// record so that it never goes out along with it
+func PutItemKey(itemID int, wrapped []byte) error {
+	return db.Update(
+		func(tx *bbolt.Tx) error {
+			b := tx.Bucket(itemKeysBucket)
+			if b == nil {
+				return fmt.Errorf("bucket %q not found", itemKeysBucket)
+			}
+			return b.Put([]byte(strconv.Itoa(itemID)), wrapped)
+		},
+	)
+}
+
+// DeleteItemKey forgets an item's wrapped data key
+func DeleteItemKey(itemID int) error {
+	return db.Update(
+		func(tx *bbolt.Tx) error {
+			b := tx.Bucket(itemKeysBucket)
+			if b == nil {
+				return fmt.Errorf("bucket %q not found", itemKeysBucket)
+			}
+			return b.Delete([]byte(strconv.Itoa(itemID)))
+		},
+	)
+}
+
+// UpdateUserKeys saves a user along with their items' keys, wrapped again,
+// all or nothing
+func UpdateUserKeys(user *models.User, keys map[int][]byte) error {
+	return db.Update(
+		func(tx *bbolt.Tx) error {
+			users, itemKeys := tx.Bucket(usersBucket), tx.Bucket(itemKeysBucket)
+			if users == nil || itemKeys == nil {
+				return fmt.Errorf("buckets %q and %q not found", usersBucket, itemKeysBucket)
+			}
+			for id, wrapped := range keys {
+				if err := itemKeys.Put([]byte(strconv.Itoa(id)), wrapped); err != nil {
+					return err
+				}
+			}
+			userJSON, err := json.Marshal(user)
+			if err != nil {
+				return err
+			}
+			return users.Put([]byte(strconv.Itoa(user.ID)), userJSON)
+		},
+	)
+}
+
+// ClaimInboxPort gives the user with the ID the inbox port, unless they
+// already have one, and returns the port they end up with
+func ClaimInboxPort(userID int, port uint64) (uint64, error) {
+	var user models.User
+	err := db.Update(
+		func(tx *bbolt.Tx) error {
+			users := tx.Bucket(usersBucket)
+			if users == nil {
+				return fmt.Errorf("bucket %q not found ", usersBucket)
+			}
+			key := []byte(strconv.Itoa(userID))
+			userJSON := users.Get(key)
+			if userJSON == nil {
+				return fmt.Errorf("user %d not found", userID)
+			}
+			if err := json.Unmarshal(userJSON, &user); err != nil {
+				return err
+			}
+			if user.InboxPort != 0 {
+				return nil
+			}
+
+			user.InboxPort = port
+			userJSON, err := json.Marshal(user)
+			if err != nil {
+				return err
+			}
+			return users.Put(key, userJSON)
+		},
+	)
+	if err != nil {
+		return 0, err
+	}
+	return user.InboxPort, nil
+}
+
+// itob returns an 8-byte big endian representation of v, so keys sort in order.
+func itob(v uint64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, v)
+	return b
+}
+
+// file puts key in the bucket named name within index, unless name is empty
+func file(index *bbolt.Bucket, name string, key []byte) error {
+	if name == "" {
+		return nil
+	}
+	b, err := index.CreateBucketIfNotExists([]byte(name))
+	if err != nil {
+		return err
+	}
+	return b.Put(key, nil)
+}
+
+// unfile takes key out of the bucket named name within index
+func unfile(index *bbolt.Bucket, name string, key []byte) error {
+	if name == "" {
+		return nil
+	}
+	b := index.Bucket([]byte(name))
+	if b == nil {
+		return nil
+	}
+	return b.Delete(key)
+}
+
+// filed returns the keys in the bucket named name within index
+func filed(index *bbolt.Bucket, name string) [][]byte {
+	if index == nil {
+		return nil
+	}
+	b := index.Bucket([]byte(name))
+	if b == nil {
+		return nil
+	}
+	var keys [][]byte
+	b.ForEach(func(k, _ []byte) error {
+		keys = append(keys, append([]byte(nil), k...))
+		return nil
+	})
+	return keys
+}
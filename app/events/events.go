@@ -0,0 +1,159 @@
+package events
+
+import (
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// Event types
+const (
+	BlockNew          = "block.new"          // the node reached a new block
+	SCChanged         = "sc.changed"         // a tracked contract's variables changed
+	TransferIncoming  = "transfer.incoming"  // the server wallet received a transfer
+	ItemCreated       = "item.created"       // an item was listed
+	ItemUpdated       = "item.updated"       // an item was edited or restored
+	ItemDeleted       = "item.deleted"       // an item was moved to the trash
+	CheckoutPaid      = "checkout.paid"      // a checkout got its payment
+	CheckoutExpired   = "checkout.expired"   // a checkout ran out of time unpaid
+	CheckoutUnderpaid = "checkout.underpaid" // a checkout got less than its price
+	CheckoutOverpaid  = "checkout.overpaid"  // a paid checkout got more on top
+	CheckoutLate      = "checkout.late"      // a checkout got paid after it expired
+	CheckoutRefunded  = "checkout.refunded"  // a checkout's money went back
+	StreamReset       = "stream.reset"       // a stream couldn't replay what its client missed
+)
+
+// buffer is how many events a slow subscriber may fall behind before it misses some
+const buffer = 64
+
+// history is how many past events are kept for subscribers catching up
+const history = 256
+
+// Event is something that happened, on-chain or in the app
+type Event struct {
+	ID         uint64      `json:"id"`
+	Type       string      `json:"type"`
+	Resource   string      `json:"resource,omitempty"`    // the bucket of the record it's about, if any
+	ResourceID int         `json:"resource_id,omitempty"` // the record's ID
+	SCID       string      `json:"scid,omitempty"`
+	Data       interface{} `json:"data"`
+	Time       time.Time   `json:"time"`
+}
+
+// Subscription receives the events it subscribed to on C until it's closed
+type Subscription struct {
+	C <-chan Event
+
+	c     chan Event
+	types map[string]bool
+	once  sync.Once
+}
+
+// IDs carry on from a thousand per millisecond since the epoch at start,
+// so the ones from before a restart stay below the ones after it
+var bus = struct {
+	mu     sync.RWMutex
+	subs   map[*Subscription]bool
+	last   uint64
+	recent []Event // the latest events, oldest first
+}{
+	subs: make(map[*Subscription]bool),
+	last: uint64(time.Now().UnixMilli()) * 1000,
+}
+
+// Subscribe starts receiving events of the given types, or of every type when none are given
+func Subscribe(types ...string) *Subscription {
+	c := make(chan Event, buffer)
+	sub := &Subscription{C: c, c: c, types: make(map[string]bool)}
+	for _, t := range types {
+		sub.types[t] = true
+	}
+
+	bus.mu.Lock()
+	defer bus.mu.Unlock()
+	bus.subs[sub] = true
+	return sub
+}
+
+// Close stops the subscription and closes its channel
+func (s *Subscription) Close() {
+	s.once.Do(func() {
+		bus.mu.Lock()
+		defer bus.mu.Unlock()
+		delete(bus.subs, s)
+		close(s.c)
+	})
+}
+
+// Close ends every subscription, eg. so that long-lived streams let the
+// server shut down
+func Close() {
+	bus.mu.RLock()
+	subs := make([]*Subscription, 0, len(bus.subs))
+	for sub := range bus.subs {
+		subs = append(subs, sub)
+	}
+	bus.mu.RUnlock()
+
+	for _, sub := range subs {
+		sub.Close()
+	}
+}
+
+// Publish numbers and timestamps an event and hands it to every subscriber
+// of its type; publishing never blocks, so a subscriber that falls too far
+// behind misses events
+func Publish(event Event) Event {
+	bus.mu.Lock()
+	defer bus.mu.Unlock()
+
+	bus.last++
+	event.ID = bus.last
+	event.Time = time.Now()
+
+	bus.recent = append(bus.recent, event)
+	if len(bus.recent) > history {
+		bus.recent = bus.recent[len(bus.recent)-history:]
+	}
+
+	for sub := range bus.subs {
+		if len(sub.types) > 0 && !sub.types[event.Type] {
+			continue
+		}
+		select {
+		case sub.c <- event:
+		default:
+			slog.Warn("subscriber fell behind, event dropped", "event", event.Type, "id", event.ID)
+		}
+	}
+	return event
+}
+
+// Last returns the ID of the latest event published
+func Last() uint64 {
+	bus.mu.RLock()
+	defer bus.mu.RUnlock()
+	return bus.last
+}
+
+// Held reports whether every event after the given ID is still held, so
+// that Since returns all of them; IDs from before a restart aren't
+func Held(id uint64) bool {
+	bus.mu.RLock()
+	defer bus.mu.RUnlock()
+	return id <= bus.last && bus.last-id <= uint64(len(bus.recent))
+}
+
+// Since returns the events still held that came after the given ID, oldest first
+func Since(id uint64) []Event {
+	bus.mu.RLock()
+	defer bus.mu.RUnlock()
+
+	var since []Event
+	for _, event := range bus.recent {
+		if event.ID > id {
+			since = append(since, event)
+		}
+	}
+	return since
+}
@@ -0,0 +1,94 @@
+package events_test
+
+import (
+	"testing"
+
+	"github.com/secretnamebasis/secret-site/app/events"
+)
+
+func TestSubscribeFiltersByType(t *testing.T) {
+	blocks := events.Subscribe(events.BlockNew)
+	defer blocks.Close()
+	all := events.Subscribe()
+	defer all.Close()
+
+	events.Publish(events.Event{Type: events.TransferIncoming})
+	published := events.Publish(events.Event{Type: events.BlockNew})
+
+	got := <-blocks.C
+	if got.ID != published.ID || got.Type != events.BlockNew {
+		t.Errorf("Expected the block event, but got: %+v", got)
+	}
+	if len(blocks.C) != 0 {
+		t.Errorf("Expected no other events, but got %d", len(blocks.C))
+	}
+	if len(all.C) != 2 {
+		t.Errorf("Expected every event without a filter, but got %d", len(all.C))
+	}
+}
+
+func TestPublishDoesNotBlock(t *testing.T) {
+	sub := events.Subscribe(events.BlockNew)
+	defer sub.Close()
+
+	// nobody reads, so the events past the buffer are dropped
+	for i := 0; i < 1000; i++ {
+		events.Publish(events.Event{Type: events.BlockNew, Data: i})
+	}
+	if len(sub.C) == 0 {
+		t.Error("Expected the buffered events to be kept")
+	}
+}
+
+func TestSinceReplaysMissedEvents(t *testing.T) {
+	last := events.Last()
+	first := events.Publish(events.Event{Type: events.ItemCreated, Resource: "items", ResourceID: 1})
+	second := events.Publish(events.Event{Type: events.ItemUpdated, Resource: "items", ResourceID: 1})
+
+	if first.ID != last+1 || events.Last() != second.ID {
+		t.Errorf("Expected IDs to follow %d, but got %d and %d", last, first.ID, second.ID)
+	}
+
+	missed := events.Since(first.ID)
+	if len(missed) != 1 || missed[0].ID != second.ID {
+		t.Errorf("Expected only the second event, but got: %+v", missed)
+	}
+	if missed := events.Since(second.ID); len(missed) != 0 {
+		t.Errorf("Expected nothing after the latest event, but got: %+v", missed)
+	}
+}
+
+func TestSinceKeepsLimitedHistory(t *testing.T) {
+	last := events.Last()
+	for i := 0; i < 1000; i++ {
+		events.Publish(events.Event{Type: events.BlockNew})
+	}
+
+	held := events.Since(last)
+	if len(held) == 0 || len(held) >= 1000 {
+		t.Errorf("Expected the history to be capped, but got %d events", len(held))
+	}
+	if held[len(held)-1].ID != events.Last() {
+		t.Errorf("Expected the history to end with the latest event")
+	}
+}
+
+func TestHeld(t *testing.T) {
+	last := events.Last()
+	events.Publish(events.Event{Type: events.BlockNew})
+	if !events.Held(last) || !events.Held(events.Last()) {
+		t.Errorf("Expected the events after %d held", last)
+	}
+
+	// IDs from before a restart are far below, and those never handed out above
+	if events.Held(1) || events.Held(events.Last()+1) {
+		t.Error("Expected IDs this process didn't hand out recently not to be held")
+	}
+
+	for i := 0; i < 1000; i++ {
+		events.Publish(events.Event{Type: events.BlockNew})
+	}
+	if events.Held(last) {
+		t.Errorf("Expected the events after %d to have dropped out of the history", last)
+	}
+}
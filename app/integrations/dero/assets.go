@@ -0,0 +1,72 @@
+package dero
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/deroproject/derohe/cryptography/crypto"
+)
+
+// DERODecimals is how many decimals there are to DERO's atomic units
+const DERODecimals = 5
+
+// IsDERO tells whether an asset SCID stands for DERO itself, which is
+// either left empty or the zero hash
+func IsDERO(scid string) bool {
+	return scid == "" || scid == crypto.ZEROHASH.String()
+}
+
+// AssetHash returns the hash transfers and addresses carry for an asset,
+// the zero hash for DERO
+func AssetHash(scid string) (crypto.Hash, error) {
+	if IsDERO(scid) {
+		return crypto.ZEROHASH, nil
+	}
+	raw, err := hex.DecodeString(scid)
+	if err != nil || len(raw) != crypto.HashLength {
+		return crypto.Hash{}, fmt.Errorf("invalid asset %q", scid)
+	}
+	var hash crypto.Hash
+	copy(hash[:], raw)
+	return hash, nil
+}
+
+// AssetDecimals returns how many decimals there are to an asset's atomic
+// units: those of DERO, or whatever the token's contract keeps in its
+// "decimals" variable, none when it keeps nothing
+func AssetDecimals(endpoint, scid string) (int, error) {
+	if IsDERO(scid) {
+		return DERODecimals, nil
+	}
+	if _, err := AssetHash(scid); err != nil {
+		return 0, err
+	}
+	sc, err := GetSCID(endpoint, scid)
+	if err != nil {
+		return 0, err
+	}
+	if sc.Code == "" {
+		return 0, fmt.Errorf("asset %s not found", scid)
+	}
+
+	if decimals, ok := sc.VariableStringKeys["decimals"].(float64); ok {
+		return int(decimals), nil
+	}
+	return 0, nil
+}
+
+// FormatAmount spells out atomic units with the asset's decimals, eg.
+// 123456 with 5 decimals is 1.23456
+func FormatAmount(amount uint64, decimals int) string {
+	digits := strconv.FormatUint(amount, 10)
+	if decimals <= 0 {
+		return digits
+	}
+	if len(digits) <= decimals {
+		digits = strings.Repeat("0", decimals-len(digits)+1) + digits
+	}
+	point := len(digits) - decimals
+	return digits[:point] + "." + digits[point:]
+}
@@ -0,0 +1,100 @@
+package dero_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/deroproject/derohe/cryptography/crypto"
+	"github.com/deroproject/derohe/rpc"
+	"github.com/secretnamebasis/secret-site/app/config"
+	"github.com/secretnamebasis/secret-site/app/integrations/dero"
+)
+
+func TestFormatAmount(t *testing.T) {
+	for _, tc := range []struct {
+		amount   uint64
+		decimals int
+		want     string
+	}{
+		{123456, 5, "1.23456"},
+		{100000, 5, "1.00000"},
+		{5, 5, "0.00005"},
+		{0, 5, "0.00000"},
+		{1234, 2, "12.34"},
+		{1234, 0, "1234"},
+	} {
+		if got := dero.FormatAmount(tc.amount, tc.decimals); got != tc.want {
+			t.Errorf("FormatAmount(%d, %d) = %q, want %q", tc.amount, tc.decimals, got, tc.want)
+		}
+	}
+}
+
+func TestAssetDecimals(t *testing.T) {
+	config.EnvPath = "../../../.env.test"
+	token := strings.Repeat("d", 64)
+	node := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			ID int `json:"id"`
+		}
+		json.NewDecoder(r.Body).Decode(&request)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"jsonrpc": "2.0",
+			"id":      request.ID,
+			"result": rpc.GetSC_Result{
+				Code:               "Function Initialize() Uint64\n10 RETURN 0\nEnd Function",
+				VariableStringKeys: map[string]interface{}{"decimals": float64(2)},
+			},
+		})
+	}))
+	defer node.Close()
+
+	for scid, want := range map[string]int{"": 5, crypto.ZEROHASH.String(): 5, token: 2} {
+		decimals, err := dero.AssetDecimals(node.URL, scid)
+		if err != nil || decimals != want {
+			t.Errorf("Expected %d decimals for %q, but got %d (%v)", want, scid, decimals, err)
+		}
+	}
+	if _, err := dero.AssetDecimals(node.URL, "not an scid"); err == nil {
+		t.Error("Expected an invalid SCID refused")
+	}
+}
+
+func TestMakeIntegratedAddressAsset(t *testing.T) {
+	token := strings.Repeat("e", 64)
+	var arguments rpc.Arguments
+	wallet := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			ID     int                                `json:"id"`
+			Params rpc.Make_Integrated_Address_Params `json:"params"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			t.Errorf("Failed to decode request: %v", err)
+		}
+		arguments = request.Params.Payload_RPC
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"jsonrpc": "2.0",
+			"id":      request.ID,
+			"result":  rpc.Make_Integrated_Address_Result{Integrated_Address: "deroi1"},
+		})
+	}))
+	defer wallet.Close()
+	config.WalletEndpoint = wallet.URL
+
+	if _, err := dero.MakeIntegratedAddress("pay", 7, 100, "", time.Now()); err != nil {
+		t.Fatalf("Failed to make an address: %v", err)
+	}
+	if arguments.Has(rpc.RPC_ASSET, rpc.DataHash) {
+		t.Errorf("Expected DERO addresses to leave the asset out, but got: %+v", arguments)
+	}
+
+	if _, err := dero.MakeIntegratedAddress("pay", 7, 100, token, time.Now()); err != nil {
+		t.Fatalf("Failed to make an address: %v", err)
+	}
+	if !arguments.Has(rpc.RPC_ASSET, rpc.DataHash) || arguments.Value(rpc.RPC_ASSET, rpc.DataHash).(crypto.Hash).String() != token {
+		t.Errorf("Expected the address to ask for %s, but got: %+v", token, arguments)
+	}
+}
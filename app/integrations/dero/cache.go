@@ -0,0 +1,226 @@
+package dero
+
+import (
+	"sync"
+	"time"
+
+	"github.com/deroproject/derohe/rpc"
+	c "github.com/secretnamebasis/secret-site/app/config"
+	"github.com/secretnamebasis/secret-site/app/events"
+	"github.com/secretnamebasis/secret-site/app/metrics"
+	"golang.org/x/sync/singleflight"
+)
+
+// topoCheck is how often, at most, we ask the node for its topoheight
+const topoCheck = 2 * time.Second
+
+// evictAfter is how many TTLs an entry nobody refreshed is kept for
+const evictAfter = 10
+
+// scEntry is a contract's state as it was at a topoheight
+type scEntry struct {
+	result     rpc.GetSC_Result
+	topoHeight int64
+	fetchedAt  time.Time
+}
+
+// topo is the last topoheight a node told us about
+type topo struct {
+	height    int64
+	checkedAt time.Time
+}
+
+// scCache sits in front of the node's GetSC, one entry per SCID;
+// an entry goes stale once it's older than the TTL or the node moves
+// to a new block, and stale entries are served while they're refreshed
+var scCache = struct {
+	mu      sync.RWMutex
+	entries map[string]scEntry // by endpoint and SCID
+	topos   map[string]topo    // by endpoint
+	calls   singleflight.Group // identical calls in flight share one answer
+}{
+	entries: make(map[string]scEntry),
+	topos:   make(map[string]topo),
+}
+
+// NewBlock tells the cache the node has reached a topoheight, so that
+// everything read before it goes stale without waiting for the TTL; entries
+// nobody asked for in evictAfter TTLs are dropped
+func NewBlock(endpoint string, topoHeight int64) {
+	scCache.mu.Lock()
+	defer scCache.mu.Unlock()
+	if topoHeight <= scCache.topos[endpoint].height {
+		return
+	}
+	scCache.topos[endpoint] = topo{height: topoHeight, checkedAt: time.Now()}
+
+	for key, entry := range scCache.entries {
+		if time.Since(entry.fetchedAt) > evictAfter*c.SCCacheTTL {
+			delete(scCache.entries, key)
+		}
+	}
+}
+
+// WatchBlocks lets new block events invalidate the cache for the node at
+// endpoint; run it in a goroutine of its own
+func WatchBlocks(endpoint string) {
+	sub := events.Subscribe(events.BlockNew)
+	defer sub.Close()
+
+	for event := range sub.C {
+		if header, ok := event.Data.(*rpc.BlockHeader_Print); ok {
+			NewBlock(endpoint, header.TopoHeight)
+		}
+	}
+}
+
+// InvalidateSC drops a contract from the cache, eg. after we've changed it
+func InvalidateSC(endpoint, scid string) {
+	scCache.mu.Lock()
+	defer scCache.mu.Unlock()
+	delete(scCache.entries, endpoint+"/"+scid)
+}
+
+// RefreshSC fetches a contract's latest state from the node, into the cache
+func RefreshSC(endpoint, scid string) (*rpc.GetSC_Result, error) {
+	return refreshSC(endpoint, scid, topoHeight(endpoint))
+}
+
+// private functions
+
+// cachedSC returns the contract's code and variables from the cache if it
+// can, from the node if it must
+func cachedSC(endpoint, scid string) (*rpc.GetSC_Result, error) {
+	// a TTL of 0 turns the cache off
+	if c.SCCacheTTL <= 0 {
+		return fetchSC(endpoint, scid, 0)
+	}
+
+	key := endpoint + "/" + scid
+	height := topoHeight(endpoint)
+
+	scCache.mu.RLock()
+	entry, ok := scCache.entries[key]
+	scCache.mu.RUnlock()
+
+	switch {
+	case !ok:
+		metrics.SCCacheLookups.WithLabelValues("miss").Inc()
+		return refreshSC(endpoint, scid, height)
+
+	case height <= entry.topoHeight && time.Since(entry.fetchedAt) < c.SCCacheTTL:
+		metrics.SCCacheLookups.WithLabelValues("hit").Inc()
+
+	default:
+		// serve what we have, and bring it up to date for the next one
+		metrics.SCCacheLookups.WithLabelValues("stale").Inc()
+		go refreshSC(endpoint, scid, height)
+	}
+
+	return copySC(entry.result), nil
+}
+
+// refreshSC fetches the contract into the cache; identical calls
+// made while one is in flight wait for it instead of calling the node too
+func refreshSC(endpoint, scid string, height int64) (*rpc.GetSC_Result, error) {
+	key := endpoint + "/" + scid
+	value, err, _ := scCache.calls.Do(key, func() (interface{}, error) {
+		result, err := fetchSC(endpoint, scid, 0)
+		if err != nil {
+			return nil, err
+		}
+
+		scCache.mu.Lock()
+		defer scCache.mu.Unlock()
+		scCache.entries[key] = scEntry{
+			result:     *result,
+			topoHeight: height,
+			fetchedAt:  time.Now(),
+		}
+		return *result, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// every caller gets a copy of its own to change as it likes
+	return copySC(value.(rpc.GetSC_Result)), nil
+}
+
+// fetchSC asks the node for the contract's code and variables as they were
+// at a topoheight, 0 for the latest; the cache keeps the topoheight it knew
+// before asking for the latest, which can only be older
+func fetchSC(endpoint, scid string, topoHeight int64) (*rpc.GetSC_Result, error) {
+	var response rpc.GetSC_Result
+	err := CallRPC(
+		endpoint,
+		&response,
+		prefix+"GetSC",
+		rpc.GetSC_Params{
+			SCID:       scid,
+			Code:       true,
+			Variables:  true,
+			TopoHeight: topoHeight,
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
+
+// topoHeight returns the node's topoheight, asking the node at most
+// every topoCheck; 0 means we don't know it
+func topoHeight(endpoint string) int64 {
+	scCache.mu.RLock()
+	last := scCache.topos[endpoint]
+	scCache.mu.RUnlock()
+
+	// no use waiting on a node we know is down
+	if time.Since(last.checkedAt) < topoCheck || !NodeOnline() {
+		return last.height
+	}
+
+	value, err, _ := scCache.calls.Do("info/"+endpoint, func() (interface{}, error) {
+		info, err := GetInfo(endpoint)
+		if err != nil {
+			return nil, err
+		}
+		NewBlock(endpoint, info.TopoHeight)
+		return info.TopoHeight, nil
+	})
+	if err != nil {
+		// go with what we knew, the TTL still holds
+		return last.height
+	}
+	return value.(int64)
+}
+
+// copySC copies a contract's state, maps and all
+func copySC(result rpc.GetSC_Result) *rpc.GetSC_Result {
+	if result.VariableStringKeys != nil {
+		stringKeys := make(map[string]interface{}, len(result.VariableStringKeys))
+		for k, v := range result.VariableStringKeys {
+			stringKeys[k] = v
+		}
+		result.VariableStringKeys = stringKeys
+	}
+	if result.VariableUint64Keys != nil {
+		uint64Keys := make(map[uint64]interface{}, len(result.VariableUint64Keys))
+		for k, v := range result.VariableUint64Keys {
+			uint64Keys[k] = v
+		}
+		result.VariableUint64Keys = uint64Keys
+	}
+	if result.Balances != nil {
+		balances := make(map[string]uint64, len(result.Balances))
+		for k, v := range result.Balances {
+			balances[k] = v
+		}
+		result.Balances = balances
+	}
+	result.ValuesUint64 = append([]string(nil), result.ValuesUint64...)
+	result.ValuesString = append([]string(nil), result.ValuesString...)
+	result.ValuesBytes = append([]string(nil), result.ValuesBytes...)
+	return &result
+}
@@ -0,0 +1,144 @@
+package dero_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/secretnamebasis/secret-site/app/config"
+	"github.com/secretnamebasis/secret-site/app/integrations/dero"
+)
+
+// fakeNode answers DERO.GetInfo and DERO.GetSC, counting the GetSC calls
+func fakeNode(t *testing.T, topoHeight *atomic.Int64, calls *atomic.Int64) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			ID     int    `json:"id"`
+			Method string `json:"method"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			t.Errorf("Failed to decode request: %v", err)
+		}
+
+		var result interface{}
+		switch request.Method {
+		case "DERO.GetInfo":
+			result = map[string]interface{}{"topoheight": topoHeight.Load()}
+		case "DERO.GetSC":
+			calls.Add(1)
+			// slow enough for concurrent calls to overlap
+			time.Sleep(50 * time.Millisecond)
+			result = map[string]interface{}{
+				"code":       "Function Initialize() Uint64\n10 RETURN 0\nEnd Function",
+				"stringkeys": map[string]interface{}{"C": "abc"},
+			}
+		}
+
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"jsonrpc": "2.0",
+			"id":      request.ID,
+			"result":  result,
+		})
+	}))
+}
+
+func TestGetSCIDCache(t *testing.T) {
+	config.EnvPath = "../../../.env.test"
+	config.SCCacheTTL = time.Minute
+
+	var topoHeight, calls atomic.Int64
+	topoHeight.Store(100)
+	node := fakeNode(t, &topoHeight, &calls)
+	defer node.Close()
+	endpoint := node.URL + "/json_rpc"
+
+	// concurrent misses make a single call
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := dero.GetSCID(endpoint, "scid"); err != nil {
+				t.Errorf("Failed to get SC: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if got := calls.Load(); got != 1 {
+		t.Fatalf("Expected 1 call to the node, but got: %d", got)
+	}
+
+	// hits don't call the node, and callers can't change the cached state
+	result, err := dero.GetSCID(endpoint, "scid")
+	if err != nil {
+		t.Fatalf("Failed to get SC: %v", err)
+	}
+	result.VariableStringKeys["C"] = "changed"
+	result, _ = dero.GetSCID(endpoint, "scid")
+	if result.VariableStringKeys["C"] != "abc" {
+		t.Errorf("Expected the cached state to be untouched, but got: %v", result.VariableStringKeys["C"])
+	}
+	if got := calls.Load(); got != 1 {
+		t.Fatalf("Expected hits not to call the node, but got: %d calls", got)
+	}
+
+	// a new block serves the stale state while it's refreshed
+	dero.NewBlock(endpoint, 101)
+	if _, err := dero.GetSCID(endpoint, "scid"); err != nil {
+		t.Fatalf("Failed to get stale SC: %v", err)
+	}
+	deadline := time.Now().Add(time.Second)
+	for calls.Load() != 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := calls.Load(); got != 2 {
+		t.Errorf("Expected the new block to refresh the state, but got: %d calls", got)
+	}
+}
+
+func TestGetSCIDCacheEviction(t *testing.T) {
+	config.EnvPath = "../../../.env.test"
+	config.SCCacheTTL = 10 * time.Millisecond
+	t.Cleanup(func() { config.SCCacheTTL = time.Minute })
+
+	// every answer tells which call it was
+	var calls atomic.Int64
+	node := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			ID     int    `json:"id"`
+			Method string `json:"method"`
+		}
+		json.NewDecoder(r.Body).Decode(&request)
+		var result interface{} = map[string]interface{}{"topoheight": 0}
+		if request.Method == "DERO.GetSC" {
+			result = map[string]interface{}{"stringkeys": map[string]interface{}{"call": calls.Add(1)}}
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"jsonrpc": "2.0",
+			"id":      request.ID,
+			"result":  result,
+		})
+	}))
+	defer node.Close()
+	endpoint := node.URL + "/json_rpc"
+
+	if _, err := dero.GetSCID(endpoint, "evicted"); err != nil {
+		t.Fatalf("Failed to get SC: %v", err)
+	}
+
+	// long forgotten, the entry goes with the next block, so the next
+	// lookup waits for a fresh answer instead of being served the old one
+	time.Sleep(20 * config.SCCacheTTL)
+	dero.NewBlock(endpoint, 1)
+	result, err := dero.GetSCID(endpoint, "evicted")
+	if err != nil {
+		t.Fatalf("Failed to get SC: %v", err)
+	}
+	if got := result.VariableStringKeys["call"]; got != float64(2) {
+		t.Errorf("Expected the evicted entry fetched again, but got call %v", got)
+	}
+}
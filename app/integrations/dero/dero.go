@@ -2,18 +2,21 @@ package dero
 
 import (
 	"encoding/base64"
+	"net/http"
 	"strings"
 	"time"
 
 	"github.com/deroproject/derohe/cryptography/crypto"
 	"github.com/deroproject/derohe/rpc"
 	c "github.com/secretnamebasis/secret-site/app/config"
+	"github.com/secretnamebasis/secret-site/app/metrics"
 	"github.com/ybbus/jsonrpc"
 )
 
 const prefix = "DERO."
 const user = "DERO_WALLET_USER"
 const pass = "DERO_WALLET_PASS"
+const timeout = 10 * time.Second
 const DERO_SCID_STRING = "0000000000000000000000000000000000000000000000000000000000000000"
 
 // CallRPC is a generic function to make JSON-RPC calls to either the DERO wallet or node.
@@ -23,31 +26,35 @@ func CallRPC(
 	method string,
 	params ...interface{},
 ) error {
+	// every call gets counted and timed
+	start := time.Now()
+	err := callRPC(endpoint, object, method, params...)
+	metrics.ObserveRPC(method, start, err)
+	// and tells us whether the other end is still there
+	return track(method, err)
+}
 
-	// For DERO Node calls
-	if strings.Contains(method, prefix) {
-		rpcClient := jsonrpc.NewClient(endpoint)
-		if len(params) > 0 {
-			return rpcClient.CallFor(
-				&object,
-				method,
-				params[0],
-			)
-		}
-		return rpcClient.CallFor(
-			&object,
-			method,
-		)
+// callRPC makes the call for CallRPC
+func callRPC(
+	endpoint string,
+	object interface{},
+	method string,
+	params ...interface{},
+) error {
+
+	// a wallet or node that hangs is as good as gone
+	opts := &jsonrpc.RPCClientOpts{
+		HTTPClient: &http.Client{Timeout: timeout},
 	}
 
 	// For DERO Wallet calls
-	endpointAuth := c.Env(c.EnvPath, user) + ":" + c.Env(c.EnvPath, pass)
-	encodedEndpointAuth := base64.StdEncoding.EncodeToString([]byte(endpointAuth))
+	if !isNodeMethod(method) {
+		endpointAuth := c.Env(c.EnvPath, user) + ":" + c.Env(c.EnvPath, pass)
+		encodedEndpointAuth := base64.StdEncoding.EncodeToString([]byte(endpointAuth))
 
-	opts := &jsonrpc.RPCClientOpts{
-		CustomHeaders: map[string]string{
+		opts.CustomHeaders = map[string]string{
 			"Authorization": "Basic " + encodedEndpointAuth,
-		},
+		}
 	}
 
 	rpcClient := jsonrpc.NewClientWithOpts(
@@ -69,6 +76,11 @@ func CallRPC(
 	)
 }
 
+// isNodeMethod tells the DERO node's methods from the wallet's
+func isNodeMethod(method string) bool {
+	return strings.Contains(method, prefix)
+}
+
 // GetWalletAddress fetches the DERO wallet address.
 func GetWalletAddress(endpoint string) (*rpc.Address, error) {
 	// params := map[string]interface{}{}
@@ -83,6 +95,90 @@ func GetWalletAddress(endpoint string) (*rpc.Address, error) {
 	)
 }
 
+// GetInfo fetches the node's info, its heights among them.
+func GetInfo(endpoint string) (*rpc.GetInfo_Result, error) {
+	method := prefix + "GetInfo"
+	var response rpc.GetInfo_Result
+	err := CallRPC(
+		endpoint,
+		&response,
+		method,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
+
+// GetBlockHeaderByTopoHeight fetches the header of the block at the given topoheight.
+func GetBlockHeaderByTopoHeight(endpoint string, topoHeight int64) (*rpc.BlockHeader_Print, error) {
+	method := prefix + "GetBlockHeaderByTopoHeight"
+	params := rpc.GetBlockHeaderByTopoHeight_Params{
+		TopoHeight: uint64(topoHeight),
+	}
+	var response rpc.GetBlockHeaderByHeight_Result
+	err := CallRPC(
+		endpoint,
+		&response,
+		method,
+		params,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &response.Block_Header, nil
+}
+
+// GetIncomingTransfers fetches the transfers of an asset, DERO when empty,
+// the wallet received from minHeight on.
+func GetIncomingTransfers(endpoint, scid string, minHeight uint64) ([]rpc.Entry, error) {
+	asset, err := AssetHash(scid)
+	if err != nil {
+		return nil, err
+	}
+	method := "GetTransfers"
+	params := rpc.Get_Transfers_Params{
+		SCID:       asset,
+		In:         true,
+		Min_Height: minHeight,
+	}
+	var response rpc.Get_Transfers_Result
+	if err := CallRPC(
+		endpoint,
+		&response,
+		method,
+		params,
+	); err != nil {
+		return nil, err
+	}
+	return response.Entries, nil
+}
+
+// GetOutgoingTransfers fetches the transfers of an asset, DERO when empty,
+// the wallet sent from minHeight on; the wallet lists them once they're mined.
+func GetOutgoingTransfers(endpoint, scid string, minHeight uint64) ([]rpc.Entry, error) {
+	asset, err := AssetHash(scid)
+	if err != nil {
+		return nil, err
+	}
+	method := "GetTransfers"
+	params := rpc.Get_Transfers_Params{
+		SCID:       asset,
+		Out:        true,
+		Min_Height: minHeight,
+	}
+	var response rpc.Get_Transfers_Result
+	if err := CallRPC(
+		endpoint,
+		&response,
+		method,
+		params,
+	); err != nil {
+		return nil, err
+	}
+	return response.Entries, nil
+}
+
 func GetWalletTransfers(endpoint string) (*rpc.Get_Transfers_Result, error) {
 	method := "GetTransfers"
 	params := rpc.Get_Transfers_Params{}
@@ -119,29 +215,29 @@ func GetEncryptedBalance(endpoint, address string) (*rpc.GetEncryptedBalance_Res
 	return &response, nil
 }
 
-// GetSCID fetches the SCID for the given TXID.
+// GetSCID fetches the code and variables of the contract with the given SCID,
+// through the cache.
 func GetSCID(endpoint, scid string) (*rpc.GetSC_Result, error) {
+	return cachedSC(endpoint, scid)
+}
 
-	var response rpc.GetSC_Result
-	method := prefix + "GetSC"
-	err := CallRPC(
-		endpoint,
-		&response,
-		method,
-		rpc.GetSC_Params{
-			SCID:      scid,
-			Code:      true,
-			Variables: true,
-		},
-	)
+// GetSCAt fetches the code and variables of the contract with the given
+// SCID as they were at a topoheight, straight from the node.
+func GetSCAt(endpoint, scid string, topoHeight int64) (*rpc.GetSC_Result, error) {
+	return fetchSC(endpoint, scid, topoHeight)
+}
 
+// Comment sends one atomic unit of an asset, DERO when empty, carrying the
+// comment to destination; fees, unless 0, are paid instead of what the
+// wallet works out
+func Comment(endpoint, comment, destination, scid string, fees uint64) (rpc.Transfer_Result, error) {
+	asset, err := AssetHash(scid)
 	if err != nil {
-		return nil, err
+		return rpc.Transfer_Result{}, err
+	}
+	if err := CheckComment(comment); err != nil {
+		return rpc.Transfer_Result{}, err
 	}
-	return &response, nil
-}
-
-func Comment(endpoint, comment, destination string) (rpc.Transfer_Result, error) {
 
 	// and a pencil
 	object := rpc.Transfer_Result{}
@@ -150,7 +246,7 @@ func Comment(endpoint, comment, destination string) (rpc.Transfer_Result, error)
 	method := "transfer"
 	transfer := rpc.Transfer{
 		//
-		SCID:        crypto.ZEROHASH,
+		SCID:        asset,
 		Destination: destination,
 		Amount:      1, // we want them to keep one,
 		Payload_RPC: rpc.Arguments{
@@ -165,6 +261,8 @@ func Comment(endpoint, comment, destination string) (rpc.Transfer_Result, error)
 		Transfers: []rpc.Transfer{
 			transfer,
 		},
+		Ringsize: CommentRingsize,
+		Fees:     fees,
 	}
 
 	return object,
@@ -176,11 +274,55 @@ func Comment(endpoint, comment, destination string) (rpc.Transfer_Result, error)
 		)
 }
 
+// Send transfers amount of an asset, DERO when empty, to destination with
+// a comment for the receiving wallet
+func Send(endpoint, destination, scid string, amount uint64, comment string) (rpc.Transfer_Result, error) {
+	asset, err := AssetHash(scid)
+	if err != nil {
+		return rpc.Transfer_Result{}, err
+	}
+	if err := CheckComment(comment); err != nil {
+		return rpc.Transfer_Result{}, err
+	}
+
+	params := rpc.Transfer_Params{
+		Transfers: []rpc.Transfer{
+			{
+				SCID:        asset,
+				Destination: destination,
+				Amount:      amount,
+				Payload_RPC: rpc.Arguments{
+					rpc.Argument{
+						Name:     rpc.RPC_COMMENT,
+						DataType: rpc.DataString,
+						Value:    comment,
+					},
+				},
+			},
+		},
+	}
+	var result rpc.Transfer_Result
+	if err := CallRPC(
+		endpoint,
+		&result,
+		"transfer",
+		params,
+	); err != nil {
+		return rpc.Transfer_Result{}, err
+	}
+	return result, nil
+}
+
+// MintContract installs the contract from the wallet, after making sure the
+// DVM can parse it
 func MintContract(
 	endpoint,
 	contract,
 	destination string,
 ) (rpc.Transfer_Result, error) {
+	if err := CheckContract(contract); err != nil {
+		return rpc.Transfer_Result{}, err
+	}
 
 	t := rpc.Transfer{
 		Destination: destination,
@@ -214,32 +356,60 @@ func MintContract(
 	return obj, nil
 }
 
+// MakeIntegratedAddress makes an address to pay price of an asset, DERO
+// when empty, to the server wallet; a zero price or expiry leaves either
+// up to the sender
 func MakeIntegratedAddress(
 	comment string,
+	port uint64, // the destination port tells the payments apart
 	price uint64,
+	scid string,
 	expiry time.Time,
 ) (rpc.Make_Integrated_Address_Result, error) {
+	asset, err := AssetHash(scid)
+	if err != nil {
+		return rpc.Make_Integrated_Address_Result{}, err
+	}
 
-	params := rpc.Make_Integrated_Address_Params{
-		Address: c.ServerWallet.Address,
-		Payload_RPC: rpc.Arguments{
-			rpc.Argument{
-				Name:     rpc.RPC_COMMENT,
-				DataType: rpc.DataString,
-				Value:    comment,
-			},
-			rpc.Argument{
-				Name:     rpc.RPC_VALUE_TRANSFER,
-				DataType: rpc.DataUint64,
-				Value:    price,
-			},
-			rpc.Argument{
-				Name:     rpc.RPC_EXPIRY,
-				DataType: rpc.DataTime,
-				Value:    expiry,
-			},
+	arguments := rpc.Arguments{
+		rpc.Argument{
+			Name:     rpc.RPC_COMMENT,
+			DataType: rpc.DataString,
+			Value:    comment,
+		},
+		rpc.Argument{
+			Name:     rpc.RPC_DESTINATION_PORT,
+			DataType: rpc.DataUint64,
+			Value:    port,
 		},
 	}
+	if price > 0 {
+		arguments = append(arguments, rpc.Argument{
+			Name:     rpc.RPC_VALUE_TRANSFER,
+			DataType: rpc.DataUint64,
+			Value:    price,
+		})
+	}
+	if !expiry.IsZero() {
+		arguments = append(arguments, rpc.Argument{
+			Name:     rpc.RPC_EXPIRY,
+			DataType: rpc.DataTime,
+			Value:    expiry,
+		})
+	}
+	// wallets assume DERO unless told otherwise
+	if asset != crypto.ZEROHASH {
+		arguments = append(arguments, rpc.Argument{
+			Name:     rpc.RPC_ASSET,
+			DataType: rpc.DataHash,
+			Value:    asset,
+		})
+	}
+
+	params := rpc.Make_Integrated_Address_Params{
+		Address:     c.ServerWallet.Address,
+		Payload_RPC: arguments,
+	}
 	var result rpc.Make_Integrated_Address_Result
 	method := "MakeIntegratedAddress"
 	if err := CallRPC(
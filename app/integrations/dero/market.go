@@ -0,0 +1,176 @@
+package dero
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/deroproject/derohe/cryptography/crypto"
+	"github.com/deroproject/derohe/rpc"
+)
+
+// Listing types the contract's Start takes
+const (
+	ListSale    = "sale"
+	ListAuction = "auction"
+)
+
+// MaxListingHours is the longest listing; the contract cuts Start's duration
+// down to a week, and lists anything under an hour for an hour
+const MaxListingHours = 168
+
+// MarketActions maps the marketplace actions to the ART-NFA-MS1 entrypoints
+var MarketActions = map[string]string{
+	"start":  "Start",
+	"buy":    "BuyItNow",
+	"bid":    "Bid",
+	"close":  "CloseListing",
+	"cancel": "CancelListing",
+	"claim":  "ClaimOwnership",
+}
+
+// Marketplace call errors
+var (
+	ErrUnknownAction = errors.New("unknown marketplace action")
+	ErrInvalidCall   = errors.New("invalid marketplace call")
+)
+
+// MarketCall is a call to one of the contract's marketplace entrypoints
+type MarketCall struct {
+	Action      string // a key of MarketActions
+	SCID        string
+	ListType    string // start: sale or auction
+	Duration    uint64 // start: hours
+	StartPrice  uint64 // start: atomic units
+	CharityAddr string // start: gets CharityPerc of the sale
+	CharityPerc uint64 // start
+	Amount      uint64 // buy and bid: atomic units sent with the call
+}
+
+// Validate checks the call against what its entrypoint will accept
+func (m MarketCall) Validate() error {
+	if _, ok := MarketActions[m.Action]; !ok {
+		return fmt.Errorf("%w: %q", ErrUnknownAction, m.Action)
+	}
+	if len(m.SCID) != 64 || crypto.HashHexToHash(m.SCID).IsZero() {
+		return fmt.Errorf("%w: invalid scid", ErrInvalidCall)
+	}
+
+	switch m.Action {
+	case "start":
+		if m.ListType != ListSale && m.ListType != ListAuction {
+			return fmt.Errorf("%w: list type must be sale or auction", ErrInvalidCall)
+		}
+		if m.Duration > MaxListingHours {
+			return fmt.Errorf("%w: duration cannot exceed %d hours", ErrInvalidCall, MaxListingHours)
+		}
+		// the contract trims the charity's cut to what the fees leave
+		// over, but a big enough one overflows the sum it checks
+		if m.CharityPerc > 100-ArtificerFee {
+			return fmt.Errorf("%w: charity percent cannot exceed %d", ErrInvalidCall, 100-ArtificerFee)
+		}
+		if m.CharityPerc > 0 {
+			if _, err := rpc.NewAddress(strings.TrimSpace(m.CharityAddr)); err != nil {
+				return fmt.Errorf("%w: charity address is not a DERO address", ErrInvalidCall)
+			}
+		}
+	case "buy", "bid":
+		// an empty call is refunded, but still costs the fee
+		if m.Amount == 0 {
+			return fmt.Errorf("%w: amount cannot be zero", ErrInvalidCall)
+		}
+	}
+	return nil
+}
+
+// MarketParams builds the transfer that makes the call. Tokens and DERO go to
+// the contract as burns, which the wallet only sends alongside a transfer to
+// someone; destination is that someone, and receives nothing. It can be any
+// registered address but the signer's own.
+func MarketParams(m MarketCall, destination string) (rpc.Transfer_Params, error) {
+	if err := m.Validate(); err != nil {
+		return rpc.Transfer_Params{}, err
+	}
+
+	args := rpc.Arguments{
+		rpc.Argument{
+			Name:     "entrypoint",
+			DataType: rpc.DataString,
+			Value:    MarketActions[m.Action],
+		},
+	}
+
+	var transfers []rpc.Transfer
+	switch m.Action {
+	case "start":
+		args = append(args,
+			rpc.Argument{Name: "listType", DataType: rpc.DataString, Value: m.ListType},
+			rpc.Argument{Name: "duration", DataType: rpc.DataUint64, Value: m.Duration},
+			rpc.Argument{Name: "startPrice", DataType: rpc.DataUint64, Value: m.StartPrice},
+			rpc.Argument{Name: "charityDonateAddr", DataType: rpc.DataString, Value: strings.TrimSpace(m.CharityAddr)},
+			rpc.Argument{Name: "charityDonatePerc", DataType: rpc.DataUint64, Value: m.CharityPerc},
+		)
+		fallthrough
+	case "claim":
+		// the contract holds the token while it's listed, and hands it
+		// straight back to whoever claims it
+		transfers = append(transfers, rpc.Transfer{
+			SCID:        crypto.HashHexToHash(m.SCID),
+			Destination: destination,
+			Burn:        1,
+		})
+	case "buy", "bid":
+		transfers = append(transfers, rpc.Transfer{
+			SCID:        crypto.ZEROHASH,
+			Destination: destination,
+			Burn:        m.Amount,
+		})
+	}
+
+	return rpc.Transfer_Params{
+		Transfers: transfers,
+		SC_ID:     m.SCID,
+		SC_RPC:    args,
+		// the contract goes by SIGNER(), which an anonymous ring hides
+		Ringsize: 2,
+	}, nil
+}
+
+// CallContract sends the transfer from the wallet
+func CallContract(endpoint string, params rpc.Transfer_Params) (rpc.Transfer_Result, error) {
+	var result rpc.Transfer_Result
+	if err := CallRPC(
+		endpoint,
+		&result,
+		"transfer",
+		params,
+	); err != nil {
+		return rpc.Transfer_Result{}, err
+	}
+	return result, nil
+}
+
+// GetRandomAddress returns a registered address from the node that isn't
+// one of those given
+func GetRandomAddress(endpoint string, exclude ...string) (string, error) {
+	var result rpc.GetRandomAddress_Result
+	if err := CallRPC(
+		endpoint,
+		&result,
+		"DERO.GetRandomAddress",
+		rpc.GetRandomAddress_Params{},
+	); err != nil {
+		return "", err
+	}
+
+next:
+	for _, address := range result.Address {
+		for _, excluded := range exclude {
+			if address == excluded {
+				continue next
+			}
+		}
+		return address, nil
+	}
+	return "", errors.New("no address to send the call through")
+}
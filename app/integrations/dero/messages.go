@@ -0,0 +1,62 @@
+package dero
+
+import (
+	"fmt"
+
+	"github.com/deroproject/derohe/config"
+	"github.com/deroproject/derohe/rpc"
+)
+
+// PayloadLimit is how many bytes of arguments a transfer can carry, the
+// transaction package's PAYLOAD0_LIMIT
+const PayloadLimit = 144
+
+// CommentRingsize is the ring size comments are sent with
+const CommentRingsize = 16
+
+// CommentFee is what the wallet, at its base fee multiplier, works out a
+// comment transfer of DERO at CommentRingsize pays: its two outputs and the
+// transfer, at FEE_PER_KB for every 16 ring members and once more. That is
+// more than the node asks of a transaction that size.
+func CommentFee() uint64 {
+	return 3 * config.FEE_PER_KB * (CommentRingsize/16 + 1)
+}
+
+// CheckComment makes sure a comment fits in a transfer's payload
+func CheckComment(comment string) error {
+	arguments := rpc.Arguments{
+		rpc.Argument{
+			Name:     rpc.RPC_COMMENT,
+			DataType: rpc.DataString,
+			Value:    comment,
+		},
+	}
+	if _, err := arguments.CheckPack(PayloadLimit); err != nil {
+		return fmt.Errorf("comment is too long: %w", err)
+	}
+	return nil
+}
+
+// CommentOf returns the comment a transfer carries, if any
+func CommentOf(entry rpc.Entry) (string, bool) {
+	if !entry.Payload_RPC.Has(rpc.RPC_COMMENT, rpc.DataString) {
+		return "", false
+	}
+	comment, ok := entry.Payload_RPC.Value(rpc.RPC_COMMENT, rpc.DataString).(string)
+	return comment, ok
+}
+
+// GetTransferByTXID looks up a transfer of the wallet's in DERO, its fees
+// among the rest; the wallet only knows it once it is mined
+func GetTransferByTXID(endpoint, txid string) (rpc.Entry, error) {
+	var result rpc.Get_Transfer_By_TXID_Result
+	if err := CallRPC(
+		endpoint,
+		&result,
+		"GetTransferbyTXID",
+		rpc.Get_Transfer_By_TXID_Params{TXID: txid},
+	); err != nil {
+		return rpc.Entry{}, err
+	}
+	return result.Entry, nil
+}
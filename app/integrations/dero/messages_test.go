@@ -0,0 +1,49 @@
+package dero_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/deroproject/derohe/rpc"
+	"github.com/secretnamebasis/secret-site/app/integrations/dero"
+)
+
+func TestCheckComment(t *testing.T) {
+	if err := dero.CheckComment("bob on example.com: is it still for sale?"); err != nil {
+		t.Errorf("Expected a short comment to fit, but got %v", err)
+	}
+	if err := dero.CheckComment(strings.Repeat("a", dero.PayloadLimit)); err == nil {
+		t.Errorf("Expected a comment as long as the payload not to fit")
+	}
+}
+
+func TestCommentOf(t *testing.T) {
+	entry := rpc.Entry{Payload_RPC: rpc.Arguments{
+		{Name: rpc.RPC_DESTINATION_PORT, DataType: rpc.DataUint64, Value: uint64(7)},
+		{Name: rpc.RPC_COMMENT, DataType: rpc.DataString, Value: "hello"},
+	}}
+	if comment, ok := dero.CommentOf(entry); !ok || comment != "hello" {
+		t.Errorf("Expected the comment hello, but got %q (%v)", comment, ok)
+	}
+	if _, ok := dero.CommentOf(rpc.Entry{}); ok {
+		t.Errorf("Expected no comment on a bare transfer")
+	}
+}
+
+func TestSendChecksComment(t *testing.T) {
+	var calls atomic.Int64
+	wallet := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+	}))
+	defer wallet.Close()
+
+	if _, err := dero.Send(wallet.URL, "dero1", "", 100, strings.Repeat("a", dero.PayloadLimit)); err == nil {
+		t.Errorf("Expected a comment too long for the payload refused")
+	}
+	if calls.Load() != 0 {
+		t.Errorf("Expected nothing sent to the wallet, but it was called %d times", calls.Load())
+	}
+}
@@ -1,36 +1,211 @@
 package dero
 
-func NFAContract(
-	royalty,
-	nameHdr,
-	descHdr,
-	typeHdr,
-	collection,
-	addr string,
-) string {
-
-	// let's make the contract
-	contract :=
-		`
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"text/scanner"
+	"text/template"
+	"unicode/utf8"
+
+	"github.com/deroproject/derohe/dvm"
+	"github.com/deroproject/derohe/rpc"
+)
+
+// ArtificerFee is the percent of every sale the contract pays to Artificer
+const ArtificerFee = 1
+
+// MaxRoyalty is the highest royalty the contract will initialize with, as
+// init() refuses anything that takes the fees past 100 percent
+const MaxRoyalty = 100 - ArtificerFee
+
+// ErrInvalidContract is returned for headers or source that can't make a contract
+var ErrInvalidContract = errors.New("invalid contract")
+
+// NFA holds the headers an ART-NFA-MS1 contract is minted with
+type NFA struct {
+	Royalty     uint64 // percent of every sale paid to the creator
+	Name        string
+	Description string
+	Type        string // eg. image, audio, video
+	Collection  string
+	Tags        string
+	IconURL     string
+	CoverURL    string
+	FileURL     string
+	FileSignURL string
+	FileCheckC  string
+	FileCheckS  string
+	Owner       string // the address the token goes to
+	Creator     string // the address royalties go to, which may update the token
+}
+
+// Validate checks the headers before they go anywhere near the contract
+func (nfa NFA) Validate() error {
+	if nfa.Royalty > MaxRoyalty {
+		return fmt.Errorf("%w: royalty cannot exceed %d", ErrInvalidContract, MaxRoyalty)
+	}
+	headers := map[string]string{
+		"name":        nfa.Name,
+		"description": nfa.Description,
+		"type":        nfa.Type,
+		"collection":  nfa.Collection,
+		"tags":        nfa.Tags,
+		"iconURL":     nfa.IconURL,
+		"coverURL":    nfa.CoverURL,
+		"fileURL":     nfa.FileURL,
+		"fileSignURL": nfa.FileSignURL,
+		"fileCheckC":  nfa.FileCheckC,
+		"fileCheckS":  nfa.FileCheckS,
+	}
+	for name, value := range headers {
+		// everything else is escaped, but there's no escaping broken text
+		if !utf8.ValidString(value) {
+			return fmt.Errorf("%w: %s is not valid UTF-8", ErrInvalidContract, name)
+		}
+	}
+	if _, err := rpc.NewAddress(strings.TrimSpace(nfa.Owner)); err != nil {
+		return fmt.Errorf("%w: owner is not a DERO address", ErrInvalidContract)
+	}
+	if _, err := rpc.NewAddress(strings.TrimSpace(nfa.Creator)); err != nil {
+		return fmt.Errorf("%w: creator is not a DERO address", ErrInvalidContract)
+	}
+	return nil
+}
+
+// NFAContract returns the ART-NFA-MS1 contract for the headers. Strings are
+// quoted as DVM-BASIC literals, so no header can change the code around it.
+func NFAContract(nfa NFA) (string, error) {
+	if err := nfa.Validate(); err != nil {
+		return "", err
+	}
+	nfa.Owner = strings.TrimSpace(nfa.Owner)
+	nfa.Creator = strings.TrimSpace(nfa.Creator)
+
+	var contract strings.Builder
+	if err := nfaTemplate.Execute(&contract, nfa); err != nil {
+		return "", err
+	}
+	if err := CheckContract(contract.String()); err != nil {
+		return "", err
+	}
+	return contract.String(), nil
+}
+
+// CheckContract parses the source the way the DVM will, so a broken contract
+// is caught here rather than paid for on chain
+func CheckContract(contract string) error {
+	if _, pos, err := dvm.ParseSmartContract(contract); err != nil {
+		return fmt.Errorf("%w: %s at %s", ErrInvalidContract, err, pos)
+	}
+	return nil
+}
+
+// IsNFAContract tells whether the code is an ART-NFA-MS1 contract, whatever
+// headers it was minted with
+func IsNFAContract(code string) bool {
+	return codeSignature(code) == nfaSignature
+}
+
+// private functions
+
+// artificerAddr is where the contract sends the Artificer fee
+const artificerAddr = "dero1qy0khp9s9yw2h0eu20xmy9lth3zp5cacmx3rwt6k45l568d2mmcf6qgcsevzx"
+
+// nfaSignature is the signature of every contract nfaTemplate renders
+var nfaSignature = func() string {
+	contract, err := NFAContract(NFA{Owner: artificerAddr, Creator: artificerAddr})
+	if err != nil {
+		panic(err)
+	}
+	return codeSignature(contract)
+}()
+
+// mintedKeys are the variables whose values minting fills in
+var mintedKeys = map[string]bool{
+	`"royalty"`:     true,
+	`"nameHdr"`:     true,
+	`"descrHdr"`:    true,
+	`"typeHdr"`:     true,
+	`"iconURLHdr"`:  true,
+	`"tagsHdr"`:     true,
+	`"fileCheckC"`:  true,
+	`"fileCheckS"`:  true,
+	`"fileURL"`:     true,
+	`"fileSignURL"`: true,
+	`"coverURL"`:    true,
+	`"collection"`:  true,
+	`"owner"`:       true,
+	`"creatorAddr"`: true,
+}
+
+// codeSignature hashes the contract's tokens with the values minting fills in
+// left out, so that whitespace, comments and headers don't count. A value is
+// the literal stored under one of mintedKeys, ADDRESS_RAW() or not; SIGNER()
+// counts as one too, as the standard stores the creator that way.
+func codeSignature(code string) string {
+	var s scanner.Scanner
+	s.Init(strings.NewReader(code))
+	s.Mode = scanner.ScanIdents | scanner.ScanInts | scanner.ScanStrings | scanner.ScanComments | scanner.SkipComments
+	s.Error = func(*scanner.Scanner, string) {} // a broken contract just won't match
+
+	var tokens strings.Builder
+	var previous [3]string // the last tokens, latest first
+	value := false         // a minted value is next
+	for tok := s.Scan(); tok != scanner.EOF; tok = s.Scan() {
+		text := s.TokenText()
+		switch {
+		case value && (tok == scanner.String || tok == scanner.Int):
+			text, value = "?", false
+		case value && text == "SIGNER":
+			text = "ADDRESS_RAW"
+		case value && text == ")":
+			text, value = "? )", false
+		case value && (text == "ADDRESS_RAW" || text == "("):
+		default:
+			value = text == "," && mintedKeys[previous[0]] &&
+				previous[1] == "(" && previous[2] == "STORE"
+		}
+		previous = [3]string{text, previous[0], previous[1]}
+		tokens.WriteString(text)
+		tokens.WriteByte(' ')
+	}
+
+	sum := sha256.Sum256([]byte(tokens.String()))
+	return hex.EncodeToString(sum[:])
+}
+
+// nfaTemplate renders nfaSource; quote makes a DVM-BASIC string literal,
+// which the DVM reads back with strconv.Unquote
+var nfaTemplate = template.Must(
+	template.New("nfa").
+		Funcs(template.FuncMap{"quote": strconv.Quote}).
+		Parse(nfaSource),
+)
+
+const nfaSource = `
 //    Copyright 2022. Civilware. All rights reserved.
 //    Artificer NFA Market Standard (ART-NFA-MS1)
 
 Function InitializePrivate() Uint64
 10  IF EXISTS("owner") == 0 THEN GOTO 300 ELSE GOTO 999
 300 STORE("artificerFee", 1)
-310 STORE("royalty", ` + royalty + `)
+310 STORE("royalty", {{.Royalty}})
 320 STORE("ownerCanUpdate", 1)
-330 STORE("nameHdr", "` + nameHdr + `")
-340 STORE("descrHdr", "` + descHdr + `")
-350 STORE("typeHdr", "` + typeHdr + `")
-360 STORE("iconURLHdr", "<iconURLHdr>")
-370 STORE("tagsHdr", "<tagsHdr>")
-400 STORE("fileCheckC", "<fileCheckC>")
-410 STORE("fileCheckS", "<fileCheckS>")
-420 STORE("fileURL", "<fileURL>")
-430 STORE("fileSignURL", "<fileSignURL>")
-440 STORE("coverURL", "<coverURL>")
-450 STORE("collection", "` + collection + `")
+330 STORE("nameHdr", {{quote .Name}})
+340 STORE("descrHdr", {{quote .Description}})
+350 STORE("typeHdr", {{quote .Type}})
+360 STORE("iconURLHdr", {{quote .IconURL}})
+370 STORE("tagsHdr", {{quote .Tags}})
+400 STORE("fileCheckC", {{quote .FileCheckC}})
+410 STORE("fileCheckS", {{quote .FileCheckS}})
+420 STORE("fileURL", {{quote .FileURL}})
+430 STORE("fileSignURL", {{quote .FileSignURL}})
+440 STORE("coverURL", {{quote .CoverURL}})
+450 STORE("collection", {{quote .Collection}})
 500 IF init() == 0 THEN GOTO 600 ELSE GOTO 999
 600 RETURN 0
 999 RETURN 1
@@ -38,8 +213,8 @@ End Function
 
 Function init() Uint64
 10  IF EXISTS("owner") == 0 THEN GOTO 20 ELSE GOTO 999
-20  STORE("owner", ADDRESS_RAW("` + addr + `"))
-30  STORE("creatorAddr", SIGNER())
+20  STORE("owner", ADDRESS_RAW({{quote .Owner}}))
+30  STORE("creatorAddr", ADDRESS_RAW({{quote .Creator}}))
 40  STORE("artificerAddr", ADDRESS_RAW("dero1qy0khp9s9yw2h0eu20xmy9lth3zp5cacmx3rwt6k45l568d2mmcf6qgcsevzx"))
 50  IF IS_ADDRESS_VALID(LOAD("artificerAddr")) == 1 THEN GOTO 60 ELSE GOTO 999
 60  STORE("active", 0)
@@ -56,7 +231,7 @@ Function init() Uint64
 170 STORE("currBidPrice", 0)
 180 STORE("version", "1.1.1")
 500 IF LOAD("charityDonatePerc") + LOAD("artificerFee") + LOAD("royalty") > 100 THEN GOTO 999
-600 SEND_ASSET_TO_ADDRESS(ADDRESS_RAW("` + addr + `"), 1, SCID())
+600 SEND_ASSET_TO_ADDRESS(ADDRESS_RAW({{quote .Owner}}), 1, SCID())
 610 RETURN 0
 999 RETURN 1
 End Function
@@ -325,6 +500,4 @@ Function findLesserIncrease(bidAmt Uint64) Uint64
 	100 RETURN percentCalc
 	200 RETURN staticCalc
 End Function
-			 `
-	return contract
-}
+`
@@ -0,0 +1,172 @@
+package dero_test
+
+import (
+	"errors"
+	"flag"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/deroproject/derohe/dvm"
+	"github.com/secretnamebasis/secret-site/app/integrations/dero"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+const owner = "dero1qy0khp9s9yw2h0eu20xmy9lth3zp5cacmx3rwt6k45l568d2mmcf6qgcsevzx"
+
+const creator = "dero1qyvqpdftj8r6005xs20rnflakmwa5pdxg9vcjzdcuywq2t8skqhvwqglt6x0g"
+
+// goldenNFA fills every header the contract takes
+func goldenNFA() dero.NFA {
+	return dero.NFA{
+		Royalty:     5,
+		Name:        "sunset",
+		Description: "a sunset over the sea",
+		Type:        "image",
+		Collection:  "seascapes",
+		Tags:        "sea,sunset",
+		IconURL:     "https://example.com/images/7",
+		CoverURL:    "https://example.com/images/7",
+		FileURL:     "https://example.com/files/7",
+		FileSignURL: "https://example.com/files/7/checksum",
+		FileCheckC:  strings.Repeat("a", 64),
+		FileCheckS:  strings.Repeat("b", 64),
+		Owner:       owner,
+		Creator:     creator,
+	}
+}
+
+func TestNFAContractGolden(t *testing.T) {
+	contract, err := dero.NFAContract(goldenNFA())
+	if err != nil {
+		t.Fatalf("Failed to render contract: %v", err)
+	}
+
+	golden := filepath.Join("testdata", "nfa.golden")
+	if *update {
+		if err := os.WriteFile(golden, []byte(contract), 0644); err != nil {
+			t.Fatalf("Failed to update %s: %v", golden, err)
+		}
+	}
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatalf("Failed to read %s: %v", golden, err)
+	}
+	if contract != string(want) {
+		t.Errorf("Contract differs from %s; run go test -update if the change is intended", golden)
+	}
+}
+
+func TestNFAContractEscapesHeaders(t *testing.T) {
+	baseline, err := dero.NFAContract(goldenNFA())
+	if err != nil {
+		t.Fatalf("Failed to render contract: %v", err)
+	}
+	sc, _, err := dvm.ParseSmartContract(baseline)
+	if err != nil {
+		t.Fatalf("Failed to parse contract: %v", err)
+	}
+
+	for _, header := range []string{
+		`"), 1) STORE("owner", "me`,
+		"line\n999 RETURN 0",
+		`back\slash`,
+		"// not a comment",
+		"tab\tand `raw`",
+	} {
+		nfa := goldenNFA()
+		nfa.Name = header
+		nfa.Description = header
+		contract, err := dero.NFAContract(nfa)
+		if err != nil {
+			t.Errorf("Failed to render contract for %q: %v", header, err)
+			continue
+		}
+		if !strings.Contains(contract, `STORE("nameHdr", `+strconv.Quote(header)+`)`) {
+			t.Errorf("Expected %q as a single string literal", header)
+		}
+
+		// the header can't add lines or functions to the contract
+		parsed, _, err := dvm.ParseSmartContract(contract)
+		if err != nil {
+			t.Errorf("Failed to parse contract for %q: %v", header, err)
+			continue
+		}
+		want := sc.Functions["InitializePrivate"].Lines
+		got := parsed.Functions["InitializePrivate"].Lines
+		if len(parsed.Functions) != len(sc.Functions) || len(got) != len(want) {
+			t.Errorf("Expected %q to leave the contract's shape alone", header)
+		}
+	}
+}
+
+func TestNFAContractRejects(t *testing.T) {
+	for name, change := range map[string]func(*dero.NFA){
+		"royalty over the limit": func(n *dero.NFA) { n.Royalty = dero.MaxRoyalty + 1 },
+		"empty owner":            func(n *dero.NFA) { n.Owner = "" },
+		"bad owner":              func(n *dero.NFA) { n.Owner = `dero1"), 1) RETURN 0` },
+		"empty creator":          func(n *dero.NFA) { n.Creator = "" },
+		"bad creator":            func(n *dero.NFA) { n.Creator = `dero1"), 1) RETURN 0` },
+		"invalid UTF-8":          func(n *dero.NFA) { n.Tags = "\xff" },
+	} {
+		nfa := goldenNFA()
+		change(&nfa)
+		if _, err := dero.NFAContract(nfa); !errors.Is(err, dero.ErrInvalidContract) {
+			t.Errorf("%s: expected ErrInvalidContract, got %v", name, err)
+		}
+	}
+
+	nfa := goldenNFA()
+	nfa.Royalty = dero.MaxRoyalty
+	if _, err := dero.NFAContract(nfa); err != nil {
+		t.Errorf("Expected the highest royalty to render, got %v", err)
+	}
+}
+
+func TestMintContractChecksSource(t *testing.T) {
+	wallet := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("Expected a broken contract to never reach the wallet")
+	}))
+	defer wallet.Close()
+
+	_, err := dero.MintContract(wallet.URL, "Function Broken() Uint64\n10 RETURN 0\n", owner)
+	if !errors.Is(err, dero.ErrInvalidContract) {
+		t.Errorf("Expected ErrInvalidContract, got %v", err)
+	}
+}
+
+func TestIsNFAContract(t *testing.T) {
+	nfa := goldenNFA()
+	nfa.Name, nfa.Royalty = "sunrise", 12
+	contract, err := dero.NFAContract(nfa)
+	if err != nil {
+		t.Fatalf("Failed to render contract: %v", err)
+	}
+	if !dero.IsNFAContract(contract) {
+		t.Error("Expected a token minted with other headers to match")
+	}
+	// the standard makes whoever installs it the creator
+	installed := strings.Replace(contract, `"creatorAddr", ADDRESS_RAW("`+creator+`")`, `"creatorAddr", SIGNER()`, 1)
+	if installed == contract || !dero.IsNFAContract(installed) {
+		t.Error("Expected a token its creator installed to match")
+	}
+
+	// a contract that pays out differently is something else
+	altered := strings.Replace(contract, "RETURN 0", "RETURN 1", 1)
+	if dero.IsNFAContract(altered) {
+		t.Error("Expected an altered contract not to match")
+	}
+	// and so is one that pays the fee to someone else
+	redirected := strings.Replace(contract, `"artificerAddr", ADDRESS_RAW("`+owner, `"artificerAddr", ADDRESS_RAW("dero1qyvqpdftj8r6005xs20rnflakmwa5pdxg9vcjzdcuywq2t8skqhvwqglt6x0g`, 1)
+	if redirected == contract || dero.IsNFAContract(redirected) {
+		t.Error("Expected a contract with another artificer not to match")
+	}
+	if dero.IsNFAContract("Function Initialize() Uint64\n10 RETURN 0\nEnd Function\n") {
+		t.Error("Expected another contract not to match")
+	}
+}
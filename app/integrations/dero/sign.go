@@ -0,0 +1,73 @@
+package dero
+
+import (
+	"encoding/pem"
+	"errors"
+)
+
+// signedMessage is the PEM type of the DERO signed messages wallets write
+const signedMessage = "DERO SIGNED MESSAGE"
+
+// SignData has the wallet sign data, and returns the DERO signed message
+// it makes of it, the same PEM block its sign_file writes. Only wallets
+// that answer SignData can.
+func SignData(endpoint string, data []byte) ([]byte, error) {
+	var signed []byte
+	if err := CallRPC(
+		endpoint,
+		&signed,
+		"SignData",
+		data,
+	); err != nil {
+		return nil, err
+	}
+	return signed, nil
+}
+
+// SignFile has the wallet sign a file, and returns who signed it and the C
+// and S of the signature, which NFAs hold as fileCheckC and fileCheckS
+func SignFile(endpoint string, file []byte) (signer, c, s string, err error) {
+	signed, err := SignData(endpoint, file)
+	if err != nil {
+		return "", "", "", err
+	}
+	block, err := checkSignedMessage(signed)
+	if err != nil {
+		return "", "", "", err
+	}
+	return block.Headers["Address"], block.Headers["C"], block.Headers["S"], nil
+}
+
+// SignedMessage puts a signature and the data it signs back together as a
+// DERO signed message, the way the wallet's sign_file writes it
+func SignedMessage(signer, c, s string, data []byte) []byte {
+	return pem.EncodeToMemory(&pem.Block{
+		Type:    signedMessage,
+		Headers: map[string]string{"Address": signer, "C": c, "S": s},
+		Bytes:   data,
+	})
+}
+
+// CheckSignedMessage verifies a DERO signed message, and returns who signed
+// it and what they signed
+func CheckSignedMessage(signed []byte) (signer string, message []byte, err error) {
+	block, err := checkSignedMessage(signed)
+	if err != nil {
+		return "", nil, err
+	}
+	return block.Headers["Address"], block.Bytes, nil
+}
+
+// private functions
+
+// checkSignedMessage decodes a DERO signed message and verifies it
+func checkSignedMessage(signed []byte) (*pem.Block, error) {
+	block, _ := pem.Decode(signed)
+	if block == nil || block.Type != signedMessage {
+		return nil, errors.New("not a DERO signed message")
+	}
+	if err := VerifyFileSignature(block.Headers["Address"], block.Headers["C"], block.Headers["S"], block.Bytes); err != nil {
+		return nil, err
+	}
+	return block, nil
+}
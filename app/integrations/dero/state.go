@@ -0,0 +1,311 @@
+package dero
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/deroproject/derohe/rpc"
+)
+
+// ErrNotNFA is returned for contracts that don't hold ART-NFA-MS1 variables
+var ErrNotNFA = errors.New("contract is not an ART-NFA-MS1 token")
+
+// NFAState is an ART-NFA-MS1 contract's variables, decoded
+type NFAState struct {
+	SCID        string `json:"scid"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Type        string `json:"type"`
+	Collection  string `json:"collection"`
+	Tags        string `json:"tags"`
+	IconURL     string `json:"icon_url"`
+	CoverURL    string `json:"cover_url"`
+	FileURL     string `json:"file_url"`
+	FileSignURL string `json:"file_sign_url"`
+	FileCheckC  string `json:"file_check_c"`
+	FileCheckS  string `json:"file_check_s"`
+	Version     string `json:"version"`
+
+	Owner         string `json:"owner"`
+	Creator       string `json:"creator"`
+	PreviousOwner string `json:"previous_owner,omitempty"`
+
+	Royalty      uint64 `json:"royalty"`       // percent paid to the creator
+	ArtificerFee uint64 `json:"artificer_fee"` // percent paid to Artificer
+	CharityAddr  string `json:"charity_addr,omitempty"`
+	CharityPerc  uint64 `json:"charity_perc"`
+
+	PreviousSalePrice    uint64 `json:"previous_sale_price"`    // what it last sold for, 0 if it never has
+	PreviousAuctionPrice uint64 `json:"previous_auction_price"` // what its last auction closed at
+
+	ListType       string    `json:"list_type"` // sale, auction or empty
+	Active         bool      `json:"active"`    // as of the contract's last call
+	Held           bool      `json:"held"`      // the contract holds the token
+	StartPrice     uint64    `json:"start_price"`
+	CurrBidPrice   uint64    `json:"curr_bid_price"` // the least the next bid may be
+	CurrBidAmt     uint64    `json:"curr_bid_amt"`
+	CurrBidAddr    string    `json:"curr_bid_addr,omitempty"`
+	BidCount       uint64    `json:"bid_count"`
+	StaticBidIncr  uint64    `json:"static_bid_incr"`
+	PercentBidIncr uint64    `json:"percent_bid_incr"` // in hundredths of a percent
+	CancelBuffer   uint64    `json:"cancel_buffer"`    // seconds after the start a listing may be cancelled
+	StartTime      time.Time `json:"start_time"`
+	EndTime        time.Time `json:"end_time"`
+}
+
+// NFAListing is the state as it stands at a given time
+type NFAListing struct {
+	NFAState
+	Listed        bool   `json:"listed"`         // buyers and bidders are taken
+	Ended         bool   `json:"ended"`          // waiting on the owner to close it
+	TimeRemaining int64  `json:"time_remaining"` // seconds
+	MinimumBid    uint64 `json:"minimum_bid"`
+}
+
+// NFASale is a token changing hands on the market, and how the contract's
+// processDEROFinalPayment split the price
+type NFASale struct {
+	SCID         string `json:"scid"`
+	Name         string `json:"name"`
+	Creator      string `json:"creator"`
+	Seller       string `json:"seller"`
+	Buyer        string `json:"buyer"`
+	ListType     string `json:"list_type"`
+	Price        uint64 `json:"price"`
+	Royalty      uint64 `json:"royalty"`       // to the creator
+	ArtificerFee uint64 `json:"artificer_fee"` // to Artificer
+	Charity      uint64 `json:"charity"`       // to CharityAddr
+	CharityAddr  string `json:"charity_addr,omitempty"`
+	Payout       uint64 `json:"payout"` // to the seller, what's left
+}
+
+// ParseNFAState decodes the variables of an ART-NFA-MS1 contract. Strings
+// come hex encoded, and addresses as raw keys.
+func ParseNFAState(scid string, sc *rpc.GetSC_Result) (NFAState, error) {
+	vars := sc.VariableStringKeys
+	if _, ok := vars["owner"]; !ok {
+		return NFAState{}, ErrNotNFA
+	}
+	if _, ok := vars["artificerFee"]; !ok {
+		return NFAState{}, ErrNotNFA
+	}
+
+	state := NFAState{SCID: scid}
+	var err error
+	text := func(key string) string {
+		if err != nil {
+			return ""
+		}
+		var s string
+		s, err = stringVar(vars, key)
+		return s
+	}
+	number := func(key string) uint64 {
+		if err != nil {
+			return 0
+		}
+		var n uint64
+		n, err = uint64Var(vars, key)
+		return n
+	}
+	address := func(key string) string {
+		if err != nil {
+			return ""
+		}
+		var s string
+		s, err = addressVar(vars, key)
+		return s
+	}
+
+	state.Name = text("nameHdr")
+	state.Description = text("descrHdr")
+	state.Type = text("typeHdr")
+	state.Collection = text("collection")
+	state.Tags = text("tagsHdr")
+	state.IconURL = text("iconURLHdr")
+	state.CoverURL = text("coverURL")
+	state.FileURL = text("fileURL")
+	state.FileSignURL = text("fileSignURL")
+	state.FileCheckC = text("fileCheckC")
+	state.FileCheckS = text("fileCheckS")
+	state.Version = text("version")
+
+	state.Owner = address("owner")
+	state.Creator = address("creatorAddr")
+	state.PreviousOwner = address("previousOwner")
+
+	state.Royalty = number("royalty")
+	state.ArtificerFee = number("artificerFee")
+	state.CharityAddr = address("charityDonateAddr")
+	state.CharityPerc = number("charityDonatePerc")
+	state.PreviousSalePrice = number("previousSalePrice")
+	state.PreviousAuctionPrice = number("previousAuctionPrice")
+
+	state.ListType = text("listType")
+	state.Active = number("active") == 1
+	state.Held = number("scBalance") == 1
+	state.StartPrice = number("startPrice")
+	state.CurrBidPrice = number("currBidPrice")
+	state.CurrBidAmt = number("currBidAmt")
+	state.CurrBidAddr = address("currBidAddr")
+	state.BidCount = number("bidCount")
+	state.StaticBidIncr = number("staticBidIncr")
+	state.PercentBidIncr = number("percentBidIncr")
+	state.CancelBuffer = number("cancelBuffer")
+	state.StartTime = blockTime(number("startBlockTime"))
+	state.EndTime = blockTime(number("endBlockTime"))
+
+	if err != nil {
+		return NFAState{}, err
+	}
+	return state, nil
+}
+
+// Listed tells whether the listing takes buyers and bidders at now, the way
+// the contract's checkActive does
+func (s NFAState) Listed(now time.Time) bool {
+	return s.Held && !s.StartTime.After(now) && s.EndTime.After(now)
+}
+
+// Ended tells whether the listing has run out and is waiting on CloseListing
+func (s NFAState) Ended(now time.Time) bool {
+	return s.Held && !s.EndTime.IsZero() && !s.EndTime.After(now)
+}
+
+// TimeRemaining is how long the listing has left at now
+func (s NFAState) TimeRemaining(now time.Time) time.Duration {
+	if !s.Listed(now) {
+		return 0
+	}
+	return s.EndTime.Sub(now)
+}
+
+// MinimumBid is the least a bid has to be to be taken: the start price, and
+// after the first bid whatever findLesserIncrease made of the last one
+func (s NFAState) MinimumBid() uint64 {
+	if s.CurrBidPrice > s.StartPrice {
+		return s.CurrBidPrice
+	}
+	return s.StartPrice
+}
+
+// NextBidPrice mirrors the contract's findLesserIncrease: the least the bid
+// after bid may be, which is the smaller of the percent and static increases
+func (s NFAState) NextBidPrice(bid uint64) uint64 {
+	percent := bid + bid*s.PercentBidIncr/10000
+	static := bid + s.StaticBidIncr
+	if percent < static {
+		return percent
+	}
+	return static
+}
+
+// SaleTo tells whether after follows a sale out of s: the token was listed,
+// and the market handed it to someone else. The price is what the contract
+// kept of the sale or the auction; the rates are the listing's, as the
+// contract resets the charity once it has paid out.
+func (s NFAState) SaleTo(after NFAState) (NFASale, bool) {
+	if !s.Held || s.ListType == "" || after.Owner == s.Owner || after.Held {
+		return NFASale{}, false
+	}
+
+	price := after.PreviousSalePrice
+	if s.ListType == ListAuction {
+		price = after.PreviousAuctionPrice
+	}
+	if price == 0 {
+		return NFASale{}, false
+	}
+
+	sale := NFASale{
+		SCID:         s.SCID,
+		Name:         s.Name,
+		Creator:      s.Creator,
+		Seller:       s.Owner,
+		Buyer:        after.Owner,
+		ListType:     s.ListType,
+		Price:        price,
+		Royalty:      s.Royalty * price / 100,
+		ArtificerFee: s.ArtificerFee * price / 100,
+		Charity:      s.CharityPerc * price / 100,
+		CharityAddr:  s.CharityAddr,
+	}
+	if cut := sale.Royalty + sale.ArtificerFee + sale.Charity; cut < price {
+		sale.Payout = price - cut
+	}
+	return sale, true
+}
+
+// At returns the listing as it stands at now
+func (s NFAState) At(now time.Time) NFAListing {
+	listing := NFAListing{
+		NFAState:      s,
+		Listed:        s.Listed(now),
+		Ended:         s.Ended(now),
+		TimeRemaining: int64(s.TimeRemaining(now) / time.Second),
+	}
+	if s.ListType == ListAuction {
+		listing.MinimumBid = s.MinimumBid()
+	}
+	return listing
+}
+
+// private functions
+
+// stringVar decodes the hex encoded string stored under key, or nothing
+func stringVar(vars map[string]interface{}, key string) (string, error) {
+	value, ok := vars[key]
+	if !ok {
+		return "", nil
+	}
+	encoded, ok := value.(string)
+	if !ok {
+		return "", fmt.Errorf("%s is not a string", key)
+	}
+	decoded, err := hex.DecodeString(encoded)
+	if err != nil {
+		return "", fmt.Errorf("%s is not hex encoded: %w", key, err)
+	}
+	return string(decoded), nil
+}
+
+// uint64Var reads the number stored under key, or zero
+func uint64Var(vars map[string]interface{}, key string) (uint64, error) {
+	switch value := vars[key].(type) {
+	case nil:
+		return 0, nil
+	case float64:
+		return uint64(value), nil
+	case uint64:
+		return value, nil
+	case json.Number:
+		return strconv.ParseUint(value.String(), 10, 64)
+	default:
+		return 0, fmt.Errorf("%s is not a number", key)
+	}
+}
+
+// addressVar decodes the raw address stored under key, or nothing
+func addressVar(vars map[string]interface{}, key string) (string, error) {
+	raw, err := stringVar(vars, key)
+	if err != nil || raw == "" {
+		return "", err
+	}
+	address, err := rpc.NewAddressFromCompressedKeys([]byte(raw))
+	if err != nil {
+		return "", fmt.Errorf("%s is not an address: %w", key, err)
+	}
+	return address.String(), nil
+}
+
+// blockTime turns a BLOCK_TIMESTAMP() into a time, zero staying zero
+func blockTime(seconds uint64) time.Time {
+	if seconds == 0 {
+		return time.Time{}
+	}
+	return time.Unix(int64(seconds), 0).UTC()
+}
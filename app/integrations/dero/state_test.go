@@ -0,0 +1,151 @@
+package dero_test
+
+import (
+	"encoding/hex"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/deroproject/derohe/rpc"
+	"github.com/secretnamebasis/secret-site/app/integrations/dero"
+)
+
+// listedSC is an auction with one bid in, as the node returns it
+func listedSC(t *testing.T, start, end time.Time) *rpc.GetSC_Result {
+	address, err := rpc.NewAddress(owner)
+	if err != nil {
+		t.Fatalf("Failed to parse address: %v", err)
+	}
+	raw := hex.EncodeToString(address.Compressed())
+	text := func(s string) string { return hex.EncodeToString([]byte(s)) }
+
+	return &rpc.GetSC_Result{
+		VariableStringKeys: map[string]interface{}{
+			"nameHdr":           text("sunset"),
+			"collection":        text("seascapes"),
+			"fileURL":           text("https://example.com/files/7"),
+			"owner":             raw,
+			"creatorAddr":       raw,
+			"currBidAddr":       raw,
+			"artificerFee":      float64(1),
+			"royalty":           float64(5),
+			"listType":          text("auction"),
+			"active":            float64(1),
+			"scBalance":         float64(1),
+			"startPrice":        float64(100000),
+			"currBidAmt":        float64(200000),
+			"currBidPrice":      float64(210000),
+			"bidCount":          float64(1),
+			"staticBidIncr":     float64(10000),
+			"percentBidIncr":    float64(1000),
+			"startBlockTime":    float64(start.Unix()),
+			"endBlockTime":      float64(end.Unix()),
+			"charityDonateAddr": text(""),
+		},
+	}
+}
+
+func TestParseNFAState(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	state, err := dero.ParseNFAState("scid", listedSC(t, now.Add(-time.Hour), now.Add(2*time.Hour)))
+	if err != nil {
+		t.Fatalf("Failed to parse state: %v", err)
+	}
+
+	if state.Name != "sunset" || state.Collection != "seascapes" || state.FileURL != "https://example.com/files/7" {
+		t.Errorf("Expected the headers decoded, but got: %+v", state)
+	}
+	if state.Owner != owner || state.Creator != owner || state.CurrBidAddr != owner {
+		t.Errorf("Expected addresses decoded to %s, but got: %+v", owner, state)
+	}
+	if state.CharityAddr != "" {
+		t.Errorf("Expected no charity, but got %q", state.CharityAddr)
+	}
+	if state.Royalty != 5 || state.ListType != dero.ListAuction || !state.Active || state.BidCount != 1 {
+		t.Errorf("Expected a live auction paying 5%% royalty, but got: %+v", state)
+	}
+
+	listing := state.At(now)
+	if !listing.Listed || listing.Ended {
+		t.Errorf("Expected the auction listed, but got: %+v", listing)
+	}
+	if listing.TimeRemaining != 7200 {
+		t.Errorf("Expected 7200 seconds left, but got %d", listing.TimeRemaining)
+	}
+	if listing.MinimumBid != 210000 {
+		t.Errorf("Expected a minimum bid of 210000, but got %d", listing.MinimumBid)
+	}
+
+	// after the end the contract turns bidders away until the owner closes it
+	ended := state.At(now.Add(3 * time.Hour))
+	if ended.Listed || !ended.Ended || ended.TimeRemaining != 0 {
+		t.Errorf("Expected the auction ended, but got: %+v", ended)
+	}
+}
+
+func TestNFAStateNextBidPrice(t *testing.T) {
+	state := dero.NFAState{StaticBidIncr: 10000, PercentBidIncr: 1000}
+
+	// 10% of a small bid is less than the static increase
+	if next := state.NextBidPrice(50000); next != 55000 {
+		t.Errorf("Expected 55000, but got %d", next)
+	}
+	// and the static increase is less than 10% of a big one
+	if next := state.NextBidPrice(500000); next != 510000 {
+		t.Errorf("Expected 510000, but got %d", next)
+	}
+
+	// before any bid, the start price is the least taken
+	state.StartPrice = 70000
+	if minimum := state.MinimumBid(); minimum != 70000 {
+		t.Errorf("Expected 70000, but got %d", minimum)
+	}
+}
+
+func TestParseNFAStateRejectsOtherContracts(t *testing.T) {
+	sc := &rpc.GetSC_Result{VariableStringKeys: map[string]interface{}{"C": "abc"}}
+	if _, err := dero.ParseNFAState("scid", sc); !errors.Is(err, dero.ErrNotNFA) {
+		t.Errorf("Expected ErrNotNFA, but got %v", err)
+	}
+}
+
+func TestNFAStateSaleTo(t *testing.T) {
+	listed := dero.NFAState{
+		SCID:         "scid",
+		Owner:        owner,
+		Creator:      owner,
+		Held:         true,
+		ListType:     dero.ListSale,
+		Royalty:      10,
+		ArtificerFee: 1,
+		CharityPerc:  4,
+	}
+	sold := dero.NFAState{SCID: "scid", Owner: "buyer", PreviousSalePrice: 1000}
+
+	sale, ok := listed.SaleTo(sold)
+	if !ok {
+		t.Fatal("Expected a sale")
+	}
+	if sale.Seller != owner || sale.Buyer != "buyer" || sale.Price != 1000 {
+		t.Errorf("Expected %s to sell to buyer for 1000, but got: %+v", owner, sale)
+	}
+	if sale.Royalty != 100 || sale.ArtificerFee != 10 || sale.Charity != 40 || sale.Payout != 850 {
+		t.Errorf("Expected the price split 100/10/40/850, but got: %+v", sale)
+	}
+
+	// auctions keep their price apart
+	listed.ListType = dero.ListAuction
+	if _, ok := listed.SaleTo(sold); ok {
+		t.Error("Expected no auction sale without an auction price")
+	}
+	sold.PreviousAuctionPrice = 2000
+	if sale, ok := listed.SaleTo(sold); !ok || sale.Price != 2000 || sale.Royalty != 200 {
+		t.Errorf("Expected the auction sold for 2000, but got: %+v", sale)
+	}
+
+	// withdrawing a listing gives the token back to the same owner
+	sold.Owner = owner
+	if _, ok := listed.SaleTo(sold); ok {
+		t.Error("Expected no sale when the owner takes the token back")
+	}
+}
@@ -0,0 +1,155 @@
+package dero
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/deroproject/derohe/rpc"
+	c "github.com/secretnamebasis/secret-site/app/config"
+	"github.com/ybbus/jsonrpc"
+)
+
+// ErrUnavailable is returned when the DERO wallet or node can't be reached
+var ErrUnavailable = errors.New("DERO wallet or node unavailable")
+
+// connection keeps track of whether the wallet, or the node, answers
+type connection struct {
+	mu      sync.RWMutex
+	offline bool
+}
+
+var (
+	node   connection
+	wallet connection
+
+	// the server wallet's address doesn't change, so we hold on to it
+	addressMu     sync.RWMutex
+	walletAddress *rpc.Address
+
+	// wakes up KeepConnected when something goes offline
+	wentOffline = make(chan struct{}, 1)
+)
+
+// Online tells whether both the wallet and the node answer
+func Online() bool {
+	return WalletOnline() && NodeOnline()
+}
+
+// WalletOnline tells whether the wallet answers
+func WalletOnline() bool {
+	return wallet.online()
+}
+
+// NodeOnline tells whether the node answers
+func NodeOnline() bool {
+	return node.online()
+}
+
+// WalletAddress returns the server wallet's address, asking the wallet
+// only until it has answered once
+func WalletAddress(endpoint string) (*rpc.Address, error) {
+	addressMu.RLock()
+	addr := walletAddress
+	addressMu.RUnlock()
+	if addr != nil {
+		return addr, nil
+	}
+
+	addr, err := GetWalletAddress(endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	addressMu.Lock()
+	defer addressMu.Unlock()
+	walletAddress = addr
+	// the wallet should answer with this address from now on
+	c.DeroAddress = addr
+	return addr, nil
+}
+
+// KeepConnected probes whatever has gone offline, backing off up to
+// maxBackoff between tries, until it answers again; run it in a goroutine of its own
+func KeepConnected(maxBackoff time.Duration) {
+	backoff := time.Second
+	for {
+		if Online() {
+			backoff = time.Second
+			<-wentOffline
+			continue
+		}
+
+		time.Sleep(backoff)
+
+		if !NodeOnline() {
+			if _, err := GetInfo(c.NodeEndpoint); err == nil {
+				log.Println("DERO node is back online")
+			}
+		}
+		if !WalletOnline() {
+			// the cached address would answer without asking the wallet
+			if _, err := GetWalletAddress(c.WalletEndpoint); err == nil {
+				log.Println("DERO wallet is back online")
+			}
+		}
+
+		backoff *= 2
+		if backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
+// private functions
+
+// track marks the wallet, or the node, online or offline after a call;
+// an RPC error means it answered, anything else means it didn't
+func track(method string, err error) error {
+	conn := &wallet
+	if isNodeMethod(method) {
+		conn = &node
+	}
+
+	if err == nil {
+		conn.up()
+		return nil
+	}
+
+	var rpcErr *jsonrpc.RPCError
+	if errors.As(err, &rpcErr) {
+		conn.up()
+		return err
+	}
+
+	conn.down()
+	return fmt.Errorf("%w: %v", ErrUnavailable, err)
+}
+
+func (conn *connection) online() bool {
+	conn.mu.RLock()
+	defer conn.mu.RUnlock()
+	return !conn.offline
+}
+
+func (conn *connection) up() {
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+	conn.offline = false
+}
+
+func (conn *connection) down() {
+	conn.mu.Lock()
+	defer conn.mu.Unlock()
+	if conn.offline {
+		return
+	}
+	conn.offline = true
+
+	select {
+	case wentOffline <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,57 @@
+package dero_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/deroproject/derohe/rpc"
+	"github.com/secretnamebasis/secret-site/app/config"
+	"github.com/secretnamebasis/secret-site/app/integrations/dero"
+)
+
+func TestKeepConnectedBringsTheWalletBack(t *testing.T) {
+	config.EnvPath = "../../../.env.test"
+	address := "dero1qy0khp9s9yw2h0eu20xmy9lth3zp5cacmx3rwt6k45l568d2mmcf6qgcsevzx"
+	wallet := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			ID int `json:"id"`
+		}
+		json.NewDecoder(r.Body).Decode(&request)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"jsonrpc": "2.0",
+			"id":      request.ID,
+			"result":  rpc.GetAddress_Result{Address: address},
+		})
+	}))
+	defer wallet.Close()
+
+	// the address is cached while the wallet answers
+	if _, err := dero.WalletAddress(wallet.URL); err != nil {
+		t.Fatalf("Failed to get the wallet address: %v", err)
+	}
+
+	// then the wallet goes away
+	gone := httptest.NewServer(http.NotFoundHandler())
+	gone.Close()
+	if _, err := dero.GetWalletAddress(gone.URL); err == nil {
+		t.Fatal("Expected no answer from a closed wallet")
+	}
+	if dero.WalletOnline() {
+		t.Fatal("Expected the wallet offline")
+	}
+
+	// and comes back; only asking it again can tell
+	config.WalletEndpoint = wallet.URL
+	go dero.KeepConnected(time.Second)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !dero.WalletOnline() {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the wallet back online")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
@@ -0,0 +1,106 @@
+package dero
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/deroproject/derohe/cryptography/crypto"
+	"github.com/deroproject/derohe/rpc"
+	"github.com/deroproject/derohe/transaction"
+)
+
+// SCTransaction is a smart-contract install or call found in a block
+type SCTransaction struct {
+	TXID    string
+	SCID    string
+	Install bool
+	Code    string    // installs only
+	Time    time.Time // of the block
+}
+
+// GetSCTransactions lists the smart-contract transactions of the block at
+// topoHeight. Transactions only count in the block they are valid in.
+func GetSCTransactions(endpoint string, topoHeight int64) ([]SCTransaction, error) {
+	var block rpc.GetBlock_Result
+	if err := CallRPC(
+		endpoint,
+		&block,
+		"DERO.GetBlock",
+		rpc.GetBlock_Params{Height: uint64(topoHeight)},
+	); err != nil {
+		return nil, err
+	}
+
+	var body struct {
+		TXHashes []string `json:"tx_hashes"`
+	}
+	if err := json.Unmarshal([]byte(block.Json), &body); err != nil {
+		return nil, fmt.Errorf("block %d: %w", topoHeight, err)
+	}
+	if len(body.TXHashes) == 0 {
+		return nil, nil
+	}
+
+	var txs rpc.GetTransaction_Result
+	if err := CallRPC(
+		endpoint,
+		&txs,
+		"DERO.GetTransaction",
+		rpc.GetTransaction_Params{Tx_Hashes: body.TXHashes},
+	); err != nil {
+		return nil, err
+	}
+
+	at := time.UnixMilli(int64(block.Block_Header.Timestamp)).UTC()
+	var found []SCTransaction
+	for i, related := range txs.Txs {
+		if i >= len(body.TXHashes) || related.ValidBlock != block.Block_Header.Hash {
+			continue
+		}
+		txid := body.TXHashes[i]
+
+		// the node hands over the code of what was installed
+		if related.Code != "" {
+			found = append(found, SCTransaction{TXID: txid, SCID: txid, Install: true, Code: related.Code, Time: at})
+			continue
+		}
+		if i >= len(txs.Txs_as_hex) {
+			continue
+		}
+		if scid, ok := calledSCID(txs.Txs_as_hex[i]); ok {
+			found = append(found, SCTransaction{TXID: txid, SCID: scid, Time: at})
+		}
+	}
+	return found, nil
+}
+
+// private functions
+
+// calledSCID returns the SCID a transaction calls, ok is false for anything
+// but a contract call
+func calledSCID(txHex string) (scid string, ok bool) {
+	raw, err := hex.DecodeString(txHex)
+	if err != nil || len(raw) == 0 {
+		return "", false
+	}
+
+	// the decoder panics on some malformed transactions
+	defer func() {
+		if recover() != nil {
+			scid, ok = "", false
+		}
+	}()
+
+	var tx transaction.Transaction
+	if err := tx.Deserialize(raw); err != nil || tx.TransactionType != transaction.SC_TX {
+		return "", false
+	}
+	if !tx.SCDATA.Has(rpc.SCACTION, rpc.DataUint64) ||
+		rpc.SC_ACTION(tx.SCDATA.Value(rpc.SCACTION, rpc.DataUint64).(uint64)) != rpc.SC_CALL ||
+		!tx.SCDATA.Has(rpc.SCID, rpc.DataHash) {
+		return "", false
+	}
+	return tx.SCDATA.Value(rpc.SCID, rpc.DataHash).(crypto.Hash).String(), true
+}
@@ -0,0 +1,130 @@
+package dero
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"time"
+
+	"github.com/secretnamebasis/secret-site/app/safehttp"
+
+	"github.com/deroproject/derohe/cryptography/bn256"
+	"github.com/deroproject/derohe/cryptography/crypto"
+	"github.com/deroproject/derohe/rpc"
+)
+
+// How a file was found to match its token
+const (
+	FileCheckSignature = "signature" // fileCheckC and fileCheckS sign the file
+	FileCheckChecksum  = "checksum"  // fileCheckC and fileCheckS hash the file and icon, as tokens minted here used to
+)
+
+// ErrFileMismatch is returned when a file doesn't match what its token holds
+var ErrFileMismatch = errors.New("file does not match the token")
+
+// maxCheckedFile caps how much of a file is downloaded to check it
+const maxCheckedFile = 64 << 20
+
+// fileClient fetches the files to check; servers that hang count as
+// unreachable, and so do the private addresses a token's URLs could point at
+var fileClient = safehttp.NewClient(30 * time.Second)
+
+// CheckFile fetches the token's file and checks it against fileCheckC and
+// fileCheckS. Tokens hold the C and S of a DERO signature of the file, as
+// the wallet's sign_file makes them: Artificer's by the creator, the ones
+// minted here by the server wallet, which is passed among the signers
+// trusted besides the creator. Tokens minted here before hold the SHA-256
+// of the file and of the icon instead. It returns which of the two matched,
+// ErrFileMismatch if neither did, or why the file couldn't be fetched.
+func CheckFile(state NFAState, signers ...string) (string, error) {
+	if state.FileURL == "" || state.FileCheckC == "" {
+		return "", fmt.Errorf("%w: no file or checksum", ErrFileMismatch)
+	}
+
+	file, err := fetchFile(state.FileURL)
+	if err != nil {
+		return "", err
+	}
+
+	for _, signer := range append([]string{state.Creator}, signers...) {
+		if VerifyFileSignature(signer, state.FileCheckC, state.FileCheckS, file) == nil {
+			return FileCheckSignature, nil
+		}
+	}
+
+	if FileChecksum(file) != state.FileCheckC {
+		return "", fmt.Errorf("%w: file checksum differs", ErrFileMismatch)
+	}
+	icon, err := fetchFile(state.IconURL)
+	if err != nil {
+		return "", err
+	}
+	if FileChecksum(icon) != state.FileCheckS {
+		return "", fmt.Errorf("%w: icon checksum differs", ErrFileMismatch)
+	}
+	return FileCheckChecksum, nil
+}
+
+// FileChecksum is the hex SHA-256 of the data
+func FileChecksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// VerifyFileSignature checks the hex C and S of a DERO signed message are
+// the signer's signature of the data, the way the wallet's CheckSignature does
+func VerifyFileSignature(signer, c, s string, data []byte) error {
+	address, err := rpc.NewAddress(signer)
+	if err != nil {
+		return err
+	}
+	cInt, ok := new(big.Int).SetString(c, 16)
+	if !ok {
+		return errors.New("invalid C")
+	}
+	sInt, ok := new(big.Int).SetString(s, 16)
+	if !ok {
+		return errors.New("invalid S")
+	}
+
+	public := address.PublicKey.G1()
+	point := new(bn256.G1).Add(
+		new(bn256.G1).ScalarMult(crypto.G, sInt),
+		new(bn256.G1).ScalarMult(public, new(big.Int).Neg(cInt)),
+	)
+	serialized := []byte(fmt.Sprintf("%s%s%x", public.String(), point.String(), data))
+	if crypto.ReducedHash(serialized).Cmp(cInt) != 0 {
+		return errors.New("signature mismatch")
+	}
+	return nil
+}
+
+// private functions
+
+// fetchFile downloads up to maxCheckedFile of the file at url
+func fetchFile(url string) ([]byte, error) {
+	if url == "" {
+		return nil, errors.New("no url")
+	}
+	response, err := fileClient.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching %s: %s", url, response.Status)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(response.Body, maxCheckedFile+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxCheckedFile {
+		return nil, fmt.Errorf("fetching %s: larger than %d bytes", url, maxCheckedFile)
+	}
+	return data, nil
+}
@@ -0,0 +1,149 @@
+package dero_test
+
+import (
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/deroproject/derohe/cryptography/bn256"
+	"github.com/deroproject/derohe/cryptography/crypto"
+	"github.com/deroproject/derohe/rpc"
+	"github.com/secretnamebasis/secret-site/app/config"
+	"github.com/secretnamebasis/secret-site/app/integrations/dero"
+	"github.com/secretnamebasis/secret-site/app/safehttp"
+)
+
+// sign makes the C and S of a DERO signed message of data, the way the
+// wallet's sign_file does, under a fresh key
+func sign(data []byte) (signer, c, s string) {
+	secret := crypto.RandomScalar()
+	public := new(bn256.G1).ScalarMult(crypto.G, secret)
+
+	nonce := crypto.RandomScalar()
+	point := new(bn256.G1).ScalarMult(crypto.G, nonce)
+	cInt := crypto.ReducedHash([]byte(fmt.Sprintf("%s%s%x", public.String(), point.String(), data)))
+	sInt := new(big.Int).Mul(cInt, secret)
+	sInt.Add(sInt, nonce)
+	sInt.Mod(sInt, bn256.Order)
+
+	address := rpc.NewAddressFromKeys((*crypto.Point)(public))
+	return address.String(), fmt.Sprintf("%x", cInt), fmt.Sprintf("%x", sInt)
+}
+
+// serveFiles serves each path's content, and 404 for the rest, from an
+// address files are only fetched from while private hosts are allowed
+func serveFiles(t *testing.T, files map[string][]byte) *httptest.Server {
+	config.AllowPrivateHosts = true
+	t.Cleanup(func() { config.AllowPrivateHosts = false })
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		content, ok := files[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(content)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestCheckFileSignature(t *testing.T) {
+	file := []byte("the artwork itself")
+	server := serveFiles(t, map[string][]byte{"/file": file, "/forged": []byte("something else")})
+
+	signer, c, s := sign(file)
+	state := dero.NFAState{Creator: signer, FileURL: server.URL + "/file", FileCheckC: c, FileCheckS: s}
+	method, err := dero.CheckFile(state)
+	if err != nil || method != dero.FileCheckSignature {
+		t.Errorf("Expected the signature to verify, but got %q (%v)", method, err)
+	}
+
+	// the signature is of the file, by the creator
+	state.FileURL = server.URL + "/forged"
+	if _, err := dero.CheckFile(state); !errors.Is(err, dero.ErrFileMismatch) {
+		t.Errorf("Expected ErrFileMismatch for another file, but got %v", err)
+	}
+	state.FileURL = server.URL + "/file"
+	state.Creator = owner
+	if _, err := dero.CheckFile(state); !errors.Is(err, dero.ErrFileMismatch) {
+		t.Errorf("Expected ErrFileMismatch for another signer, but got %v", err)
+	}
+
+	// or by a signer trusted besides the creator
+	if method, err := dero.CheckFile(state, creator, signer); err != nil || method != dero.FileCheckSignature {
+		t.Errorf("Expected the trusted signer's signature to verify, but got %q (%v)", method, err)
+	}
+}
+
+func TestCheckFileChecksum(t *testing.T) {
+	file, icon := []byte("the artwork itself"), []byte("its icon")
+	server := serveFiles(t, map[string][]byte{"/file": file, "/icon": icon})
+
+	state := dero.NFAState{
+		Creator:    owner,
+		FileURL:    server.URL + "/file",
+		IconURL:    server.URL + "/icon",
+		FileCheckC: dero.FileChecksum(file),
+		FileCheckS: dero.FileChecksum(icon),
+	}
+	method, err := dero.CheckFile(state)
+	if err != nil || method != dero.FileCheckChecksum {
+		t.Errorf("Expected the checksums to match, but got %q (%v)", method, err)
+	}
+
+	state.FileCheckS = dero.FileChecksum(file)
+	if _, err := dero.CheckFile(state); !errors.Is(err, dero.ErrFileMismatch) {
+		t.Errorf("Expected ErrFileMismatch for the wrong icon, but got %v", err)
+	}
+
+	// a file that can't be fetched isn't a mismatch
+	state.FileURL = server.URL + "/gone"
+	if _, err := dero.CheckFile(state); err == nil || errors.Is(err, dero.ErrFileMismatch) {
+		t.Errorf("Expected the file unreachable, but got %v", err)
+	}
+}
+
+func TestCheckFileRefusesPrivateAddresses(t *testing.T) {
+	file := []byte("the artwork itself")
+	server := serveFiles(t, map[string][]byte{"/file": file})
+	config.AllowPrivateHosts = false
+
+	signer, c, s := sign(file)
+	state := dero.NFAState{Creator: signer, FileURL: server.URL + "/file", FileCheckC: c, FileCheckS: s}
+	if _, err := dero.CheckFile(state); !errors.Is(err, safehttp.ErrPrivateAddress) {
+		t.Errorf("Expected ErrPrivateAddress for %s, but got %v", state.FileURL, err)
+	}
+}
+
+func TestCheckSignedMessage(t *testing.T) {
+	message := []byte(`{"invoice":1}`)
+	signer, c, s := sign(message)
+	signed := pem.EncodeToMemory(&pem.Block{
+		Type:    "DERO SIGNED MESSAGE",
+		Headers: map[string]string{"Address": signer, "C": c, "S": s},
+		Bytes:   message,
+	})
+
+	who, what, err := dero.CheckSignedMessage(signed)
+	if err != nil || who != signer || string(what) != string(message) {
+		t.Errorf("Expected %s to have signed the message, but got %s, %q (%v)", signer, who, what, err)
+	}
+
+	// the signature covers the message
+	tampered := pem.EncodeToMemory(&pem.Block{
+		Type:    "DERO SIGNED MESSAGE",
+		Headers: map[string]string{"Address": signer, "C": c, "S": s},
+		Bytes:   []byte(`{"invoice":2}`),
+	})
+	if _, _, err := dero.CheckSignedMessage(tampered); err == nil {
+		t.Error("Expected a tampered message refused")
+	}
+	if _, _, err := dero.CheckSignedMessage([]byte("not pem")); err == nil {
+		t.Error("Expected something else than a signed message refused")
+	}
+}
@@ -0,0 +1,107 @@
+package metrics
+
+import (
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.etcd.io/bbolt"
+)
+
+// the database package hands us its db once it's open
+var (
+	boltMu sync.RWMutex
+	boltDB *bbolt.DB
+)
+
+var (
+	boltFreePages = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "bbolt", "free_pages"),
+		"Free pages on the freelist.", nil, nil,
+	)
+	boltPendingPages = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "bbolt", "pending_pages"),
+		"Pages freed but still in use by open transactions.", nil, nil,
+	)
+	boltFreelistBytes = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "bbolt", "freelist_bytes"),
+		"Bytes allocated to the freelist.", nil, nil,
+	)
+	boltFreelistInuseBytes = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "bbolt", "freelist_inuse_bytes"),
+		"Bytes of the freelist in use.", nil, nil,
+	)
+	boltReadTxs = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "bbolt", "read_tx_total"),
+		"Read transactions started.", nil, nil,
+	)
+	boltOpenReadTxs = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "bbolt", "open_read_tx"),
+		"Read transactions currently open.", nil, nil,
+	)
+	boltPageAllocs = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "bbolt", "page_allocs_total"),
+		"Page allocations by transactions.", nil, nil,
+	)
+	boltPageAllocBytes = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "bbolt", "page_alloc_bytes_total"),
+		"Bytes allocated to pages by transactions.", nil, nil,
+	)
+	boltWrites = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "bbolt", "writes_total"),
+		"Writes performed by transactions.", nil, nil,
+	)
+	boltWriteSeconds = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "bbolt", "write_seconds_total"),
+		"Time spent writing to disk.", nil, nil,
+	)
+)
+
+// WatchBolt points the bbolt collector at the open database
+func WatchBolt(db *bbolt.DB) {
+	boltMu.Lock()
+	defer boltMu.Unlock()
+	boltDB = db
+}
+
+// boltCollector reads the bbolt stats on every scrape
+type boltCollector struct{}
+
+func (boltCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, desc := range []*prometheus.Desc{
+		boltFreePages,
+		boltPendingPages,
+		boltFreelistBytes,
+		boltFreelistInuseBytes,
+		boltReadTxs,
+		boltOpenReadTxs,
+		boltPageAllocs,
+		boltPageAllocBytes,
+		boltWrites,
+		boltWriteSeconds,
+	} {
+		ch <- desc
+	}
+}
+
+func (boltCollector) Collect(ch chan<- prometheus.Metric) {
+	boltMu.RLock()
+	db := boltDB
+	boltMu.RUnlock()
+
+	// nothing to report before the database is open
+	if db == nil {
+		return
+	}
+	stats := db.Stats()
+
+	ch <- prometheus.MustNewConstMetric(boltFreePages, prometheus.GaugeValue, float64(stats.FreePageN))
+	ch <- prometheus.MustNewConstMetric(boltPendingPages, prometheus.GaugeValue, float64(stats.PendingPageN))
+	ch <- prometheus.MustNewConstMetric(boltFreelistBytes, prometheus.GaugeValue, float64(stats.FreeAlloc))
+	ch <- prometheus.MustNewConstMetric(boltFreelistInuseBytes, prometheus.GaugeValue, float64(stats.FreelistInuse))
+	ch <- prometheus.MustNewConstMetric(boltReadTxs, prometheus.CounterValue, float64(stats.TxN))
+	ch <- prometheus.MustNewConstMetric(boltOpenReadTxs, prometheus.GaugeValue, float64(stats.OpenTxN))
+	ch <- prometheus.MustNewConstMetric(boltPageAllocs, prometheus.CounterValue, float64(stats.TxStats.GetPageCount()))
+	ch <- prometheus.MustNewConstMetric(boltPageAllocBytes, prometheus.CounterValue, float64(stats.TxStats.GetPageAlloc()))
+	ch <- prometheus.MustNewConstMetric(boltWrites, prometheus.CounterValue, float64(stats.TxStats.GetWrite()))
+	ch <- prometheus.MustNewConstMetric(boltWriteSeconds, prometheus.CounterValue, stats.TxStats.GetWriteTime().Seconds())
+}
@@ -0,0 +1,196 @@
+package metrics
+
+import (
+	"crypto/subtle"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/secretnamebasis/secret-site/app/config"
+)
+
+const namespace = "secret_site"
+
+// we keep our own registry so only what we register gets exposed
+var registry = prometheus.NewRegistry()
+
+var (
+	// HTTPRequests counts the requests served, by route rather than path
+	HTTPRequests = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "http_requests_total",
+			Help:      "HTTP requests served, by method, route and status.",
+		},
+		[]string{"method", "route", "status"},
+	)
+
+	// HTTPDuration measures how long requests take to serve
+	HTTPDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "HTTP request latency, by method and route.",
+			Buckets:   prometheus.DefBuckets,
+		},
+		[]string{"method", "route"},
+	)
+
+	// RPCCalls counts the calls made to the DERO node and wallet
+	RPCCalls = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "dero_rpc_calls_total",
+			Help:      "DERO RPC calls, by method.",
+		},
+		[]string{"method"},
+	)
+
+	// RPCErrors counts the calls to the DERO node and wallet that failed
+	RPCErrors = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "dero_rpc_errors_total",
+			Help:      "DERO RPC calls that returned an error, by method.",
+		},
+		[]string{"method"},
+	)
+
+	// RPCDuration measures how long the DERO node and wallet take to answer
+	RPCDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "dero_rpc_duration_seconds",
+			Help:      "DERO RPC call latency, by method.",
+			Buckets:   prometheus.DefBuckets,
+		},
+		[]string{"method"},
+	)
+
+	// SCCacheLookups counts smart-contract state reads by how the cache answered them
+	SCCacheLookups = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "sc_cache_lookups_total",
+			Help:      "Smart-contract state reads, by result: hit, stale or miss.",
+		},
+		[]string{"result"},
+	)
+
+	// CheckoutsCreated counts the checkouts handed out to buyers
+	CheckoutsCreated = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "checkouts_created_total",
+			Help:      "Checkouts created.",
+		},
+	)
+
+	// PaymentsReceived counts the payments that settled a checkout
+	PaymentsReceived = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "payments_received_total",
+			Help:      "Payments received against checkouts.",
+		},
+	)
+
+	// RefundsSent counts the refunds sent back for checkouts
+	RefundsSent = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "refunds_sent_total",
+			Help:      "Refunds sent for checkouts.",
+		},
+	)
+
+	// WebhookDeliveries counts webhook delivery attempts by how they went
+	WebhookDeliveries = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "webhook_deliveries_total",
+			Help:      "Webhook delivery attempts by result: delivered, retry or failed.",
+		},
+		[]string{"result"},
+	)
+
+	// FileChecks counts NFA files checked against their tokens by how they compared
+	FileChecks = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "nfa_file_checks_total",
+			Help:      "NFA file checks by result: verified, mismatch or unreachable.",
+		},
+		[]string{"result"},
+	)
+)
+
+func init() {
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		HTTPRequests,
+		HTTPDuration,
+		RPCCalls,
+		RPCErrors,
+		RPCDuration,
+		SCCacheLookups,
+		CheckoutsCreated,
+		PaymentsReceived,
+		RefundsSent,
+		WebhookDeliveries,
+		FileChecks,
+		boltCollector{},
+	)
+}
+
+// ObserveRPC records a DERO RPC call that started at start and ended with err
+func ObserveRPC(method string, start time.Time, err error) {
+	RPCCalls.WithLabelValues(method).Inc()
+	RPCDuration.WithLabelValues(method).Observe(time.Since(start).Seconds())
+	if err != nil {
+		RPCErrors.WithLabelValues(method).Inc()
+	}
+}
+
+// Handler serves the metrics, behind Basic auth when a METRICS_USER is set in the .env
+func Handler() http.Handler {
+	handler := promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+
+	user := config.Env(config.EnvPath, "METRICS_USER")
+	pass := config.Env(config.EnvPath, "METRICS_PASS")
+	if user == "" {
+		return handler
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		u, p, ok := r.BasicAuth()
+		if !ok ||
+			subtle.ConstantTimeCompare([]byte(u), []byte(user)) != 1 ||
+			subtle.ConstantTimeCompare([]byte(p), []byte(pass)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Basic realm="metrics"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// Serve exposes /metrics on a listener of its own, away from the site;
+// run it in a goroutine of its own
+func Serve(addr string) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", Handler())
+
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+	if err := server.ListenAndServe(); err != nil {
+		log.Printf("Error serving metrics: %v", err)
+	}
+}
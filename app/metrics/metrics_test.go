@@ -0,0 +1,72 @@
+package metrics_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/secretnamebasis/secret-site/app/config"
+	"github.com/secretnamebasis/secret-site/app/metrics"
+)
+
+// useEnv points the config at an empty .env, leaving the variables to t.Setenv
+func useEnv(t *testing.T) {
+	envPath := filepath.Join(t.TempDir(), ".env")
+	if err := os.WriteFile(envPath, nil, 0o600); err != nil {
+		t.Fatalf("Failed to write the .env: %v", err)
+	}
+	previous := config.EnvPath
+	config.EnvPath = envPath
+	t.Cleanup(func() { config.EnvPath = previous })
+}
+
+// scrape asks the handler for the metrics, with the credentials when given
+func scrape(handler http.Handler, user, pass string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	if user != "" {
+		r.SetBasicAuth(user, pass)
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	return w
+}
+
+func TestHandlerBasicAuth(t *testing.T) {
+	useEnv(t)
+	t.Setenv("METRICS_USER", "scraper")
+	t.Setenv("METRICS_PASS", "scraper-password")
+	handler := metrics.Handler()
+
+	tests := []struct {
+		name       string
+		user, pass string
+		expected   int
+	}{
+		{"no credentials", "", "", http.StatusUnauthorized},
+		{"wrong user", "someone", "scraper-password", http.StatusUnauthorized},
+		{"wrong password", "scraper", "guess", http.StatusUnauthorized},
+		{"right credentials", "scraper", "scraper-password", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := scrape(handler, tt.user, tt.pass)
+			if w.Code != tt.expected {
+				t.Errorf("Expected %d, but got %d", tt.expected, w.Code)
+			}
+			if tt.expected == http.StatusUnauthorized && w.Header().Get("WWW-Authenticate") == "" {
+				t.Errorf("Expected a WWW-Authenticate challenge")
+			}
+		})
+	}
+}
+
+func TestHandlerOpenWithoutUser(t *testing.T) {
+	useEnv(t)
+	t.Setenv("METRICS_USER", "")
+
+	if w := scrape(metrics.Handler(), "", ""); w.Code != http.StatusOK {
+		t.Errorf("Expected the metrics open without a METRICS_USER, but got %d", w.Code)
+	}
+}
@@ -0,0 +1,100 @@
+package middleware
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/textproto"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// redacted replaces whatever shouldn't end up in the logs
+const redacted = "[REDACTED]"
+
+// redactedHeaders carry credentials and keys, canonical form
+var redactedHeaders = map[string]bool{
+	"Authorization":       true,
+	"Proxy-Authorization": true,
+	"Cookie":              true,
+	"Set-Cookie":          true,
+	"X-Item-Key":          true,
+}
+
+// redactedFields are body keys holding secrets, or item contents,
+// which may be decrypted or just too big to log
+var redactedFields = map[string]bool{
+	"password":    true,
+	"key":         true,
+	"secret":      true,
+	"wrapped_key": true,
+	"data":        true,
+	"image":       true,
+	"file":        true,
+}
+
+// RedactHeader returns the value of a header as it may be logged
+func RedactHeader(key, value string) string {
+	if redactedHeaders[textproto.CanonicalMIMEHeaderKey(key)] {
+		return redacted
+	}
+	return value
+}
+
+// RedactBody returns a body as it may be logged: JSON bodies with their
+// secret fields redacted and cut to the limit, anything else summed up,
+// because forms carry passwords and files we can't pick out cheaply
+func RedactBody(body []byte, contentType string, limit int) string {
+	if len(body) == 0 || limit <= 0 {
+		return ""
+	}
+
+	if !strings.HasPrefix(contentType, "application/json") {
+		return fmt.Sprintf("[%d bytes of %s]", len(body), contentType)
+	}
+
+	var value interface{}
+	if err := json.Unmarshal(body, &value); err != nil {
+		return fmt.Sprintf("[%d bytes of invalid json]", len(body))
+	}
+
+	cleanJSON, err := json.Marshal(redactValue(value))
+	if err != nil {
+		return fmt.Sprintf("[%d bytes of json]", len(body))
+	}
+
+	if len(cleanJSON) > limit {
+		return fmt.Sprintf("%s...[%d bytes truncated]", cleanJSON[:limit], len(cleanJSON)-limit)
+	}
+	return string(cleanJSON)
+}
+
+// private functions
+
+// redactValue walks a decoded JSON value and redacts the secret fields at any depth
+func redactValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, field := range v {
+			if redactedFields[strings.ToLower(key)] {
+				v[key] = redacted
+				continue
+			}
+			v[key] = redactValue(field)
+		}
+	case []interface{}:
+		for i, field := range v {
+			v[i] = redactValue(field)
+		}
+	}
+	return value
+}
+
+// requestHeaders collects the request headers, redacted, for the log
+func requestHeaders(c *fiber.Ctx) map[string]string {
+	headers := make(map[string]string)
+	c.Request().Header.VisitAll(func(key, value []byte) {
+		headers[string(key)] = RedactHeader(string(key), string(value))
+	})
+	return headers
+}
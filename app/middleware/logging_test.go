@@ -0,0 +1,53 @@
+package middleware_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/secretnamebasis/secret-site/app/middleware"
+)
+
+func TestRedactHeader(t *testing.T) {
+	tests := []struct {
+		key, value, expected string
+	}{
+		{"Authorization", "Basic c2VjcmV0OnBhc3M=", "[REDACTED]"},
+		{"x-item-key", "deadbeef", "[REDACTED]"},
+		{"Content-Type", "application/json", "application/json"},
+	}
+
+	for _, tt := range tests {
+		if got := middleware.RedactHeader(tt.key, tt.value); got != tt.expected {
+			t.Errorf("RedactHeader(%q) = %q, expected %q", tt.key, got, tt.expected)
+		}
+	}
+}
+
+func TestRedactBody(t *testing.T) {
+	body := []byte(`{"title":"secret","user":{"name":"secret","password":"pass"},"item_data":{"image":"aGVsbG8=","description":"hi"}}`)
+
+	got := middleware.RedactBody(body, "application/json", 1024)
+
+	for _, leak := range []string{"pass\"", "aGVsbG8="} {
+		if strings.Contains(got, leak) {
+			t.Errorf("Expected %s to be redacted from: %s", leak, got)
+		}
+	}
+	if !strings.Contains(got, `"description":"hi"`) {
+		t.Errorf("Expected the description to be kept in: %s", got)
+	}
+}
+
+func TestRedactBodyLimits(t *testing.T) {
+	body := []byte(`{"description":"` + strings.Repeat("a", 100) + `"}`)
+
+	if got := middleware.RedactBody(body, "application/json", 10); !strings.Contains(got, "truncated") {
+		t.Errorf("Expected the body to be truncated, but got: %s", got)
+	}
+	if got := middleware.RedactBody(body, "application/json", 0); got != "" {
+		t.Errorf("Expected no body with a limit of 0, but got: %s", got)
+	}
+	if got := middleware.RedactBody([]byte("name=secret&password=pass"), "multipart/form-data", 1024); strings.Contains(got, "pass") {
+		t.Errorf("Expected form bodies not to be logged, but got: %s", got)
+	}
+}
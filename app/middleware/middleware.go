@@ -3,18 +3,24 @@
 package middleware
 
 import (
+	"bytes"
 	"encoding/base64"
 	"errors"
 	"fmt"
-	"log"
+	"log/slog"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/helmet"
 	"github.com/gofiber/fiber/v2/middleware/limiter"
+	"github.com/gofiber/fiber/v2/middleware/requestid"
 	"github.com/secretnamebasis/secret-site/app/api"
+	"github.com/secretnamebasis/secret-site/app/config"
+	"github.com/secretnamebasis/secret-site/app/cryptography"
 	"github.com/secretnamebasis/secret-site/app/database"
+	"github.com/secretnamebasis/secret-site/app/metrics"
 )
 
 // Middleware provides a collection of middleware handlers
@@ -25,50 +31,113 @@ func New() *Middleware {
 	return &Middleware{}
 }
 
-// instead of toggling these on and off, let's set up a "log-level"
+// RequestID tags every request with an ID, kept in the X-Request-ID header
+func (m *Middleware) RequestID() fiber.Handler {
+	return requestid.New()
+}
+
+// LogRequests writes an access log line for every request; at debug level
+// the headers and bodies go along, with their secrets redacted
 func (m *Middleware) LogRequests() fiber.Handler {
 	return func(c *fiber.Ctx) error {
-		// Log request details
-		log.Printf("Request: %s %s", c.Method(), c.OriginalURL())
-
-		// Log request headers
-		log.Println("Request Headers:")
-		c.Request().Header.VisitAll(func(key, value []byte) {
-			log.Printf("%s: %s", key, value)
-		})
-
-		// Log request body if present
-		// this adds overhead to the processing of the server by 2x
-		if len(c.Request().Body()) > 0 {
-			log.Println("Request Body: " + string(c.Request().Body()))
+		start := time.Now()
+
+		// the ID comes from the RequestID middleware
+		logger := slog.Default().With(
+			"request_id", c.GetRespHeader(fiber.HeaderXRequestID),
+		)
+
+		// only the name, the password never goes near the log
+		user, _, _ := getCredentials(c)
+
+		if logger.Enabled(c.UserContext(), slog.LevelDebug) {
+			logger.Debug("request",
+				"headers", requestHeaders(c),
+				"body", RedactBody(
+					c.Request().Body(),
+					string(c.Request().Header.ContentType()),
+					config.LogBodyLimit,
+				),
+			)
 		}
 
 		// Proceed to next middleware or route handler
-		if err := c.Next(); err != nil {
-			return err
+		err := c.Next()
+		if err != nil {
+			// let the error handler write the response before we log it
+			if handlerErr := c.App().ErrorHandler(c, err); handlerErr != nil {
+				_ = c.SendStatus(fiber.StatusInternalServerError)
+			}
+		}
+
+		status := c.Response().StatusCode()
+
+		// reading a streamed body, like server-sent events, would wait for
+		// the stream to end, so its size goes unlogged
+		streaming := c.Response().IsBodyStream()
+		size := 0
+		if !streaming {
+			size = len(c.Response().Body())
 		}
 
-		// Log response details
-		// adds little overhead if any.
-		log.Printf("Response: %d", c.Response().StatusCode())
-
-		// // // Log response headers
-		// // adds little overhead, but more noise
-		log.Println("Response Headers:")
-		c.Response().Header.VisitAll(func(key, value []byte) {
-			log.Printf("%s: %s", key, value)
-		})
-
-		// // Log response body if present
-		// this add trmendous insight, but causes the server to work 4x
-		if len(c.Response().Body()) > 0 {
-			log.Printf("Response Body: %s\n", string(c.Response().Body()))
+		level := slog.LevelInfo
+		if status >= fiber.StatusInternalServerError {
+			level = slog.LevelError
+		}
+
+		logger.Log(c.UserContext(), level, "access",
+			"method", c.Method(),
+			"path", c.Path(),
+			"status", status,
+			"bytes", size,
+			"latency", time.Since(start),
+			"ip", c.IP(),
+			"user", user,
+		)
+
+		if !streaming && logger.Enabled(c.UserContext(), slog.LevelDebug) {
+			logger.Debug("response",
+				"body", RedactBody(
+					c.Response().Body(),
+					string(c.Response().Header.ContentType()),
+					config.LogBodyLimit,
+				),
+			)
 		}
 
 		return nil
 	}
 }
 
+// Metrics middleware counts and times every request by its route
+func (m *Middleware) Metrics() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		start := time.Now()
+
+		err := c.Next()
+		if err != nil {
+			// let the error handler set the status before we count it
+			if handlerErr := c.App().ErrorHandler(c, err); handlerErr != nil {
+				_ = c.SendStatus(fiber.StatusInternalServerError)
+			}
+		}
+
+		// the route, eg. /api/items/:id, keeps the label count down
+		route := c.Route().Path
+		metrics.HTTPRequests.WithLabelValues(
+			c.Method(),
+			route,
+			strconv.Itoa(c.Response().StatusCode()),
+		).Inc()
+		metrics.HTTPDuration.WithLabelValues(
+			c.Method(),
+			route,
+		).Observe(time.Since(start).Seconds())
+
+		return nil
+	}
+}
+
 // AuthRequired middleware authenticates incoming requests and checks for required roles
 func (m *Middleware) AuthRequired(roles ...string) fiber.Handler {
 	return func(c *fiber.Ctx) error {
@@ -99,6 +168,34 @@ func (m *Middleware) AuthRequired(roles ...string) fiber.Handler {
 		return c.Next()
 	}
 }
+
+// AdminRequired middleware only lets authenticated admins through
+func (m *Middleware) AdminRequired() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		username, password, err := getCredentials(c)
+		if err != nil {
+			return c.Status(fiber.StatusUnauthorized).SendString("Unauthorized")
+		}
+
+		user, err := database.GetUserByUsername(username)
+		if err != nil || user.Name == "" || user.IsDeleted() {
+			return api.ErrorResponse(c, fiber.StatusUnauthorized, "Unauthorized: we don't know you")
+		}
+
+		// admins have to prove who they are
+		if !bytes.Equal(user.Password, cryptography.HashString(password)) {
+			return api.ErrorResponse(c, fiber.StatusUnauthorized, "Unauthorized: invalid password")
+		}
+
+		if !user.IsAdmin() {
+			return api.ErrorResponse(c, fiber.StatusForbidden, "Forbidden")
+		}
+
+		// Proceed to the next middleware or route handler
+		return c.Next()
+	}
+}
+
 func getCredentials(c *fiber.Ctx) (username, password string, err error) {
 	// Get the Authorization header from the request
 	authHeader := c.Get("Authorization")
@@ -0,0 +1,99 @@
+package models
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// AuditEntry records a single mutation; every entry carries the hash of the
+// one before it, so that changing or removing an entry breaks the chain
+type AuditEntry struct {
+	// ID represents the position of the entry in the chain, starting at 1.
+	ID int `json:"id"`
+	// Actor stores the name of the user who made the change.
+	Actor string `json:"actor"`
+	// Action stores what was done, eg. create, update, delete.
+	Action string `json:"action"`
+	// Resource stores the kind of record that was changed, eg. items.
+	Resource string `json:"resource"`
+	// ResourceID stores the ID of the record that was changed.
+	ResourceID int `json:"resource_id"`
+	// BeforeHash stores the hash of the record before the change.
+	BeforeHash string `json:"before_hash"`
+	// AfterHash stores the hash of the record after the change.
+	AfterHash string `json:"after_hash"`
+	// Timestamp stores when the change was made.
+	Timestamp time.Time `json:"timestamp"`
+	// PrevHash stores the hash of the previous entry in the chain.
+	PrevHash string `json:"prev_hash"`
+	// Hash stores the hash of this entry, PrevHash included.
+	Hash string `json:"hash"`
+}
+
+// AuditChainError tells where, and why, the audit chain is broken
+type AuditChainError struct {
+	ID     int
+	Reason string
+}
+
+func (e *AuditChainError) Error() string {
+	return fmt.Sprintf("audit chain broken at entry %d: %s", e.ID, e.Reason)
+}
+
+// ComputeHash calculates the hash of the entry from all of its fields but Hash
+func (e AuditEntry) ComputeHash() string {
+	hasher := sha256.New()
+	for _, field := range []string{
+		strconv.Itoa(e.ID),
+		e.Actor,
+		e.Action,
+		e.Resource,
+		strconv.Itoa(e.ResourceID),
+		e.BeforeHash,
+		e.AfterHash,
+		e.Timestamp.UTC().Format(time.RFC3339Nano),
+		e.PrevHash,
+	} {
+		// length-prefix each field so they can't bleed into one another
+		fmt.Fprintf(hasher, "%d:%s;", len(field), field)
+	}
+	return hex.EncodeToString(hasher.Sum(nil))
+}
+
+// HashRecord calculates the hash of a record as it would be stored;
+// there is nothing to hash before a create or after a purge, so nil hashes to ""
+func HashRecord(record interface{}) string {
+	if record == nil {
+		return ""
+	}
+	recordJSON, err := json.Marshal(record)
+	if err != nil {
+		return ""
+	}
+	hash := sha256.Sum256(recordJSON)
+	return hex.EncodeToString(hash[:])
+}
+
+// VerifyAuditChain checks every link of the chain, oldest entry first, and
+// returns an *AuditChainError for the first one that is broken
+func VerifyAuditChain(entries []AuditEntry) error {
+	prevHash := ""
+	for i, entry := range entries {
+		// entries are numbered without gaps, so a removed one shows
+		if entry.ID != i+1 {
+			return &AuditChainError{ID: entry.ID, Reason: fmt.Sprintf("expected entry %d", i+1)}
+		}
+		if entry.PrevHash != prevHash {
+			return &AuditChainError{ID: entry.ID, Reason: "does not link to the previous entry"}
+		}
+		if entry.Hash != entry.ComputeHash() {
+			return &AuditChainError{ID: entry.ID, Reason: "hash does not match its contents"}
+		}
+		prevHash = entry.Hash
+	}
+	return nil
+}
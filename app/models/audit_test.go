@@ -0,0 +1,78 @@
+package models_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/secretnamebasis/secret-site/app/models"
+)
+
+// chain builds a valid audit chain of n entries
+func chain(n int) []models.AuditEntry {
+	var entries []models.AuditEntry
+	prevHash := ""
+	for i := 1; i <= n; i++ {
+		entry := models.AuditEntry{
+			ID:         i,
+			Actor:      "secret",
+			Action:     "update",
+			Resource:   "items",
+			ResourceID: 1,
+			Timestamp:  time.Now(),
+			PrevHash:   prevHash,
+		}
+		entry.Hash = entry.ComputeHash()
+		prevHash = entry.Hash
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+func TestVerifyAuditChain(t *testing.T) {
+	if err := models.VerifyAuditChain(chain(5)); err != nil {
+		t.Errorf("Expected a valid chain, but got: %v", err)
+	}
+}
+
+func TestVerifyAuditChainTampered(t *testing.T) {
+	tests := []struct {
+		name     string
+		tamper   func([]models.AuditEntry) []models.AuditEntry
+		brokenAt int
+	}{
+		{
+			"changed entry",
+			func(e []models.AuditEntry) []models.AuditEntry { e[2].Actor = "mallory"; return e },
+			3,
+		},
+		{
+			"removed entry",
+			func(e []models.AuditEntry) []models.AuditEntry { return append(e[:1], e[2:]...) },
+			3,
+		},
+		{
+			"rehashed entry",
+			func(e []models.AuditEntry) []models.AuditEntry {
+				e[1].Action = "delete"
+				e[1].Hash = e[1].ComputeHash()
+				return e
+			},
+			3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := models.VerifyAuditChain(tt.tamper(chain(5)))
+
+			var chainErr *models.AuditChainError
+			if !errors.As(err, &chainErr) {
+				t.Fatalf("Expected an audit chain error, but got: %v", err)
+			}
+			if chainErr.ID != tt.brokenAt {
+				t.Errorf("Expected the chain to break at entry %d, but got: %d", tt.brokenAt, chainErr.ID)
+			}
+		})
+	}
+}
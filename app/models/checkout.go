@@ -1,19 +1,206 @@
 package models
 
-import "time"
+import (
+	"errors"
+	"time"
 
+	"github.com/secretnamebasis/secret-site/app/integrations/dero"
+)
+
+// Checkout statuses
+const (
+	CheckoutPending   = "pending"
+	CheckoutPaid      = "paid"
+	CheckoutExpired   = "expired"
+	CheckoutUnderpaid = "underpaid" // paid short; the rest may still come in before it expires
+	CheckoutOverpaid  = "overpaid"  // paid more than the price, the excess is due back
+	CheckoutLate      = "late"      // paid after it expired, so all of it is due back
+	CheckoutRefunded  = "refunded"  // whatever came in went back
+)
+
+// Refund states
+const (
+	RefundSending = "refunding" // saved before the transfer goes out, until it is known to have
+	RefundSent    = "sent"
+)
+
+// CheckoutPayment is a transfer received against a checkout
+type CheckoutPayment struct {
+	TXID   string    `json:"txid"`
+	Height uint64    `json:"height"`
+	Sender string    `json:"sender,omitempty"` // when the wallet could tell
+	Amount uint64    `json:"amount"`
+	Time   time.Time `json:"time"`
+}
+
+// CheckoutRefund is a transfer sent back for a checkout
+type CheckoutRefund struct {
+	TXID    string    `json:"txid"`
+	Address string    `json:"address"`
+	Amount  uint64    `json:"amount"`
+	By      string    `json:"by"` // the user who issued it
+	At      time.Time `json:"at"`
+	Nonce   string    `json:"nonce,omitempty"` // carried in the transfer's comment, to find it again
+	State   string    `json:"state,omitempty"` // refunding or sent; refunds from before states were kept are sent
+}
+
+// IsSending reports whether the refund was saved but isn't known to have gone out
+func (r CheckoutRefund) IsSending() bool {
+	return r.State == RefundSending
+}
+
+// Checkout is a buyer's order for an item, paid to an integrated address
 type Checkout struct {
-	ID         int
-	Address    string
-	CreatedAt  time.Time
-	Expiration time.Time
+	// ID represents the unique identifier of the checkout.
+	ID int `json:"id"`
+	// ItemID is the item being bought.
+	ItemID int `json:"item_id"`
+	// Buyer stores the name of the user buying, empty for guests.
+	Buyer string `json:"buyer"`
+	// Address stores the integrated address the buyer pays to.
+	Address string `json:"address"`
+	// PaymentID stores the destination port the payment carries.
+	PaymentID uint64 `json:"payment_id"`
+	// Amount stores the price, in atomic units.
+	Amount uint64 `json:"amount"`
+	// Asset stores the SCID of the token the price is in, empty for DERO.
+	Asset string `json:"asset,omitempty"`
+	// Decimals stores how many decimals there are to the asset's atomic units.
+	Decimals int `json:"decimals"`
+	// Status stores whether the checkout is pending, paid or expired.
+	Status string `json:"status"`
+	// TXID stores the transaction that paid the checkout.
+	TXID string `json:"txid,omitempty"`
+	// Height stores the block height the payment was mined at.
+	Height uint64 `json:"height,omitempty"`
+	// Sender stores the address that paid, when the wallet could tell.
+	Sender string `json:"sender,omitempty"`
+	// CreatedAt stores the timestamp when the checkout was created.
+	CreatedAt time.Time `json:"created_at"`
+	// Expiration stores when an unpaid checkout expires.
+	Expiration time.Time `json:"expiration"`
+	// PaidAt stores when the payment arrived.
+	PaidAt time.Time `json:"paid_at"`
+	// RefundAddress stores where the buyer wants refunds sent, instead of
+	// back to the sender.
+	RefundAddress string `json:"refund_address,omitempty"`
+	// Payments stores every transfer received against the checkout.
+	Payments []CheckoutPayment `json:"payments,omitempty"`
+	// Refunds stores every transfer sent back for the checkout.
+	Refunds []CheckoutRefund `json:"refunds,omitempty"`
+	// InvoiceID is the invoice issued once the checkout was paid.
+	InvoiceID int `json:"invoice_id,omitempty"`
 }
 
 func (c *Checkout) Initialize() *Checkout {
 	return &Checkout{
 		ID:         c.ID,
+		ItemID:     c.ItemID,
+		Buyer:      c.Buyer,
 		Address:    c.Address,
+		PaymentID:  c.PaymentID,
+		Amount:     c.Amount,
+		Asset:      c.Asset,
+		Decimals:   c.Decimals,
+		Status:     c.Status,
 		CreatedAt:  c.CreatedAt,
 		Expiration: c.Expiration,
+
+		RefundAddress: c.RefundAddress,
+	}
+}
+
+// FormattedAmount spells out the amount in whole units of its asset
+func (c Checkout) FormattedAmount() string {
+	return dero.FormatAmount(c.Amount, c.Decimals)
+}
+
+// Received adds up the payments received against the checkout
+func (c Checkout) Received() uint64 {
+	var received uint64
+	for _, payment := range c.Payments {
+		received += payment.Amount
+	}
+	return received
+}
+
+// Refunded adds up the refunds sent for the checkout, and the one being sent
+func (c Checkout) Refunded() uint64 {
+	var refunded uint64
+	for _, refund := range c.Refunds {
+		refunded += refund.Amount
+	}
+	return refunded
+}
+
+// RefundDue is how much is yet to go back to the buyer: the excess of a
+// sale, or everything received when there was no sale
+func (c Checkout) RefundDue() uint64 {
+	owed := c.Received()
+	switch c.Status {
+	case CheckoutPaid, CheckoutOverpaid:
+		owed -= c.Amount // settled checkouts received at least the price
+	case CheckoutUnderpaid, CheckoutExpired, CheckoutLate, CheckoutRefunded:
+	default:
+		return 0
+	}
+	if refunded := c.Refunded(); refunded < owed {
+		return owed - refunded
+	}
+	return 0
+}
+
+// SendingRefund returns the index of the refund being sent, -1 if none is
+func (c Checkout) SendingRefund() int {
+	for i, refund := range c.Refunds {
+		if refund.IsSending() {
+			return i
+		}
+	}
+	return -1
+}
+
+// RefundTo is where refunds go: the address the buyer gave, or else the
+// sender of the last payment that carried one
+func (c Checkout) RefundTo() string {
+	if c.RefundAddress != "" {
+		return c.RefundAddress
+	}
+	for i := len(c.Payments) - 1; i >= 0; i-- {
+		if c.Payments[i].Sender != "" {
+			return c.Payments[i].Sender
+		}
+	}
+	return ""
+}
+
+// IsSettled reports whether the checkout received at least its price in time
+func (c Checkout) IsSettled() bool {
+	return c.Status == CheckoutPaid || c.Status == CheckoutOverpaid
+}
+
+// IsOpen reports whether the checkout is still waiting for its price to
+// come in, whether nothing or only some of it has
+func (c Checkout) IsOpen() bool {
+	return c.Status == CheckoutPending || c.Status == CheckoutUnderpaid
+}
+
+// IsExpired reports whether the checkout is still open past its expiration
+func (c Checkout) IsExpired(now time.Time) bool {
+	return c.IsOpen() && now.After(c.Expiration)
+}
+
+// Validate method validates the checkout data.
+func (c *Checkout) Validate() error {
+	if c.ID == 0 ||
+		c.ItemID == 0 ||
+		c.Address == "" ||
+		c.PaymentID == 0 ||
+		c.Amount == 0 {
+		return errors.New("cannot be empty")
+	}
+	if !c.Expiration.After(c.CreatedAt) {
+		return errors.New("checkout expires before it is created")
 	}
+	return nil
 }
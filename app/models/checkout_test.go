@@ -0,0 +1,50 @@
+package models_test
+
+import (
+	"testing"
+
+	"github.com/secretnamebasis/secret-site/app/models"
+)
+
+func TestCheckoutRefundDue(t *testing.T) {
+	paid := func(status string, amounts ...uint64) models.Checkout {
+		checkout := models.Checkout{Amount: 1000, Status: status}
+		for _, amount := range amounts {
+			checkout.Payments = append(checkout.Payments, models.CheckoutPayment{Amount: amount})
+		}
+		return checkout
+	}
+
+	for _, tc := range []struct {
+		checkout models.Checkout
+		due      uint64
+	}{
+		{paid(models.CheckoutPending), 0},
+		{paid(models.CheckoutPaid, 1000), 0},
+		{paid(models.CheckoutUnderpaid, 300, 200), 500},
+		{paid(models.CheckoutOverpaid, 1000, 250), 250},
+		{paid(models.CheckoutLate, 1000), 1000},
+	} {
+		if due := tc.checkout.RefundDue(); due != tc.due {
+			t.Errorf("Expected %d due on a %s checkout, but got %d", tc.due, tc.checkout.Status, due)
+		}
+	}
+
+	// what went back already isn't due again
+	checkout := paid(models.CheckoutRefunded, 400)
+	checkout.Refunds = []models.CheckoutRefund{{Amount: 400}}
+	if due := checkout.RefundDue(); due != 0 {
+		t.Errorf("Expected nothing due once refunded, but got %d", due)
+	}
+}
+
+func TestCheckoutRefundTo(t *testing.T) {
+	checkout := models.Checkout{Payments: []models.CheckoutPayment{{Sender: "first"}, {}}}
+	if to := checkout.RefundTo(); to != "first" {
+		t.Errorf("Expected the last known sender, but got %q", to)
+	}
+	checkout.RefundAddress = "given"
+	if to := checkout.RefundTo(); to != "given" {
+		t.Errorf("Expected the buyer's address first, but got %q", to)
+	}
+}
@@ -0,0 +1,125 @@
+package models
+
+import (
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/secretnamebasis/secret-site/app/integrations/dero"
+)
+
+// Collection groups NFAs under the name minted into their collection header
+type Collection struct {
+	// ID represents the unique identifier of the collection.
+	ID int `json:"id"`
+	// Slug stores the collection's name as it goes in URLs; it stays put when the name changes.
+	Slug string `json:"slug"`
+	// Name stores the collection header its NFAs are minted with.
+	Name string `json:"name"`
+	// Description stores what the collection is about.
+	Description string `json:"description"`
+	// Cover stores the cover image, base64 encoded.
+	Cover string `json:"cover"`
+	// Owner stores the name of the user who curates the collection.
+	Owner string `json:"owner"`
+	// SCIDs stores the collection's NFAs.
+	SCIDs []string `json:"scids"`
+	// CreatedAt stores the timestamp when the collection was created.
+	CreatedAt time.Time `json:"created_at"`
+	// UpdatedAt stores the timestamp when the collection was last updated.
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// CollectionStats is how a collection's NFAs are doing on the market
+type CollectionStats struct {
+	Items      int    `json:"items"`
+	Listed     int    `json:"listed"`      // for sale or auction right now
+	FloorPrice uint64 `json:"floor_price"` // the least asked of what's listed, in atomic units
+	LastSale   uint64 `json:"last_sale"`   // the previousSalePrice of the latest NFA sold, in atomic units
+}
+
+// Has reports whether the NFA is in the collection
+func (c Collection) Has(scid string) bool {
+	for _, s := range c.SCIDs {
+		if s == scid {
+			return true
+		}
+	}
+	return false
+}
+
+// Stats sums up the members' states at now. A listed sale asks its start
+// price, an auction its minimum bid.
+func (c Collection) Stats(members []IndexedNFA, now time.Time) CollectionStats {
+	stats := CollectionStats{Items: len(c.SCIDs)}
+	var lastSold int64 = -1
+	for _, nfa := range members {
+		if nfa.Listed(now) {
+			stats.Listed++
+			asked := nfa.StartPrice
+			if nfa.ListType == dero.ListAuction {
+				asked = nfa.MinimumBid()
+			}
+			if stats.Listed == 1 || asked < stats.FloorPrice {
+				stats.FloorPrice = asked
+			}
+		}
+		if nfa.PreviousSalePrice > 0 && nfa.UpdatedHeight > lastSold {
+			stats.LastSale = nfa.PreviousSalePrice
+			lastSold = nfa.UpdatedHeight
+		}
+	}
+	return stats
+}
+
+// Validate method validates the collection data.
+func (c *Collection) Validate() error {
+	if c.ID == 0 ||
+		c.Slug == "" ||
+		c.Name == "" ||
+		c.Owner == "" ||
+		c.CreatedAt == (time.Time{}) ||
+		c.UpdatedAt == (time.Time{}) {
+		return errors.New("cannot be empty")
+	}
+	return validSCIDs(c.SCIDs)
+}
+
+// Slug turns a collection name into lowercase words joined by dashes; a
+// slug of digits alone is prefixed, so that it can't pass for an ID
+func Slug(name string) string {
+	var slug strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(name) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			if dash && slug.Len() > 0 {
+				slug.WriteByte('-')
+			}
+			slug.WriteRune(r)
+			dash = false
+			continue
+		}
+		dash = true
+	}
+	if _, err := strconv.Atoi(slug.String()); err == nil {
+		return "collection-" + slug.String()
+	}
+	return slug.String()
+}
+
+// validSCIDs checks each SCID is a hash, and only listed once
+func validSCIDs(scids []string) error {
+	seen := make(map[string]bool, len(scids))
+	for _, scid := range scids {
+		if decoded, err := hex.DecodeString(scid); err != nil || len(decoded) != 32 {
+			return errors.New("invalid scid " + scid)
+		}
+		if seen[scid] {
+			return errors.New("scid " + scid + " cannot be listed twice")
+		}
+		seen[scid] = true
+	}
+	return nil
+}
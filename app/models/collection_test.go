@@ -0,0 +1,65 @@
+package models_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/secretnamebasis/secret-site/app/integrations/dero"
+	"github.com/secretnamebasis/secret-site/app/models"
+)
+
+func TestSlug(t *testing.T) {
+	for name, want := range map[string]string{
+		"Seascapes":             "seascapes",
+		"  Sunsets & Sunrises ": "sunsets-sunrises",
+		"Vol. 2 -- Night":       "vol-2-night",
+		"!!!":                   "",
+		"1984":                  "collection-1984",
+		"2024 / 25":             "2024-25",
+	} {
+		if slug := models.Slug(name); slug != want {
+			t.Errorf("Expected %q to slug to %q, but got %q", name, want, slug)
+		}
+	}
+}
+
+func TestCollectionStats(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	listed := func(listType string, price, bid uint64) dero.NFAState {
+		return dero.NFAState{
+			ListType:     listType,
+			Held:         true,
+			StartPrice:   price,
+			CurrBidPrice: bid,
+			StartTime:    now.Add(-time.Hour),
+			EndTime:      now.Add(time.Hour),
+		}
+	}
+
+	sold := dero.NFAState{PreviousSalePrice: 40000}
+	resold := dero.NFAState{PreviousSalePrice: 90000}
+	members := []models.IndexedNFA{
+		{NFAState: listed(dero.ListSale, 80000, 0)},
+		// an auction asks for its next bid, not its start price
+		{NFAState: listed(dero.ListAuction, 20000, 60000)},
+		{NFAState: resold, UpdatedHeight: 12},
+		{NFAState: sold, UpdatedHeight: 7},
+	}
+
+	collection := models.Collection{SCIDs: make([]string, 5)}
+	stats := collection.Stats(members, now)
+	if stats.Items != 5 || stats.Listed != 2 {
+		t.Errorf("Expected 2 of 5 listed, but got: %+v", stats)
+	}
+	if stats.FloorPrice != 60000 {
+		t.Errorf("Expected a floor of 60000, but got %d", stats.FloorPrice)
+	}
+	if stats.LastSale != 90000 {
+		t.Errorf("Expected the latest sale at 90000, but got %d", stats.LastSale)
+	}
+
+	// nothing listed has no floor
+	if stats := collection.Stats(members[2:], now); stats.FloorPrice != 0 || stats.Listed != 0 {
+		t.Errorf("Expected no floor, but got: %+v", stats)
+	}
+}
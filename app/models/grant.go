@@ -0,0 +1,41 @@
+package models
+
+import (
+	"errors"
+	"time"
+)
+
+// Grant gives a user read access to a restricted item
+type Grant struct {
+	// ID represents the unique identifier of the grant.
+	ID int `json:"id"`
+	// ItemID is the item the grant gives access to.
+	ItemID int `json:"item_id"`
+	// Grantee stores the name of the user holding the grant.
+	Grantee string `json:"grantee"`
+	// Wallet stores the DERO wallet address of the grantee.
+	Wallet string `json:"wallet"`
+	// ExpiresAt stores when the grant lapses; the zero time never does.
+	ExpiresAt time.Time `json:"expires_at"`
+	// CreatedAt stores the timestamp when the grant was created.
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// IsActive reports whether the grant still gives access at the given time
+func (g Grant) IsActive(now time.Time) bool {
+	return g.ExpiresAt.IsZero() || now.Before(g.ExpiresAt)
+}
+
+// Validate method validates the grant data.
+func (g *Grant) Validate() error {
+	if g.ID == 0 ||
+		g.ItemID == 0 ||
+		g.Grantee == "" ||
+		g.CreatedAt == (time.Time{}) {
+		return errors.New("cannot be empty")
+	}
+	if !g.ExpiresAt.IsZero() && !g.ExpiresAt.After(g.CreatedAt) {
+		return errors.New("grant expires before it is created")
+	}
+	return nil
+}
@@ -0,0 +1,31 @@
+package models
+
+// Health statuses
+const (
+	HealthUp   = "up"
+	HealthDown = "down"
+)
+
+// Health reports on the app and each of the dependencies it needs to serve
+type Health struct {
+	Status string                 `json:"status"`
+	Checks map[string]HealthCheck `json:"checks,omitempty"`
+}
+
+// HealthCheck reports on a single dependency
+type HealthCheck struct {
+	Status  string                 `json:"status"`
+	Latency string                 `json:"latency"`
+	Error   string                 `json:"error,omitempty"`
+	Details map[string]interface{} `json:"details,omitempty"`
+}
+
+// Ready tells whether every dependency is up
+func (h Health) Ready() bool {
+	for _, check := range h.Checks {
+		if check.Status != HealthUp {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,70 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/secretnamebasis/secret-site/app/integrations/dero"
+)
+
+// InvoiceLine is something bought on an invoice
+type InvoiceLine struct {
+	Description string `json:"description"`
+	ItemID      int    `json:"item_id"`
+	SCID        string `json:"scid,omitempty"`
+	Quantity    uint64 `json:"quantity"`
+	Amount      uint64 `json:"amount"` // in atomic units, for all of them
+}
+
+// Invoice is the receipt of a paid checkout, signed by the server wallet so
+// the buyer can prove the purchase later
+type Invoice struct {
+	// ID represents the unique identifier of the invoice.
+	ID int `json:"id"`
+	// CheckoutID is the checkout the invoice is for.
+	CheckoutID int `json:"checkout_id"`
+	// Lines stores what was bought.
+	Lines []InvoiceLine `json:"lines"`
+	// Amount stores the total, in atomic units.
+	Amount uint64 `json:"amount"`
+	// Asset stores the SCID of the token it was paid in, empty for DERO.
+	Asset string `json:"asset,omitempty"`
+	// Decimals stores how many decimals there are to the asset's atomic units.
+	Decimals int `json:"decimals"`
+	// TXID stores the transaction that paid the checkout.
+	TXID string `json:"txid"`
+	// Height stores the block height the payment was mined at.
+	Height uint64 `json:"height"`
+	// Buyer stores the name of the user who bought, empty for guests.
+	Buyer string `json:"buyer,omitempty"`
+	// BuyerWallet stores the buyer's DERO address, when it is known.
+	BuyerWallet string `json:"buyer_wallet,omitempty"`
+	// Seller stores the name of the user who sold.
+	Seller string `json:"seller"`
+	// SellerWallet stores the seller's DERO address.
+	SellerWallet string `json:"seller_wallet"`
+	// Issuer stores the address of the server wallet that signs the invoice.
+	Issuer string `json:"issuer"`
+	// IssuedAt stores when the invoice was issued.
+	IssuedAt time.Time `json:"issued_at"`
+	// Signature stores the server wallet's DERO signed message of the
+	// invoice's payload; empty until the wallet could sign it.
+	Signature string `json:"signature,omitempty"`
+}
+
+// Payload is what the server wallet signs: the invoice as JSON, without
+// its signature
+func (i Invoice) Payload() ([]byte, error) {
+	i.Signature = ""
+	return json.Marshal(i)
+}
+
+// FormattedAmount spells out the total in whole units of its asset
+func (i Invoice) FormattedAmount() string {
+	return dero.FormatAmount(i.Amount, i.Decimals)
+}
+
+// IsSigned reports whether the server wallet has signed the invoice
+func (i Invoice) IsSigned() bool {
+	return i.Signature != ""
+}
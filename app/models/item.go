@@ -1,6 +1,9 @@
 package models
 
 import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"errors"
 	"time"
 
@@ -9,14 +12,42 @@ import (
 
 // Item represents a sample data structure for demonstration
 type Item struct {
-	ID        int       `json:"id"`
-	Title     string    `json:"title"`
-	SCID      string    `json:"scid"`
-	Data      []byte    `json:"data"` // ItemData
-	ImageURL  string    `json:"image_url"`
-	FileURL   string    `json:"file_url"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID         int       `json:"id"`
+	Title      string    `json:"title"`
+	SCID       string    `json:"scid"`
+	Data       []byte    `json:"data"` // ItemData
+	ImageURL   string    `json:"image_url"`
+	FileURL    string    `json:"file_url"`
+	Owner      string    `json:"owner"`
+	Restricted bool      `json:"restricted"`            // only the owner and grantees may view the item
+	Price      uint64    `json:"price"`                 // in atomic units, 0 is not for sale
+	PriceAsset string    `json:"price_asset,omitempty"` // SCID of the token the price is in, empty for DERO
+	Private    bool      `json:"private,omitempty"`     // the data is encrypted with a user-held key
+	WrappedKey []byte    `json:"-"`                     // private items only: the data key, sealed by the owner, kept apart
+	FileSign   *FileSign `json:"file_sign,omitempty"`   // minted items only: the signature of the file their token holds
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+	DeletedAt  time.Time `json:"deleted_at"` // set while the item is in the trash
+}
+
+// ItemSummary is what live updates tell about an item, leaving its data out
+type ItemSummary struct {
+	ID         int       `json:"id"`
+	Title      string    `json:"title"`
+	SCID       string    `json:"scid"`
+	Owner      string    `json:"owner"`
+	Restricted bool      `json:"restricted"`
+	Price      uint64    `json:"price"`
+	PriceAsset string    `json:"price_asset,omitempty"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// FileSign is the server wallet's signature of an item's file, which the
+// token minted for it holds as fileCheckC and fileCheckS
+type FileSign struct {
+	Signer string `json:"signer"`
+	C      string `json:"c"`
+	S      string `json:"s"`
 }
 
 type ItemData struct {
@@ -25,6 +56,28 @@ type ItemData struct {
 	File        string `json:"file"`
 }
 
+// Checksums returns the hex SHA-256 of the file and of the image, as they
+// are served at /files and /images
+func (d ItemData) Checksums() (file, image string, err error) {
+	if file, err = checksum(d.File); err != nil {
+		return "", "", err
+	}
+	if image, err = checksum(d.Image); err != nil {
+		return "", "", err
+	}
+	return file, image, nil
+}
+
+// checksum returns the hex SHA-256 of base64-encoded content
+func checksum(encoded string) (string, error) {
+	decoded, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(decoded)
+	return hex.EncodeToString(sum[:]), nil
+}
+
 // InitializeItem creates and initializes a new Item instance
 func (i *Item) Initialize() *Item {
 	timestamp := time.Now()
@@ -45,6 +98,30 @@ func (i *Item) Initialize() *Item {
 	return item
 }
 
+// Summary returns the item without its data or keys
+func (i Item) Summary() ItemSummary {
+	return ItemSummary{
+		ID:         i.ID,
+		Title:      i.Title,
+		SCID:       i.SCID,
+		Owner:      i.Owner,
+		Restricted: i.Restricted,
+		Price:      i.Price,
+		PriceAsset: i.PriceAsset,
+		UpdatedAt:  i.UpdatedAt,
+	}
+}
+
+// IsPrivate reports whether the item's data is encrypted with a user-held key
+func (i Item) IsPrivate() bool {
+	return i.Private || len(i.WrappedKey) > 0
+}
+
+// IsDeleted reports whether the item has been moved to the trash
+func (i Item) IsDeleted() bool {
+	return !i.DeletedAt.IsZero()
+}
+
 // Validate method validates the fields of the Item struct
 func (i *Item) Validate() error {
 	if i.Data == nil ||
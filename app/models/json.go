@@ -2,9 +2,15 @@ package models
 
 import (
 	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
 
+	"github.com/deroproject/derohe/rpc"
 	"github.com/secretnamebasis/secret-site/app/config"
 	"github.com/secretnamebasis/secret-site/app/integrations/dero"
+	"github.com/secretnamebasis/secret-site/app/safehttp"
 )
 
 type JSON_Item_Order struct {
@@ -13,6 +19,11 @@ type JSON_Item_Order struct {
 	Description string          `json:"description"`
 	Image       string          `json:"image"`
 	File        string          `json:"file"`
+	Private     bool            `json:"private"`
+	Key         string          `json:"key"`         // optional client-supplied key for private items
+	Restricted  *bool           `json:"restricted"`  // only the owner and grantees may view the item
+	Price       uint64          `json:"price"`       // in atomic units
+	PriceAsset  string          `json:"price_asset"` // SCID of the token the price is in, empty for DERO
 	User        JSON_User_Order `json:"user"`
 }
 
@@ -24,6 +35,140 @@ func (i *JSON_Item_Order) Validate() error {
 	if err := hasValidSCID(i.SCID); err != nil {
 		return err
 	}
+	return HasValidAsset(i.PriceAsset)
+}
+
+type JSON_Checkout_Order struct {
+	RefundAddress string          `json:"refund_address"` // optional, where refunds go instead of back to the sender
+	User          JSON_User_Order `json:"user"`
+}
+
+// Validate method validates the fields of the JSON_Checkout_Order struct
+func (o *JSON_Checkout_Order) Validate() error {
+	if o.RefundAddress == "" {
+		return nil
+	}
+	if _, err := rpc.NewAddress(o.RefundAddress); err != nil {
+		return fmt.Errorf("invalid refund address: %w", err)
+	}
+	return nil
+}
+
+type JSON_Message_Order struct {
+	Message string          `json:"message"`
+	User    JSON_User_Order `json:"user"`
+}
+
+// Validate method validates the fields of the JSON_Message_Order struct
+func (o *JSON_Message_Order) Validate() error {
+	o.Message = strings.TrimSpace(o.Message)
+	if o.Message == "" {
+		return errors.New("message is empty")
+	}
+	return nil
+}
+
+type JSON_Grant_Order struct {
+	Grantee   string          `json:"grantee"` // user name or DERO wallet
+	ExpiresAt time.Time       `json:"expires_at"`
+	User      JSON_User_Order `json:"user"`
+}
+
+type JSON_NFA_Order struct {
+	Title       string          `json:"title"`
+	Description string          `json:"description"`
+	Image       string          `json:"image"` // base64, the token's icon and cover
+	File        string          `json:"file"`  // base64, the image when empty
+	Type        string          `json:"type"`  // eg. image, audio, video
+	Collection  string          `json:"collection"`
+	Tags        string          `json:"tags"`
+	Royalty     uint64          `json:"royalty"`     // percent of every sale paid to the creator
+	Price       uint64          `json:"price"`       // in atomic units
+	PriceAsset  string          `json:"price_asset"` // SCID of the token the price is in, empty for DERO
+	User        JSON_User_Order `json:"user"`
+}
+
+// Validate method validates the fields of the JSON_NFA_Order struct
+func (n *JSON_NFA_Order) Validate() error {
+	if n.Title == "" || n.Description == "" || n.Image == "" || n.User.Name == "" {
+		return errors.New("cannot be empty")
+	}
+	// the contract takes the artificer fee on top
+	if n.Royalty > dero.MaxRoyalty {
+		return fmt.Errorf("royalty cannot exceed %d", dero.MaxRoyalty)
+	}
+	return HasValidAsset(n.PriceAsset)
+}
+
+type JSON_Market_Order struct {
+	ListType       string          `json:"list_type"`       // start: sale or auction
+	Duration       uint64          `json:"duration"`        // start: hours
+	StartPrice     uint64          `json:"start_price"`     // start: in atomic units
+	CharityAddress string          `json:"charity_address"` // start
+	CharityPercent uint64          `json:"charity_percent"` // start
+	Amount         uint64          `json:"amount"`          // buy and bid: in atomic units
+	Prepare        bool            `json:"prepare"`         // return the transfer for the user's own wallet to send
+	User           JSON_User_Order `json:"user"`
+}
+
+type JSON_Collection_Order struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+	Cover       string          `json:"cover"` // base64
+	SCIDs       []string        `json:"scids"` // on update, nil leaves the members be
+	User        JSON_User_Order `json:"user"`
+}
+
+// Validate method validates the fields of the JSON_Collection_Order struct
+func (c *JSON_Collection_Order) Validate() error {
+	if c.Name == "" {
+		return errors.New("name cannot be empty")
+	}
+	if Slug(c.Name) == "" {
+		return errors.New("name needs a letter or digit")
+	}
+	return validSCIDs(c.SCIDs)
+}
+
+type JSON_Collection_Mint_Order struct {
+	NFAs []JSON_NFA_Order `json:"nfas"` // minted in order, into the collection
+	User JSON_User_Order  `json:"user"`
+}
+
+type JSON_Webhook_Order struct {
+	URL    string          `json:"url"`
+	Events []string        `json:"events"` // event types to deliver, empty for all
+	User   JSON_User_Order `json:"user"`
+}
+
+// Validate method validates the fields of the JSON_Webhook_Order struct
+func (w *JSON_Webhook_Order) Validate() error {
+	u, err := url.Parse(w.URL)
+	if err != nil || u.Host == "" {
+		return errors.New("invalid url")
+	}
+	switch u.Scheme {
+	case "https":
+	case "http":
+		// event payloads don't travel in the clear in production
+		if config.Environment == "prod" {
+			return errors.New("url must use https")
+		}
+	default:
+		return errors.New("invalid url")
+	}
+	// the server does the posting, so it mustn't be pointed inwards
+	return safehttp.CheckURL(w.URL)
+}
+
+// Validate method validates the fields of the JSON_Grant_Order struct
+func (g *JSON_Grant_Order) Validate() error {
+	if g.Grantee == "" {
+		return errors.New("grantee cannot be empty")
+	}
+	if !g.ExpiresAt.IsZero() && g.ExpiresAt.Before(time.Now()) {
+		return errors.New("grant cannot expire in the past")
+	}
 	return nil
 }
 
@@ -31,6 +176,8 @@ type JSON_User_Order struct {
 	Name     string `json:"name"`
 	Wallet   string `json:"wallet"`
 	Password string `json:"password"`
+	// the current password, when changing it
+	OldPassword string `json:"old_password,omitempty"`
 }
 
 // Validate method validates the fields of the JSON_User_Order struct
@@ -57,3 +204,14 @@ func hasValidSCID(scid string) error {
 	}
 	return nil
 }
+
+// HasValidAsset checks that a price is in DERO or in a token on chain
+func HasValidAsset(scid string) error {
+	if dero.IsDERO(scid) {
+		return nil
+	}
+	if _, err := dero.AssetHash(scid); err != nil {
+		return err
+	}
+	return hasValidSCID(scid)
+}
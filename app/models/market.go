@@ -0,0 +1,13 @@
+package models
+
+import "github.com/deroproject/derohe/rpc"
+
+// MarketCall is a marketplace action on an item's contract: the transfer that
+// makes it and, once the server wallet has sent it, the TXID
+type MarketCall struct {
+	Action string              `json:"action"`
+	ItemID int                 `json:"item_id"`
+	SCID   string              `json:"scid"`
+	Params rpc.Transfer_Params `json:"params"`
+	TXID   string              `json:"txid,omitempty"`
+}
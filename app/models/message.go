@@ -0,0 +1,48 @@
+package models
+
+import "time"
+
+// Messages come in through the site or straight from a wallet
+const (
+	MessageViaSite  = "site"
+	MessageViaChain = "chain"
+)
+
+// Message is a note in a user's inbox: one a user sent through the site,
+// which went on-chain as a comment transfer to the recipient's wallet, or a
+// comment transfer someone sent to the recipient's inbox address
+type Message struct {
+	// ID represents the unique identifier of the message.
+	ID int `json:"id"`
+	// To stores the name of the user whose inbox it is in.
+	To string `json:"to"`
+	// From stores the name of the user who sent it through the site.
+	From string `json:"from,omitempty"`
+	// Sender stores the address it came from, when the wallet could tell.
+	Sender string `json:"sender,omitempty"`
+	// ItemID stores the item it was sent about, if any.
+	ItemID int `json:"item_id,omitempty"`
+	// Body stores the comment.
+	Body string `json:"body"`
+	// Via stores whether it came through the site or the chain.
+	Via string `json:"via"`
+	// TXID stores the comment transfer.
+	TXID string `json:"txid"`
+	// Height stores the block height the transfer was mined at, when known.
+	Height uint64 `json:"height,omitempty"`
+	// Amount stores what the transfer carried along, in atomic units.
+	Amount uint64 `json:"amount"`
+	// Asset stores the SCID of the token it carried, empty for DERO.
+	Asset string `json:"asset,omitempty"`
+	// Fee stores what the server wallet paid in fees to send it, once known.
+	Fee uint64 `json:"fee,omitempty"`
+	// CreatedAt stores when it was sent.
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Inbox is a user's messages, with the address that leaves one
+type Inbox struct {
+	User     string    `json:"user"`
+	Address  string    `json:"address,omitempty"` // empty while the wallet is away
+	Messages []Message `json:"messages"`
+}
@@ -0,0 +1,32 @@
+package models
+
+import (
+	"time"
+
+	"github.com/secretnamebasis/secret-site/app/integrations/dero"
+)
+
+// IndexedNFA is an ART-NFA-MS1 token the indexer found on chain, with its
+// state as of the last call to it
+type IndexedNFA struct {
+	dero.NFAState
+	DeployHeight  int64 `json:"deploy_height"`  // topoheight it was installed at
+	UpdatedHeight int64 `json:"updated_height"` // topoheight it was last read at
+}
+
+// File check statuses
+const (
+	FileVerified    = "verified"
+	FileMismatch    = "mismatch"
+	FileUnreachable = "unreachable"
+)
+
+// FileCheck is how a token's file compared with its checksums, last it was checked
+type FileCheck struct {
+	SCID      string    `json:"scid"`
+	FileURL   string    `json:"file_url"`
+	Status    string    `json:"status"`
+	Method    string    `json:"method,omitempty"` // signature or checksum, when verified
+	Reason    string    `json:"reason,omitempty"` // what went wrong otherwise
+	CheckedAt time.Time `json:"checked_at"`
+}
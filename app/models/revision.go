@@ -0,0 +1,43 @@
+package models
+
+import (
+	"errors"
+	"time"
+)
+
+// Revision is an earlier version of an item, kept when the item is updated
+type Revision struct {
+	// ID represents the identifier of the revision within its item.
+	ID int `json:"id"`
+	// ItemID is the item this is a revision of.
+	ItemID int `json:"item_id"`
+	// Title stores the item's title at the time.
+	Title string `json:"title"`
+	// Data stores the item's ItemData at the time, encrypted as the item was.
+	Data []byte `json:"data,omitempty"`
+	// UpdatedAt stores when this version of the item was written.
+	UpdatedAt time.Time `json:"updated_at"`
+	// CreatedAt stores when this version was replaced and became a revision.
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// NewRevision captures the stored state of an item as a revision
+func NewRevision(item Item) *Revision {
+	return &Revision{
+		ItemID:    item.ID,
+		Title:     item.Title,
+		Data:      item.Data,
+		UpdatedAt: item.UpdatedAt,
+		CreatedAt: time.Now(),
+	}
+}
+
+// Validate method validates the revision data.
+func (r *Revision) Validate() error {
+	if r.ItemID == 0 ||
+		r.Data == nil ||
+		r.CreatedAt == (time.Time{}) {
+		return errors.New("cannot be empty")
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package models
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/secretnamebasis/secret-site/app/integrations/dero"
+)
+
+// Sale is an NFA sale the indexer saw on chain
+type Sale struct {
+	dero.NFASale
+	TXID   string    `json:"txid"`
+	Height int64     `json:"height"` // topoheight of the block it was in
+	Time   time.Time `json:"time"`   // of the block it was in
+}
+
+// RoyaltySummary adds up sales, of an item or of everything in a report
+type RoyaltySummary struct {
+	SCID         string `json:"scid,omitempty"`
+	Name         string `json:"name,omitempty"`
+	Sales        int    `json:"sales"`
+	Volume       uint64 `json:"volume"`        // in atomic units
+	Royalties    uint64 `json:"royalties"`     // received by the creator
+	ArtificerFee uint64 `json:"artificer_fee"` // paid out of the sales
+	Charity      uint64 `json:"charity"`       // paid out of the sales
+}
+
+// Add counts a sale in the summary
+func (s *RoyaltySummary) Add(sale Sale) {
+	s.Sales++
+	s.Volume += sale.Price
+	s.Royalties += sale.Royalty
+	s.ArtificerFee += sale.ArtificerFee
+	s.Charity += sale.Charity
+}
+
+// RoyaltyReport is what a creator's NFAs sold for, and what they earned,
+// from From up to To; zero times leave the range open
+type RoyaltyReport struct {
+	Wallet string           `json:"wallet"`
+	From   time.Time        `json:"from"`
+	To     time.Time        `json:"to"`
+	Sales  []Sale           `json:"sales"`
+	Items  []RoyaltySummary `json:"items"`
+	Totals RoyaltySummary   `json:"totals"`
+}
+
+// WriteCSV writes the report's sales as CSV, a row each under a header
+func (r RoyaltyReport) WriteCSV(w io.Writer) error {
+	out := csv.NewWriter(w)
+	if err := out.Write([]string{
+		"time", "txid", "scid", "name", "list_type", "seller", "buyer",
+		"price", "royalty", "artificer_fee", "charity", "payout",
+	}); err != nil {
+		return err
+	}
+
+	amount := func(n uint64) string { return strconv.FormatUint(n, 10) }
+	for _, sale := range r.Sales {
+		if err := out.Write([]string{
+			sale.Time.UTC().Format(time.RFC3339),
+			sale.TXID,
+			sale.SCID,
+			sale.Name,
+			sale.ListType,
+			sale.Seller,
+			sale.Buyer,
+			amount(sale.Price),
+			amount(sale.Royalty),
+			amount(sale.ArtificerFee),
+			amount(sale.Charity),
+			amount(sale.Payout),
+		}); err != nil {
+			return err
+		}
+	}
+	out.Flush()
+	return out.Error()
+}
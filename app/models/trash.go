@@ -0,0 +1,7 @@
+package models
+
+// Trash holds the items and users that have been deleted but not yet purged
+type Trash struct {
+	Items []Item `json:"items"`
+	Users []User `json:"users"`
+}
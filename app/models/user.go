@@ -25,6 +25,11 @@ type User struct {
 	CreatedAt time.Time `json:"created_at"`
 	// UpdatedAt stores the timestamp when the user was last updated.
 	UpdatedAt time.Time `json:"updated_at"`
+	// DeletedAt stores the timestamp when the user was moved to the trash.
+	DeletedAt time.Time `json:"deleted_at"`
+	// InboxPort is the destination port of transfers to the user's inbox,
+	// picked when the inbox is first opened.
+	InboxPort uint64 `json:"inbox_port,omitempty"`
 }
 
 // NewUser creates a new User instance with the provided data
@@ -42,6 +47,23 @@ func (u *User) Initialize() *User {
 	}
 }
 
+// IsDeleted reports whether the user has been moved to the trash
+func (u User) IsDeleted() bool {
+	return !u.DeletedAt.IsZero()
+}
+
+// IsAdmin reports whether the user holds the admin role;
+// the user registered with the site's DEV_ADDRESS wallet always does.
+func (u User) IsAdmin() bool {
+	for _, role := range u.Role {
+		if role == "admin" {
+			return true
+		}
+	}
+	devAddress := config.Env(config.EnvPath, "DEV_ADDRESS")
+	return devAddress != "" && u.Wallet == devAddress
+}
+
 // Validate method validates the user data.
 func (u *User) Validate() error {
 
@@ -51,6 +73,10 @@ func (u *User) Validate() error {
 
 	}
 	if err := hasValidWallet(u.Wallet); err != nil {
+		// we can't tell whether it's valid while the node is down
+		if errors.Is(err, dero.ErrUnavailable) {
+			return err
+		}
 		return errors.New("invalid wallet address")
 	}
 
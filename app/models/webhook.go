@@ -0,0 +1,103 @@
+package models
+
+import (
+	"errors"
+	"time"
+)
+
+// Delivery statuses
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed"
+)
+
+// Webhook is an endpoint a user registered to be told about events
+type Webhook struct {
+	// ID represents the unique identifier of the webhook.
+	ID int `json:"id"`
+	// Owner stores the name of the user who registered the webhook.
+	Owner string `json:"owner"`
+	// URL stores where events are posted.
+	URL string `json:"url"`
+	// Events stores the event types delivered; empty delivers them all.
+	Events []string `json:"events"`
+	// Secret stores the key deliveries are signed with; it's only shown
+	// when the webhook is created.
+	Secret string `json:"secret,omitempty"`
+	// CreatedAt stores the timestamp when the webhook was created.
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Wants reports whether the webhook is to be told about the event type
+func (w Webhook) Wants(eventType string) bool {
+	if len(w.Events) == 0 {
+		return true
+	}
+	for _, e := range w.Events {
+		if e == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate method validates the webhook data.
+func (w *Webhook) Validate() error {
+	if w.ID == 0 ||
+		w.Owner == "" ||
+		w.URL == "" ||
+		w.Secret == "" ||
+		w.CreatedAt == (time.Time{}) {
+		return errors.New("cannot be empty")
+	}
+	return nil
+}
+
+// Delivery is an event on its way to a webhook, and the log of how it went
+type Delivery struct {
+	// ID represents the unique identifier of the delivery.
+	ID int `json:"id"`
+	// WebhookID is the webhook the event goes to.
+	WebhookID int `json:"webhook_id"`
+	// EventID stores the ID of the event delivered.
+	EventID uint64 `json:"event_id"`
+	// EventType stores the type of the event delivered.
+	EventType string `json:"event_type"`
+	// Payload stores the body posted, kept for retries and redeliveries.
+	Payload []byte `json:"payload"`
+	// Status stores whether the delivery is pending, delivered or failed.
+	Status string `json:"status"`
+	// Attempts stores how many times delivery was tried.
+	Attempts int `json:"attempts"`
+	// NextAttempt stores when a pending delivery is tried next.
+	NextAttempt time.Time `json:"next_attempt"`
+	// ResponseStatus stores the HTTP status of the last attempt, 0 if there was no answer.
+	ResponseStatus int `json:"response_status,omitempty"`
+	// LastError stores why the last attempt failed.
+	LastError string `json:"last_error,omitempty"`
+	// RedeliveryOf stores the delivery this one repeats, if any.
+	RedeliveryOf int `json:"redelivery_of,omitempty"`
+	// CreatedAt stores the timestamp when the delivery was queued.
+	CreatedAt time.Time `json:"created_at"`
+	// DeliveredAt stores when the endpoint accepted the delivery.
+	DeliveredAt time.Time `json:"delivered_at"`
+}
+
+// IsDue reports whether a pending delivery is to be tried at the given time
+func (d Delivery) IsDue(now time.Time) bool {
+	return d.Status == DeliveryPending && !now.Before(d.NextAttempt)
+}
+
+// Validate method validates the delivery data.
+func (d *Delivery) Validate() error {
+	if d.ID == 0 ||
+		d.WebhookID == 0 ||
+		d.EventType == "" ||
+		d.Payload == nil ||
+		d.Status == "" ||
+		d.CreatedAt == (time.Time{}) {
+		return errors.New("cannot be empty")
+	}
+	return nil
+}
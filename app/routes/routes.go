@@ -11,7 +11,12 @@ import (
 func Draw(app *fiber.App) {
 	// Initialize middleware
 	mw := middleware.New()
+	app.Use(mw.RequestID())
 	app.Use(mw.LogRequests())
+	app.Use(mw.Metrics())
+
+	// Define health routes, ahead of the rate limiters
+	defineHealthRoutes(app)
 
 	// Define views routes
 	defineViewsRoutes(app, mw)
@@ -20,6 +25,12 @@ func Draw(app *fiber.App) {
 	defineAPIRoutes(app, mw)
 }
 
+// defineHealthRoutes defines routes for load balancers and watchdogs
+func defineHealthRoutes(app *fiber.App) {
+	app.Get("/healthz", api.Healthz)
+	app.Get("/readyz", api.Readyz)
+}
+
 // defineViewsRoutes defines routes for views
 func defineViewsRoutes(app *fiber.App, mw *middleware.Middleware) {
 
@@ -32,6 +43,10 @@ func defineViewsRoutes(app *fiber.App, mw *middleware.Middleware) {
 	// Serve static files from the "assets" directory
 	viewsGroup.Static("/", "./app/assets")
 	viewsGroup.Static("/items", "./app/assets")
+	viewsGroup.Static("/checkouts", "./app/assets")
+	viewsGroup.Static("/invoices", "./app/assets")
+	viewsGroup.Static("/nfas", "./app/assets")
+	viewsGroup.Static("/collections", "./app/assets")
 
 	// Define view routes
 	viewRoutes := []struct {
@@ -66,6 +81,30 @@ func defineViewsRoutes(app *fiber.App, mw *middleware.Middleware) {
 			Path:   "/files/:scid",
 			Handle: views.Files,
 		},
+		{
+			Path:   "/files/:scid/checksum",
+			Handle: views.FileChecksum,
+		},
+		{
+			Path:   "/files/:scid/signature",
+			Handle: views.FileSignature,
+		},
+		{
+			Path:   "/nfas/new",
+			Handle: views.NewNFA,
+		},
+		{
+			Path:   "/collections/:slug",
+			Handle: views.Collection,
+		},
+		{
+			Path:   "/checkouts/:id",
+			Handle: views.Checkout,
+		},
+		{
+			Path:   "/invoices/:id",
+			Handle: views.Invoice,
+		},
 		{
 			Path:   "/users/",
 			Handle: views.Users,
@@ -78,6 +117,14 @@ func defineViewsRoutes(app *fiber.App, mw *middleware.Middleware) {
 			Path:   "/users/:wallet",
 			Handle: views.User,
 		},
+		{
+			Path:   "/users/:wallet/royalties",
+			Handle: views.Royalties,
+		},
+		{
+			Path:   "/users/:wallet/inbox",
+			Handle: views.Inbox,
+		},
 	}
 
 	// Register view routes
@@ -90,6 +137,7 @@ func defineViewsRoutes(app *fiber.App, mw *middleware.Middleware) {
 	// Actions
 	viewsGroup.Post("/users/submit", views.SubmitUser)
 	viewsGroup.Post("/items/submit", views.SubmitItem)
+	viewsGroup.Post("/nfas/submit", views.SubmitNFA)
 
 }
 
@@ -108,6 +156,15 @@ func defineAPIRoutes(app *fiber.App, mw *middleware.Middleware) {
 
 	apiGroup.Get("/ping", api.Ping)
 
+	// events check credentials themselves, so that anyone may follow what is public
+	apiGroup.Get("/events", api.Events)
+
+	// the NFA index is only what anyone can read on chain
+	apiGroup.Get("/nfas", api.NFAs)
+
+	// anyone holding an invoice may prove it was ours
+	apiGroup.Post("/invoices/verify", api.VerifyInvoice)
+
 	// here there be monsters
 	roles := []string{"user"}
 	apiGroup.Use(mw.AuthRequired(roles[0]))
@@ -123,6 +180,59 @@ func defineAPIRoutes(app *fiber.App, mw *middleware.Middleware) {
 		api.DeleteItem,
 	)
 
+	// Define API routes for item grants
+	grants := apiGroup.Group("/items/:id/grants")
+	grants.Get("/", api.ItemGrants)
+	grants.Post("/", api.CreateGrant)
+	grants.Delete("/:grant", api.RevokeGrant)
+
+	// Define API routes for item revisions
+	revisions := apiGroup.Group("/items/:id/revisions")
+	revisions.Get("/", api.ItemRevisions)
+	revisions.Get("/:revision", api.ItemRevision)
+	revisions.Post("/:revision/restore", api.RestoreItemRevision)
+
+	// Define API routes for NFAs
+	apiGroup.Post("/nfas", api.MintNFA)
+	apiGroup.Get("/items/:id/nfa", api.ItemNFA)
+	apiGroup.Get("/items/:id/nfa/file", api.VerifyNFAFile)
+	apiGroup.Post("/items/:id/market/:action", api.MarketAction)
+
+	// Define API routes for collections
+	defineResourceRoutes(
+		apiGroup,
+		"collections",
+		api.AllCollections,
+		api.CollectionByID,
+		api.CreateCollection,
+		api.UpdateCollection,
+		api.DeleteCollection,
+	)
+	apiGroup.Get("/collections/:id/stats", api.CollectionStats)
+	apiGroup.Post("/collections/:id/nfas", api.MintCollection)
+
+	// Define API routes for checkouts
+	apiGroup.Post("/items/:id/checkouts", api.CreateCheckout)
+	apiGroup.Get("/checkouts/:id", api.CheckoutByID)
+	apiGroup.Put("/checkouts/:id", api.UpdateCheckout)
+	apiGroup.Post("/checkouts/:id/refund", api.RefundCheckout)
+
+	// Define API routes for invoices
+	apiGroup.Get("/invoices", api.Invoices)
+	apiGroup.Get("/invoices/:id", api.InvoiceByID)
+
+	// Define API routes for messages
+	apiGroup.Post("/items/:id/messages", api.SendMessage)
+	apiGroup.Get("/messages", api.Inbox)
+
+	// Define API routes for webhooks
+	webhooks := apiGroup.Group("/webhooks")
+	webhooks.Get("/", api.Webhooks)
+	webhooks.Post("/", api.CreateWebhook)
+	webhooks.Delete("/:id", api.DeleteWebhook)
+	webhooks.Get("/:id/deliveries", api.WebhookDeliveries)
+	webhooks.Post("/:id/deliveries/:delivery/redeliver", api.RedeliverWebhook)
+
 	// Define API routes for users
 	defineResourceRoutes(
 		apiGroup,
@@ -133,6 +243,16 @@ func defineAPIRoutes(app *fiber.App, mw *middleware.Middleware) {
 		api.UpdateUser,
 		api.DeleteUser,
 	)
+
+	// Define API routes for admins
+	adminGroup := apiGroup.Group("/admin", mw.AdminRequired())
+	adminGroup.Get("/trash", api.Trash)
+	adminGroup.Post("/trash/items/:id/restore", api.RestoreItem)
+	adminGroup.Post("/trash/users/:id/restore", api.RestoreUser)
+	adminGroup.Get("/audit", api.AuditLog)
+	adminGroup.Get("/audit/verify", api.VerifyAudit)
+	adminGroup.Post("/audit/anchor", api.AnchorAudit)
+	adminGroup.Get("/filechecks", api.FileChecks)
 }
 
 // Define resource routes for CRUD operations
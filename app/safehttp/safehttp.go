@@ -0,0 +1,131 @@
+package safehttp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"syscall"
+	"time"
+
+	"github.com/secretnamebasis/secret-site/app/config"
+)
+
+// ErrPrivateAddress is returned for hosts that resolve to an address only
+// reachable from inside, like loopback, private or link-local ones
+var ErrPrivateAddress = errors.New("address is not public")
+
+// nonPublic are the ranges, besides those net.IP tells apart, that aren't
+// routed on the internet
+var nonPublic = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),       // this network
+	netip.MustParsePrefix("100.64.0.0/10"),   // shared address space, eg. carrier-grade NAT
+	netip.MustParsePrefix("192.0.0.0/24"),    // IETF protocol assignments
+	netip.MustParsePrefix("192.0.2.0/24"),    // documentation
+	netip.MustParsePrefix("198.18.0.0/15"),   // benchmarking
+	netip.MustParsePrefix("198.51.100.0/24"), // documentation
+	netip.MustParsePrefix("203.0.113.0/24"),  // documentation
+	netip.MustParsePrefix("240.0.0.0/4"),     // reserved, and the broadcast address
+	netip.MustParsePrefix("64:ff9b::/96"),    // IPv4 translation, which could reach any of the above
+	netip.MustParsePrefix("64:ff9b:1::/48"),  // local IPv4 translation
+	netip.MustParsePrefix("2001:db8::/32"),   // documentation
+	netip.MustParsePrefix("2002::/16"),       // 6to4, which embeds an IPv4 address
+}
+
+// CheckURL resolves the URL's host and refuses it unless every address it
+// resolves to is public.
+func CheckURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || u.Hostname() == "" {
+		return errors.New("invalid url")
+	}
+	return CheckHost(u.Hostname())
+}
+
+// CheckHost resolves the host and refuses it unless every address it
+// resolves to is public.
+func CheckHost(host string) error {
+	if config.AllowPrivateHosts {
+		return nil
+	}
+
+	addrs, err := net.DefaultResolver.LookupIPAddr(context.Background(), host)
+	if err != nil {
+		return fmt.Errorf("resolving %s: %w", host, err)
+	}
+	for _, addr := range addrs {
+		if !public(addr.IP) {
+			return fmt.Errorf("%s resolves to %s: %w", host, addr.IP, ErrPrivateAddress)
+		}
+	}
+	return nil
+}
+
+// NewClient returns an http.Client that gives up after timeout and refuses
+// to connect to anything but public addresses; the address is checked as it
+// is dialed, so redirects and names that resolve differently the second
+// time are caught too.
+func NewClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: timeout,
+		Control: control,
+	}
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			// a proxy would do the dialing where it can't be checked
+			Proxy:               nil,
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: timeout,
+			MaxIdleConns:        16,
+			IdleConnTimeout:     90 * time.Second,
+		},
+	}
+}
+
+// private functions
+
+// control refuses connections to addresses that aren't public
+func control(network, address string, _ syscall.RawConn) error {
+	if config.AllowPrivateHosts {
+		return nil
+	}
+
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !public(ip) {
+		return fmt.Errorf("dialing %s: %w", address, ErrPrivateAddress)
+	}
+	return nil
+}
+
+// public tells whether the address can be reached from the internet
+func public(ip net.IP) bool {
+	if ip.IsLoopback() ||
+		ip.IsPrivate() ||
+		ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() ||
+		ip.IsMulticast() ||
+		ip.IsUnspecified() {
+		return false
+	}
+
+	addr, ok := netip.AddrFromSlice(ip)
+	if !ok {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, prefix := range nonPublic {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,64 @@
+package safehttp_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/secretnamebasis/secret-site/app/config"
+	"github.com/secretnamebasis/secret-site/app/safehttp"
+)
+
+func TestCheckURL(t *testing.T) {
+	tests := []struct {
+		name string
+		url  string
+	}{
+		{"loopback", "http://127.0.0.1:8080/hook"},
+		{"localhost", "https://localhost/hook"},
+		{"private", "https://10.0.0.5/hook"},
+		{"link-local metadata", "http://169.254.169.254/latest/meta-data"},
+		{"unspecified", "http://0.0.0.0/hook"},
+		{"ipv6 loopback", "http://[::1]/hook"},
+		{"ipv6 unique local", "http://[fd00::1]/hook"},
+		{"shared address space", "http://100.64.0.1/hook"},
+		{"protocol assignments", "http://192.0.0.8/hook"},
+		{"benchmarking", "http://198.18.0.1/hook"},
+		{"reserved", "http://240.0.0.1/hook"},
+		{"broadcast", "http://255.255.255.255/hook"},
+		{"ipv4-mapped private", "http://[::ffff:10.0.0.5]/hook"},
+		{"ipv4 translation", "http://[64:ff9b::a00:5]/hook"},
+		{"6to4", "http://[2002:a00:5::1]/hook"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := safehttp.CheckURL(tt.url); !errors.Is(err, safehttp.ErrPrivateAddress) {
+				t.Errorf("Expected ErrPrivateAddress for %s, but got %v", tt.url, err)
+			}
+		})
+	}
+
+	if err := safehttp.CheckURL("https://93.184.215.14/hook"); err != nil {
+		t.Errorf("Expected a public address to pass, but got %v", err)
+	}
+}
+
+func TestClientRefusesPrivateAddresses(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	// the check happens when dialing, whatever was checked before
+	if _, err := safehttp.NewClient(time.Second).Get(server.URL); !errors.Is(err, safehttp.ErrPrivateAddress) {
+		t.Errorf("Expected ErrPrivateAddress dialing %s, but got %v", server.URL, err)
+	}
+
+	config.AllowPrivateHosts = true
+	t.Cleanup(func() { config.AllowPrivateHosts = false })
+	response, err := safehttp.NewClient(time.Second).Get(server.URL)
+	if err != nil {
+		t.Fatalf("Expected private hosts allowed, but got %v", err)
+	}
+	response.Body.Close()
+}
@@ -11,6 +11,7 @@ import (
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/secretnamebasis/secret-site/app/config"
+	"github.com/secretnamebasis/secret-site/app/events"
 	"github.com/secretnamebasis/secret-site/app/routes"
 )
 
@@ -55,6 +56,8 @@ func (a *App) StartApp(c config.Server) error {
 
 // StopApp stops the Fiber application gracefully
 func (a *App) StopApp() error {
+	// event streams stay open until their subscriptions end
+	events.Close()
 	return a.Shutdown()
 }
 func (a *App) WaitForShutdown() error {
@@ -5,25 +5,17 @@ import (
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/secretnamebasis/secret-site/app/config"
-
-	"github.com/secretnamebasis/secret-site/app/integrations/dero"
 )
 
 // Home renders the home page
 func About(c *fiber.Ctx) error {
-	// Fetch Dero wallet address
-	addr, err := dero.GetWalletAddress(config.WalletEndpoint)
-	if err != nil {
-		return fiber.NewError(http.StatusInternalServerError, "Failed to fetch Dero wallet address")
-	}
-
 	// Define data for rendering the template
 	data := struct {
 		Title   string
 		Address string
 	}{
 		Title:   config.Domain,
-		Address: addr.String(),
+		Address: walletAddress(),
 	}
 
 	// Render the template
@@ -0,0 +1,56 @@
+package views
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/secretnamebasis/secret-site/app/api"
+	"github.com/secretnamebasis/secret-site/app/config"
+	"github.com/secretnamebasis/secret-site/app/controllers"
+	"github.com/secretnamebasis/secret-site/app/models"
+)
+
+// CheckoutData defines the data structure for the checkout template
+type CheckoutData struct {
+	Title    string
+	Address  string
+	Checkout models.Checkout
+	Item     string
+}
+
+// Checkout renders a checkout's payment details, which follow its status live
+func Checkout(c *fiber.Ctx) error {
+	checkout, err := controllers.GetCheckout(c.Params("id"), api.Viewer(c))
+	if errors.Is(err, controllers.ErrForbidden) {
+		return requestCredentials(c)
+	}
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": err.Error(), "status": "error"})
+	}
+
+	// the item may have gone to the trash since
+	var title string
+	if item, err := controllers.GetItemByID(strconv.Itoa(checkout.ItemID)); err == nil {
+		title = item.Title
+	}
+
+	// Define data for rendering the template
+	data := CheckoutData{
+		Title:    config.Domain,
+		Address:  walletAddress(),
+		Checkout: checkout,
+		Item:     title,
+	}
+
+	// Render the template using renderTemplate function
+	if err := renderTemplate(c, "app/public/checkout.html", data); err != nil {
+		return fiber.NewError(http.StatusInternalServerError, err.Error())
+	}
+
+	// Set the Content-Type header
+	c.Set(fiber.HeaderContentType, fiber.MIMETextHTML)
+
+	return nil
+}
@@ -0,0 +1,61 @@
+package views
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/secretnamebasis/secret-site/app/api"
+	"github.com/secretnamebasis/secret-site/app/config"
+	"github.com/secretnamebasis/secret-site/app/controllers"
+	"github.com/secretnamebasis/secret-site/app/integrations/dero"
+	"github.com/secretnamebasis/secret-site/app/models"
+)
+
+// CollectionData defines the data structure for the collection template
+type CollectionData struct {
+	Title      string
+	Address    string
+	Collection models.Collection
+	Stats      models.CollectionStats
+	NFAs       []dero.NFAListing
+}
+
+// Collection renders a collection's page, with its NFAs and how they're doing
+func Collection(c *fiber.Ctx) error {
+	collection, err := controllers.GetCollection(c.Params("slug"))
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).SendString("Collection not found")
+	}
+
+	members, err := controllers.CollectionNFAs(collection)
+	if errors.Is(err, dero.ErrUnavailable) {
+		return api.UnavailableResponse(c)
+	}
+	if err != nil {
+		return fiber.NewError(http.StatusInternalServerError, err.Error())
+	}
+
+	now := time.Now()
+	listings := make([]dero.NFAListing, 0, len(members))
+	for _, nfa := range members {
+		listings = append(listings, nfa.At(now))
+	}
+
+	data := CollectionData{
+		Title:      config.Domain,
+		Address:    walletAddress(),
+		Collection: collection,
+		Stats:      collection.Stats(members, now),
+		NFAs:       listings,
+	}
+
+	if err := renderTemplate(c, "app/public/collection.html", data); err != nil {
+		return fiber.NewError(http.StatusInternalServerError, err.Error())
+	}
+
+	c.Set(fiber.HeaderContentType, fiber.MIMETextHTML)
+
+	return nil
+}
@@ -3,10 +3,14 @@ package views
 import (
 	"encoding/base64"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/secretnamebasis/secret-site/app/api"
 	"github.com/secretnamebasis/secret-site/app/controllers"
+	"github.com/secretnamebasis/secret-site/app/integrations/dero"
 	"github.com/secretnamebasis/secret-site/app/models"
 )
 
@@ -14,12 +18,20 @@ func Files(c *fiber.Ctx) error {
 	// Extract the image ID from the request URL
 	scid := c.Params("scid")
 
-	// Retrieve the item by ID from the database
-	item, err := controllers.GetItemBySCID(scid)
+	// Retrieve the item by SCID, or by ID for links minted into NFAs
+	item, err := controllers.GetItemByRef(scid, api.Viewer(c))
+	if errors.Is(err, controllers.ErrForbidden) {
+		return requestCredentials(c)
+	}
 	if err != nil {
 		return c.Status(fiber.StatusNotFound).SendString("File not found")
 	}
 
+	// private items can only be read through the API by their owner
+	if item.IsPrivate() {
+		return c.Status(fiber.StatusForbidden).SendString("File is private")
+	}
+
 	var itemData models.ItemData
 	if err := json.Unmarshal(item.Data, &itemData); err != nil {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": err.Error(), "status": "error"})
@@ -42,3 +54,66 @@ func Files(c *fiber.Ctx) error {
 	// Send the file data in the response
 	return c.Send(decoded)
 }
+
+// FileChecksum serves the SHA-256 of the file and the image, in sha256sum's
+// format; NFAs minted here used to carry the same in fileCheckC and fileCheckS
+func FileChecksum(c *fiber.Ctx) error {
+	scid := c.Params("scid")
+
+	item, err := controllers.GetItemByRef(scid, api.Viewer(c))
+	if errors.Is(err, controllers.ErrForbidden) {
+		return requestCredentials(c)
+	}
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).SendString("File not found")
+	}
+
+	if item.IsPrivate() {
+		return c.Status(fiber.StatusForbidden).SendString("File is private")
+	}
+
+	var itemData models.ItemData
+	if err := json.Unmarshal(item.Data, &itemData); err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": err.Error(), "status": "error"})
+	}
+
+	file, image, err := itemData.Checksums()
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": err.Error(), "status": "error"})
+	}
+
+	c.Set(fiber.HeaderContentType, fiber.MIMETextPlainCharsetUTF8)
+	return c.SendString(fmt.Sprintf("%s  file\n%s  image\n", file, image))
+}
+
+// FileSignature serves the file signed by the server wallet, as a DERO
+// signed message; minted NFAs carry its C and S in fileCheckC and fileCheckS
+func FileSignature(c *fiber.Ctx) error {
+	scid := c.Params("scid")
+
+	item, err := controllers.GetItemByRef(scid, api.Viewer(c))
+	if errors.Is(err, controllers.ErrForbidden) {
+		return requestCredentials(c)
+	}
+	if err != nil || item.FileSign == nil {
+		return c.Status(fiber.StatusNotFound).SendString("Signature not found")
+	}
+
+	if item.IsPrivate() {
+		return c.Status(fiber.StatusForbidden).SendString("File is private")
+	}
+
+	var itemData models.ItemData
+	if err := json.Unmarshal(item.Data, &itemData); err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": err.Error(), "status": "error"})
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(itemData.File)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": err.Error(), "status": "error"})
+	}
+
+	sign := item.FileSign
+	c.Set(fiber.HeaderContentType, fiber.MIMETextPlainCharsetUTF8)
+	return c.Send(dero.SignedMessage(sign.Signer, sign.C, sign.S, decoded))
+}
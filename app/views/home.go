@@ -5,7 +5,6 @@ import (
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/secretnamebasis/secret-site/app/config"
-	"github.com/secretnamebasis/secret-site/app/integrations/dero"
 )
 
 // HomeData defines the data structure for the home page template
@@ -16,15 +15,10 @@ type HomeData struct {
 
 // Home renders the home page
 func Home(c *fiber.Ctx) error {
-	addr, err := dero.GetWalletAddress(config.WalletEndpoint)
-	if err != nil {
-		return fiber.NewError(http.StatusInternalServerError, "Failed to fetch Dero wallet address")
-	}
-
 	// Define data for rendering the template
 	data := HomeData{
 		Title:   config.Domain,
-		Address: addr.String(),
+		Address: walletAddress(),
 	}
 
 	// Render the template
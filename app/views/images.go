@@ -3,9 +3,11 @@ package views
 import (
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"net/http"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/secretnamebasis/secret-site/app/api"
 	"github.com/secretnamebasis/secret-site/app/controllers"
 	"github.com/secretnamebasis/secret-site/app/models"
 )
@@ -14,12 +16,20 @@ func Images(c *fiber.Ctx) error {
 	// Extract the image ID from the request URL
 	scid := c.Params("scid")
 
-	// Retrieve the item by ID from the database
-	item, err := controllers.GetItemBySCID(scid)
+	// Retrieve the item by SCID, or by ID for links minted into NFAs
+	item, err := controllers.GetItemByRef(scid, api.Viewer(c))
+	if errors.Is(err, controllers.ErrForbidden) {
+		return requestCredentials(c)
+	}
 	if err != nil {
 		return c.Status(fiber.StatusNotFound).SendString("Image not found")
 	}
 
+	// private items can only be read through the API by their owner
+	if item.IsPrivate() {
+		return c.Status(fiber.StatusForbidden).SendString("Image is private")
+	}
+
 	var itemData models.ItemData
 	if err := json.Unmarshal(item.Data, &itemData); err != nil {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": err.Error(), "status": "error"})
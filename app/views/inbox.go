@@ -0,0 +1,49 @@
+package views
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/secretnamebasis/secret-site/app/api"
+	"github.com/secretnamebasis/secret-site/app/config"
+	"github.com/secretnamebasis/secret-site/app/controllers"
+	"github.com/secretnamebasis/secret-site/app/models"
+)
+
+// InboxData defines the data structure for the inbox template
+type InboxData struct {
+	Title  string
+	Wallet string
+	Inbox  models.Inbox
+}
+
+// Inbox renders a user's messages, for them or an admin
+func Inbox(c *fiber.Ctx) error {
+	wallet := c.Params("wallet")
+
+	inbox, err := controllers.WalletInbox(wallet, api.Viewer(c))
+	if errors.Is(err, controllers.ErrForbidden) {
+		return requestCredentials(c)
+	}
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": err.Error(), "status": "error"})
+	}
+
+	// Define data for rendering the template
+	data := InboxData{
+		Title:  config.Domain,
+		Wallet: wallet,
+		Inbox:  inbox,
+	}
+
+	// Render the template using renderTemplate function
+	if err := renderTemplate(c, "app/public/inbox.html", data); err != nil {
+		return fiber.NewError(http.StatusInternalServerError, err.Error())
+	}
+
+	// Set the Content-Type header
+	c.Set(fiber.HeaderContentType, fiber.MIMETextHTML)
+
+	return nil
+}
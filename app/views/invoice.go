@@ -0,0 +1,53 @@
+package views
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/secretnamebasis/secret-site/app/api"
+	"github.com/secretnamebasis/secret-site/app/config"
+	"github.com/secretnamebasis/secret-site/app/controllers"
+	"github.com/secretnamebasis/secret-site/app/models"
+)
+
+// InvoiceData defines the data structure for the invoice template
+type InvoiceData struct {
+	Title   string
+	Invoice models.Invoice
+	JSON    string
+}
+
+// Invoice renders a printable invoice, with the signed JSON to keep as proof
+func Invoice(c *fiber.Ctx) error {
+	invoice, err := controllers.GetInvoice(c.Params("id"), api.Viewer(c))
+	if errors.Is(err, controllers.ErrForbidden) {
+		return requestCredentials(c)
+	}
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": err.Error(), "status": "error"})
+	}
+
+	signed, err := json.MarshalIndent(invoice, "", "  ")
+	if err != nil {
+		return fiber.NewError(http.StatusInternalServerError, err.Error())
+	}
+
+	// Define data for rendering the template
+	data := InvoiceData{
+		Title:   config.Domain,
+		Invoice: invoice,
+		JSON:    string(signed),
+	}
+
+	// Render the template using renderTemplate function
+	if err := renderTemplate(c, "app/public/invoice.html", data); err != nil {
+		return fiber.NewError(http.StatusInternalServerError, err.Error())
+	}
+
+	// Set the Content-Type header
+	c.Set(fiber.HeaderContentType, fiber.MIMETextHTML)
+
+	return nil
+}
@@ -2,24 +2,36 @@ package views
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
-	"strconv"
-	"strings"
+	"sort"
+	"time"
 
 	"github.com/deroproject/derohe/rpc"
 	"github.com/gofiber/fiber/v2"
+	"github.com/secretnamebasis/secret-site/app/api"
 	"github.com/secretnamebasis/secret-site/app/config"
 	"github.com/secretnamebasis/secret-site/app/controllers"
 	"github.com/secretnamebasis/secret-site/app/integrations/dero"
 	"github.com/secretnamebasis/secret-site/app/models"
 )
 
+// Reserve is a balance a contract holds, in whole units of its asset
+type Reserve struct {
+	SCID   string
+	Amount string
+}
+
 // ItemData defines the data structure for the item detail template
 type ItemData struct {
 	Title       string
 	Address     string
 	Item        models.Item
 	SC_Data     rpc.GetSC_Result
+	Reserves    []Reserve         // the contract's balances, formatted
+	NFA         *dero.NFAListing  // nil when the contract isn't an NFA
+	Remaining   string            // what's left of the listing
+	FileCheck   *models.FileCheck // nil until the NFA's file has been checked
 	ImageUrl    string
 	Image       string
 	Description string
@@ -27,11 +39,6 @@ type ItemData struct {
 
 // Item renders the item detail page
 func Item(c *fiber.Ctx) error {
-	addr, err := dero.GetWalletAddress(config.WalletEndpoint)
-	if err != nil {
-		return fiber.NewError(http.StatusInternalServerError, "Failed to fetch Dero wallet address")
-	}
-
 	// Get the item ID from the request parameters
 	scid := c.Params("scid")
 
@@ -39,6 +46,10 @@ func Item(c *fiber.Ctx) error {
 		config.NodeEndpoint,
 		scid,
 	)
+	// the page is built around the contract, so there's nothing to show without the node
+	if errors.Is(err, dero.ErrUnavailable) {
+		return api.UnavailableResponse(c)
+	}
 	if err != nil {
 		return c.Status(
 			fiber.StatusNotFound,
@@ -59,36 +70,30 @@ func Item(c *fiber.Ctx) error {
 			},
 		)
 	}
-	// Truncate key "C" value to display first 16 bytes followed by an ellipsis and then the next 16 bytes
-	cValue := sc_data.VariableStringKeys["C"].(string)
-	if len(cValue) > 32 {
-		truncatedValue := cValue[:16] + "..." + cValue[len(cValue)-16:]
-		sc_data.VariableStringKeys["C"] = truncatedValue
+	// contracts other than ART-NFA-MS1 tokens only show their reserves and code
+	var listing *dero.NFAListing
+	state, err := dero.ParseNFAState(scid, sc_data)
+	switch {
+	case err == nil:
+		at := state.At(time.Now())
+		listing = &at
+	case !errors.Is(err, dero.ErrNotNFA):
+		return err
 	}
 
-	// Decode hex values in VariableStringKeys for all keys except "c"
-	for k, v := range sc_data.VariableStringKeys {
-		if k != "C" { // Exclude key "c"
-			hexValue, ok := v.(string)
-			if ok && isHex(hexValue) {
-				decodedValue := decodeHex(hexValue)
-				// Convert certain keys to string after decoding
-				if k == "artificerAddr" || k == "creatorAddr" || k == "owner" {
-					result, err := rpc.NewAddressFromCompressedKeys([]byte(decodedValue))
-					if err != nil {
-						return err
-					}
-					// Handle non-printable characters or characters that can't be directly represented as strings
-					sc_data.VariableStringKeys[k] = result.String()
-				} else {
-					sc_data.VariableStringKeys[k] = decodedValue
-				}
-			}
+	// the file is checked in the background, the page shows how it went last
+	var fileCheck *models.FileCheck
+	if listing != nil {
+		if fileCheck, err = controllers.FileCheck(scid); err != nil {
+			return err
 		}
 	}
 
 	// Retrieve the item by ID
-	item, err := controllers.GetItemBySCID(scid)
+	item, err := controllers.GetItemBySCID(scid, api.Viewer(c))
+	if errors.Is(err, controllers.ErrForbidden) {
+		return requestCredentials(c)
+	}
 	if err != nil {
 		return c.Status(
 			fiber.StatusNotFound,
@@ -100,23 +105,30 @@ func Item(c *fiber.Ctx) error {
 		)
 	}
 
+	// private items only show their public metadata
 	var itemData models.ItemData
-	if err := json.Unmarshal(item.Data, &itemData); err != nil {
-		return c.Status(
-			fiber.StatusNotFound,
-		).JSON(
-			fiber.Map{
-				"message": err.Error(),
-				"status":  "error",
-			},
-		)
+	if !item.IsPrivate() {
+		if err := json.Unmarshal(item.Data, &itemData); err != nil {
+			return c.Status(
+				fiber.StatusNotFound,
+			).JSON(
+				fiber.Map{
+					"message": err.Error(),
+					"status":  "error",
+				},
+			)
+		}
 	}
 	// Define data for rendering the template
 	data := ItemData{
 		Title:       config.Domain,
-		Address:     addr.String(),
+		Address:     walletAddress(),
 		Item:        item,
 		SC_Data:     *sc_data,
+		Reserves:    reserves(sc_data.Balances),
+		NFA:         listing,
+		Remaining:   remaining(listing),
+		FileCheck:   fileCheck,
 		ImageUrl:    item.ImageURL,
 		Image:       itemData.Image,
 		Description: itemData.Description,
@@ -133,22 +145,25 @@ func Item(c *fiber.Ctx) error {
 	return nil
 }
 
-// isHex checks if a string is in hexadecimal format
-func isHex(s string) bool {
-	for _, c := range s {
-		if !((c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')) {
-			return false
+// reserves formats a contract's balances, leaving those of assets whose
+// decimals can't be read in atomic units
+func reserves(balances map[string]uint64) []Reserve {
+	list := make([]Reserve, 0, len(balances))
+	for scid, amount := range balances {
+		decimals, err := dero.AssetDecimals(config.NodeEndpoint, scid)
+		if err != nil {
+			decimals = 0
 		}
+		list = append(list, Reserve{SCID: scid, Amount: dero.FormatAmount(amount, decimals)})
 	}
-	return true
+	sort.Slice(list, func(i, j int) bool { return list[i].SCID < list[j].SCID })
+	return list
 }
 
-// decodeHex decodes a hexadecimal string to its ASCII representation
-func decodeHex(hexString string) string {
-	var str strings.Builder
-	for i := 0; i < len(hexString); i += 2 {
-		b, _ := strconv.ParseUint(hexString[i:i+2], 16, 8)
-		str.WriteByte(byte(b))
+// remaining spells out the time left on a listing
+func remaining(listing *dero.NFAListing) string {
+	if listing == nil {
+		return ""
 	}
-	return str.String()
+	return (time.Duration(listing.TimeRemaining) * time.Second).String()
 }
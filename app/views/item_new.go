@@ -12,12 +12,6 @@ import (
 
 // NewItem renders the new item page
 func NewItem(c *fiber.Ctx) error {
-	// Fetch Dero wallet address
-	addr, err := dero.GetWalletAddress(config.WalletEndpoint)
-	if err != nil {
-		return fiber.NewError(http.StatusInternalServerError, "Failed to fetch Dero wallet address")
-	}
-
 	// Define data for rendering the template
 	data := struct {
 		Title   string
@@ -25,7 +19,7 @@ func NewItem(c *fiber.Ctx) error {
 		Failed  bool // Add the Failed field
 	}{
 		Title:   config.Domain,
-		Address: addr.String(),
+		Address: walletAddress(),
 		Failed:  false, // Initially set to false
 	}
 
@@ -91,6 +85,17 @@ func SubmitItem(c *fiber.Ctx) error {
 				"Invalid wallet address. Please provide a valid DERO wallet address.",
 			)
 
+		case bytes.Contains(
+			responseBody,
+			[]byte(
+				dero.ErrUnavailable.Error(),
+			),
+		):
+			return handleNewItemFailure(
+				c,
+				"The DERO network can't be reached right now. Please try again shortly.",
+			)
+
 		case bytes.Contains(
 			responseBody,
 			[]byte(
@@ -121,12 +126,6 @@ func SubmitItem(c *fiber.Ctx) error {
 
 // handleNewItemFailure handles the rendering of the registration failure page with a custom message
 func handleNewItemFailure(c *fiber.Ctx, message string) error {
-	// Fetch Dero wallet address
-	addr, err := dero.GetWalletAddress(config.WalletEndpoint)
-	if err != nil {
-		return fiber.NewError(http.StatusInternalServerError, "Failed to fetch Dero wallet address")
-	}
-
 	// Define data for rendering the template
 	data := struct {
 		Title         string
@@ -135,7 +134,7 @@ func handleNewItemFailure(c *fiber.Ctx, message string) error {
 		FailedMessage string // Custom failed registration message
 	}{
 		Title:         config.Domain,
-		Address:       addr.String(),
+		Address:       walletAddress(),
 		Failed:        true, // Set to true indicating registration failure
 		FailedMessage: message,
 	}
@@ -7,7 +7,6 @@ import (
 	"github.com/gofiber/fiber/v2"
 	"github.com/secretnamebasis/secret-site/app/config"
 	"github.com/secretnamebasis/secret-site/app/controllers"
-	"github.com/secretnamebasis/secret-site/app/integrations/dero"
 	"github.com/secretnamebasis/secret-site/app/models"
 )
 
@@ -19,13 +18,9 @@ type ItemsData struct {
 }
 
 func Items(c *fiber.Ctx) error {
-	addr, err := dero.GetWalletAddress(config.WalletEndpoint)
-	if err != nil {
-		return fiber.NewError(http.StatusInternalServerError, "Failed to fetch Dero wallet address")
-	}
 	var items []models.Item
 	// Retrieve blog posts
-	items, err = controllers.AllItemTitles()
+	items, err := controllers.AllItemTitles()
 	if err != nil {
 		return fiber.NewError(http.StatusInternalServerError, "Failed to retrieve items")
 	}
@@ -40,7 +35,7 @@ func Items(c *fiber.Ctx) error {
 	// Define data for rendering the template
 	data := ItemsData{
 		Title:   config.Domain,
-		Address: addr.String(),
+		Address: walletAddress(),
 		Items:   items,
 	}
 
@@ -0,0 +1,71 @@
+package views
+
+import (
+	"bytes"
+	"net/http"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/secretnamebasis/secret-site/app/api"
+	"github.com/secretnamebasis/secret-site/app/config"
+	"github.com/secretnamebasis/secret-site/app/integrations/dero"
+)
+
+// NewNFA renders the page that mints an NFA for a new item
+func NewNFA(c *fiber.Ctx) error {
+	return renderNewNFA(c, "")
+}
+
+// SubmitNFA handles the form submission for minting an NFA
+func SubmitNFA(c *fiber.Ctx) error {
+	if err := api.MintNFA(c); err != nil {
+		return fiber.NewError(http.StatusInternalServerError, "Internal Server Error")
+	}
+
+	responseBody := c.Response().Body()
+	if c.Response().StatusCode() == fiber.StatusOK {
+		// the item page needs the contract on-chain, which takes a block
+		return c.Redirect("/items")
+	}
+
+	switch {
+	case bytes.Contains(responseBody, []byte("item with the same title already exists")):
+		return renderNewNFA(c, "An item with the same Title already exists. Please choose a different Title.")
+	case bytes.Contains(responseBody, []byte("royalty")):
+		return renderNewNFA(c, "Royalty has to be a whole percentage, up to 99.")
+	case bytes.Contains(responseBody, []byte("upload an image")):
+		return renderNewNFA(c, "The image has to be an image file.")
+	case bytes.Contains(responseBody, []byte("error invalid password")):
+		return renderNewNFA(c, "Invalid password. Please provide a valid password.")
+	case bytes.Contains(responseBody, []byte("user does not exist")):
+		return renderNewNFA(c, "User is not registered. Please register.")
+	case bytes.Contains(responseBody, []byte(dero.ErrUnavailable.Error())):
+		return renderNewNFA(c, "The DERO network can't be reached right now. Please try again shortly.")
+	default:
+		return renderNewNFA(c, "The NFA could not be minted. Please check the form and try again.")
+	}
+}
+
+// renderNewNFA renders the mint page, with a notice when minting failed
+func renderNewNFA(c *fiber.Ctx, failure string) error {
+	data := struct {
+		Title         string
+		Address       string
+		Failed        bool
+		FailedMessage string
+	}{
+		Title:         config.Domain,
+		Address:       walletAddress(),
+		Failed:        failure != "",
+		FailedMessage: failure,
+	}
+
+	if err := renderTemplate(c, "app/public/nfa_new.html", data); err != nil {
+		return fiber.NewError(http.StatusInternalServerError, err.Error())
+	}
+
+	// a failed mint answered with its error status, the page is a 200
+	c.Status(fiber.StatusOK)
+	c.Set(fiber.HeaderContentType, fiber.MIMETextHTML)
+
+	return nil
+}
@@ -0,0 +1,50 @@
+package views
+
+import (
+	"bytes"
+	"net/http"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/secretnamebasis/secret-site/app/api"
+	"github.com/secretnamebasis/secret-site/app/controllers"
+)
+
+// Royalties reports what a wallet's NFAs sold for and earned, as JSON or,
+// with format=csv, as a CSV download. from and to are dates, both included.
+func Royalties(c *fiber.Ctx) error {
+	wallet := c.Params("wallet")
+
+	var from, to time.Time
+	if value := c.Query("from"); value != "" {
+		date, err := time.Parse(time.DateOnly, value)
+		if err != nil {
+			return api.ErrorResponse(c, fiber.StatusBadRequest, "from must be a date like 2006-01-02")
+		}
+		from = date
+	}
+	if value := c.Query("to"); value != "" {
+		date, err := time.Parse(time.DateOnly, value)
+		if err != nil {
+			return api.ErrorResponse(c, fiber.StatusBadRequest, "to must be a date like 2006-01-02")
+		}
+		to = date.AddDate(0, 0, 1)
+	}
+
+	report, err := controllers.RoyaltyReport(wallet, from, to)
+	if err != nil {
+		return api.ErrorResponse(c, fiber.StatusInternalServerError, err.Error())
+	}
+
+	if c.Query("format") != "csv" {
+		return api.SuccessResponse(c, "Royalty report", report)
+	}
+
+	var csv bytes.Buffer
+	if err := report.WriteCSV(&csv); err != nil {
+		return fiber.NewError(http.StatusInternalServerError, err.Error())
+	}
+	c.Set(fiber.HeaderContentType, "text/csv; charset=utf-8")
+	c.Set(fiber.HeaderContentDisposition, "attachment; filename=royalties.csv")
+	return c.Send(csv.Bytes())
+}
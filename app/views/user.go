@@ -6,7 +6,6 @@ import (
 	"github.com/gofiber/fiber/v2"
 	"github.com/secretnamebasis/secret-site/app/config"
 	"github.com/secretnamebasis/secret-site/app/database"
-	"github.com/secretnamebasis/secret-site/app/integrations/dero"
 	"github.com/secretnamebasis/secret-site/app/models"
 )
 
@@ -19,11 +18,6 @@ type UserData struct {
 
 // Item renders the item detail page
 func User(c *fiber.Ctx) error {
-	addr, err := dero.GetWalletAddress(config.WalletEndpoint)
-	if err != nil {
-		return fiber.NewError(http.StatusInternalServerError, "Failed to fetch Dero wallet address")
-	}
-
 	// Get the item ID from the request parameters
 	wallet := c.Params("wallet")
 
@@ -32,11 +26,14 @@ func User(c *fiber.Ctx) error {
 	if err != nil {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": err.Error(), "status": "error"})
 	}
+	if user.IsDeleted() {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": "user not found", "status": "error"})
+	}
 
 	// Define data for rendering the template
 	data := UserData{
 		Title:   config.Domain,
-		Address: addr.String(),
+		Address: walletAddress(),
 		User:    user,
 	}
 
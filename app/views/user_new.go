@@ -11,12 +11,6 @@ import (
 )
 
 func NewUser(c *fiber.Ctx) error {
-	// Fetch Dero wallet address
-	addr, err := dero.GetWalletAddress(config.WalletEndpoint)
-	if err != nil {
-		return fiber.NewError(http.StatusInternalServerError, "Failed to fetch Dero wallet address")
-	}
-
 	// Define data for rendering the template
 	data := struct {
 		Title   string
@@ -24,7 +18,7 @@ func NewUser(c *fiber.Ctx) error {
 		Failed  bool // Flag indicating whether registration failed
 	}{
 		Title:   config.Domain,
-		Address: addr.String(),
+		Address: walletAddress(),
 		Failed:  false, // Initially set to false
 	}
 
@@ -79,6 +73,14 @@ func SubmitUser(c *fiber.Ctx) error {
 				c,
 				"Invalid wallet address. Please provide a valid DERO wallet address.",
 			)
+		} else if strings.Contains(
+			string(responseBody),
+			dero.ErrUnavailable.Error(),
+		) {
+			return handleRegistrationFailure(
+				c,
+				"The DERO network can't be reached right now. Please try again shortly.",
+			)
 		}
 	}
 
@@ -88,12 +90,6 @@ func SubmitUser(c *fiber.Ctx) error {
 
 // handleRegistrationFailure handles the rendering of the registration failure page with a custom message
 func handleRegistrationFailure(c *fiber.Ctx, message string) error {
-	// Fetch Dero wallet address
-	addr, err := dero.GetWalletAddress(config.WalletEndpoint)
-	if err != nil {
-		return fiber.NewError(http.StatusInternalServerError, "Failed to fetch Dero wallet address")
-	}
-
 	// Define data for rendering the template
 	data := struct {
 		Title         string
@@ -102,7 +98,7 @@ func handleRegistrationFailure(c *fiber.Ctx, message string) error {
 		FailedMessage string // Custom failed registration message
 	}{
 		Title:         config.Domain,
-		Address:       addr.String(),
+		Address:       walletAddress(),
 		Failed:        true, // Set to true indicating registration failure
 		FailedMessage: message,
 	}
@@ -8,7 +8,6 @@ import (
 	"github.com/secretnamebasis/secret-site/app/config"
 	"github.com/secretnamebasis/secret-site/app/controllers"
 
-	"github.com/secretnamebasis/secret-site/app/integrations/dero"
 	"github.com/secretnamebasis/secret-site/app/models"
 )
 
@@ -20,11 +19,6 @@ type UsersData struct {
 }
 
 func Users(c *fiber.Ctx) error {
-	addr, err := dero.GetWalletAddress(config.WalletEndpoint)
-	if err != nil {
-		return fiber.NewError(http.StatusInternalServerError, "Failed to fetch Dero wallet address")
-	}
-
 	// Retrieve blog posts
 	users, err := controllers.AllUsers()
 	if err != nil {
@@ -41,7 +35,7 @@ func Users(c *fiber.Ctx) error {
 	// Define data for rendering the template
 	data := UsersData{
 		Title:   config.Domain,
-		Address: addr.String(),
+		Address: walletAddress(),
 		Users:   users,
 	}
 
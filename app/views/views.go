@@ -6,8 +6,13 @@ import (
 	"os"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/secretnamebasis/secret-site/app/config"
+	"github.com/secretnamebasis/secret-site/app/integrations/dero"
 )
 
+// offlineBanner shows on every page while the DERO wallet or node can't be reached
+const offlineBanner = `<div class="offline">Wallet offline: on-chain data and new submissions are unavailable for now.</div>`
+
 // renderTemplate parses and executes the template with the provided data
 func renderTemplate(c *fiber.Ctx, filename string, data interface{}) error {
 	// Read the contents of header.html
@@ -32,6 +37,11 @@ func renderTemplate(c *fiber.Ctx, filename string, data interface{}) error {
 	// Include CSS file link in the header
 	header.WriteString(`<link rel="stylesheet" href="styles.css">`)
 
+	// let visitors know why chain data might be missing
+	if !dero.Online() {
+		header.WriteString(offlineBanner)
+	}
+
 	// Parse the main template file
 	mainTmpl, err := template.ParseFiles(filename)
 	if err != nil {
@@ -71,3 +81,20 @@ func renderTemplate(c *fiber.Ctx, filename string, data interface{}) error {
 
 	return nil
 }
+
+// requestCredentials asks the browser for Basic credentials, so that owners
+// and grantees can view restricted items
+func requestCredentials(c *fiber.Ctx) error {
+	c.Set(fiber.HeaderWWWAuthenticate, `Basic realm="`+config.Domain+`"`)
+	return c.Status(fiber.StatusUnauthorized).SendString("Unauthorized")
+}
+
+// walletAddress returns the server wallet's address for the footer,
+// or nothing if the wallet hasn't answered since startup
+func walletAddress() string {
+	addr, err := dero.WalletAddress(config.WalletEndpoint)
+	if err != nil {
+		return ""
+	}
+	return addr.String()
+}
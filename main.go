@@ -3,22 +3,35 @@ package main
 import (
 	"fmt"
 	"log"
+	"os"
+	"time"
 
 	"github.com/secretnamebasis/secret-site/app"
+	"github.com/secretnamebasis/secret-site/app/chain"
 	"github.com/secretnamebasis/secret-site/app/config"
+	"github.com/secretnamebasis/secret-site/app/controllers"
 	"github.com/secretnamebasis/secret-site/app/database"
 	"github.com/secretnamebasis/secret-site/app/integrations/dero"
+	"github.com/secretnamebasis/secret-site/app/metrics"
 )
 
 func main() {
 
 	c := config.Initialize()
 
-	addr, err := dero.GetWalletAddress(config.WalletEndpoint)
+	// verifying the audit chain needs nothing but the database
+	if config.VerifyAudit {
+		os.Exit(verifyAudit(c))
+	}
+
+	// without the wallet we serve what we can until it comes back
+	addr, err := dero.WalletAddress(config.WalletEndpoint)
 	if err != nil {
-		log.Fatalf("Wallet is not loaded")
+		log.Printf("Wallet is not loaded, running in degraded mode: %v", err)
+	} else {
+		fmt.Printf("WELCOME: %s\n", addr.String())
 	}
-	fmt.Printf("WELCOME: %s\n", addr.String())
+	go dero.KeepConnected(time.Minute)
 	if c == (config.Server{}) {
 		log.Fatalf("Config is empty")
 	}
@@ -36,6 +49,40 @@ func main() {
 		if err := database.Initialize(c); err != nil {
 			log.Fatal(err)
 		}
+		// Empty the trash of what is past its retention
+		go controllers.RunTrashPurge(time.Hour)
+		// Follow the chain, and let the cache and checkouts follow along
+		follower := &chain.Follower{
+			NodeEndpoint:   config.NodeEndpoint,
+			WalletEndpoint: config.WalletEndpoint,
+			Tracked:        controllers.ItemSCIDs,
+			Assets:         controllers.PaymentAssets,
+			Receive:        controllers.ReceiveTransfer,
+		}
+		go follower.Run(5 * time.Second)
+		// Index the ART-NFA-MS1 tokens on chain, resuming where it left off
+		indexer := &chain.Indexer{
+			NodeEndpoint: config.NodeEndpoint,
+			From:         config.IndexFrom,
+		}
+		go indexer.Run(5 * time.Second)
+		// Check NFA files still match what their tokens hold
+		if c.FileCheckInterval > 0 {
+			go controllers.RunFileChecks(c.FileCheckInterval)
+		}
+		go dero.WatchBlocks(config.NodeEndpoint)
+		go controllers.WatchPayments()
+		// Tell webhooks what happened, retrying from the queue in the database
+		go controllers.WatchWebhooks()
+		go controllers.RunWebhookDeliveries(5 * time.Second)
+		// Expose /metrics on its own listener
+		if c.MetricsAddr != "" {
+			go metrics.Serve(c.MetricsAddr)
+		}
+		// Put the head of the audit chain on-chain, if asked to
+		if c.AuditAnchor > 0 {
+			go controllers.RunAuditAnchor(c.AuditAnchor)
+		}
 		if err := a.StartApp(c); err != nil {
 			log.Fatalf("Error starting server: %s\n", err)
 		}
@@ -44,3 +91,18 @@ func main() {
 	// Wait for termination signal to stop the server gracefully
 	a.WaitForShutdown()
 }
+
+// verifyAudit checks the audit chain and returns the exit code
+func verifyAudit(c config.Server) int {
+	if err := database.Initialize(c); err != nil {
+		log.Println(err)
+		return 1
+	}
+	entries, err := controllers.VerifyAudit()
+	if err != nil {
+		log.Println(err)
+		return 1
+	}
+	fmt.Printf("audit chain intact: %d entries\n", entries)
+	return 0
+}